@@ -0,0 +1,112 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/SIGBlockchain/project_aurum/internal/audit"
+	"github.com/SIGBlockchain/project_aurum/internal/config"
+	"github.com/SIGBlockchain/project_aurum/internal/constants"
+	"github.com/SIGBlockchain/project_aurum/internal/datadir"
+	"github.com/SIGBlockchain/project_aurum/internal/genesis"
+	"github.com/SIGBlockchain/project_aurum/internal/monetary"
+)
+
+// main audits the ledger, metadata and accounts table in a data directory against the monetary policy of the node's
+// configuration and writes the report to stdout as JSON.
+// It exits with status 1 if the audit found problems or could not be carried out
+func main() {
+	dataDir := flag.String("data", constants.DefaultDataDir, "data directory holding the ledger, metadata and accounts table")
+	configFile := flag.String("config", constants.ConfigurationFile, "configuration file of the node, setting the monetary policy")
+	specFile := flag.String("spec", constants.GenesisSpecFile, "genesis spec of the chain, applied to the configuration if it exists")
+	flag.Parse()
+
+	policy, err := loadPolicy(*configFile, *specFile)
+	if err != nil {
+		log.Fatalf("Failed to load monetary policy: %v", err)
+	}
+
+	// the directory is not locked, so a running node can be audited
+	dir := datadir.New(*dataDir)
+	ledgerFile, err := os.Open(dir.Ledger())
+	if err != nil {
+		log.Fatalf("Failed to open ledger file: %v", err)
+	}
+	defer ledgerFile.Close()
+	metadata, err := openReadOnly(dir.Metadata())
+	if err != nil {
+		log.Fatalf("Failed to open metadata table: %v", err)
+	}
+	defer metadata.Close()
+	accounts, err := openReadOnly(dir.Accounts())
+	if err != nil {
+		log.Fatalf("Failed to open accounts table: %v", err)
+	}
+	defer accounts.Close()
+
+	// blocks are replayed into a scratch accounts table so the node's own is left untouched
+	scratchDir, err := ioutil.TempDir("", "aurum_audit")
+	if err != nil {
+		log.Fatalf("Failed to create scratch directory: %v", err)
+	}
+	defer os.RemoveAll(scratchDir)
+	scratch, err := sql.Open("sqlite3", filepath.Join(scratchDir, constants.AccountsTable))
+	if err != nil {
+		log.Fatalf("Failed to open scratch accounts table: %v", err)
+	}
+	defer scratch.Close()
+
+	report, err := audit.Run(ledgerFile, metadata, accounts, scratch, policy)
+	if err != nil {
+		log.Fatalf("Failed to audit %s: %v", *dataDir, err)
+	}
+	marshalledReport, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to marshal report: %v", err)
+	}
+	os.Stdout.Write(append(marshalledReport, '\n'))
+	if !report.OK {
+		// deferred calls do not run on os.Exit
+		scratch.Close()
+		os.RemoveAll(scratchDir)
+		os.Exit(1)
+	}
+}
+
+// loadPolicy returns the monetary policy of the configuration in configFile and the environment, with the
+// settings of the genesis spec in specFile applied as the node applies them
+func loadPolicy(configFile string, specFile string) (monetary.Policy, error) {
+	var apply func(cfg *config.Config) error
+	if _, err := os.Stat(specFile); err == nil {
+		spec, err := genesis.ReadSpec(specFile)
+		if err != nil {
+			return monetary.Policy{}, errors.New("Failed to read genesis spec: " + err.Error())
+		}
+		apply = spec.Apply
+	}
+	cfg, err := config.LoadWith(configFile, nil, apply)
+	if err != nil {
+		return monetary.Policy{}, err
+	}
+	return monetary.NewPolicy(&cfg)
+}
+
+// openReadOnly opens an existing sqlite database without creating or modifying it
+func openReadOnly(filename string) (*sql.DB, error) {
+	if _, err := os.Stat(filename); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite3", "file:"+filename+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	return db, db.Ping()
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/SIGBlockchain/project_aurum/internal/address"
+	"github.com/SIGBlockchain/project_aurum/internal/block"
+	"github.com/SIGBlockchain/project_aurum/internal/config"
+	"github.com/SIGBlockchain/project_aurum/internal/constants"
+	"github.com/SIGBlockchain/project_aurum/internal/contracts"
+	"github.com/SIGBlockchain/project_aurum/internal/genesis"
+	"github.com/SIGBlockchain/project_aurum/internal/prompt"
+	"github.com/SIGBlockchain/project_aurum/internal/wallet"
+)
+
+const usage = `usage: genesis [-n count] [-out dir] [-supply aurum] [-alloc file]
+
+Generates the wallets the genesis block mints the initial aurum supply to. The accounts genesis-0 to genesis-<count-1>
+are created in the wallet <dir>/wallet, the key of each encrypted under its own passphrase, which is prompted for in
+turn, and <dir>/` + constants.GenesisAddresses + ` allocates the supply to their addresses. Each account file in
+<dir>/wallet/accounts can be handed to its owner together with its passphrase, which the owner adds to their wallet
+with wallet migrate <file> <name> and changes with wallet passwd.
+
+The alloc file allocates a given value to an account or address, one "<account or address> <value>" per line.
+Addresses outside the generated wallet are added to the genesis block; accounts without a value share the rest of
+the supply evenly. Copy ` + constants.GenesisAddresses + ` next to the node's config.json before its first start;
+every node started from it builds the genesis block with the printed hash.
+`
+
+const accountPrefix = "genesis-"
+
+// main generates the genesis wallet and address file and prints the allocations and the genesis block hash
+func main() {
+	n := flag.Int("n", 10, "number of genesis accounts to generate")
+	out := flag.String("out", "genesis", "directory to write the genesis wallet and address file to")
+	supply := flag.Uint64("supply", 0, "initial aurum supply (defaults to InitialAurumSupply in config.json in the current directory)")
+	allocFile := flag.String("alloc", "", "file allocating values to accounts or addresses, a line of `<account or address> <value>` each")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage+"\nflags:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *supply == 0 {
+		cfg, err := config.Load(constants.ConfigurationFile, nil)
+		if err != nil {
+			log.Fatalf("No -supply given and failed to load configuration: %v", err)
+		}
+		*supply = cfg.InitialAurumSupply
+	}
+	var allocations []allocation
+	if *allocFile != "" {
+		var err error
+		if allocations, err = readAllocations(*allocFile); err != nil {
+			log.Fatalf("Failed to read allocations: %v", err)
+		}
+	}
+	genesisBlock, err := generate(*out, *n, *supply, allocations, prompt.New(os.Stdin).NewPassphrase)
+	if err != nil {
+		log.Fatalf("Failed to generate genesis: %v", err)
+	}
+	if err := printGenesis(os.Stdout, *out, genesisBlock); err != nil {
+		log.Fatalf("Failed to print genesis block: %v", err)
+	}
+}
+
+// allocation is a line of the alloc file, giving value to an account of the genesis wallet or to an address
+type allocation struct {
+	target string
+	value  uint64
+}
+
+// readAllocations reads the alloc file filename
+func readAllocations(filename string) ([]allocation, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, errors.New("Failed to open allocation file: " + err.Error())
+	}
+	defer file.Close()
+	var allocations []allocation
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, errors.New("Invalid allocation, expected <account or address> <value>: " + scanner.Text())
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil || value == 0 {
+			return nil, errors.New("Invalid allocation value: " + fields[1])
+		}
+		allocations = append(allocations, allocation{fields[0], value})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.New("Failed to read allocation file: " + err.Error())
+	}
+	return allocations, nil
+}
+
+// generate creates the accounts genesis-0 to genesis-<n-1> in the wallet out/wallet, each encrypted under the
+// passphrase newPassphrase returns for its name, and writes the genesis address file allocating supply to them and
+// to the addresses in allocations. It returns the genesis block the address file produces
+func generate(out string, n int, supply uint64, allocations []allocation, newPassphrase func(account string) ([]byte, error)) (block.Block, error) {
+	if n < 1 {
+		return block.Block{}, errors.New("At least one genesis account is needed")
+	}
+	addressFile := filepath.Join(out, constants.GenesisAddresses)
+	if _, err := os.Stat(addressFile); err == nil {
+		return block.Block{}, errors.New("Genesis address file already exists: " + addressFile)
+	}
+
+	// allocations are checked before any key is generated
+	values := make(map[string]uint64)
+	var extra []genesis.Allocation
+	for _, a := range allocations {
+		var key string
+		if index, ok := accountIndex(a.target); ok && index < n {
+			key = accountPrefix + strconv.Itoa(index)
+		} else {
+			walletAddress, err := address.Decode(a.target)
+			if err != nil {
+				return block.Block{}, errors.New("Allocation is neither a generated account nor an address: " + a.target)
+			}
+			key = hex.EncodeToString(walletAddress)
+			extra = append(extra, genesis.Allocation{Address: walletAddress, Value: a.value})
+		}
+		if _, ok := values[key]; ok {
+			return block.Block{}, errors.New("Allocation is repeated: " + a.target)
+		}
+		values[key] = a.value
+	}
+
+	w, err := wallet.Open(filepath.Join(out, "wallet"))
+	if err != nil {
+		return block.Block{}, err
+	}
+	var genesisAllocations []genesis.Allocation
+	for i := 0; i < n; i++ {
+		name := accountPrefix + strconv.Itoa(i)
+		passphrase, err := newPassphrase(name)
+		if err != nil {
+			return block.Block{}, err
+		}
+		if err := w.NewAccount(name, passphrase); err != nil {
+			return block.Block{}, err
+		}
+		walletAddress, err := w.GetWalletAddress(name)
+		if err != nil {
+			return block.Block{}, err
+		}
+		genesisAllocations = append(genesisAllocations, genesis.Allocation{Address: walletAddress, Value: values[name]})
+	}
+	genesisAllocations = append(genesisAllocations, extra...)
+
+	genesisBlock, err := genesis.BringOnTheGenesisAllocations(genesisAllocations, supply)
+	if err != nil {
+		return block.Block{}, err
+	}
+	if err := genesis.WriteGenesisAllocations(addressFile, genesisAllocations); err != nil {
+		return block.Block{}, err
+	}
+	return genesisBlock, nil
+}
+
+// accountIndex returns the index of a generated account name
+func accountIndex(name string) (int, bool) {
+	if !strings.HasPrefix(name, accountPrefix) {
+		return 0, false
+	}
+	index, err := strconv.Atoi(strings.TrimPrefix(name, accountPrefix))
+	return index, err == nil && index >= 0
+}
+
+// printGenesis prints the aurum the genesis block mints to each address and the hash of the block
+func printGenesis(out io.Writer, dir string, genesisBlock block.Block) error {
+	for _, serialized := range genesisBlock.Data {
+		var c contracts.Contract
+		if err := c.Deserialize(serialized); err != nil {
+			return errors.New("Failed to deserialize genesis contract: " + err.Error())
+		}
+		fmt.Fprintf(out, "%s %d\n", address.Encode(c.RecipPubKeyHash), c.Value)
+	}
+	fmt.Fprintf(out, "Wrote %s and the wallet %s\n", filepath.Join(dir, constants.GenesisAddresses), filepath.Join(dir, "wallet"))
+	fmt.Fprintf(out, "Genesis block hash: %s\n", hex.EncodeToString(block.HashBlock(genesisBlock)))
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/SIGBlockchain/project_aurum/internal/address"
+	"github.com/SIGBlockchain/project_aurum/internal/constants"
+	"github.com/SIGBlockchain/project_aurum/internal/contracts"
+	"github.com/SIGBlockchain/project_aurum/internal/genesis"
+	"github.com/SIGBlockchain/project_aurum/internal/hashing"
+	"github.com/SIGBlockchain/project_aurum/internal/keystore"
+	"github.com/SIGBlockchain/project_aurum/internal/prompt"
+	"github.com/SIGBlockchain/project_aurum/internal/wallet"
+)
+
+func TestGenerate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aurum_genesis")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	wallet.KeystoreParams = keystore.LightParams
+	treasury := address.Encode(hashing.New([]byte("treasury")))
+
+	allocFile := filepath.Join(dir, "alloc.txt")
+	ioutil.WriteFile(allocFile, []byte("genesis-1 500\n\n"+treasury+" 100\n"), 0644)
+	allocations, err := readAllocations(allocFile)
+	if err != nil {
+		t.Fatalf("failed to read allocations: %v", err)
+	}
+	passphrases := func(account string) ([]byte, error) { return []byte("secret-" + account), nil }
+	if _, err := generate(filepath.Join(dir, "unknown"), 3, 1000, []allocation{{"genesis-3", 10}}, passphrases); err == nil {
+		t.Errorf("expected an allocation to an account that is not generated to be rejected")
+	}
+	if _, err := generate(filepath.Join(dir, "repeated"), 3, 1000, []allocation{{"genesis-1", 10}, {"genesis-1", 20}}, passphrases); err == nil {
+		t.Errorf("expected a repeated allocation to be rejected")
+	}
+
+	out := filepath.Join(dir, "out")
+	// each account is encrypted under its own passphrase, so its owner cannot unlock the others
+	input := "secret-genesis-0\nsecret-genesis-0\nsecret-genesis-1\nsecret-genesis-1\nsecret-genesis-2\nsecret-genesis-2\n"
+	genesisBlock, err := generate(out, 3, 1000, allocations, prompt.New(strings.NewReader(input)).NewPassphrase)
+	if err != nil {
+		t.Fatalf("failed to generate genesis: %v", err)
+	}
+	if _, err := generate(out, 3, 1000, nil, passphrases); err == nil {
+		t.Errorf("expected an existing genesis to be kept")
+	}
+
+	// genesis-1 and the treasury get their allocations and the others share the rest
+	var values []uint64
+	for _, serialized := range genesisBlock.Data {
+		var c contracts.Contract
+		c.Deserialize(serialized)
+		values = append(values, c.Value)
+	}
+	if len(values) != 4 || values[0] != 200 || values[1] != 500 || values[2] != 200 || values[3] != 100 {
+		t.Errorf("unexpected genesis values: %v", values)
+	}
+
+	// the address file produces the same allocations, to addresses whose keys are in the wallet
+	read, err := genesis.ReadGenesisAllocations(filepath.Join(out, constants.GenesisAddresses))
+	if err != nil {
+		t.Fatalf("failed to read genesis address file: %v", err)
+	}
+	w, _ := wallet.Open(filepath.Join(out, "wallet"))
+	names := []string{"genesis-0", "genesis-1", "genesis-2"}
+	for i, name := range names {
+		key, err := w.GetPrivateKey(name, []byte("secret-"+name))
+		if err != nil {
+			t.Fatalf("failed to unlock %s: %v", name, err)
+		}
+		if _, err := w.GetPrivateKey(name, []byte("secret-"+names[(i+1)%len(names)])); err == nil {
+			t.Errorf("expected %s not to unlock under the passphrase of another account", name)
+		}
+		walletAddress, _ := w.GetWalletAddress(name)
+		if key == nil || !bytes.Equal(read[i].Address, walletAddress) {
+			t.Errorf("genesis address %d does not belong to %s", i, name)
+		}
+	}
+	if address.Encode(read[3].Address) != treasury || read[3].Value != 100 || read[1].Value != 500 || read[0].Value != 0 {
+		t.Errorf("unexpected genesis allocations: %+v", read)
+	}
+
+	var printed bytes.Buffer
+	if err := printGenesis(&printed, out, genesisBlock); err != nil {
+		t.Fatalf("failed to print genesis: %v", err)
+	}
+	if !strings.Contains(printed.String(), treasury+" 100\n") || !strings.Contains(printed.String(), "Genesis block hash: ") {
+		t.Errorf("unexpected output:\n%s", printed.String())
+	}
+}
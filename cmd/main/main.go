@@ -1,10 +1,13 @@
 package main
 
 import (
+	"crypto/ecdsa"
 	"database/sql"
 	"encoding/hex"
+	"errors"
+	"flag"
 	"fmt"
-	"go/build"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
@@ -13,63 +16,175 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/SIGBlockchain/project_aurum/internal/accountstable"
 	"github.com/SIGBlockchain/project_aurum/internal/block"
 	"github.com/SIGBlockchain/project_aurum/internal/blockchain"
+	"github.com/SIGBlockchain/project_aurum/internal/chainsync"
 	"github.com/SIGBlockchain/project_aurum/internal/config"
+	"github.com/SIGBlockchain/project_aurum/internal/consensus"
 	"github.com/SIGBlockchain/project_aurum/internal/contracts"
+	"github.com/SIGBlockchain/project_aurum/internal/datadir"
 	"github.com/SIGBlockchain/project_aurum/internal/hashing"
+	"github.com/SIGBlockchain/project_aurum/internal/logging"
+	"github.com/SIGBlockchain/project_aurum/internal/monetary"
+	"github.com/SIGBlockchain/project_aurum/internal/peers"
 	"github.com/SIGBlockchain/project_aurum/internal/pendingpool"
+	"github.com/SIGBlockchain/project_aurum/internal/privatekey"
 	"github.com/SIGBlockchain/project_aurum/internal/publickey"
 
 	"github.com/SIGBlockchain/project_aurum/internal/endpoints"
+	"github.com/SIGBlockchain/project_aurum/internal/forkchoice"
 	"github.com/SIGBlockchain/project_aurum/internal/handlers"
 
 	"github.com/SIGBlockchain/project_aurum/internal/constants"
 	"github.com/SIGBlockchain/project_aurum/internal/genesis"
 )
 
+const (
+	// Timeout for a single request to a peer
+	peerTimeout = 10 * time.Second
+	// Maximum number of blocks or headers transferred in one sync request
+	syncBatchSize = 100
+)
+
 func main() {
 	// Setup logging
 	log.SetFlags(log.Ldate | log.Lshortfile | log.Lmicroseconds)
 
-	// Load configuration
-	cfg, err := config.LoadConfiguration()
-	if err != nil {
+	// A genesis spec fixes the genesis block, producers and mint authority of the chain; without one the genesis
+	// block is built from the genesis address file
+	var spec *genesis.Spec
+	if _, err := os.Stat(constants.GenesisSpecFile); err == nil {
+		loadedSpec, err := genesis.ReadSpec(constants.GenesisSpecFile)
+		if err != nil {
+			log.Fatalf("Failed to read genesis spec: %v", err)
+		}
+		spec = &loadedSpec
+	}
+
+	// Load configuration, layering config.json, the environment and flags
+	cfg, err := loadConfig(spec)
+	if err == flag.ErrHelp {
+		fmt.Fprintln(os.Stderr, "usage: main [flags], each overriding config.json and its "+config.EnvPrefix+"* environment variable")
+		cfg.PrintFlags(os.Stderr)
+		fmt.Fprintln(os.Stderr, "SIGHUP or a POST to "+endpoints.AdminReload+" reloads -interval and -loglevel; "+endpoints.AdminConfig+" serves the running configuration")
+		return
+	} else if err != nil {
 		log.Fatalf("Failed to load configuration : %v", err)
 	}
+	logLevel, _ := logging.ParseLevel(cfg.LogLevel)
+	logging.SetLevel(logLevel)
+	if spec != nil {
+		logging.Infof("Starting chain %s from genesis spec", spec.ChainID)
+	}
 
-	// If no blockchain.dat, perform airdrop
-	gopath := build.Default.GOPATH
-	dataDir := gopath + constants.ProjectRoot + "data/"
-	if _, err := os.Stat(dataDir + constants.BlockchainFile); os.IsNotExist(err) {
-		log.Println("No blockchain file detected. Executing genesis procedure...")
-		addresses, err := genesis.ReadGenesisHashes()
+	productionInterval, err := time.ParseDuration(cfg.BlockProductionInterval)
+	if err != nil {
+		log.Fatalf("Failed to parse production interval: %v", err)
+	}
+
+	// With authorized producers configured, blocks are produced in rotating slots of one production interval
+	var authority *consensus.Authority
+	var producerKey *ecdsa.PrivateKey
+	var producerAddr []byte
+	if len(cfg.Producers) > 0 {
+		if cfg.Version < constants.SignedBlockVersion {
+			log.Fatalf("Producers require block version %d or later to sign blocks", constants.SignedBlockVersion)
+		}
+		producers, err := consensus.ParseProducers(cfg.Producers)
 		if err != nil {
-			log.Fatalf("Failed to read genesis addresses: %v", err)
+			log.Fatalf("Failed to parse producers: %v", err)
+		}
+		if authority, err = consensus.NewAuthority(producers, productionInterval, cfg.SignedFrom); err != nil {
+			log.Fatalf("Failed to create producer set: %v", err)
+		}
+		if cfg.ProducerKeyFile != "" {
+			encodedProducerKey, err := ioutil.ReadFile(cfg.ProducerKeyFile)
+			if err != nil {
+				log.Fatalf("Failed to read producer key: %v", err)
+			}
+			if producerKey, err = privatekey.Decode(encodedProducerKey); err != nil {
+				log.Fatalf("Failed to decode producer key: %v", err)
+			}
+			encodedProducerPublicKey, err := publickey.Encode(&producerKey.PublicKey)
+			if err != nil {
+				log.Fatalf("Failed to encode producer public key: %v", err)
+			}
+			producerAddr = hashing.New(encodedProducerPublicKey)
+		}
+		logging.Infof("Proof of authority with %d producer(s)", len(producers))
+	}
+
+	// Every block mints its reward to its producer, or to the mint address if blocks are not signed
+	policy, err := monetary.NewPolicy(&cfg)
+	if err != nil {
+		log.Fatalf("Failed to create monetary policy: %v", err)
+	}
+	rewardRecipient := policy.MintAddr
+	if authority != nil {
+		rewardRecipient = producerAddr
+	} else if cfg.BlockReward > 0 && rewardRecipient == nil {
+		log.Fatalf("A block reward requires a mint address to pay it to")
+	}
+
+	// Lock the data directory so no other node opens the same ledger
+	dataDir, err := datadir.Open(cfg.DataDir)
+	if err != nil {
+		log.Fatalf("Failed to open data directory: %v", err)
+	}
+	defer dataDir.Close()
+
+	// If syncing, download the ledger from the first reachable peer
+	if cfg.Sync {
+		logging.Infof("Syncing ledger from peers...")
+		synced := false
+		for _, host := range cfg.Peers {
+			if err := chainsync.Sync(dataDir, chainsync.NewPeer(host, peerTimeout), cfg.Version, authority, policy, syncBatchSize); err != nil {
+				logging.Warnf("Failed to sync from %s: %v", host, err)
+				continue
+			}
+			logging.Infof("Synced ledger from %s", host)
+			synced = true
+			break
+		}
+		if _, err := os.Stat(dataDir.SyncMarker()); !synced && err == nil {
+			log.Fatalf("Failed to sync ledger from any peer")
+		}
+	}
+
+	// If no blockchain.dat, perform airdrop
+	if _, err := os.Stat(dataDir.Ledger()); os.IsNotExist(err) {
+		logging.Infof("No blockchain file detected. Executing genesis procedure...")
+		var genesisBlock block.Block
+		if spec != nil {
+			genesisBlock, err = spec.Block()
+		} else {
+			var allocations []genesis.Allocation
+			if allocations, err = genesis.ReadGenesisAllocations(constants.GenesisAddresses); err != nil {
+				log.Fatalf("Failed to read genesis addresses: %v", err)
+			}
+			genesisBlock, err = genesis.BringOnTheGenesisAllocations(allocations, cfg.InitialAurumSupply)
 		}
-		genesisBlock, err := genesis.BringOnTheGenesis(addresses, cfg.InitialAurumSupply)
 		if err != nil {
 			log.Fatalf("Failed to create genesis block: %v", err)
 		}
-		log.Println("Attempting airdrop...")
-		if err := blockchain.Airdrop(dataDir+constants.BlockchainFile, dataDir+constants.MetadataTable, dataDir+constants.AccountsTable, genesisBlock); err != nil {
+		logging.Infof("Attempting airdrop...")
+		if err := blockchain.Airdrop(dataDir.Ledger(), dataDir.Metadata(), dataDir.Accounts(), genesisBlock); err != nil {
 			log.Fatalf("Failed to perform airdrop: %v", err)
 		}
-		log.Println("Airdrop complete.")
+		logging.Infof("Airdrop complete.")
 	}
 
 	// TODO: If we did have a blockchain.dat but no table(s), we could execute a recovery here
 
 	// Open connection to accounts database
-	accountsDatabaseConnection, err := sql.Open("sqlite3", dataDir+constants.AccountsTable)
+	accountsDatabaseConnection, err := sql.Open("sqlite3", dataDir.Accounts())
 	if err != nil {
 		log.Fatalf("Failed to open connection : %v", err)
 	}
 	defer accountsDatabaseConnection.Close()
 
 	// Open connection to metadata database
-	metadataDatabaseConnection, err := sql.Open("sqlite3", dataDir+constants.MetadataTable)
+	metadataDatabaseConnection, err := sql.Open("sqlite3", dataDir.Metadata())
 	if err != nil {
 		log.Fatalf("Failed to open connection : %v", err)
 	}
@@ -85,17 +200,52 @@ func main() {
 	signalChannel := make(chan os.Signal, 1)
 	signal.Notify(signalChannel, syscall.SIGINT, syscall.SIGTERM)
 
-	// Extract youngest block header from blockchain
-	ledgerFile, err := os.OpenFile(dataDir+constants.BlockchainFile, os.O_RDONLY, 0644)
+	// Hangup signals and admin requests reload the configuration
+	hangupChannel := make(chan os.Signal, 1)
+	signal.Notify(hangupChannel, syscall.SIGHUP)
+	reloadChannel := make(chan chan error)
+
+	// Open ledger file for reading and appending
+	ledgerFile, err := os.OpenFile(dataDir.Ledger(), os.O_APPEND|os.O_RDWR, 0644)
 	if err != nil {
 		log.Fatalf("Failed to open ledger file")
 	}
-	youngestBlockHeader, err := blockchain.GetYoungestBlockHeader(ledgerFile, metadataDatabaseConnection)
+	defer func() {
+		if err := ledgerFile.Close(); err != nil {
+			log.Fatalf("Failed to close ledger file: %v", err)
+		}
+	}()
+	ledgerManager := blockchain.NewLedgerManager(ledgerFile, metadataDatabaseConnection)
+
+	// A ledger made or synced earlier must start with the genesis block of the spec
+	if spec != nil {
+		serializedGenesis, err := ledgerManager.GetBlockByHeight(0)
+		if err != nil {
+			log.Fatalf("Failed to get genesis block: %v", err)
+		}
+		ledgerGenesis, err := block.Deserialize(serializedGenesis)
+		if err != nil {
+			log.Fatalf("Failed to deserialize genesis block: %v", err)
+		}
+		if err := spec.Verify(ledgerGenesis); err != nil {
+			log.Fatalf("Ledger does not match genesis spec: %v", err)
+		}
+		if err := spec.Pin(dataDir.GenesisSpecHash()); err != nil {
+			log.Fatalf("Ledger does not match genesis spec: %v", err)
+		}
+		logging.Infof("Verified genesis block %s", hex.EncodeToString(block.HashBlock(ledgerGenesis)))
+	}
+
+	// The chain holds every block seen on the network and keeps the ledger on the tallest branch
+	chain, err := forkchoice.NewChain(ledgerManager, metadataDatabaseConnection, accountsDatabaseConnection, cfg.Version, authority, policy)
 	if err != nil {
-		log.Fatalf("Failed to get youngestBlockHeader")
+		log.Fatalf("Failed to load block tree: %v", err)
 	}
-	if err := ledgerFile.Close(); err != nil {
-		log.Fatalf("Failed to close ledger file: %v", err)
+
+	// Extract youngest block header from blockchain
+	youngestBlockHeader, err := ledgerManager.GetYoungestBlockHeader()
+	if err != nil {
+		log.Fatalf("Failed to get youngestBlockHeader")
 	}
 	// Metadata about block production
 	var chainHeight = youngestBlockHeader.Height
@@ -113,26 +263,76 @@ func main() {
 	// Lock for pending map
 	pendingLock := new(sync.Mutex)
 
+	// Lock for the configuration, which changes on reload
+	configLock := new(sync.RWMutex)
+
 	pendingMap := pendingpool.NewPendingMap()
+	pendingMap.MintAddr = policy.MintAddr
+
+	// Declare channel for changes to the main chain caused by blocks from peers
+	updateChannel := make(chan forkchoice.Update)
+
+	// Peers that produced and accepted blocks are gossiped to
+	peerList := peers.New(cfg.Peers, peerTimeout)
+	logging.Infof("Gossiping blocks with %d peer(s)", len(peerList.Hosts()))
 
 	// Set handlers for endpoints and run server
 	http.HandleFunc(endpoints.AccountInfo, handlers.HandleAccountInfoRequest(accountsDatabaseConnection, pendingMap, pendingLock))
 
 	http.HandleFunc(endpoints.Contract, handlers.HandleContractRequest(accountsDatabaseConnection, contractChannel, pendingMap, pendingLock))
-	go http.ListenAndServe(hostname, nil)
-	log.Printf("Serving requests on port %s", cfg.Port)
+
+	http.HandleFunc(endpoints.IncomingBlock, handlers.HandleIncomingBlock(chain, updateChannel))
+
+	http.HandleFunc(endpoints.HeightQuery, handlers.HandleHeightQuery(ledgerManager))
+
+	http.HandleFunc(endpoints.HeaderBatchQuery, handlers.HandleGetBatchOfHeaders(ledgerManager, cfg.APIMaxBatch))
+
+	http.HandleFunc(endpoints.BlockBatchQuery, handlers.HandleGetBatchOfBlocks(ledgerManager, cfg.APIMaxBatch))
+
+	http.HandleFunc(endpoints.MintHistory, handlers.HandleMintHistory(accountsDatabaseConnection))
+
+	http.HandleFunc(endpoints.SupplyQuery, handlers.HandleSupplyQuery(ledgerManager, accountsDatabaseConnection, policy))
+
+	http.HandleFunc(endpoints.ContractStatus, handlers.HandleContractStatus(ledgerManager))
+
+	http.HandleFunc(endpoints.AdminConfig, handlers.HandleConfigQuery(&cfg, configLock))
+
+	http.HandleFunc(endpoints.AdminReload, handlers.HandleConfigReload(reloadChannel))
+	go http.ListenAndServe(hostname, handlers.LimitRequestBody(http.DefaultServeMux, cfg.APIMaxBodyBytes))
+	logging.Infof("Serving requests on port %s", cfg.Port)
 
 	// Declare channel for triggering block production
 	intervalChannel := make(chan bool)
-	productionInterval, err := time.ParseDuration(cfg.BlockProductionInterval)
-	if err != nil {
-		log.Fatalf("Failed to parse production interval: %v", err)
+
+	// Trigger block production after interval has elapsed, or at the start of this node's next slot
+	if authority != nil && !authority.IsProducer(producerAddr) {
+		logging.Infof("Not an authorized producer, following the chain without producing blocks")
+	} else {
+		go triggerInterval(intervalChannel, nextProductionDelay(authority, producerAddr, youngestBlockHeader, productionInterval))
+		logging.Infof("Will produce block every %s", cfg.BlockProductionInterval)
 	}
+	logging.Infof("Current chain height is %d", chainHeight)
 
-	// Trigger block production after interval has elapsed
-	go triggerInterval(intervalChannel, productionInterval)
-	log.Printf("Will produce block every %s", cfg.BlockProductionInterval)
-	log.Printf("Current chain height is %d", chainHeight)
+	// Reloads the configuration layers, applying the settings that may change while the node runs. A new
+	// production interval takes effect from the next block
+	reloadConfig := func() error {
+		reloaded, err := loadConfig(spec)
+		if err != nil {
+			return err
+		}
+		applied, err := cfg.Reload(reloaded)
+		if err != nil {
+			return err
+		}
+		productionInterval, _ = time.ParseDuration(applied.BlockProductionInterval)
+		logLevel, _ := logging.ParseLevel(applied.LogLevel)
+		logging.SetLevel(logLevel)
+		configLock.Lock()
+		cfg = applied
+		configLock.Unlock()
+		logging.Infof("Reloaded configuration, block production interval %s, log level %s", cfg.BlockProductionInterval, cfg.LogLevel)
+		return nil
+	}
 
 	for {
 		select {
@@ -143,70 +343,196 @@ func main() {
 				log.Fatalf("Failed to encode new contract sender public key")
 			}
 			pendingContractPool = append(pendingContractPool, newContract)
-			log.Printf("Added new contract to pool:\n(%s) ->|%d aurum|-> (%s) ",
+			logging.Debugf("Added new contract to pool:\n(%s) ->|%d aurum|-> (%s) ",
 				hex.EncodeToString(hashing.New(newContractEncodedSenderPubKey)),
 				newContract.Value, hex.EncodeToString(newContract.RecipPubKeyHash))
 
+		// Main chain changed by a block from a peer
+		case update := <-updateChannel:
+			pendingLock.Lock()
+			if update.Connected[0].Height <= chainHeight {
+				logging.Infof("Reorganized to block #%d, %d contract(s) returned to pool", update.Tip.Height, len(update.Orphaned))
+			} else {
+				logging.Infof("Block #%d received from peer", update.Tip.Height)
+			}
+			chainHeight = update.Tip.Height
+			youngestBlockHeader = update.Tip
+			pendingContractPool = reconcilePendingPool(update, pendingContractPool, pendingMap, accountsDatabaseConnection)
+			pendingLock.Unlock()
+			for _, b := range update.Connected {
+				go broadcastBlock(peerList, b)
+			}
+
 		// New block is ready to be produced
 		case <-intervalChannel:
-			log.Printf("Block #%d ready for production.", chainHeight+1)
 			pendingLock.Lock()
-			if newBlock, err := block.New(cfg.Version, chainHeight+1, block.HashBlockHeader(youngestBlockHeader), pendingContractPool); err != nil {
-				log.Fatalf("Failed to create block %v", err)
+			if authority != nil && !authority.CanProduce(producerAddr, time.Now().UnixNano(), youngestBlockHeader) {
+				// A block was already produced in this slot or the slot belongs to another producer
+				logging.Infof("Not this producer's slot, skipping production of block #%d", chainHeight+1)
 			} else {
-
-				// Add block to blockchain
-				blockchainFile, err := os.OpenFile(dataDir+constants.BlockchainFile, os.O_APPEND|os.O_WRONLY, 0644)
+				logging.Debugf("Block #%d ready for production.", chainHeight+1)
+				mintAllowance, err := policy.MintAllowance(accountsDatabaseConnection, chainHeight+1)
+				if err != nil {
+					log.Fatalf("Failed to look up mint allowance %v", err)
+				}
+				blockContracts, deferredMints := splitMints(pendingContractPool, mintAllowance)
+				if len(deferredMints) > 0 {
+					logging.Warnf("%d mint contract(s) over the mint cap deferred to a later block", len(deferredMints))
+				}
+				confirmed := len(blockContracts)
+				reward, err := policy.NewReward(chainHeight+1, rewardRecipient)
 				if err != nil {
-					log.Fatalf("failed to open ledger file: %s\n", err)
+					log.Fatalf("Failed to create block reward %v", err)
 				}
-				err = blockchain.AddBlock(newBlock, blockchainFile, metadataDatabaseConnection)
+				if reward != nil {
+					blockContracts = append(blockContracts, *reward)
+				}
+				newBlock, err := block.New(cfg.Version, chainHeight+1, block.HashBlockHeader(youngestBlockHeader), blockContracts)
 				if err != nil {
-					log.Fatalf("Failed to add block %v", err)
-				} else {
-					if err := blockchainFile.Close(); err != nil {
-						log.Fatalf("Failed to close blockchain file: %v", err)
+					log.Fatalf("Failed to create block %v", err)
+				}
+				if producerKey != nil {
+					if err := newBlock.Sign(producerKey); err != nil {
+						log.Fatalf("Failed to sign block %v", err)
 					}
+				}
+
+				// Add block to blockchain and update accounts table with all contracts in pool
+				if update, err := chain.Add(newBlock); err != nil || len(update.Connected) == 0 {
+					// A peer block changed the chain first; the pool is reconciled with it before the next interval
+					logging.Warnf("Chain advanced past block #%d, skipping production: %v", chainHeight, err)
+				} else {
 					chainHeight++
-					// Reset pending pool map to empty
-					for k := range pendingMap.Sender {
-						delete(pendingMap.Sender, k)
-					}
-					// Update accounts table with all contracts in pool
-					for _, contract := range pendingContractPool {
-						if err = accountstable.ExchangeAndUpdateAccounts(accountsDatabaseConnection, &contract); err != nil {
-							log.Printf("Failed to add contract %+v to accounts database : %v", contract, err)
-						}
-					}
+					logging.Infof("Block #%d successfully added to blockchain", chainHeight)
+					logging.Infof("%d contracts confirmed in block #%d", confirmed, chainHeight)
 
-					log.Printf("Block #%d successfully added to blockchain", chainHeight)
-					log.Printf("%d contracts confirmed in block #%d", len(pendingContractPool), chainHeight)
+					// Reset pool to the deferred mint contracts and rebuild the pending map from them
+					pendingContractPool = reconcilePendingPool(update, deferredMints, pendingMap, accountsDatabaseConnection)
 
-					// Reset pool
-					pendingContractPool = nil
+					// Gossip block to peers
+					go broadcastBlock(peerList, newBlock)
 
 					// Reset youngest block header
 					youngestBlockHeader = newBlock.GetHeader()
 
-					// Reset production interval
-					go triggerInterval(intervalChannel, productionInterval)
-
 					numBlocksGenerated++
-
 				}
 			}
+
+			// Reset production interval
+			go triggerInterval(intervalChannel, nextProductionDelay(authority, producerAddr, youngestBlockHeader, productionInterval))
 			pendingLock.Unlock()
+		// Hangup signal received, reload configuration
+		case <-hangupChannel:
+			if err := reloadConfig(); err != nil {
+				logging.Errorf("Failed to reload configuration: %v", err)
+			}
+
+		// Admin request to reload configuration
+		case result := <-reloadChannel:
+			err := reloadConfig()
+			if err != nil {
+				logging.Errorf("Failed to reload configuration: %v", err)
+			}
+			result <- err
+
 		// Signal interrupt detected
 		case <-signalChannel:
 			fmt.Print("\r")
-			log.Println("Interrupt signal encountered, terminating...")
-			log.Printf("Number of blocks generated: %d", numBlocksGenerated)
+			logging.Infof("Interrupt signal encountered, terminating...")
+			logging.Infof("Number of blocks generated: %d", numBlocksGenerated)
 			return
 		}
 
 	}
 }
 
+// loadConfig loads the configuration with the settings of spec, if any, applied before it is validated.
+// Settings contradicting spec are rejected
+func loadConfig(spec *genesis.Spec) (config.Config, error) {
+	if spec == nil {
+		return config.Load(constants.ConfigurationFile, os.Args[1:])
+	}
+	return config.LoadWith(constants.ConfigurationFile, os.Args[1:], func(cfg *config.Config) error {
+		if err := spec.Apply(cfg); err != nil {
+			return errors.New("Failed to apply genesis spec: " + err.Error())
+		}
+		return nil
+	})
+}
+
+// reconcilePendingPool returns the contracts of orphaned blocks to the pending pool, drops the contracts
+// included in the connected blocks and rebuilds the pending map from the contracts that are still valid
+func reconcilePendingPool(update forkchoice.Update, pool []contracts.Contract, pendingMap pendingpool.PendingMap, accountsDatabaseConnection *sql.DB) []contracts.Contract {
+	included := make(map[string]bool)
+	for _, b := range update.Connected {
+		for _, d := range b.Data {
+			included[string(d)] = true
+		}
+	}
+	for k := range pendingMap.Sender {
+		delete(pendingMap.Sender, k)
+	}
+	var remaining []contracts.Contract
+	for _, contract := range append(update.Orphaned, pool...) {
+		serializedContract, err := contract.Serialize()
+		if err != nil || included[string(serializedContract)] {
+			continue
+		}
+		if err := pendingMap.Add(&contract, accountsDatabaseConnection); err != nil {
+			logging.Warnf("Dropped pending contract invalidated by new block: %v", err)
+			continue
+		}
+		remaining = append(remaining, contract)
+	}
+	return remaining
+}
+
+// splitMints returns the contracts of pool that fit in the next block, in order, and the mint contracts that
+// would take it over mintAllowance. Once a mint contract is deferred the mints after it are too, as their
+// state nonces follow it
+func splitMints(pool []contracts.Contract, mintAllowance uint64) (included []contracts.Contract, deferred []contracts.Contract) {
+	for _, contract := range pool {
+		if !contract.IsMint() {
+			included = append(included, contract)
+		} else if len(deferred) == 0 && contract.Value <= mintAllowance {
+			mintAllowance -= contract.Value
+			included = append(included, contract)
+		} else {
+			deferred = append(deferred, contract)
+		}
+	}
+	return included, deferred
+}
+
+// broadcastBlock gossips b to every peer and logs the peers that did not accept it
+func broadcastBlock(peerList *peers.Peers, b block.Block) {
+	for host, err := range peerList.Broadcast(b) {
+		logging.Warnf("Failed to gossip block #%d to %s: %v", b.Height, host, err)
+	}
+}
+
+// nextProductionDelay returns how long to wait before the next block production. Without an authority this is
+// the production interval; otherwise it lasts until the start of the producer's next slot after the tip's slot
+func nextProductionDelay(authority *consensus.Authority, producerAddr []byte, tip block.BlockHeader, productionInterval time.Duration) time.Duration {
+	if authority == nil {
+		return productionInterval
+	}
+	now := time.Now().UnixNano()
+	fromSlot := authority.SlotAt(now)
+	if tipSlot := authority.SlotAt(tip.Timestamp); tip.Height > 0 && tipSlot >= fromSlot {
+		fromSlot = tipSlot + 1
+	}
+	slot, err := authority.NextSlot(producerAddr, fromSlot)
+	if err != nil {
+		log.Fatalf("Failed to find next slot: %v", err)
+	}
+	if delay := time.Duration(authority.SlotStart(slot) - now); delay > 0 {
+		return delay
+	}
+	return 0
+}
+
 func triggerInterval(intervalChannel chan bool, productionInterval time.Duration) {
 	// Triggers block production case
 	time.Sleep(productionInterval)
@@ -2,27 +2,35 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
+	"fmt"
 	"io/ioutil"
 	"log"
+	"os"
 
 	"github.com/SIGBlockchain/project_aurum/internal/config"
 	"github.com/SIGBlockchain/project_aurum/internal/constants"
-	"github.com/SIGBlockchain/project_aurum/internal/validation"
 )
 
-// main does runs four tasks: open a config file, set configuration flags, setup configuration as json,
-// and write configurations into open file
+// main updates the configuration file in the current directory, which the node reads when run from the same
+// directory, with the settings given as flags, after validating the result. Settings the file lacks are written
+// with their defaults; the environment is not applied, so that AURUM_* variables do not end up in the file
 func main() {
-	// open config file
-	configFile, err := config.GetConfigFile(config.GetBinDir() + constants.ConfigurationFile)
-	if err != nil {
+	configFile := constants.ConfigurationFile
+
+	// load the file over the defaults and update it from flags
+	cfg := config.Defaults()
+	if err := cfg.LoadFile(configFile); err != nil {
 		log.Fatal("Failed to open configuration file: " + err.Error())
 	}
-	defer configFile.Close()
-
-	// update config interface based on flags
-	cfg, err := validation.SetConfigFromFlags(configFile)
-	if err != nil {
+	if err := cfg.ParseFlags(os.Args[1:]); err == flag.ErrHelp {
+		fmt.Fprintln(os.Stderr, "usage: settings [flags], each updating "+configFile)
+		cfg.PrintFlags(os.Stderr)
+		return
+	} else if err != nil {
+		log.Fatal("Failed to set configuration: " + err.Error())
+	}
+	if err := cfg.Validate(); err != nil {
 		log.Fatal("Failed to set configuration: " + err.Error())
 	}
 
@@ -33,7 +41,7 @@ func main() {
 	}
 
 	// write bytes to file
-	if err := ioutil.WriteFile(config.GetBinDir()+constants.ConfigurationFile, marshalledJSON, 0644); err != nil {
+	if err := ioutil.WriteFile(configFile, marshalledJSON, 0644); err != nil {
 		log.Fatalf("failed to write to file: %v", err)
 	}
 }
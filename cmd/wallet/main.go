@@ -0,0 +1,711 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+
+	"github.com/SIGBlockchain/project_aurum/internal/address"
+	"github.com/SIGBlockchain/project_aurum/internal/contractfile"
+	"github.com/SIGBlockchain/project_aurum/internal/contracts"
+	"github.com/SIGBlockchain/project_aurum/internal/handlers"
+	"github.com/SIGBlockchain/project_aurum/internal/hashing"
+	"github.com/SIGBlockchain/project_aurum/internal/hdwallet"
+	"github.com/SIGBlockchain/project_aurum/internal/paymenturi"
+	"github.com/SIGBlockchain/project_aurum/internal/privatekey"
+	"github.com/SIGBlockchain/project_aurum/internal/prompt"
+	"github.com/SIGBlockchain/project_aurum/internal/publickey"
+	"github.com/SIGBlockchain/project_aurum/internal/requests"
+	"github.com/SIGBlockchain/project_aurum/internal/wallet"
+)
+
+const usage = `usage: wallet [-wallet dir] [-account name] [-node host:port] <command>
+
+commands:
+  new <name>             create the account name with a new key encrypted under a passphrase; init is an alias
+  seed                   create the seed accounts are derived from and print its mnemonic to back it up
+  derive <name>          create the account name with the next key derived from the seed
+  restore                recreate the seed from its mnemonic, and the used accounts derived from it with their balances
+  accounts               list the accounts, marking the default account with *
+  default <name>         make name the default account
+  migrate <file> <name>  import a single account aurum_wallet.json as the account name, encrypting it if needed
+  address                print the wallet address of the account
+  balance                refresh the balance and state nonce of the account from the node and print them
+  send <address> <value> sign a contract sending value aurum from the account to address and post it to the node
+  request [value [memo]] print a payment request URI asking for value aurum to be sent to the account
+  qr <uri> <file>        write the QR code of a payment request URI to file as a PNG image
+  pay <uri> [value]      send the payment requested by the URI, with value if it does not set an amount
+  status <contract>      print whether the contract with the given hash is in the node's ledger
+  import <name> <file>   create the account name from the private key in file, in PKCS #8 or SEC 1 PEM, JWK or hex
+  export <format> <file> write the account's private key unencrypted to file as pkcs8, sec1, jwk or hex
+  pubkey                 print the public key of the account, which build takes to build contracts from it
+  build <public key> <address> <value> <file>
+                         write a file holding an unsigned contract sending value from the sender with the given hex
+                         public key to address, with the sender's next state nonce on the node
+  sign <file> <signed>   sign the contract in file with the account's key, writing the signed contract to signed
+  broadcast <file>       post the signed contract in file to the node and print its hash
+  history                reconcile the contracts sent from the account with the node and list them, flagging stuck ones
+  encrypt                encrypt the private key of a plaintext account under a passphrase
+  passwd                 change the passphrase of an encrypted account
+
+Addresses are printed in the aur1... form, whose checksum catches typos, and are also accepted in 64 character hex.
+Commands use the default account unless -account is given. The wallet directory defaults to $` + wallet.DirEnv + `,
+or .aurum/wallet in the home directory. Passphrases are read from the terminal, or a line each from standard input
+if it is not a terminal`
+
+const (
+	requestTimeout = 10 * time.Second
+	qrSize         = 256 // width and height of QR codes in pixels
+)
+
+// session is a wallet command run against an account of a wallet and a node
+type session struct {
+	wallet  *wallet.Wallet
+	account string // empty for the default account
+	node    string
+	prompt  *prompt.Prompter
+	out     io.Writer
+}
+
+// main runs a single wallet command
+func main() {
+	walletDir := flag.String("wallet", "", "wallet directory")
+	account := flag.String("account", "", "account to use instead of the default account")
+	node := flag.String("node", "localhost:26000", "host and port of the node to query and send contracts to")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *walletDir == "" {
+		dir, err := wallet.DefaultDir()
+		if err != nil {
+			log.Fatal(err)
+		}
+		*walletDir = dir
+	}
+	w, err := wallet.Open(*walletDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	s := session{w, *account, *node, prompt.New(os.Stdin), os.Stdout}
+	if err := s.run(flag.Args()); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run runs the wallet command in args
+func (s *session) run(args []string) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	switch command := args[0]; {
+	case (command == "new" || command == "init") && len(args) == 2:
+		passphrase, err := s.prompt.NewPassphrase("")
+		if err != nil {
+			return err
+		}
+		if err := s.wallet.NewAccount(args[1], passphrase); err != nil {
+			return errors.New("Failed to create account: " + err.Error())
+		}
+		s.account = args[1]
+		return s.printAddress()
+	case command == "seed" && len(args) == 1:
+		return s.createSeed()
+	case command == "derive" && len(args) == 2:
+		passphrase, err := s.prompt.Passphrase("Seed passphrase: ")
+		if err != nil {
+			return err
+		}
+		if err := s.wallet.DeriveAccount(args[1], passphrase); err != nil {
+			return errors.New("Failed to derive account: " + err.Error())
+		}
+		s.account = args[1]
+		return s.printAddress()
+	case command == "restore" && len(args) == 1:
+		return s.restore()
+	case command == "accounts" && len(args) == 1:
+		return s.listAccounts()
+	case command == "default" && len(args) == 2:
+		return s.wallet.SetDefaultAccount(args[1])
+	case command == "migrate" && len(args) == 3:
+		return s.migrate(args[1], args[2])
+	case command == "address" && len(args) == 1:
+		return s.printAddress()
+	case command == "balance" && len(args) == 1:
+		balance, stateNonce, err := s.refresh()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(s.out, "Balance: %d aurum, state nonce: %d\n", balance, stateNonce)
+		return s.warnStuck()
+	case command == "send" && len(args) == 3:
+		return s.send(args[1], args[2])
+	case command == "request" && len(args) <= 3:
+		return s.request(args[1:])
+	case command == "qr" && len(args) == 3:
+		// a QR code of a malformed request would only fail when scanned
+		if _, err := paymenturi.Parse(args[1]); err != nil {
+			return err
+		}
+		if err := qrcode.WriteFile(args[1], qrcode.Medium, qrSize, args[2]); err != nil {
+			return errors.New("Failed to write QR code: " + err.Error())
+		}
+		return nil
+	case command == "pay" && (len(args) == 2 || len(args) == 3):
+		return s.pay(args[1], args[2:])
+	case command == "status" && len(args) == 2:
+		return status(s.node, args[1], s.out)
+	case command == "import" && len(args) == 3:
+		return s.importKey(args[1], args[2])
+	case command == "export" && len(args) == 3:
+		return s.exportKey(args[1], args[2])
+	case command == "pubkey" && len(args) == 1:
+		privateKey, err := s.privateKey()
+		if err != nil {
+			return err
+		}
+		pubKey, err := publickey.New(privateKey)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(s.out, pubKey.Hex)
+		return nil
+	case command == "build" && len(args) == 5:
+		return s.build(args[1], args[2], args[3], args[4])
+	case command == "sign" && len(args) == 3:
+		return s.sign(args[1], args[2])
+	case command == "broadcast" && len(args) == 2:
+		return s.broadcast(args[1])
+	case command == "history" && len(args) == 1:
+		return s.history()
+	case command == "encrypt" && len(args) == 1:
+		passphrase, err := s.prompt.NewPassphrase("")
+		if err != nil {
+			return err
+		}
+		if err := s.wallet.EncryptAccount(s.account, passphrase); err != nil {
+			return errors.New("Failed to encrypt account: " + err.Error())
+		}
+		fmt.Fprintln(s.out, "Account encrypted")
+		return nil
+	case command == "passwd" && len(args) == 1:
+		oldPassphrase, err := s.prompt.Passphrase("Current passphrase: ")
+		if err != nil {
+			return err
+		}
+		newPassphrase, err := s.prompt.NewPassphrase("")
+		if err != nil {
+			return err
+		}
+		if err := s.wallet.ChangePassphrase(s.account, oldPassphrase, newPassphrase); err != nil {
+			return errors.New("Failed to change passphrase: " + err.Error())
+		}
+		fmt.Fprintln(s.out, "Passphrase changed")
+		return nil
+	}
+	return errors.New(usage)
+}
+
+func (s *session) printAddress() error {
+	walletAddress, err := s.wallet.GetWalletAddress(s.account)
+	if err != nil {
+		return errors.New("Failed to get wallet address: " + err.Error())
+	}
+	fmt.Fprintln(s.out, address.Encode(walletAddress))
+	return nil
+}
+
+func (s *session) listAccounts() error {
+	names, err := s.wallet.Accounts()
+	if err != nil {
+		return err
+	}
+	defaultAccount, _ := s.wallet.DefaultAccount()
+	for _, name := range names {
+		walletAddress, err := s.wallet.GetWalletAddress(name)
+		if err != nil {
+			return errors.New("Failed to get wallet address of " + name + ": " + err.Error())
+		}
+		marker := " "
+		if name == defaultAccount {
+			marker = "*"
+		}
+		fmt.Fprintf(s.out, "%s %s %s\n", marker, name, address.Encode(walletAddress))
+	}
+	return nil
+}
+
+// migrate imports the wallet file as the account name and encrypts it if it holds its key in plaintext
+func (s *session) migrate(filename string, name string) error {
+	if err := s.wallet.ImportWalletFile(name, filename); err != nil {
+		return errors.New("Failed to import wallet file: " + err.Error())
+	}
+	if encrypted, err := s.wallet.IsEncrypted(name); err != nil || encrypted {
+		return err
+	}
+	passphrase, err := s.prompt.NewPassphrase("")
+	if err != nil {
+		return err
+	}
+	if err := s.wallet.EncryptAccount(name, passphrase); err != nil {
+		return errors.New("Failed to encrypt account: " + err.Error())
+	}
+	fmt.Fprintf(s.out, "Imported %s as %s; the original file may now be deleted\n", filename, name)
+	return nil
+}
+
+// createSeed creates the wallet's seed from a new mnemonic, which is printed once so that it can be written down
+func (s *session) createSeed() error {
+	if s.wallet.HasSeed() {
+		return errors.New("Wallet already has a seed")
+	}
+	mnemonic, err := hdwallet.NewMnemonic()
+	if err != nil {
+		return err
+	}
+	passphrase, err := s.prompt.NewPassphrase("")
+	if err != nil {
+		return err
+	}
+	if err := s.wallet.CreateSeed(mnemonic, passphrase); err != nil {
+		return errors.New("Failed to create seed: " + err.Error())
+	}
+	fmt.Fprintf(s.out, "Write down this mnemonic and keep it safe; it restores every account derived from the seed:\n\n%s\n\n", mnemonic)
+	fmt.Fprintln(s.out, "Create accounts from the seed with derive <name>")
+	return nil
+}
+
+// restore recreates the wallet's seed from its mnemonic and the accounts derived from it that the node knows,
+// and prints their balances
+func (s *session) restore() error {
+	mnemonic, err := s.prompt.Passphrase("Mnemonic: ")
+	if err != nil {
+		return err
+	}
+	passphrase, err := s.prompt.NewPassphrase("")
+	if err != nil {
+		return err
+	}
+	used := func(walletAddress []byte) (bool, error) {
+		found, _, _, err := accountInfo(s.node, walletAddress)
+		return found, err
+	}
+	names, err := s.wallet.RestoreSeed(string(mnemonic), passphrase, used)
+	if err != nil {
+		return errors.New("Failed to restore seed: " + err.Error())
+	}
+	for _, name := range names {
+		s.account = name
+		balance, _, err := s.refresh()
+		if err != nil {
+			return err
+		}
+		walletAddress, err := s.wallet.GetWalletAddress(name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(s.out, "%s %s %d aurum\n", name, address.Encode(walletAddress), balance)
+	}
+	return nil
+}
+
+// refresh updates the account with the balance and state nonce the node has for it, counting its pending contracts.
+// An account the node does not know has a balance and state nonce of zero
+func (s *session) refresh() (uint64, uint64, error) {
+	walletAddress, err := s.wallet.GetWalletAddress(s.account)
+	if err != nil {
+		return 0, 0, errors.New("Failed to get wallet address: " + err.Error())
+	}
+	_, balance, stateNonce, err := accountInfo(s.node, walletAddress)
+	if err != nil {
+		return 0, 0, err
+	}
+	contractHeight := func(contractHash string) (uint64, bool, error) {
+		contractStatus, found, err := getContractStatus(s.node, contractHash)
+		return contractStatus.Height, found, err
+	}
+	if _, err := s.wallet.Reconcile(s.account, balance, stateNonce, contractHeight); err != nil {
+		return 0, 0, errors.New("Failed to update wallet: " + err.Error())
+	}
+	return balance, stateNonce, nil
+}
+
+// history reconciles the account's journal with the node and prints the contracts sent from the account
+func (s *session) history() error {
+	if _, _, err := s.refresh(); err != nil {
+		return err
+	}
+	journal, err := s.wallet.Journal(s.account)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, entry := range journal {
+		state := string(entry.State)
+		if entry.State == wallet.ContractConfirmed {
+			state += fmt.Sprintf(" in block #%d", entry.Height)
+		} else if entry.Stuck(now) {
+			state += ", stuck"
+		}
+		fmt.Fprintf(s.out, "#%d %s %d aurum to %s, contract %s (%s)\n", entry.StateNonce, entry.SentAt.Format(time.RFC3339), entry.Value, entry.Recipient, entry.ContractHash, state)
+	}
+	return nil
+}
+
+// warnStuck prints a warning for each contract of the account that has been in flight for longer than wallet.StuckAfter
+func (s *session) warnStuck() error {
+	journal, err := s.wallet.Journal(s.account)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, entry := range journal {
+		if entry.Stuck(now) {
+			fmt.Fprintf(s.out, "Warning: contract %s with state nonce %d has been %s for %s\n", entry.ContractHash, entry.StateNonce, entry.State, now.Sub(entry.SentAt).Round(time.Second))
+		}
+	}
+	return nil
+}
+
+// accountInfo returns whether the node knows walletAddress, and its balance and state nonce if it does
+func accountInfo(node string, walletAddress []byte) (bool, uint64, uint64, error) {
+	req, err := requests.NewAccountInfoRequest(node, hex.EncodeToString(walletAddress))
+	if err != nil {
+		return false, 0, 0, err
+	}
+	body, statusCode, err := do(req)
+	if err != nil {
+		return false, 0, 0, err
+	}
+
+	var info struct {
+		Balance    uint64
+		StateNonce uint64
+	}
+	switch statusCode {
+	case http.StatusOK:
+		if err := json.Unmarshal(body, &info); err != nil {
+			return false, 0, 0, errors.New("Failed to parse account info: " + err.Error())
+		}
+		return true, info.Balance, info.StateNonce, nil
+	case http.StatusNotFound:
+		return false, 0, 0, nil
+	}
+	return false, 0, 0, fmt.Errorf("Node failed to return account info (%d): %s", statusCode, body)
+}
+
+// send signs a contract sending value from the account to recipient with the next state nonce of the account,
+// posts it to the node, records it in the account's journal and prints the contract's hash
+func (s *session) send(recipient string, value string) error {
+	recipientPKHash, err := address.Decode(recipient)
+	if err != nil {
+		return errors.New("Invalid recipient address: " + err.Error())
+	}
+	recipient = address.Encode(recipientPKHash)
+	amount, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || amount == 0 {
+		return errors.New("Invalid value: " + value)
+	}
+	privateKey, err := s.privateKey()
+	if err != nil {
+		return err
+	}
+	balance, stateNonce, err := s.refresh()
+	if err != nil {
+		return err
+	}
+	if balance < amount {
+		return fmt.Errorf("Insufficient funds: balance is %d aurum", balance)
+	}
+	stateNonce, err = s.wallet.NextStateNonce(s.account)
+	if err != nil {
+		return err
+	}
+
+	contract, err := contracts.New(1, privateKey, recipientPKHash, amount, stateNonce)
+	if err != nil {
+		return errors.New("Failed to create contract: " + err.Error())
+	}
+	if err := contract.Sign(privateKey); err != nil {
+		return errors.New("Failed to sign contract: " + err.Error())
+	}
+	serializedContract, err := contract.Serialize()
+	if err != nil {
+		return errors.New("Failed to serialize contract: " + err.Error())
+	}
+	req, err := requests.NewContractRequest("http://"+s.node, *contract)
+	if err != nil {
+		return err
+	}
+	body, statusCode, err := do(req)
+	if err != nil {
+		return err
+	}
+	if statusCode != http.StatusOK {
+		return fmt.Errorf("Node rejected contract (%d): %s", statusCode, body)
+	}
+	contractHash := hex.EncodeToString(hashing.New(serializedContract))
+	entry := wallet.JournalEntry{ContractHash: contractHash, Recipient: recipient, Value: amount, StateNonce: stateNonce, SentAt: time.Now()}
+	if err := s.wallet.RecordSent(s.account, entry); err != nil {
+		return errors.New("Failed to update wallet: " + err.Error())
+	}
+	fmt.Fprintf(s.out, "Sent %d aurum to %s in contract %s\n", amount, recipient, contractHash)
+	return nil
+}
+
+// importKey creates the account name from the private key in filename, encrypting it under a new passphrase
+func (s *session) importKey(name string, filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return errors.New("Failed to read key file: " + err.Error())
+	}
+	privateKey, err := privatekey.Import(data)
+	if err != nil {
+		return errors.New("Failed to import private key: " + err.Error())
+	}
+	passphrase, err := s.prompt.NewPassphrase("")
+	if err != nil {
+		return err
+	}
+	if err := s.wallet.ImportKey(name, privateKey, passphrase); err != nil {
+		return errors.New("Failed to create account: " + err.Error())
+	}
+	s.account = name
+	return s.printAddress()
+}
+
+// exportKey writes the account's private key to filename in format. The file is created readable only by its
+// owner and an existing file is not overwritten
+func (s *session) exportKey(format string, filename string) error {
+	privateKey, err := s.privateKey()
+	if err != nil {
+		return err
+	}
+	exported, err := privatekey.Export(privateKey, format)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return errors.New("Failed to create key file: " + err.Error())
+	}
+	defer file.Close()
+	if _, err := file.Write(append(bytes.TrimRight(exported, "\n"), '\n')); err != nil {
+		return errors.New("Failed to write key file: " + err.Error())
+	}
+	fmt.Fprintf(s.out, "Wrote the unencrypted private key to %s; keep it safe\n", filename)
+	return nil
+}
+
+// request prints a payment request URI for the account, with the amount and memo in args if they are given
+func (s *session) request(args []string) error {
+	walletAddress, err := s.wallet.GetWalletAddress(s.account)
+	if err != nil {
+		return errors.New("Failed to get wallet address: " + err.Error())
+	}
+	r := paymenturi.Request{Address: walletAddress}
+	if len(args) > 0 {
+		if r.Amount, err = strconv.ParseUint(args[0], 10, 64); err != nil {
+			return errors.New("Invalid value: " + args[0])
+		}
+	}
+	if len(args) > 1 {
+		r.Memo = args[1]
+	}
+	fmt.Fprintln(s.out, r.String())
+	return nil
+}
+
+// pay sends the payment requested by uri from the account. The amount is taken from the URI, or from args if the
+// URI leaves it to the payer
+func (s *session) pay(uri string, args []string) error {
+	r, err := paymenturi.Parse(uri)
+	if err != nil {
+		return err
+	}
+	value := strconv.FormatUint(r.Amount, 10)
+	if len(args) == 1 {
+		if r.Amount != 0 && args[0] != value {
+			return fmt.Errorf("Payment request is for %d aurum, not %s", r.Amount, args[0])
+		}
+		value = args[0]
+	} else if r.Amount == 0 {
+		return errors.New("Payment request does not set an amount; give the value to pay")
+	}
+	if r.Memo != "" {
+		fmt.Fprintf(s.out, "Paying %s aurum to %s for %q\n", value, address.Encode(r.Address), r.Memo)
+	}
+	return s.send(address.Encode(r.Address), value)
+}
+
+// privateKey returns the private key of the account, prompting for its passphrase if it is encrypted
+func (s *session) privateKey() (*ecdsa.PrivateKey, error) {
+	var passphrase []byte
+	if encrypted, err := s.wallet.IsEncrypted(s.account); err != nil {
+		return nil, err
+	} else if encrypted {
+		if passphrase, err = s.prompt.Passphrase("Passphrase: "); err != nil {
+			return nil, err
+		}
+	}
+	privateKey, err := s.wallet.GetPrivateKey(s.account, passphrase)
+	if err != nil {
+		return nil, errors.New("Failed to get private key: " + err.Error())
+	}
+	return privateKey, nil
+}
+
+// build writes an unsigned contract sending value from sender, the hex encoded PEM public key printed by pubkey,
+// to recipient, with the sender's next state nonce on the node
+func (s *session) build(sender string, recipient string, value string, filename string) error {
+	encodedSender, err := hex.DecodeString(sender)
+	if err != nil {
+		return errors.New("Invalid sender public key: " + err.Error())
+	}
+	senderPubKey, err := publickey.Decode(encodedSender)
+	if err != nil {
+		return errors.New("Invalid sender public key: " + err.Error())
+	}
+	recipientPKHash, err := address.Decode(recipient)
+	if err != nil {
+		return errors.New("Invalid recipient address: " + err.Error())
+	}
+	recipient = address.Encode(recipientPKHash)
+	amount, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || amount == 0 {
+		return errors.New("Invalid value: " + value)
+	}
+	found, balance, stateNonce, err := accountInfo(s.node, hashing.New(encodedSender))
+	if err != nil {
+		return err
+	}
+	if !found || balance < amount {
+		return fmt.Errorf("Insufficient funds: balance is %d aurum", balance)
+	}
+	f, err := contractfile.Build(senderPubKey, recipientPKHash, amount, stateNonce+1)
+	if err != nil {
+		return errors.New("Failed to build contract: " + err.Error())
+	}
+	if err := f.Write(filename); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "Wrote unsigned contract sending %d aurum to %s with state nonce %d to %s\n", amount, recipient, stateNonce+1, filename)
+	return nil
+}
+
+// sign signs the unsigned contract in filename with the account's private key and writes it to signedFilename
+func (s *session) sign(filename string, signedFilename string) error {
+	f, err := contractfile.Read(filename)
+	if err != nil {
+		return err
+	}
+	privateKey, err := s.privateKey()
+	if err != nil {
+		return err
+	}
+	if err := f.Sign(privateKey); err != nil {
+		return errors.New("Failed to sign contract: " + err.Error())
+	}
+	if err := f.Write(signedFilename); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "Signed contract sending %d aurum to %s with state nonce %d, written to %s\n", f.Contract.Value, f.Contract.RecipientWalletAddress, f.Contract.StateNonce, signedFilename)
+	return nil
+}
+
+// broadcast posts the signed contract in filename to the node and prints its hash
+func (s *session) broadcast(filename string) error {
+	f, err := contractfile.Read(filename)
+	if err != nil {
+		return err
+	}
+	contract, err := f.Signed()
+	if err != nil {
+		return err
+	}
+	contractHash, err := f.Hash()
+	if err != nil {
+		return err
+	}
+	req, err := requests.NewContractRequest("http://"+s.node, contract)
+	if err != nil {
+		return err
+	}
+	body, statusCode, err := do(req)
+	if err != nil {
+		return err
+	}
+	if statusCode != http.StatusOK {
+		return fmt.Errorf("Node rejected contract (%d): %s", statusCode, body)
+	}
+	fmt.Fprintf(s.out, "Broadcast contract %s\n", contractHash)
+	return nil
+}
+
+// status prints the block confirming the contract with the hex encoded contractHash, if it is in the node's ledger
+func status(node string, contractHash string, out io.Writer) error {
+	contractStatus, found, err := getContractStatus(node, contractHash)
+	if err != nil {
+		return err
+	}
+	if found {
+		fmt.Fprintf(out, "Contract %s confirmed in block #%d (%d confirmations)\n", contractHash, contractStatus.Height, contractStatus.Confirmations)
+	} else {
+		fmt.Fprintf(out, "Contract %s is not in the ledger; it is pending or unknown to the node\n", contractHash)
+	}
+	return nil
+}
+
+// getContractStatus returns the status of the contract with the hex encoded contractHash, or false if it is not in
+// the node's ledger
+func getContractStatus(node string, contractHash string) (handlers.ContractStatusResponse, bool, error) {
+	var contractStatus handlers.ContractStatusResponse
+	req, err := requests.GetContractStatusRequest(node, contractHash)
+	if err != nil {
+		return contractStatus, false, err
+	}
+	body, statusCode, err := do(req)
+	if err != nil {
+		return contractStatus, false, err
+	}
+	switch statusCode {
+	case http.StatusOK:
+		if err := json.Unmarshal(body, &contractStatus); err != nil {
+			return contractStatus, false, errors.New("Failed to parse contract status: " + err.Error())
+		}
+		return contractStatus, true, nil
+	case http.StatusNotFound:
+		return contractStatus, false, nil
+	}
+	return contractStatus, false, fmt.Errorf("Node failed to return contract status (%d): %s", statusCode, body)
+}
+
+// do sends req and returns the body and status code of the response
+func do(req *http.Request) ([]byte, int, error) {
+	client := http.Client{Timeout: requestTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, errors.New("Failed to reach node: " + err.Error())
+	}
+	defer resp.Body.Close()
+	buf := new(bytes.Buffer)
+	if _, err := buf.ReadFrom(resp.Body); err != nil {
+		return nil, 0, errors.New("Failed to read response: " + err.Error())
+	}
+	return buf.Bytes(), resp.StatusCode, nil
+}
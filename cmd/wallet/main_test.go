@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/SIGBlockchain/project_aurum/internal/address"
+	"github.com/SIGBlockchain/project_aurum/internal/block"
+	"github.com/SIGBlockchain/project_aurum/internal/blockchain"
+	"github.com/SIGBlockchain/project_aurum/internal/constants"
+	"github.com/SIGBlockchain/project_aurum/internal/contracts"
+	"github.com/SIGBlockchain/project_aurum/internal/endpoints"
+	"github.com/SIGBlockchain/project_aurum/internal/handlers"
+	"github.com/SIGBlockchain/project_aurum/internal/hashing"
+	"github.com/SIGBlockchain/project_aurum/internal/keystore"
+	"github.com/SIGBlockchain/project_aurum/internal/paymenturi"
+	"github.com/SIGBlockchain/project_aurum/internal/pendingpool"
+	"github.com/SIGBlockchain/project_aurum/internal/privatekey"
+	"github.com/SIGBlockchain/project_aurum/internal/prompt"
+	"github.com/SIGBlockchain/project_aurum/internal/wallet"
+)
+
+func TestWalletCommands(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aurum_wallet")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	w, err := wallet.Open(filepath.Join(dir, "wallet"))
+	if err != nil {
+		t.Fatalf("failed to open wallet: %v", err)
+	}
+	wallet.KeystoreParams = keystore.LightParams
+
+	var node string
+	var input string
+	var out bytes.Buffer
+	command := func(args ...string) (string, error) {
+		out.Reset()
+		s := session{w, "", node, prompt.New(strings.NewReader(input)), &out}
+		err := s.run(args)
+		return out.String(), err
+	}
+
+	// The node is set up once the wallet exists, so its address can be airdropped aurum
+	input = "secret\nsecrets\n"
+	if _, err := command("new", "main"); err == nil {
+		t.Errorf("expected new to reject mismatched passphrases")
+	}
+	input = "secret\nsecret\n"
+	if _, err := command("new", "main"); err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+	if _, err := command("new", "main"); err == nil {
+		t.Errorf("expected new to refuse to overwrite the account")
+	}
+	if _, err := command("init", "main"); err == nil || !strings.Contains(err.Error(), "Failed to create account") {
+		t.Errorf("expected init to create accounts like new, got %v", err)
+	}
+	walletAddress, _ := w.GetWalletAddress("")
+	airdrop, _ := contracts.New(1, nil, walletAddress, 1000, 0)
+	genesisBlock, _ := block.New(1, 0, make([]byte, 32), []contracts.Contract{*airdrop})
+	ledgerName := filepath.Join(dir, constants.BlockchainFile)
+	metadataName := filepath.Join(dir, constants.MetadataTable)
+	accountsName := filepath.Join(dir, constants.AccountsTable)
+	if err := blockchain.Airdrop(ledgerName, metadataName, accountsName, genesisBlock); err != nil {
+		t.Fatalf("failed to airdrop: %v", err)
+	}
+	ledgerFile, _ := os.OpenFile(ledgerName, os.O_APPEND|os.O_RDWR, 0644)
+	defer ledgerFile.Close()
+	metadata, _ := sql.Open("sqlite3", metadataName)
+	defer metadata.Close()
+	accounts, _ := sql.Open("sqlite3", accountsName)
+	defer accounts.Close()
+	ledger := blockchain.NewLedgerManager(ledgerFile, metadata)
+
+	pendingMap := pendingpool.NewPendingMap()
+	pendingLock := new(sync.Mutex)
+	contractChannel := make(chan contracts.Contract, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc(endpoints.AccountInfo, handlers.HandleAccountInfoRequest(accounts, pendingMap, pendingLock))
+	mux.HandleFunc(endpoints.Contract, handlers.HandleContractRequest(accounts, contractChannel, pendingMap, pendingLock))
+	mux.HandleFunc(endpoints.ContractStatus, handlers.HandleContractStatus(ledger))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	node = strings.TrimPrefix(server.URL, "http://")
+
+	if output, err := command("address"); err != nil || strings.TrimSpace(output) != address.Encode(walletAddress) {
+		t.Errorf("unexpected address %q (%v)", output, err)
+	}
+	if output, err := command("balance"); err != nil || !strings.Contains(output, "Balance: 1000 aurum, state nonce: 0") {
+		t.Errorf("unexpected balance %q (%v)", output, err)
+	}
+
+	recipient := hex.EncodeToString(hashing.New([]byte("recipient")))
+	if _, err := command("send", recipient, "2000"); err == nil {
+		t.Errorf("expected sending more than the balance to fail")
+	}
+	if _, err := command("send", "abcd", "100"); err == nil {
+		t.Errorf("expected sending to an invalid address to fail")
+	}
+	typo := []byte(address.Encode(hashing.New([]byte("recipient"))))
+	if typo[10] == 'q' {
+		typo[10] = 'p'
+	} else {
+		typo[10] = 'q'
+	}
+	if _, err := command("send", string(typo), "100"); err == nil {
+		t.Errorf("expected sending to a mistyped address to fail")
+	}
+	input = "wrong\n"
+	if _, err := command("send", recipient, "100"); err == nil {
+		t.Errorf("expected sending with the wrong passphrase to fail")
+	}
+	input = "secret\n"
+	output, err := command("send", recipient, "100")
+	if err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+	fields := strings.Fields(output)
+	contractHash := fields[len(fields)-1]
+	sent := <-contractChannel
+	if sent.Value != 100 || sent.StateNonce != 1 {
+		t.Errorf("unexpected contract posted: %+v", sent)
+	}
+	if nonce, _ := w.GetStateNonce("main"); nonce != 1 {
+		t.Errorf("expected the wallet's state nonce to advance to 1, got %d", nonce)
+	}
+	if output, err := command("balance"); err != nil || !strings.Contains(output, "Balance: 900 aurum, state nonce: 1") {
+		t.Errorf("expected the pending contract in the balance, got %q (%v)", output, err)
+	}
+
+	if output, err := command("status", contractHash); err != nil || !strings.Contains(output, "not in the ledger") {
+		t.Errorf("expected the contract to be pending, got %q (%v)", output, err)
+	}
+	b, _ := block.New(1, 1, block.HashBlock(genesisBlock), []contracts.Contract{sent})
+	if err := ledger.AddBlock(b); err != nil {
+		t.Fatalf("failed to add block: %v", err)
+	}
+	if output, err := command("status", contractHash); err != nil || !strings.Contains(output, "confirmed in block #1 (1 confirmations)") {
+		t.Errorf("expected the contract to be confirmed, got %q (%v)", output, err)
+	}
+	if output, err := command("history"); err != nil || !strings.Contains(output, "#1 ") || !strings.Contains(output, contractHash+" (confirmed in block #1)") {
+		t.Errorf("expected the contract to be confirmed in the journal, got %q (%v)", output, err)
+	}
+
+	if output, err := command("request", "5", "dues"); err != nil || strings.TrimSpace(output) != "aurum:"+address.Encode(walletAddress)+"?amount=5&memo=dues" {
+		t.Errorf("unexpected payment request %q (%v)", output, err)
+	}
+	uri := paymenturi.Request{Address: hashing.New([]byte("recipient")), Amount: 50, Memo: "pizza"}.String()
+	qrName := filepath.Join(dir, "pay.png")
+	if _, err := command("qr", uri, qrName); err != nil {
+		t.Errorf("failed to write QR code: %v", err)
+	}
+	if png, _ := ioutil.ReadFile(qrName); !bytes.HasPrefix(png, []byte("\x89PNG")) {
+		t.Errorf("expected a PNG image")
+	}
+	badQRName := filepath.Join(dir, "bad.png")
+	if _, err := command("qr", "aurum:aur1xyz?amount=50", badQRName); err == nil {
+		t.Errorf("expected a QR code of an invalid payment request to be refused")
+	}
+	if _, err := os.Stat(badQRName); !os.IsNotExist(err) {
+		t.Errorf("expected no QR code to be written for an invalid payment request")
+	}
+	if _, err := command("pay", uri, "60"); err == nil {
+		t.Errorf("expected paying a different amount than requested to fail")
+	}
+	input = "secret\n"
+	if output, err := command("pay", uri); err != nil || !strings.Contains(output, `Paying 50 aurum to `+address.Encode(hashing.New([]byte("recipient")))+` for "pizza"`) {
+		t.Errorf("failed to pay request: %q (%v)", output, err)
+	}
+	if paid := <-contractChannel; paid.Value != 50 || paid.StateNonce != 2 {
+		t.Errorf("unexpected contract posted: %+v", paid)
+	}
+
+	input = "secret\nchanged\nchanged\n"
+	if _, err := command("passwd"); err != nil {
+		t.Errorf("failed to change passphrase: %v", err)
+	}
+	if _, err := w.GetPrivateKey("", []byte("secret")); err != keystore.ErrWrongPassphrase {
+		t.Errorf("expected the old passphrase to be rejected, got %v", err)
+	}
+	if _, err := w.GetPrivateKey("", []byte("changed")); err != nil {
+		t.Errorf("expected the new passphrase to unlock the wallet: %v", err)
+	}
+
+	if _, err := command("send", recipient); err == nil {
+		t.Errorf("expected missing arguments to be rejected")
+	}
+}
+
+func TestMigratePlaintextWallet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aurum_wallet")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	w, _ := wallet.Open(filepath.Join(dir, "wallet"))
+	wallet.KeystoreParams = keystore.LightParams
+
+	// Wallets used to be a single aurum_wallet.json holding the hex encoded PEM private key in plaintext
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	pemEncoded, _ := privatekey.Encode(key)
+	plaintext := fmt.Sprintf(`{"PrivateKey":"%s","Balance":10,"Nonce":2}`, hex.EncodeToString(pemEncoded))
+	legacyName := filepath.Join(dir, "aurum_wallet.json")
+	if err := ioutil.WriteFile(legacyName, []byte(plaintext), 0644); err != nil {
+		t.Fatalf("failed to write wallet: %v", err)
+	}
+
+	var out bytes.Buffer
+	s := session{w, "", "", prompt.New(strings.NewReader("secret\nsecret\n")), &out}
+	if err := s.run([]string{"migrate", legacyName, "old"}); err != nil {
+		t.Fatalf("failed to migrate wallet: %v", err)
+	}
+	data, _ := ioutil.ReadFile(filepath.Join(dir, "wallet", "accounts", "old.json"))
+	if strings.Contains(string(data), hex.EncodeToString(pemEncoded)) {
+		t.Errorf("expected the plaintext key to be removed")
+	}
+	if info, _ := os.Stat(filepath.Join(dir, "wallet", "accounts", "old.json")); info.Mode().Perm() != 0600 {
+		t.Errorf("expected the account to be readable only by its owner, got %v", info.Mode().Perm())
+	}
+	if balance, _ := w.GetBalance("old"); balance != 10 {
+		t.Errorf("expected the balance to be kept, got %d", balance)
+	}
+	if decrypted, err := w.GetPrivateKey("old", []byte("secret")); err != nil || decrypted.D.Cmp(key.D) != 0 {
+		t.Errorf("expected the encrypted key to decrypt to the original key: %v", err)
+	}
+	s.prompt = prompt.New(strings.NewReader("secret\nsecret\n"))
+	if err := s.run([]string{"encrypt"}); err == nil {
+		t.Errorf("expected an encrypted account not to be encrypted again")
+	}
+}
+
+func TestRestoreWallet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aurum_wallet")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	wallet.KeystoreParams = keystore.LightParams
+	lost, _ := wallet.Open(filepath.Join(dir, "lost"))
+
+	var out bytes.Buffer
+	s := session{lost, "", "", prompt.New(strings.NewReader("secret\nsecret\nsecret\nsecret\n")), &out}
+	if err := s.run([]string{"seed"}); err != nil {
+		t.Fatalf("failed to create seed: %v", err)
+	}
+	lines := strings.Split(out.String(), "\n")
+	mnemonic := lines[2]
+	if len(strings.Fields(mnemonic)) != 12 {
+		t.Fatalf("expected a 12 word mnemonic, got %q", mnemonic)
+	}
+	for _, name := range []string{"first", "second"} {
+		if err := s.run([]string{"derive", name}); err != nil {
+			t.Fatalf("failed to derive account: %v", err)
+		}
+	}
+
+	// Only the second account has aurum, so the first is recreated as the account before it
+	secondAddress, _ := lost.GetWalletAddress("second")
+	airdrop, _ := contracts.New(1, nil, secondAddress, 500, 0)
+	genesisBlock, _ := block.New(1, 0, make([]byte, 32), []contracts.Contract{*airdrop})
+	accountsName := filepath.Join(dir, constants.AccountsTable)
+	if err := blockchain.Airdrop(filepath.Join(dir, constants.BlockchainFile), filepath.Join(dir, constants.MetadataTable), accountsName, genesisBlock); err != nil {
+		t.Fatalf("failed to airdrop: %v", err)
+	}
+	accounts, _ := sql.Open("sqlite3", accountsName)
+	defer accounts.Close()
+	mux := http.NewServeMux()
+	mux.HandleFunc(endpoints.AccountInfo, handlers.HandleAccountInfoRequest(accounts, pendingpool.NewPendingMap(), new(sync.Mutex)))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	restored, _ := wallet.Open(filepath.Join(dir, "restored"))
+	out.Reset()
+	s = session{restored, "", strings.TrimPrefix(server.URL, "http://"), prompt.New(strings.NewReader(mnemonic + "\nchanged\nchanged\n")), &out}
+	if err := s.run([]string{"restore"}); err != nil {
+		t.Fatalf("failed to restore wallet: %v", err)
+	}
+	expected := "account-1 " + address.Encode(secondAddress) + " 500 aurum"
+	if !strings.Contains(out.String(), expected) {
+		t.Errorf("expected %q in %q", expected, out.String())
+	}
+	if balance, _ := restored.GetBalance("account-1"); balance != 500 {
+		t.Errorf("expected the restored balance to be cached, got %d", balance)
+	}
+}
+
+func TestOfflineSigning(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aurum_wallet")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	wallet.KeystoreParams = keystore.LightParams
+	cold, _ := wallet.Open(filepath.Join(dir, "cold"))
+	hot, _ := wallet.Open(filepath.Join(dir, "hot"))
+	if err := cold.NewAccount("treasury", []byte("secret")); err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+	var out bytes.Buffer
+	offline := session{cold, "", "", prompt.New(strings.NewReader("secret\nsecret\n")), &out}
+	if err := offline.run([]string{"pubkey"}); err != nil {
+		t.Fatalf("failed to print public key: %v", err)
+	}
+	pubKey := strings.TrimSpace(out.String())
+
+	treasuryAddress, _ := cold.GetWalletAddress("")
+	airdrop, _ := contracts.New(1, nil, treasuryAddress, 1000, 0)
+	genesisBlock, _ := block.New(1, 0, make([]byte, 32), []contracts.Contract{*airdrop})
+	accountsName := filepath.Join(dir, constants.AccountsTable)
+	if err := blockchain.Airdrop(filepath.Join(dir, constants.BlockchainFile), filepath.Join(dir, constants.MetadataTable), accountsName, genesisBlock); err != nil {
+		t.Fatalf("failed to airdrop: %v", err)
+	}
+	accounts, _ := sql.Open("sqlite3", accountsName)
+	defer accounts.Close()
+	pendingMap := pendingpool.NewPendingMap()
+	pendingLock := new(sync.Mutex)
+	contractChannel := make(chan contracts.Contract, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc(endpoints.AccountInfo, handlers.HandleAccountInfoRequest(accounts, pendingMap, pendingLock))
+	mux.HandleFunc(endpoints.Contract, handlers.HandleContractRequest(accounts, contractChannel, pendingMap, pendingLock))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	online := session{hot, "", strings.TrimPrefix(server.URL, "http://"), prompt.New(strings.NewReader("")), &out}
+
+	recipient := hex.EncodeToString(hashing.New([]byte("recipient")))
+	unsignedName := filepath.Join(dir, "unsigned.json")
+	signedName := filepath.Join(dir, "signed.json")
+	if err := online.run([]string{"build", pubKey, recipient, "5000", unsignedName}); err == nil {
+		t.Errorf("expected a contract exceeding the sender's balance not to be built")
+	}
+	if err := online.run([]string{"build", pubKey, recipient, "250", unsignedName}); err != nil {
+		t.Fatalf("failed to build contract: %v", err)
+	}
+	if err := online.run([]string{"broadcast", unsignedName}); err == nil {
+		t.Errorf("expected an unsigned contract not to be broadcast")
+	}
+	if err := offline.run([]string{"sign", unsignedName, signedName}); err != nil {
+		t.Fatalf("failed to sign contract: %v", err)
+	}
+	out.Reset()
+	if err := online.run([]string{"broadcast", signedName}); err != nil {
+		t.Fatalf("failed to broadcast contract: %v", err)
+	}
+	sent := <-contractChannel
+	if sent.Value != 250 || sent.StateNonce != 1 || hex.EncodeToString(sent.RecipPubKeyHash) != recipient {
+		t.Errorf("unexpected contract posted: %+v", sent)
+	}
+	serialized, _ := sent.Serialize()
+	if !strings.Contains(out.String(), hex.EncodeToString(hashing.New(serialized))) {
+		t.Errorf("expected the hash of the contract in %q", out.String())
+	}
+}
+
+func TestImportExportKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aurum_wallet")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	wallet.KeystoreParams = keystore.LightParams
+	w, _ := wallet.Open(filepath.Join(dir, "wallet"))
+	if err := w.NewAccount("original", []byte("secret")); err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+	originalAddress, _ := w.GetWalletAddress("original")
+
+	var out bytes.Buffer
+	for i, format := range []string{"pkcs8", "sec1", "jwk", "hex"} {
+		keyName := filepath.Join(dir, format)
+		s := session{w, "original", "", prompt.New(strings.NewReader("secret\nsecret\n")), &out}
+		if err := s.run([]string{"export", format, keyName}); err != nil {
+			t.Fatalf("failed to export %s key: %v", format, err)
+		}
+		if info, _ := os.Stat(keyName); info.Mode().Perm() != 0600 {
+			t.Errorf("expected the key file to be readable only by its owner, got %v", info.Mode().Perm())
+		}
+		s.prompt = prompt.New(strings.NewReader("secret\n"))
+		if err := s.run([]string{"export", format, keyName}); err == nil {
+			t.Errorf("expected an existing key file not to be overwritten")
+		}
+
+		name := fmt.Sprintf("imported-%d", i)
+		s.prompt = prompt.New(strings.NewReader("other\nother\n"))
+		if err := s.run([]string{"import", name, keyName}); err != nil {
+			t.Fatalf("failed to import %s key: %v", format, err)
+		}
+		if importedAddress, _ := w.GetWalletAddress(name); !bytes.Equal(importedAddress, originalAddress) {
+			t.Errorf("expected the imported %s key to have the original address", format)
+		}
+	}
+
+	garbage := filepath.Join(dir, "garbage")
+	ioutil.WriteFile(garbage, []byte("-----BEGIN nothing"), 0600)
+	s := session{w, "", "", prompt.New(strings.NewReader("other\nother\n")), &out}
+	if err := s.run([]string{"import", "garbage", garbage}); err == nil {
+		t.Errorf("expected an invalid key file to be rejected")
+	}
+}
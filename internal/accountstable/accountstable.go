@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"sync"
 
 	"github.com/SIGBlockchain/project_aurum/internal/accountinfo"
@@ -17,12 +18,26 @@ import (
 
 // structs
 
+// execer is what the account updates need of a sql.DB, which a sql.Tx also provides, so that ApplyBlock can make
+// them in one transaction
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Prepare(query string) (*sql.Stmt, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
 // Connection struct used receiver call on a sql.DB with mutex support
 type Connection struct {
 	lock   sync.RWMutex
 	dbconn *sql.DB
 }
 
+// NewConnection returns a Connection wrapping an open accounts database
+func NewConnection(dbconn *sql.DB) *Connection {
+	return &Connection{dbconn: dbconn}
+}
+
 // Lock locks Connection for writing. If the lock is already locked for writing,
 // Lock blocks until the lock is available.
 func (c *Connection) Lock() {
@@ -96,7 +111,7 @@ Public Key Hash insert into pkhash column
 
 Return every error possible with an explicit message
 */
-func InsertAccountIntoAccountBalanceTable(dbConnection *sql.DB, pkhash []byte, value uint64) error {
+func InsertAccountIntoAccountBalanceTable(dbConnection execer, pkhash []byte, value uint64) error {
 	// create a prepared statement to insert into account_balances
 	statement, err := dbConnection.Prepare(sqlstatements.INSERT_VALUES_INTO_ACCOUNT_BALANCES)
 	if err != nil {
@@ -118,7 +133,7 @@ Deduct value from sender's balance
 Add value to recipient's balance
 Increment both nonces by 1
 */
-func ExchangeAndUpdateAccounts(dbConnection *sql.DB, c *contracts.Contract) error {
+func ExchangeAndUpdateAccounts(dbConnection execer, c *contracts.Contract) error {
 	encodedCContractSenderPublicKey, err := publickey.Encode(c.SenderPubKey)
 	if err != nil {
 		return err
@@ -171,7 +186,7 @@ func ExchangeAndUpdateAccounts(dbConnection *sql.DB, c *contracts.Contract) erro
 Add value to pkhash's balanace
 Increment nonce by 1
 */
-func MintAurumUpdateAccountBalanceTable(dbConnection *sql.DB, pkhash []byte, value uint64) error {
+func MintAurumUpdateAccountBalanceTable(dbConnection execer, pkhash []byte, value uint64) error {
 	// retrieve pkhash's balance and nonce
 	accountInfo, errAccount := GetAccountInfo(dbConnection, pkhash)
 
@@ -188,7 +203,7 @@ func MintAurumUpdateAccountBalanceTable(dbConnection *sql.DB, pkhash []byte, val
 	return errors.New("Failed to find row")
 }
 
-func GetBalance(dbConnection *sql.DB, pkhash []byte) (uint64, error) {
+func GetBalance(dbConnection execer, pkhash []byte) (uint64, error) {
 	// search for pkhash's balance
 	row, err := dbConnection.Query(sqlstatements.GET_BALANCE_FROM_ACCOUNT_BALANCES_BY_PUB_KEY_HASH, hex.EncodeToString(pkhash))
 	if err != nil {
@@ -208,7 +223,7 @@ func GetBalance(dbConnection *sql.DB, pkhash []byte) (uint64, error) {
 	return balance, nil
 }
 
-func GetStateNonce(dbConnection *sql.DB, pkhash []byte) (uint64, error) {
+func GetStateNonce(dbConnection execer, pkhash []byte) (uint64, error) {
 	// search for pkhash's stateNonce
 	row, err := dbConnection.Query(sqlstatements.GET_NONCE_FROM_ACCOUNT_BALANCES_BY_PUB_KEY_HASH, hex.EncodeToString(pkhash))
 	if err != nil {
@@ -228,7 +243,7 @@ func GetStateNonce(dbConnection *sql.DB, pkhash []byte) (uint64, error) {
 	return stateNonce, nil
 }
 
-func GetAccountInfo(dbConnection *sql.DB, pkhash []byte) (*accountinfo.AccountInfo, error) {
+func GetAccountInfo(dbConnection execer, pkhash []byte) (*accountinfo.AccountInfo, error) {
 	// retrieve pkhash's balance
 	balance, err := GetBalance(dbConnection, pkhash)
 	if err != nil {
@@ -244,6 +259,299 @@ func GetAccountInfo(dbConnection *sql.DB, pkhash []byte) (*accountinfo.AccountIn
 	return &accountinfo.AccountInfo{Balance: balance, StateNonce: stateNonce}, nil
 }
 
+/*
+Apply the contracts of a block in order
+Minting contracts (nil sender) credit the recipient's account with the contract value, inserting it if needed;
+those of no value are skipped
+Mint contracts signed by the mint key credit the recipient the same way, advance the mint account's nonce
+and are recorded in the mint log
+Burn contracts deduct their value from the sender's balance, increment its nonce and are recorded in the burn log
+Every other contract goes through ExchangeAndUpdateAccounts
+The balance and nonce of every account the block touches are first saved in the undo log,
+so the block can be reverted with RevertTo. If a contract fails to apply, none of the block is applied
+*/
+func ApplyBlock(dbConnection *sql.DB, b *block.Block) error {
+	blockContracts := make([]contracts.Contract, len(b.Data))
+	for i, data := range b.Data {
+		if err := blockContracts[i].Deserialize(data); err != nil {
+			return errors.New("Failed to deserialize contract: " + err.Error())
+		}
+	}
+	// The undo log and the balances are written in one transaction, so a failed block leaves no trace
+	tx, err := dbConnection.Begin()
+	if err != nil {
+		return errors.New("Failed to begin transaction: " + err.Error())
+	}
+	if err := recordBeforeImages(tx, b.Height, blockContracts); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for i := range blockContracts {
+		var err error
+		if blockContracts[i].SenderPubKey == nil && blockContracts[i].Value == 0 {
+			// such as the contract committing a genesis block to its spec, which creates no account
+			continue
+		} else if blockContracts[i].SenderPubKey == nil {
+			err = mint(tx, blockContracts[i].RecipPubKeyHash, blockContracts[i].Value)
+		} else if blockContracts[i].IsMint() {
+			err = applyMintContract(tx, b.Height, &blockContracts[i])
+		} else if blockContracts[i].IsBurn() {
+			err = applyBurnContract(tx, b.Height, &blockContracts[i])
+		} else {
+			err = ExchangeAndUpdateAccounts(tx, &blockContracts[i])
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("Failed to apply contract %d of block #%d: %v", i, b.Height, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.New("Failed to commit block: " + err.Error())
+	}
+	return nil
+}
+
+// mint credits value to an existing account, or inserts the account with value if it does not exist yet
+func mint(dbConnection execer, pkhash []byte, value uint64) error {
+	if _, err := GetAccountInfo(dbConnection, pkhash); err != nil {
+		return InsertAccountIntoAccountBalanceTable(dbConnection, pkhash, value)
+	}
+	return MintAurumUpdateAccountBalanceTable(dbConnection, pkhash, value)
+}
+
+// applyMintContract advances the state nonce of the mint account signing c, credits its value to the recipient
+// and records it in the mint log under height
+func applyMintContract(dbConnection execer, height uint64, c *contracts.Contract) error {
+	encodedMintPublicKey, err := publickey.Encode(c.SenderPubKey)
+	if err != nil {
+		return err
+	}
+	mintPKH := hashing.New(encodedMintPublicKey)
+	mintAccountInfo, err := GetAccountInfo(dbConnection, mintPKH)
+	if err != nil {
+		if err := InsertAccountIntoAccountBalanceTable(dbConnection, mintPKH, 0); err != nil {
+			return errors.New("Failed to insert mint account into table: " + err.Error())
+		}
+		mintAccountInfo = &accountinfo.AccountInfo{}
+	}
+	_, err = dbConnection.Exec(sqlstatements.UPDATE_ACCOUNT_BALANCES_BY_PUB_KEY_HASH,
+		int(mintAccountInfo.Balance), int(mintAccountInfo.StateNonce+1), hex.EncodeToString(mintPKH))
+	if err != nil {
+		return errors.New("Failed to execute sqlUpdate for mint account")
+	}
+	if err := mint(dbConnection, c.RecipPubKeyHash, c.Value); err != nil {
+		return err
+	}
+	if _, err := dbConnection.Exec(sqlstatements.CREATE_MINT_LOG_TABLE); err != nil {
+		return errors.New("Failed to create mint_log table: " + err.Error())
+	}
+	if _, err := dbConnection.Exec(sqlstatements.INSERT_VALUES_INTO_MINT_LOG, height, hex.EncodeToString(c.RecipPubKeyHash), c.Value); err != nil {
+		return errors.New("Failed to insert into mint_log: " + err.Error())
+	}
+	return nil
+}
+
+// applyBurnContract deducts the value of c from its sender's balance, increments the sender's nonce
+// and records it in the burn log under height
+func applyBurnContract(dbConnection execer, height uint64, c *contracts.Contract) error {
+	encodedSenderPublicKey, err := publickey.Encode(c.SenderPubKey)
+	if err != nil {
+		return err
+	}
+	senderPKH := hashing.New(encodedSenderPublicKey)
+	senderAccountInfo, err := GetAccountInfo(dbConnection, senderPKH)
+	if err != nil {
+		return errors.New("Cannot find Sender's account")
+	}
+	if senderAccountInfo.Balance < c.Value {
+		return errors.New("Sender's balance is less than the burned amount")
+	}
+	_, err = dbConnection.Exec(sqlstatements.UPDATE_ACCOUNT_BALANCES_BY_PUB_KEY_HASH,
+		int(senderAccountInfo.Balance-c.Value), int(senderAccountInfo.StateNonce+1), hex.EncodeToString(senderPKH))
+	if err != nil {
+		return errors.New("Failed to execute sqlUpdate for sender")
+	}
+	if _, err := dbConnection.Exec(sqlstatements.CREATE_BURN_LOG_TABLE); err != nil {
+		return errors.New("Failed to create burn_log table: " + err.Error())
+	}
+	if _, err := dbConnection.Exec(sqlstatements.INSERT_VALUES_INTO_BURN_LOG, height, hex.EncodeToString(senderPKH), c.Value); err != nil {
+		return errors.New("Failed to insert into burn_log: " + err.Error())
+	}
+	return nil
+}
+
+// MintEntry is a mint contract applied to the accounts table
+type MintEntry struct {
+	Height    uint64
+	Recipient []byte
+	Value     uint64
+}
+
+// GetMintLog returns every mint contract applied to the accounts table, oldest first
+func GetMintLog(dbConnection *sql.DB) ([]MintEntry, error) {
+	if _, err := dbConnection.Exec(sqlstatements.CREATE_MINT_LOG_TABLE); err != nil {
+		return nil, errors.New("Failed to create mint_log table: " + err.Error())
+	}
+	rows, err := dbConnection.Query(sqlstatements.GET_EVERYTHING_FROM_MINT_LOG)
+	if err != nil {
+		return nil, errors.New("Failed to query mint_log: " + err.Error())
+	}
+	defer rows.Close()
+	var entries []MintEntry
+	for rows.Next() {
+		var entry MintEntry
+		var recipient string
+		if err := rows.Scan(&entry.Height, &recipient, &entry.Value); err != nil {
+			return nil, errors.New("Failed to scan mint_log: " + err.Error())
+		}
+		if entry.Recipient, err = hex.DecodeString(recipient); err != nil {
+			return nil, errors.New("Failed to decode mint recipient: " + err.Error())
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// GetMintedBetween returns the value of the mint contracts applied in the blocks from fromHeight to toHeight inclusive
+func GetMintedBetween(dbConnection *sql.DB, fromHeight uint64, toHeight uint64) (uint64, error) {
+	if _, err := dbConnection.Exec(sqlstatements.CREATE_MINT_LOG_TABLE); err != nil {
+		return 0, errors.New("Failed to create mint_log table: " + err.Error())
+	}
+	var minted uint64
+	if err := dbConnection.QueryRow(sqlstatements.GET_SUM_OF_VALUES_FROM_MINT_LOG_BETWEEN, fromHeight, toHeight).Scan(&minted); err != nil {
+		return 0, errors.New("Failed to sum mint_log: " + err.Error())
+	}
+	return minted, nil
+}
+
+// GetBurnedBetween returns the value of the burn contracts applied in the blocks from fromHeight to toHeight inclusive
+func GetBurnedBetween(dbConnection *sql.DB, fromHeight uint64, toHeight uint64) (uint64, error) {
+	if _, err := dbConnection.Exec(sqlstatements.CREATE_BURN_LOG_TABLE); err != nil {
+		return 0, errors.New("Failed to create burn_log table: " + err.Error())
+	}
+	var burned uint64
+	if err := dbConnection.QueryRow(sqlstatements.GET_SUM_OF_VALUES_FROM_BURN_LOG_BETWEEN, fromHeight, toHeight).Scan(&burned); err != nil {
+		return 0, errors.New("Failed to sum burn_log: " + err.Error())
+	}
+	return burned, nil
+}
+
+// recordBeforeImages saves the balance and nonce of every sender and recipient in the undo log under height.
+// Accounts that do not exist yet are saved as such, so reverting the block deletes them
+func recordBeforeImages(dbConnection execer, height uint64, blockContracts []contracts.Contract) error {
+	if _, err := dbConnection.Exec(sqlstatements.CREATE_UNDO_LOG_TABLE); err != nil {
+		return errors.New("Failed to create undo_log table: " + err.Error())
+	}
+	var pkhashes [][]byte
+	for _, contract := range blockContracts {
+		if contract.SenderPubKey != nil {
+			encodedSenderPublicKey, err := publickey.Encode(contract.SenderPubKey)
+			if err != nil {
+				return err
+			}
+			pkhashes = append(pkhashes, hashing.New(encodedSenderPublicKey))
+		}
+		// burns have no recipient account
+		if !contract.IsBurn() {
+			pkhashes = append(pkhashes, contract.RecipPubKeyHash)
+		}
+	}
+	for _, pkhash := range pkhashes {
+		var balance, nonce uint64
+		existed := true
+		err := dbConnection.QueryRow(sqlstatements.GET_BALANCE_NONCE_FROM_ACCOUNT_BALANCES_BY_PUB_KEY_HASH, hex.EncodeToString(pkhash)).Scan(&balance, &nonce)
+		if err == sql.ErrNoRows {
+			existed = false
+		} else if err != nil {
+			return errors.New("Failed to read account for undo log: " + err.Error())
+		}
+		// The first image of an account in a block wins, as it holds the state before the block
+		if _, err := dbConnection.Exec(sqlstatements.INSERT_OR_IGNORE_INTO_UNDO_LOG, height, hex.EncodeToString(pkhash), balance, nonce, existed); err != nil {
+			return errors.New("Failed to insert into undo_log: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// HasUndoLog returns whether the undo log has been created, which is not the case for accounts
+// tables that were only written before undo logging was introduced
+func HasUndoLog(dbConnection *sql.DB) (bool, error) {
+	var name string
+	err := dbConnection.QueryRow(sqlstatements.GET_UNDO_LOG_TABLE_NAME).Scan(&name)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+/*
+Revert every block above height applied with ApplyBlock
+Accounts are restored from the undo log, youngest block first, and the undo log, mint log and burn log above height are removed
+*/
+func RevertTo(dbConnection *sql.DB, height uint64) error {
+	if _, err := dbConnection.Exec(sqlstatements.CREATE_UNDO_LOG_TABLE); err != nil {
+		return errors.New("Failed to create undo_log table: " + err.Error())
+	}
+	if _, err := dbConnection.Exec(sqlstatements.CREATE_MINT_LOG_TABLE); err != nil {
+		return errors.New("Failed to create mint_log table: " + err.Error())
+	}
+	if _, err := dbConnection.Exec(sqlstatements.CREATE_BURN_LOG_TABLE); err != nil {
+		return errors.New("Failed to create burn_log table: " + err.Error())
+	}
+	type beforeImage struct {
+		pkhash  string
+		balance uint64
+		nonce   uint64
+		existed bool
+	}
+	rows, err := dbConnection.Query(sqlstatements.GET_UNDO_LOG_ABOVE_HEIGHT, height)
+	if err != nil {
+		return errors.New("Failed to query undo_log: " + err.Error())
+	}
+	var images []beforeImage
+	for rows.Next() {
+		var image beforeImage
+		if err := rows.Scan(&image.pkhash, &image.balance, &image.nonce, &image.existed); err != nil {
+			rows.Close()
+			return errors.New("Failed to scan undo_log: " + err.Error())
+		}
+		images = append(images, image)
+	}
+	rows.Close()
+
+	tx, err := dbConnection.Begin()
+	if err != nil {
+		return errors.New("Failed to begin transaction: " + err.Error())
+	}
+	for _, image := range images {
+		if image.existed {
+			_, err = tx.Exec(sqlstatements.UPDATE_ACCOUNT_BALANCES_BY_PUB_KEY_HASH, image.balance, image.nonce, image.pkhash)
+		} else {
+			_, err = tx.Exec(sqlstatements.DELETE_ACCOUNT_FROM_ACCOUNT_BALANCES, image.pkhash)
+		}
+		if err != nil {
+			tx.Rollback()
+			return errors.New("Failed to restore account " + image.pkhash + ": " + err.Error())
+		}
+	}
+	if _, err := tx.Exec(sqlstatements.DELETE_UNDO_LOG_ABOVE_HEIGHT, height); err != nil {
+		tx.Rollback()
+		return errors.New("Failed to delete undo_log: " + err.Error())
+	}
+	if _, err := tx.Exec(sqlstatements.DELETE_MINT_LOG_ABOVE_HEIGHT, height); err != nil {
+		tx.Rollback()
+		return errors.New("Failed to delete mint_log: " + err.Error())
+	}
+	if _, err := tx.Exec(sqlstatements.DELETE_BURN_LOG_ABOVE_HEIGHT, height); err != nil {
+		tx.Rollback()
+		return errors.New("Failed to delete burn_log: " + err.Error())
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.New("Failed to commit revert: " + err.Error())
+	}
+	return nil
+}
+
 /*calculates and inserts accounts' balance and nonce into the account balance table
   NOTE: the db connection passed in should be open
 */
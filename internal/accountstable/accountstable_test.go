@@ -12,6 +12,7 @@ import (
 	"testing"
 
 	"github.com/SIGBlockchain/project_aurum/internal/accountinfo"
+	"github.com/SIGBlockchain/project_aurum/internal/block"
 	"github.com/SIGBlockchain/project_aurum/internal/constants"
 	"github.com/SIGBlockchain/project_aurum/internal/contracts"
 	"github.com/SIGBlockchain/project_aurum/internal/hashing"
@@ -426,3 +427,136 @@ func TestGetAccountInfo(t *testing.T) {
 		})
 	}
 }
+
+func TestApplyBlock(t *testing.T) {
+	dbName := constants.AccountsTable
+	dbc, _ := sql.Open("sqlite3", dbName)
+	defer func() {
+		if err := dbc.Close(); err != nil {
+			t.Errorf("Failed to close database: %s", err)
+		}
+		if err := os.Remove(dbName); err != nil {
+			t.Errorf("Failed to remove database: %s", err)
+		}
+	}()
+	statement, _ := dbc.Prepare(sqlstatements.CREATE_ACCOUNT_BALANCES_TABLE)
+	statement.Exec()
+
+	senderKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	encodedSenderPublicKey, _ := publickey.Encode(&senderKey.PublicKey)
+	senderPKH := hashing.New(encodedSenderPublicKey)
+	recipientPKH := hashing.New([]byte("recipient"))
+
+	mintContract, _ := contracts.New(1, nil, senderPKH, 1000, 0)
+	// A nil-sender contract of no value, such as a genesis spec commitment, creates no account
+	specHash := hashing.New([]byte("spec"))
+	commitment, _ := contracts.New(1, nil, specHash, 0, 0)
+	genesisBlock, _ := block.New(1, 0, make([]byte, 32), []contracts.Contract{*mintContract, *commitment})
+	if err := ApplyBlock(dbc, &genesisBlock); err != nil {
+		t.Fatalf("failed to apply genesis block: %v", err)
+	}
+	if _, err := GetAccountInfo(dbc, specHash); err == nil {
+		t.Errorf("expected no account for a contract of no value")
+	}
+
+	first, _ := contracts.New(1, senderKey, recipientPKH, 300, 1)
+	first.Sign(senderKey)
+	second, _ := contracts.New(1, senderKey, recipientPKH, 200, 2)
+	second.Sign(senderKey)
+	// Minting to an existing account credits it
+	reward, _ := contracts.New(1, nil, senderPKH, 50, 1)
+	b, _ := block.New(1, 1, block.HashBlock(genesisBlock), []contracts.Contract{*first, *second, *reward})
+	if err := ApplyBlock(dbc, &b); err != nil {
+		t.Fatalf("failed to apply block: %v", err)
+	}
+
+	senderInfo, _ := GetAccountInfo(dbc, senderPKH)
+	if !reflect.DeepEqual(*senderInfo, accountinfo.AccountInfo{Balance: 550, StateNonce: 3}) {
+		t.Errorf("unexpected sender account info: %+v", *senderInfo)
+	}
+	recipientInfo, _ := GetAccountInfo(dbc, recipientPKH)
+	if recipientInfo == nil || recipientInfo.Balance != 500 {
+		t.Errorf("unexpected recipient account info: %+v", recipientInfo)
+	}
+
+	// A block whose last contract fails leaves the accounts and undo log as they were
+	third, _ := contracts.New(1, senderKey, recipientPKH, 100, 3)
+	third.Sign(senderKey)
+	overburn, _ := contracts.NewBurn(senderKey, 5000, 4)
+	overburn.Sign(senderKey)
+	failing, _ := block.New(1, 2, block.HashBlock(b), []contracts.Contract{*third, *overburn})
+	if err := ApplyBlock(dbc, &failing); err == nil {
+		t.Fatalf("expected block with an invalid burn to fail")
+	}
+	senderInfo, _ = GetAccountInfo(dbc, senderPKH)
+	if !reflect.DeepEqual(*senderInfo, accountinfo.AccountInfo{Balance: 550, StateNonce: 3}) {
+		t.Errorf("expected sender account unchanged by the failed block, got %+v", *senderInfo)
+	}
+	rows, err := dbc.Query(sqlstatements.GET_UNDO_LOG_ABOVE_HEIGHT, 1)
+	if err != nil {
+		t.Fatalf("failed to query undo log: %v", err)
+	}
+	if rows.Next() {
+		t.Errorf("expected no undo log for the failed block")
+	}
+	rows.Close()
+}
+
+func TestRevertTo(t *testing.T) {
+	dbName := constants.AccountsTable
+	dbc, _ := sql.Open("sqlite3", dbName)
+	defer func() {
+		if err := dbc.Close(); err != nil {
+			t.Errorf("Failed to close database: %s", err)
+		}
+		if err := os.Remove(dbName); err != nil {
+			t.Errorf("Failed to remove database: %s", err)
+		}
+	}()
+	statement, _ := dbc.Prepare(sqlstatements.CREATE_ACCOUNT_BALANCES_TABLE)
+	statement.Exec()
+
+	senderKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	encodedSenderPublicKey, _ := publickey.Encode(&senderKey.PublicKey)
+	senderPKH := hashing.New(encodedSenderPublicKey)
+	recipientPKH := hashing.New([]byte("recipient"))
+
+	mintContract, _ := contracts.New(1, nil, senderPKH, 1000, 0)
+	genesisBlock, _ := block.New(1, 0, make([]byte, 32), []contracts.Contract{*mintContract})
+	if err := ApplyBlock(dbc, &genesisBlock); err != nil {
+		t.Fatalf("failed to apply genesis block: %v", err)
+	}
+	parent := genesisBlock
+	for i := uint64(1); i <= 3; i++ {
+		contract, _ := contracts.New(1, senderKey, recipientPKH, 100, i)
+		contract.Sign(senderKey)
+		b, _ := block.New(1, i, block.HashBlock(parent), []contracts.Contract{*contract})
+		if err := ApplyBlock(dbc, &b); err != nil {
+			t.Fatalf("failed to apply block #%d: %v", i, err)
+		}
+		parent = b
+	}
+
+	if err := RevertTo(dbc, 1); err != nil {
+		t.Fatalf("RevertTo() error = %v", err)
+	}
+	senderInfo, _ := GetAccountInfo(dbc, senderPKH)
+	if !reflect.DeepEqual(*senderInfo, accountinfo.AccountInfo{Balance: 900, StateNonce: 1}) {
+		t.Errorf("unexpected sender account info after reverting to block #1: %+v", *senderInfo)
+	}
+	recipientInfo, _ := GetAccountInfo(dbc, recipientPKH)
+	if !reflect.DeepEqual(*recipientInfo, accountinfo.AccountInfo{Balance: 100, StateNonce: 0}) {
+		t.Errorf("unexpected recipient account info after reverting to block #1: %+v", *recipientInfo)
+	}
+
+	// The recipient's account was created by block #1, so reverting it removes the account
+	if err := RevertTo(dbc, 0); err != nil {
+		t.Fatalf("RevertTo() error = %v", err)
+	}
+	if _, err := GetAccountInfo(dbc, recipientPKH); err == nil {
+		t.Errorf("expected recipient account to be removed after reverting to genesis")
+	}
+	if balance, _ := GetBalance(dbc, senderPKH); balance != 1000 {
+		t.Errorf("expected sender balance 1000 after reverting to genesis, got %d", balance)
+	}
+}
@@ -0,0 +1,134 @@
+// Package address encodes wallet addresses, the SHA-256 hashes of public keys, for people to read and type.
+// Addresses are encoded in bech32 (BIP-0173) with the human readable prefix aur, such as aur1qpzry9x8..., whose
+// checksum catches mistyped characters. Addresses in the raw 64 character hex form are still accepted
+package address
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+const (
+	// Prefix is the human readable part of addresses, identifying the network
+	Prefix = "aur"
+	// Length is the length in bytes of a wallet address
+	Length = 32
+
+	charset     = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+	separator   = "1"
+	checksumLen = 6
+)
+
+var generator = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+// Encode returns the bech32 encoding of the wallet address walletAddress
+func Encode(walletAddress []byte) string {
+	data := convertBits(walletAddress, 8, 5, true)
+	checksum := createChecksum(Prefix, data)
+	var sb strings.Builder
+	sb.WriteString(Prefix + separator)
+	for _, d := range append(data, checksum...) {
+		sb.WriteByte(charset[d])
+	}
+	return sb.String()
+}
+
+// Decode returns the wallet address encoded in s, either in bech32 with the Aurum prefix or as 64 hex characters
+func Decode(s string) ([]byte, error) {
+	if len(s) == 2*Length {
+		if walletAddress, err := hex.DecodeString(s); err == nil {
+			return walletAddress, nil
+		}
+	}
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return nil, errors.New("Invalid address: mixed case: " + s)
+	}
+	s = strings.ToLower(s)
+	sep := strings.LastIndex(s, separator)
+	if sep < 1 || sep+checksumLen+1 > len(s) {
+		return nil, errors.New("Invalid address: " + s)
+	}
+	if prefix := s[:sep]; prefix != Prefix {
+		return nil, errors.New("Invalid address: prefix " + prefix + " is not " + Prefix)
+	}
+	data := make([]byte, len(s)-sep-1)
+	for i, c := range s[sep+1:] {
+		d := strings.IndexRune(charset, c)
+		if d < 0 {
+			return nil, errors.New("Invalid address: invalid character " + string(c))
+		}
+		data[i] = byte(d)
+	}
+	if polymod(append(expandPrefix(Prefix), data...)) != 1 {
+		return nil, errors.New("Invalid address: checksum does not match, the address is mistyped: " + s)
+	}
+	walletAddress := convertBits(data[:len(data)-checksumLen], 5, 8, false)
+	if walletAddress == nil || len(walletAddress) != Length {
+		return nil, errors.New("Invalid address: wrong length: " + s)
+	}
+	return walletAddress, nil
+}
+
+// polymod returns the BCH checksum of values
+func polymod(values []byte) uint32 {
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+// expandPrefix returns the high bits of each character of prefix, a zero, and their low bits, as checksummed
+func expandPrefix(prefix string) []byte {
+	expanded := make([]byte, 0, 2*len(prefix)+1)
+	for i := 0; i < len(prefix); i++ {
+		expanded = append(expanded, prefix[i]>>5)
+	}
+	expanded = append(expanded, 0)
+	for i := 0; i < len(prefix); i++ {
+		expanded = append(expanded, prefix[i]&31)
+	}
+	return expanded
+}
+
+func createChecksum(prefix string, data []byte) []byte {
+	values := append(expandPrefix(prefix), data...)
+	mod := polymod(append(values, make([]byte, checksumLen)...)) ^ 1
+	checksum := make([]byte, checksumLen)
+	for i := range checksum {
+		checksum[i] = byte(mod >> uint(5*(5-i)) & 31)
+	}
+	return checksum
+}
+
+// convertBits regroups data from groups of fromBits bits into groups of toBits bits. Without padding,
+// leftover bits must be zero and fewer than fromBits, or nil is returned
+func convertBits(data []byte, fromBits, toBits uint, pad bool) []byte {
+	var acc uint32
+	var bits uint
+	maxv := uint32(1)<<toBits - 1
+	var converted []byte
+	for _, value := range data {
+		acc = acc<<fromBits | uint32(value)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			converted = append(converted, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			converted = append(converted, byte(acc<<(toBits-bits)&maxv))
+		}
+	} else if bits >= fromBits || acc<<(toBits-bits)&maxv != 0 {
+		return nil
+	}
+	return converted
+}
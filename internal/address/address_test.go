@@ -0,0 +1,68 @@
+package address
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/SIGBlockchain/project_aurum/internal/hashing"
+)
+
+// TestChecksum checks the bech32 checksum against valid strings of BIP-0173
+func TestChecksum(t *testing.T) {
+	for _, valid := range []string{
+		"a12uel5l",
+		"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw",
+		"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w",
+		"?1ezyfcl",
+	} {
+		sep := strings.LastIndex(valid, separator)
+		var data []byte
+		for _, c := range valid[sep+1:] {
+			data = append(data, byte(strings.IndexRune(charset, c)))
+		}
+		if polymod(append(expandPrefix(valid[:sep]), data...)) != 1 {
+			t.Errorf("expected %s to have a valid checksum", valid)
+		}
+		if checksum := createChecksum(valid[:sep], data[:len(data)-checksumLen]); !bytes.Equal(checksum, data[len(data)-checksumLen:]) {
+			t.Errorf("expected the checksum of %s to be recreated", valid)
+		}
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	walletAddress := hashing.New([]byte("wallet"))
+	encoded := Encode(walletAddress)
+	if !strings.HasPrefix(encoded, Prefix+"1") || len(encoded) != 62 {
+		t.Errorf("unexpected encoding %s", encoded)
+	}
+	for _, s := range []string{encoded, strings.ToUpper(encoded), hex.EncodeToString(walletAddress)} {
+		if decoded, err := Decode(s); err != nil || !bytes.Equal(decoded, walletAddress) {
+			t.Errorf("expected %s to decode to the address: %v", s, err)
+		}
+	}
+
+	// Changing any character is caught by the checksum
+	for i := len(Prefix) + 1; i < len(encoded); i++ {
+		typo := []byte(encoded)
+		typo[i] = charset[(strings.IndexByte(charset, typo[i])+1)%len(charset)]
+		if _, err := Decode(string(typo)); err == nil {
+			t.Errorf("expected the typo at %d in %s to be caught", i, typo)
+		}
+	}
+
+	for _, invalid := range []string{
+		"",
+		"aur1",
+		strings.Replace(encoded, Prefix, "tb", 1),
+		encoded[:10] + strings.ToUpper(encoded[10:]),
+		encoded[:len(encoded)-1] + "b",
+		hex.EncodeToString(walletAddress[:31]),
+		Encode(walletAddress[:20]),
+	} {
+		if _, err := Decode(invalid); err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
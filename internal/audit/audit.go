@@ -0,0 +1,325 @@
+// Package audit checks a node's data directory against its ledger file. It replays every block of the
+// ledger from genesis into a scratch accounts table and compares the result with the node's own tables
+package audit
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/SIGBlockchain/project_aurum/internal/accountstable"
+	"github.com/SIGBlockchain/project_aurum/internal/block"
+	"github.com/SIGBlockchain/project_aurum/internal/hashing"
+	"github.com/SIGBlockchain/project_aurum/internal/monetary"
+	"github.com/SIGBlockchain/project_aurum/internal/sqlstatements"
+)
+
+// Checks reported in a Problem
+const (
+	CheckLedger   = "ledger"   // the ledger file cannot be read
+	CheckHeight   = "height"   // a block is not at the height its position in the ledger implies
+	CheckLink     = "link"     // a block's previous hash is not the hash of the block before it
+	CheckMerkle   = "merkle"   // a block's merkle root is not the root of its contracts
+	CheckReplay   = "replay"   // a block cannot be applied to the accounts replayed so far
+	CheckPolicy   = "policy"   // a block's reward or mint contracts break the monetary policy
+	CheckMetadata = "metadata" // metadata.db does not match the ledger
+	CheckAccount  = "account"  // accounts.db does not match the replayed accounts
+	CheckSupply   = "supply"   // the balances do not add up to the aurum the monetary policy allows
+)
+
+// Problem is a discrepancy found by Run. Height is set for problems with a block and Account,
+// the hex encoded public key hash, for problems with an account
+type Problem struct {
+	Check   string
+	Height  *uint64 `json:",omitempty"`
+	Account string  `json:",omitempty"`
+	Detail  string
+}
+
+// Report is the outcome of an audit
+type Report struct {
+	OK       bool   // no problems were found
+	Blocks   uint64 // blocks read from the ledger file
+	Accounts int    // accounts after replaying every block
+	Supply   monetary.Supply
+	Balances uint64 // sum of the balances in accounts.db
+	Problems []Problem
+}
+
+type metadataEntry struct {
+	position int64
+	size     int
+	hash     []byte
+}
+
+type accountState struct {
+	balance uint64
+	nonce   uint64
+}
+
+/*
+Run reads every block of ledger from the start and checks its height, its link to the block before it and its merkle root.
+Each block is applied to scratch, an empty accounts database, which afterwards must match accounts; the position,
+size and hash of each block must match metadata. The reward and mint contracts of each block are checked against
+policy, and after each block the replayed balances must add up to the supply policy allows, as when a node connects
+the block. Finally the balances in accounts must add up to the aurum minted less the aurum burned by the ledger.
+
+Run only reads ledger, metadata and accounts. Discrepancies are reported in the Report; an error means the audit
+could not be carried out
+*/
+func Run(ledger io.Reader, metadata *sql.DB, accounts *sql.DB, scratch *sql.DB, policy monetary.Policy) (Report, error) {
+	for _, statement := range []string{sqlstatements.CREATE_ACCOUNT_BALANCES_TABLE, sqlstatements.CREATE_UNDO_LOG_TABLE,
+		sqlstatements.CREATE_MINT_LOG_TABLE, sqlstatements.CREATE_BURN_LOG_TABLE} {
+		if _, err := scratch.Exec(statement); err != nil {
+			return Report{}, errors.New("Failed to set up scratch accounts table: " + err.Error())
+		}
+	}
+
+	var report Report
+	var expectedMetadata []metadataEntry
+	var previousHash []byte
+	var genesisSupply uint64
+	replaying := true
+	var position int64
+	for {
+		serialized, err := readBlock(ledger)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			report.addProblem(CheckLedger, &report.Blocks, "", fmt.Sprintf("at byte %d: %v", position, err))
+			break
+		}
+		b, err := deserialize(serialized)
+		if err != nil {
+			report.addProblem(CheckLedger, &report.Blocks, "", fmt.Sprintf("at byte %d: %v", position, err))
+			break
+		}
+		height := report.Blocks
+		hash := block.HashBlock(b)
+		expectedMetadata = append(expectedMetadata, metadataEntry{position, len(serialized), hash})
+		position += int64(4 + len(serialized))
+		report.Blocks++
+
+		if b.Height != height {
+			report.addProblem(CheckHeight, &height, "", fmt.Sprintf("block claims height %d", b.Height))
+		}
+		if height == 0 {
+			previousHash = make([]byte, 32)
+		}
+		if !bytes.Equal(b.PreviousHash, previousHash) {
+			report.addProblem(CheckLink, &height, "", fmt.Sprintf("previous hash is %s, expected %s",
+				hex.EncodeToString(b.PreviousHash), hex.EncodeToString(previousHash)))
+		}
+		previousHash = hash
+		if merkleRoot := hashing.GetMerkleRootHash(b.Data); !bytes.Equal(b.MerkleRootHash, padHash(merkleRoot)) {
+			report.addProblem(CheckMerkle, &height, "", fmt.Sprintf("merkle root is %s, expected %s",
+				hex.EncodeToString(b.MerkleRootHash), hex.EncodeToString(merkleRoot)))
+		}
+		if err := report.Supply.Add(b); err != nil {
+			report.addProblem(CheckReplay, &height, "", err.Error())
+			replaying = false
+		}
+		// once a block fails to apply the replayed accounts are meaningless, but the ledger is still checked
+		if replaying && height > 0 {
+			if err := policy.ValidateReward(b); err != nil {
+				report.addProblem(CheckPolicy, &height, "", err.Error())
+			}
+			if err := policy.ValidateMints(scratch, b); err != nil {
+				report.addProblem(CheckPolicy, &height, "", err.Error())
+			}
+		}
+		if replaying {
+			if err := accountstable.ApplyBlock(scratch, &b); err != nil {
+				report.addProblem(CheckReplay, &height, "", err.Error())
+				replaying = false
+			} else if height == 0 {
+				if genesisSupply, err = monetary.GenesisSupply(b); err != nil {
+					report.addProblem(CheckReplay, &height, "", err.Error())
+					replaying = false
+				}
+			} else if err := policy.CheckSupply(scratch, genesisSupply, height); err != nil {
+				report.addProblem(CheckSupply, &height, "", err.Error())
+			}
+		}
+	}
+
+	if err := report.checkMetadata(metadata, expectedMetadata); err != nil {
+		return Report{}, err
+	}
+	if err := report.checkAccounts(accounts, scratch, replaying); err != nil {
+		return Report{}, err
+	}
+	report.OK = len(report.Problems) == 0
+	return report, nil
+}
+
+// readBlock reads the next serialized block from the ledger file, which holds each block after its length
+// as a little endian uint32. At the end of the ledger it returns io.EOF
+func readBlock(ledger io.Reader) ([]byte, error) {
+	length := make([]byte, 4)
+	if _, err := io.ReadFull(ledger, length); err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		return nil, errors.New("Failed to read block length: " + err.Error())
+	}
+	serialized := make([]byte, binary.LittleEndian.Uint32(length))
+	if _, err := io.ReadFull(ledger, serialized); err != nil {
+		return nil, errors.New("Failed to read block: " + err.Error())
+	}
+	return serialized, nil
+}
+
+// deserialize deserializes a block read from the ledger file, which may be corrupt
+func deserialize(serialized []byte) (block.Block, error) {
+	b, err := block.Deserialize(serialized)
+	if err != nil {
+		return block.Block{}, errors.New("Failed to deserialize block: " + err.Error())
+	}
+	return b, nil
+}
+
+// padHash pads the empty merkle root of a block without contracts to the 32 zero bytes stored in the ledger
+func padHash(hash []byte) []byte {
+	if len(hash) == 0 {
+		return make([]byte, 32)
+	}
+	return hash
+}
+
+func (r *Report) addProblem(check string, height *uint64, account string, detail string) {
+	var h *uint64
+	if height != nil {
+		heightCopy := *height
+		h = &heightCopy
+	}
+	r.Problems = append(r.Problems, Problem{check, h, account, detail})
+}
+
+// checkMetadata compares every row of the metadata table with the block at its height in the ledger
+func (r *Report) checkMetadata(metadata *sql.DB, expected []metadataEntry) error {
+	rows, err := metadata.Query(sqlstatements.GET_EVERYTHING_FROM_METADATA)
+	if err != nil {
+		return errors.New("Failed to query metadata table: " + err.Error())
+	}
+	defer rows.Close()
+
+	seen := make([]bool, len(expected))
+	for rows.Next() {
+		var height uint64
+		var entry metadataEntry
+		if err := rows.Scan(&height, &entry.position, &entry.size, &entry.hash); err != nil {
+			return errors.New("Failed to scan metadata row: " + err.Error())
+		}
+		if height >= uint64(len(expected)) {
+			r.addProblem(CheckMetadata, &height, "", "metadata has a block the ledger does not have")
+			continue
+		}
+		seen[height] = true
+		want := expected[height]
+		if entry.position != want.position || entry.size != want.size {
+			r.addProblem(CheckMetadata, &height, "", fmt.Sprintf("metadata has the block at byte %d with size %d, ledger at byte %d with size %d",
+				entry.position, entry.size, want.position, want.size))
+		}
+		if !bytes.Equal(entry.hash, want.hash) {
+			r.addProblem(CheckMetadata, &height, "", fmt.Sprintf("metadata has hash %s, ledger block hashes to %s",
+				hex.EncodeToString(entry.hash), hex.EncodeToString(want.hash)))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return errors.New("Failed to read metadata table: " + err.Error())
+	}
+	for height := range seen {
+		if !seen[height] {
+			h := uint64(height)
+			r.addProblem(CheckMetadata, &h, "", "metadata is missing the block")
+		}
+	}
+	return nil
+}
+
+// checkAccounts compares accounts with the replayed accounts in scratch, unless replaying failed,
+// and checks that the balances of both add up to the circulating supply
+func (r *Report) checkAccounts(accounts *sql.DB, scratch *sql.DB, replayed bool) error {
+	actual, err := readAccounts(accounts)
+	if err != nil {
+		return err
+	}
+	for _, state := range actual {
+		r.Balances += state.balance
+	}
+	if r.Balances != r.Supply.Circulating {
+		r.addProblem(CheckSupply, nil, "", fmt.Sprintf("balances in accounts.db add up to %d aurum, the ledger has %d in circulation",
+			r.Balances, r.Supply.Circulating))
+	}
+	if !replayed {
+		return nil
+	}
+
+	expected, err := readAccounts(scratch)
+	if err != nil {
+		return err
+	}
+	r.Accounts = len(expected)
+	if replayedSupply, err := monetary.TotalSupply(scratch); err != nil {
+		return err
+	} else if replayedSupply != r.Supply.Circulating {
+		r.addProblem(CheckSupply, nil, "", fmt.Sprintf("replayed balances add up to %d aurum, the ledger has %d in circulation",
+			replayedSupply, r.Supply.Circulating))
+	}
+
+	var addresses []string
+	for address := range expected {
+		addresses = append(addresses, address)
+	}
+	for address := range actual {
+		if _, ok := expected[address]; !ok {
+			addresses = append(addresses, address)
+		}
+	}
+	sort.Strings(addresses)
+	for _, address := range addresses {
+		want, inLedger := expected[address]
+		got, inTable := actual[address]
+		switch {
+		case !inTable:
+			r.addProblem(CheckAccount, nil, address, fmt.Sprintf("accounts.db is missing the account with balance %d and state nonce %d",
+				want.balance, want.nonce))
+		case !inLedger:
+			r.addProblem(CheckAccount, nil, address, "accounts.db has an account the ledger never created")
+		case got != want:
+			r.addProblem(CheckAccount, nil, address, fmt.Sprintf("accounts.db has balance %d and state nonce %d, expected %d and %d",
+				got.balance, got.nonce, want.balance, want.nonce))
+		}
+	}
+	return nil
+}
+
+// readAccounts returns the balance and state nonce of every account in an accounts table by hex encoded public key hash
+func readAccounts(accounts *sql.DB) (map[string]accountState, error) {
+	rows, err := accounts.Query(sqlstatements.GET_PUB_KEY_HASH_BALANCE_NONCE_FROM_ACCOUNT_BALANCES)
+	if err != nil {
+		return nil, errors.New("Failed to query accounts table: " + err.Error())
+	}
+	defer rows.Close()
+
+	states := make(map[string]accountState)
+	for rows.Next() {
+		var address string
+		var state accountState
+		if err := rows.Scan(&address, &state.balance, &state.nonce); err != nil {
+			return nil, errors.New("Failed to scan accounts row: " + err.Error())
+		}
+		states[address] = state
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.New("Failed to read accounts table: " + err.Error())
+	}
+	return states, nil
+}
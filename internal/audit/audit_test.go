@@ -0,0 +1,176 @@
+package audit
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/SIGBlockchain/project_aurum/internal/accountstable"
+	"github.com/SIGBlockchain/project_aurum/internal/block"
+	"github.com/SIGBlockchain/project_aurum/internal/blockchain"
+	"github.com/SIGBlockchain/project_aurum/internal/constants"
+	"github.com/SIGBlockchain/project_aurum/internal/contracts"
+	"github.com/SIGBlockchain/project_aurum/internal/hashing"
+	"github.com/SIGBlockchain/project_aurum/internal/monetary"
+	"github.com/SIGBlockchain/project_aurum/internal/publickey"
+	"github.com/SIGBlockchain/project_aurum/internal/sqlstatements"
+)
+
+// setUp creates a data directory whose ledger holds a genesis block and a block with a transfer, a burn, a mint
+// and its reward, and returns it with the monetary policy of the ledger
+func setUp(t *testing.T) (string, []byte, monetary.Policy) {
+	dir, err := ioutil.TempDir("", "aurum_audit")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	encodedKey, _ := publickey.Encode(&key.PublicKey)
+	sender := hashing.New(encodedKey)
+	recipient := hashing.New([]byte("recipient"))
+	mintKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	encodedMintKey, _ := publickey.Encode(&mintKey.PublicKey)
+	policy := monetary.Policy{InitialReward: 50, MintAddr: hashing.New(encodedMintKey), MintCap: 100}
+
+	airdrop, _ := contracts.New(1, nil, sender, 1000, 0)
+	genesisBlock, _ := block.New(1, 0, make([]byte, 32), []contracts.Contract{*airdrop})
+	ledgerName := filepath.Join(dir, constants.BlockchainFile)
+	if err := blockchain.Airdrop(ledgerName, filepath.Join(dir, constants.MetadataTable), filepath.Join(dir, constants.AccountsTable), genesisBlock); err != nil {
+		t.Fatalf("failed to airdrop: %v", err)
+	}
+
+	transfer, _ := contracts.New(1, key, recipient, 100, 1)
+	transfer.Sign(key)
+	burn, _ := contracts.NewBurn(key, 50, 2)
+	burn.Sign(key)
+	mint, _ := contracts.New(constants.MintContractVersion, mintKey, recipient, 30, 1)
+	mint.Sign(mintKey)
+	reward, _ := policy.NewReward(1, policy.MintAddr)
+	b, _ := block.New(1, 1, block.HashBlock(genesisBlock), []contracts.Contract{*transfer, *burn, *mint, *reward})
+
+	ledgerFile, _ := os.OpenFile(ledgerName, os.O_APPEND|os.O_WRONLY, 0644)
+	defer ledgerFile.Close()
+	metadata, accounts := openDatabases(dir)
+	defer metadata.Close()
+	defer accounts.Close()
+	accounts.Exec(sqlstatements.CREATE_UNDO_LOG_TABLE)
+	accounts.Exec(sqlstatements.CREATE_BURN_LOG_TABLE)
+	accounts.Exec(sqlstatements.CREATE_MINT_LOG_TABLE)
+	if err := blockchain.AddBlock(b, ledgerFile, metadata); err != nil {
+		t.Fatalf("failed to add block: %v", err)
+	}
+	if err := accountstable.ApplyBlock(accounts, &b); err != nil {
+		t.Fatalf("failed to apply block: %v", err)
+	}
+	return dir, recipient, policy
+}
+
+func openDatabases(dir string) (*sql.DB, *sql.DB) {
+	metadata, _ := sql.Open("sqlite3", filepath.Join(dir, constants.MetadataTable))
+	accounts, _ := sql.Open("sqlite3", filepath.Join(dir, constants.AccountsTable))
+	return metadata, accounts
+}
+
+func runAudit(t *testing.T, dir string, policy monetary.Policy) Report {
+	ledgerFile, err := os.Open(filepath.Join(dir, constants.BlockchainFile))
+	if err != nil {
+		t.Fatalf("failed to open ledger: %v", err)
+	}
+	defer ledgerFile.Close()
+	metadata, accounts := openDatabases(dir)
+	defer metadata.Close()
+	defer accounts.Close()
+	scratch, _ := sql.Open("sqlite3", filepath.Join(dir, "scratch.db"))
+	defer scratch.Close()
+
+	report, err := Run(ledgerFile, metadata, accounts, scratch, policy)
+	if err != nil {
+		t.Fatalf("failed to run audit: %v", err)
+	}
+	return report
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(dir string, recipient []byte)
+		policy func(policy *monetary.Policy) // changes the policy the ledger is audited against
+		check  string
+	}{
+		{name: "consistent"},
+		{
+			name: "wrong balance",
+			tamper: func(dir string, recipient []byte) {
+				_, accounts := openDatabases(dir)
+				defer accounts.Close()
+				accounts.Exec(sqlstatements.UPDATE_ACCOUNT_BALANCES_BY_PUB_KEY_HASH, 150, 1, hex.EncodeToString(recipient))
+			},
+			check: CheckAccount,
+		},
+		{
+			name: "missing metadata",
+			tamper: func(dir string, recipient []byte) {
+				metadata, _ := openDatabases(dir)
+				defer metadata.Close()
+				metadata.Exec(sqlstatements.DELETE_METADATA_ABOVE_HEIGHT, 0)
+			},
+			check: CheckMetadata,
+		},
+		{
+			name: "truncated ledger",
+			tamper: func(dir string, recipient []byte) {
+				ledgerName := filepath.Join(dir, constants.BlockchainFile)
+				info, _ := os.Stat(ledgerName)
+				os.Truncate(ledgerName, info.Size()-1)
+			},
+			check: CheckLedger,
+		},
+		{
+			name:   "reward over the policy",
+			policy: func(policy *monetary.Policy) { policy.InitialReward = 20 },
+			check:  CheckPolicy,
+		},
+		{
+			name:   "mint over the cap",
+			policy: func(policy *monetary.Policy) { policy.MintCap = 10 },
+			check:  CheckPolicy,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, recipient, policy := setUp(t)
+			defer os.RemoveAll(dir)
+			if tt.tamper != nil {
+				tt.tamper(dir, recipient)
+			}
+			if tt.policy != nil {
+				tt.policy(&policy)
+			}
+
+			report := runAudit(t, dir, policy)
+			if tt.check == "" {
+				if !report.OK || report.Blocks != 2 || report.Accounts != 3 || report.Supply.Circulating != 1030 || report.Balances != 1030 {
+					t.Errorf("expected a clean report, got %+v", report)
+				}
+				return
+			}
+			if report.OK {
+				t.Fatalf("expected the audit to fail")
+			}
+			found := false
+			for _, problem := range report.Problems {
+				found = found || problem.Check == tt.check
+			}
+			if !found {
+				t.Errorf("expected a %s problem, got %+v", tt.check, report.Problems)
+			}
+		})
+	}
+}
@@ -2,7 +2,9 @@
 package block
 
 import (
-	"bytes"           // for hashing
+	"bytes" // for hashing
+	"crypto/ecdsa"
+	"crypto/rand"
 	"encoding/binary" // for converting to uints to byte slices
 	"encoding/hex"
 	"errors"
@@ -13,6 +15,7 @@ import (
 	"github.com/SIGBlockchain/project_aurum/internal/constants"
 	"github.com/SIGBlockchain/project_aurum/internal/contracts"
 	"github.com/SIGBlockchain/project_aurum/internal/hashing"
+	"github.com/SIGBlockchain/project_aurum/internal/publickey"
 )
 
 type BlockHeader struct {
@@ -21,6 +24,8 @@ type BlockHeader struct {
 	Timestamp      int64
 	PreviousHash   []byte
 	MerkleRootHash []byte
+	Producer       []byte
+	Signature      []byte
 }
 
 // Block is a struct that represents a block in a blockchain.
@@ -30,6 +35,8 @@ type Block struct {
 	Timestamp      int64    // Timestamp is the time of creation for this block
 	PreviousHash   []byte   // PreviousHash is the hash of the previous block in the blockchain,
 	MerkleRootHash []byte   // MerkleRootHash is the hash of the MerkleRoot of all inputs
+	Producer       []byte   // Producer is the public key hash of the producer, from constants.SignedBlockVersion on
+	Signature      []byte   // Signature is the producer's signature of HashBlock, from constants.SignedBlockVersion on
 	DataLen        uint16   // DataLen is the number of objects in the following Data variable
 	Data           [][]byte // Data is an abritrary variable, holding the actual contents of this block
 }
@@ -41,15 +48,35 @@ type JSONBlock struct {
 	Timestamp      int64
 	PreviousHash   string
 	MerkleRootHash string
+	Producer       string
+	Signature      string
 	DataLen        uint16
 	Data           []string
 }
 
+// Allows for easy Marshaling of a block header into a JSON string
+type JSONBlockHeader struct {
+	Version        uint16
+	Height         uint64
+	Timestamp      int64
+	PreviousHash   string
+	MerkleRootHash string
+	Producer       string
+	Signature      string
+}
+
 func (b *Block) GetHeader() BlockHeader {
-	return BlockHeader{b.Version, b.Height, b.Timestamp, b.PreviousHash, b.MerkleRootHash}
+	return BlockHeader{b.Version, b.Height, b.Timestamp, b.PreviousHash, b.MerkleRootHash, b.Producer, b.Signature}
 }
 
+// New returns a block holding data, timestamped with the current time
 func New(version uint16, height uint64, previousHash []byte, data []contracts.Contract) (Block, error) {
+	return NewAt(version, height, time.Now().UnixNano(), previousHash, data)
+}
+
+// NewAt returns a block holding data with the given timestamp in Unix nanoseconds, so that the same inputs
+// always give the same block
+func NewAt(version uint16, height uint64, timestamp int64, previousHash []byte, data []contracts.Contract) (Block, error) {
 	var serializedDatum [][]byte // A series of serialized data for Merkle root hash
 
 	for i := range data {
@@ -65,7 +92,7 @@ func New(version uint16, height uint64, previousHash []byte, data []contracts.Co
 	block := Block{
 		Version:        version,
 		Height:         height,
-		Timestamp:      time.Now().UnixNano(),
+		Timestamp:      timestamp,
 		PreviousHash:   previousHash,
 		MerkleRootHash: hashing.GetMerkleRootHash(serializedDatum),
 		DataLen:        uint16(len(data)),
@@ -75,6 +102,24 @@ func New(version uint16, height uint64, previousHash []byte, data []contracts.Co
 	return block, nil
 }
 
+// Sign sets the producer of the block to the public key hash of producer and signs the block's hash with it.
+// Only blocks from constants.SignedBlockVersion on can be signed
+func (b *Block) Sign(producer *ecdsa.PrivateKey) error {
+	if b.Version < constants.SignedBlockVersion {
+		return fmt.Errorf("blocks of version %d cannot be signed", b.Version)
+	}
+	encodedPublicKey, err := publickey.Encode(&producer.PublicKey)
+	if err != nil {
+		return errors.New("Failed to encode producer public key: " + err.Error())
+	}
+	b.Producer = hashing.New(encodedPublicKey)
+	b.Signature, err = producer.Sign(rand.Reader, HashBlock(*b), nil)
+	if err != nil {
+		return errors.New("Failed to sign block: " + err.Error())
+	}
+	return nil
+}
+
 // Produces a byte string based on the block struct provided
 //
 // Block Header Structure:
@@ -85,10 +130,18 @@ func New(version uint16, height uint64, previousHash []byte, data []contracts.Co
 //      Bytes 18-50 : Previous Hash
 //      Bytes 50-82 : Merkle Root Hash
 //      Bytes 82-84 : Data Length
+//
+// From constants.SignedBlockVersion on, the producer and signature precede the data length:
+//
+//      Bytes 82-114     : Producer
+//      Byte  114        : Signature Length (n)
+//      Bytes 115-115+n  : Signature
+//      Bytes 115+n-117+n: Data Length
 func (b *Block) Serialize() []byte { // Vineet
 	//calculate the total length beforehand, to prevent unneccessary appends
 	//NOTE: 32 bit ints are used to hold lengths; unsigned 16 bit int is used for the length of Data
-	bLen := 84 //size of all fixed size fields
+	headerLen := headerLength(b.Version, len(b.Signature))
+	bLen := headerLen + 2 //size of all fixed size fields
 	for _, s := range b.Data {
 		bLen += 2 + len(s) //2 bytes for length plus the length of an element in Data
 	}
@@ -100,9 +153,14 @@ func (b *Block) Serialize() []byte { // Vineet
 	binary.LittleEndian.PutUint64(serializedBlock[10:18], uint64(b.Timestamp))
 	copy(serializedBlock[18:50], b.PreviousHash)
 	copy(serializedBlock[50:82], b.MerkleRootHash)
-	binary.LittleEndian.PutUint16(serializedBlock[82:84], b.DataLen)
+	if b.Version >= constants.SignedBlockVersion {
+		copy(serializedBlock[82:114], b.Producer)
+		serializedBlock[114] = uint8(len(b.Signature))
+		copy(serializedBlock[115:headerLen], b.Signature)
+	}
+	binary.LittleEndian.PutUint16(serializedBlock[headerLen:headerLen+2], b.DataLen)
 
-	i := 84
+	i := headerLen + 2
 	for _, s := range b.Data {
 		//for every data entry, put the legth, and then the data
 		binary.LittleEndian.PutUint16(serializedBlock[i:i+2], uint16(len(s)))
@@ -113,19 +171,55 @@ func (b *Block) Serialize() []byte { // Vineet
 	return serializedBlock
 }
 
-// Converts a block in byte form into a block struct, returns the struct
-func Deserialize(block []byte) Block {
-	dataLen := binary.LittleEndian.Uint16(block[82:84])
+// Converts a block in byte form into a block struct, returns the struct.
+// It returns an error if the bytes are truncated, too long or hold a signature longer than any producer signature
+func Deserialize(block []byte) (Block, error) {
+	if len(block) < 2 {
+		return Block{}, errors.New("serialized block is truncated")
+	}
+	version := binary.LittleEndian.Uint16(block[0:2])
+	var producer, signature []byte
+	headerLen := headerLength(version, 0)
+	if version >= constants.SignedBlockVersion {
+		if len(block) <= constants.SignedBlockHeaderLength {
+			return Block{}, errors.New("serialized block is truncated")
+		}
+		sigLen := int(block[constants.SignedBlockHeaderLength])
+		if sigLen > constants.MaxBlockSignatureLength {
+			return Block{}, fmt.Errorf("block signature of %d bytes is longer than %d bytes", sigLen, constants.MaxBlockSignatureLength)
+		}
+		headerLen = headerLength(version, sigLen)
+		if len(block) < headerLen {
+			return Block{}, errors.New("serialized block is truncated")
+		}
+		producer = make([]byte, 32)
+		signature = make([]byte, sigLen)
+		copy(producer, block[82:114])
+		copy(signature, block[115:headerLen])
+	}
+	if len(block) < headerLen+2 {
+		return Block{}, errors.New("serialized block is truncated")
+	}
+	dataLen := binary.LittleEndian.Uint16(block[headerLen : headerLen+2])
 	data := make([][]byte, dataLen)
-	index := 84
+	index := headerLen + 2
 
 	for i := 0; i < int(dataLen); i++ { // deserialize each individual element in Data
+		if len(block) < index+2 {
+			return Block{}, errors.New("serialized block is truncated")
+		}
 		elementLen := int(binary.LittleEndian.Uint16(block[index : index+2]))
 		index += 2
+		if len(block) < index+elementLen {
+			return Block{}, errors.New("serialized block is truncated")
+		}
 		data[i] = make([]byte, elementLen)
 		copy(data[i], block[index:index+elementLen])
 		index += elementLen
 	}
+	if index != len(block) {
+		return Block{}, errors.New("serialized block has trailing bytes")
+	}
 
 	previousHash := make([]byte, 32)
 	merkleRootHash := make([]byte, 32)
@@ -133,15 +227,25 @@ func Deserialize(block []byte) Block {
 	copy(merkleRootHash, block[50:82])
 	// initialize the deserialized block
 	deserializeBlock := Block{
-		Version:        binary.LittleEndian.Uint16(block[0:2]),
+		Version:        version,
 		Height:         binary.LittleEndian.Uint64(block[2:10]),
 		Timestamp:      int64(binary.LittleEndian.Uint64(block[10:18])),
 		PreviousHash:   previousHash,
 		MerkleRootHash: merkleRootHash,
+		Producer:       producer,
+		Signature:      signature,
 		DataLen:        dataLen,
 		Data:           data,
 	}
-	return deserializeBlock
+	return deserializeBlock, nil
+}
+
+// headerLength returns the number of bytes before the data length of a serialized block
+func headerLength(version uint16, sigLen int) int {
+	if version >= constants.SignedBlockVersion {
+		return constants.SignedBlockHeaderLength + 1 + sigLen
+	}
+	return constants.BlockHeaderLength
 }
 
 // Compares two block structs and returns true if all the fields in both blocks are equal, false otherwise
@@ -184,27 +288,27 @@ func (b Block) ToString() string {
 	}
 
 	blockStr := fmt.Sprintf("Version: %v\nHeight: %v\nTimestamp: %v\n", b.Version, b.Height, b.Timestamp)
-	blockStr += prevHash + merkleHash + fmt.Sprintf("DataLen: %v\n", b.DataLen) + data
+	blockStr += prevHash + merkleHash
+	if b.Version >= constants.SignedBlockVersion {
+		blockStr += "Producer: " + hex.EncodeToString(b.Producer) + "\n" + "Signature: " + hex.EncodeToString(b.Signature) + "\n"
+	}
+	blockStr += fmt.Sprintf("DataLen: %v\n", b.DataLen) + data
 	return blockStr
 }
 
 // Concatenate all the fields of the block header and return its SHA256 hash
+// The signature is not part of the hash, as it signs the hash
 func HashBlock(b Block) []byte {
-	const blength = constants.BlockHeaderLength // calculate the total length of the slice
-	concatenated := make([]byte, blength)
-
-	// convert the known variables to byte slices in little endian and add to slice
-	binary.LittleEndian.PutUint16(concatenated[0:2], b.Version)
-	binary.LittleEndian.PutUint64(concatenated[2:10], b.Height)
-	binary.LittleEndian.PutUint64(concatenated[10:18], uint64(b.Timestamp))
-	copy(concatenated[18:50], b.PreviousHash)
-	copy(concatenated[50:82], b.MerkleRootHash)
-	return hashing.New(concatenated)
+	return HashBlockHeader(b.GetHeader())
 }
 
 // Concatenate all the fields of the block header and return its SHA256 hash
+// The signature is not part of the hash, as it signs the hash
 func HashBlockHeader(b BlockHeader) []byte {
-	const blength = constants.BlockHeaderLength // calculate the total length of the slice
+	blength := constants.BlockHeaderLength // calculate the total length of the slice
+	if b.Version >= constants.SignedBlockVersion {
+		blength = constants.SignedBlockHeaderLength
+	}
 	concatenated := make([]byte, blength)
 
 	// convert the known variables to byte slices in little endian and add to slice
@@ -213,6 +317,9 @@ func HashBlockHeader(b BlockHeader) []byte {
 	binary.LittleEndian.PutUint64(concatenated[10:18], uint64(b.Timestamp))
 	copy(concatenated[18:50], b.PreviousHash)
 	copy(concatenated[50:82], b.MerkleRootHash)
+	if b.Version >= constants.SignedBlockVersion {
+		copy(concatenated[82:114], b.Producer)
+	}
 	return hashing.New(concatenated)
 }
 
@@ -223,6 +330,8 @@ func (b *Block) Marshal() JSONBlock {
 		Timestamp:      b.Timestamp,
 		PreviousHash:   hex.EncodeToString(b.PreviousHash),
 		MerkleRootHash: hex.EncodeToString(b.MerkleRootHash),
+		Producer:       hex.EncodeToString(b.Producer),
+		Signature:      hex.EncodeToString(b.Signature),
 		DataLen:        b.DataLen,
 	}
 	jsonBlock.Data = make([]string, len(b.Data))
@@ -235,6 +344,9 @@ func (b *Block) Marshal() JSONBlock {
 
 // Unmarshal converts a JSONBlock to a Block
 func (jB *JSONBlock) Unmarshal() (Block, error) {
+	if int(jB.DataLen) != len(jB.Data) {
+		return Block{}, errors.New("data length does not match number of data entries")
+	}
 	blockData := make([][]byte, jB.DataLen)
 	for i, d := range jB.Data {
 		decodeData, err := hex.DecodeString(d)
@@ -247,7 +359,11 @@ func (jB *JSONBlock) Unmarshal() (Block, error) {
 	if err != nil {
 		return Block{}, err
 	}
-	decodeMerkleRootHash, err := hex.DecodeString(jB.PreviousHash)
+	decodeMerkleRootHash, err := hex.DecodeString(jB.MerkleRootHash)
+	if err != nil {
+		return Block{}, err
+	}
+	decodeProducer, decodeSignature, err := decodeProducerAndSignature(jB.Producer, jB.Signature)
 	if err != nil {
 		return Block{}, err
 	}
@@ -257,11 +373,70 @@ func (jB *JSONBlock) Unmarshal() (Block, error) {
 		Timestamp:      jB.Timestamp,
 		PreviousHash:   decodePreviousHash,
 		MerkleRootHash: decodeMerkleRootHash,
+		Producer:       decodeProducer,
+		Signature:      decodeSignature,
 		DataLen:        jB.DataLen,
 		Data:           blockData,
 	}, nil
 }
 
+// Marshal converts a BlockHeader to a JSONBlockHeader
+func (h BlockHeader) Marshal() JSONBlockHeader {
+	return JSONBlockHeader{
+		Version:        h.Version,
+		Height:         h.Height,
+		Timestamp:      h.Timestamp,
+		PreviousHash:   hex.EncodeToString(h.PreviousHash),
+		MerkleRootHash: hex.EncodeToString(h.MerkleRootHash),
+		Producer:       hex.EncodeToString(h.Producer),
+		Signature:      hex.EncodeToString(h.Signature),
+	}
+}
+
+// Unmarshal converts a JSONBlockHeader to a BlockHeader
+func (jH *JSONBlockHeader) Unmarshal() (BlockHeader, error) {
+	decodePreviousHash, err := hex.DecodeString(jH.PreviousHash)
+	if err != nil {
+		return BlockHeader{}, err
+	}
+	decodeMerkleRootHash, err := hex.DecodeString(jH.MerkleRootHash)
+	if err != nil {
+		return BlockHeader{}, err
+	}
+	decodeProducer, decodeSignature, err := decodeProducerAndSignature(jH.Producer, jH.Signature)
+	if err != nil {
+		return BlockHeader{}, err
+	}
+	return BlockHeader{
+		Version:        jH.Version,
+		Height:         jH.Height,
+		Timestamp:      jH.Timestamp,
+		PreviousHash:   decodePreviousHash,
+		MerkleRootHash: decodeMerkleRootHash,
+		Producer:       decodeProducer,
+		Signature:      decodeSignature,
+	}, nil
+}
+
+// decodeProducerAndSignature decodes the hex encoded producer and signature, which are empty in unsigned blocks
+func decodeProducerAndSignature(producer string, signature string) ([]byte, []byte, error) {
+	if producer == "" && signature == "" {
+		return nil, nil, nil
+	}
+	decodeProducer, err := hex.DecodeString(producer)
+	if err != nil {
+		return nil, nil, err
+	}
+	decodeSignature, err := hex.DecodeString(signature)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(decodeSignature) > constants.MaxBlockSignatureLength {
+		return nil, nil, fmt.Errorf("block signature of %d bytes is longer than %d bytes", len(decodeSignature), constants.MaxBlockSignatureLength)
+	}
+	return decodeProducer, decodeSignature, nil
+}
+
 // ExtractContractsFromBlock returns contract slice based on block data
 func ExtractContractsFromBlock(b Block) ([]*contracts.Contract, error) {
 	if b.DataLen == 0 {
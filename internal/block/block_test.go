@@ -12,6 +12,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/SIGBlockchain/project_aurum/internal/constants"
 	"github.com/SIGBlockchain/project_aurum/internal/contracts"
 	"github.com/SIGBlockchain/project_aurum/internal/hashing"
 	"github.com/SIGBlockchain/project_aurum/internal/publickey"
@@ -25,7 +26,7 @@ func TestSerialize(t *testing.T) {
 
 	// create the block
 	b := Block{
-		Version:        3,
+		Version:        1,
 		Height:         300,
 		PreviousHash:   []byte("guavapineapplemango1234567890abc"),
 		MerkleRootHash: []byte("grapewatermeloncoconut1emonsabcd"),
@@ -105,7 +106,10 @@ func TestDeserialize(t *testing.T) {
 	}
 	expected.DataLen = uint16(len(expected.Data))
 	intermed := expected.Serialize()
-	actual := Deserialize(intermed)
+	actual, err := Deserialize(intermed)
+	if err != nil {
+		t.Fatalf("failed to deserialize block: %v", err)
+	}
 	if !cmp.Equal(expected, actual) {
 		t.Errorf("Blocks do not match")
 	}
@@ -183,6 +187,21 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestNewAt(t *testing.T) {
+	someAirdropContract, _ := contracts.New(1, nil, hashing.New([]byte("recipient")), 1000, 0)
+	first, err := NewAt(1, 0, 42, make([]byte, 32), []contracts.Contract{*someAirdropContract})
+	if err != nil {
+		t.Fatalf("NewAt() error = %v", err)
+	}
+	second, _ := NewAt(1, 0, 42, make([]byte, 32), []contracts.Contract{*someAirdropContract})
+	if first.Timestamp != 42 {
+		t.Errorf("expected timestamp 42, got %d", first.Timestamp)
+	}
+	if !bytes.Equal(HashBlock(first), HashBlock(second)) {
+		t.Errorf("expected blocks with the same timestamp and data to have the same hash")
+	}
+}
+
 func TestBlock_GetHeader(t *testing.T) {
 	expected := Block{
 		Version:        1,
@@ -595,3 +614,118 @@ func TestExtractContractsFromBlock(t *testing.T) {
 		})
 	}
 }
+
+func TestMarshalUnmarshalBlockHeader(t *testing.T) {
+	testBlock := Block{
+		Version:        3,
+		Height:         300,
+		PreviousHash:   hashing.New([]byte("guava")),
+		MerkleRootHash: hashing.New([]byte("grape")),
+		Timestamp:      time.Now().UnixNano(),
+	}
+	header := testBlock.GetHeader()
+	jsonHeader := header.Marshal()
+	if jsonHeader.PreviousHash != hex.EncodeToString(header.PreviousHash) {
+		t.Errorf("Failed to encode PreviousHash. Expected: %v, got %v", hex.EncodeToString(header.PreviousHash), jsonHeader.PreviousHash)
+	}
+	actualHeader, err := jsonHeader.Unmarshal()
+	if err != nil {
+		t.Fatalf("Failed to unmarshal header: %v", err)
+	}
+	if !reflect.DeepEqual(actualHeader, header) {
+		t.Errorf("Headers do not match. Expected: %v, got %v", header, actualHeader)
+	}
+
+	jsonHeader.MerkleRootHash = "not hex"
+	if _, err := jsonHeader.Unmarshal(); err == nil {
+		t.Errorf("Expected error for invalid MerkleRootHash")
+	}
+}
+
+func TestSignedBlock(t *testing.T) {
+	producerKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	encodedProducerKey, _ := publickey.Encode(&producerKey.PublicKey)
+	b := Block{
+		Version:        constants.SignedBlockVersion,
+		Height:         3,
+		Timestamp:      time.Now().UnixNano(),
+		PreviousHash:   hashing.New([]byte{'x'}),
+		MerkleRootHash: hashing.New([]byte{'q'}),
+		DataLen:        2,
+		Data:           [][]byte{{12, 3}, {132, 90, 23}},
+	}
+	unsignedHash := HashBlock(b)
+	if err := b.Sign(producerKey); err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	if !bytes.Equal(b.Producer, hashing.New(encodedProducerKey)) {
+		t.Errorf("producer is not the public key hash of the signing key")
+	}
+	if bytes.Equal(HashBlock(b), unsignedHash) {
+		t.Errorf("expected the producer to be part of the block hash")
+	}
+	if !ecdsa.VerifyASN1(&producerKey.PublicKey, HashBlock(b), b.Signature) {
+		t.Errorf("signature does not verify against the block hash")
+	}
+
+	// The signature is not hashed, so the header hash matches the block hash
+	if !bytes.Equal(HashBlockHeader(b.GetHeader()), HashBlock(b)) {
+		t.Errorf("header hash does not match block hash")
+	}
+	if deserialized, err := Deserialize(b.Serialize()); err != nil || !cmp.Equal(b, deserialized) {
+		t.Errorf("signed block does not survive serialization: %v %v", err, cmp.Diff(b, deserialized))
+	}
+	jsonBlock := b.Marshal()
+	if unmarshalled, err := jsonBlock.Unmarshal(); err != nil || !cmp.Equal(b, unmarshalled) {
+		t.Errorf("signed block does not survive marshalling: %v", err)
+	}
+	jsonHeader := b.GetHeader().Marshal()
+	if unmarshalled, err := jsonHeader.Unmarshal(); err != nil || !cmp.Equal(b.GetHeader(), unmarshalled) {
+		t.Errorf("signed header does not survive marshalling: %v", err)
+	}
+
+	old := Block{Version: 1, PreviousHash: hashing.New([]byte{'x'}), MerkleRootHash: hashing.New([]byte{'q'})}
+	if err := old.Sign(producerKey); err == nil {
+		t.Errorf("expected a block of an unsigned version not to be signed")
+	}
+	if deserialized, err := Deserialize(old.Serialize()); err != nil || deserialized.Producer != nil || deserialized.Signature != nil {
+		t.Errorf("expected unsigned block to deserialize without producer and signature")
+	}
+}
+
+func TestDeserializeMalformed(t *testing.T) {
+	producerKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	signed, _ := New(constants.SignedBlockVersion, 1, hashing.New([]byte{'x'}), nil)
+	signed.Data = [][]byte{[]byte("data")}
+	signed.DataLen = 1
+	signed.Sign(producerKey)
+	serialized := signed.Serialize()
+
+	overlong := append([]byte{}, serialized...)
+	overlong[constants.SignedBlockHeaderLength] = constants.MaxBlockSignatureLength + 1
+	withTrailingBytes := append(append([]byte{}, serialized...), 0)
+	tests := []struct {
+		name       string
+		serialized []byte
+	}{
+		{"empty", nil},
+		{"truncated header", serialized[:constants.BlockHeaderLength]},
+		{"truncated signature", serialized[:constants.SignedBlockHeaderLength+2]},
+		{"truncated data", serialized[:len(serialized)-1]},
+		{"signature too long", overlong},
+		{"trailing bytes", withTrailingBytes},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Deserialize(tt.serialized); err == nil {
+				t.Errorf("expected malformed block to be rejected")
+			}
+		})
+	}
+
+	jsonBlock := signed.Marshal()
+	jsonBlock.Signature = hex.EncodeToString(make([]byte, constants.MaxBlockSignatureLength+1))
+	if _, err := jsonBlock.Unmarshal(); err == nil {
+		t.Errorf("expected a signature longer than any producer signature to be rejected")
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/SIGBlockchain/project_aurum/internal/accountstable"
 	block "github.com/SIGBlockchain/project_aurum/internal/block"
 	"github.com/SIGBlockchain/project_aurum/internal/contracts"
+	"github.com/SIGBlockchain/project_aurum/internal/hashing"
 	"github.com/SIGBlockchain/project_aurum/internal/sqlstatements"
 )
 
@@ -26,6 +27,12 @@ type LedgerManager struct {
 	mutex    sync.RWMutex
 }
 
+// NewLedgerManager returns a LedgerManager over an open ledger file and metadata database.
+// The ledger file should be opened for both reading and appending
+func NewLedgerManager(file *os.File, database *sql.DB) *LedgerManager {
+	return &LedgerManager{file: file, database: database}
+}
+
 func (m *LedgerManager) Lock() {
 	m.mutex.Lock()
 }
@@ -34,11 +41,10 @@ func (m *LedgerManager) Unlock() {
 	m.mutex.Unlock()
 }
 
+// AddBlock appends b to the ledger. It does not lock the manager itself, so callers that
+// validate b against the youngest block should hold Lock across both steps
 func (m *LedgerManager) AddBlock(b block.Block) error {
-	m.Lock()
-	err := AddBlock(b, m.file, m.database)
-	m.Unlock()
-	return err
+	return AddBlock(b, m.file, m.database)
 }
 
 func (m *LedgerManager) GetBlockByHeight(height int) ([]byte, error) {
@@ -53,6 +59,42 @@ func (m *LedgerManager) GetBlockByHash(hash []byte) ([]byte, error) {
 	return GetBlockByHash(hash, m.file, m.database)
 }
 
+func (m *LedgerManager) GetBatchOfBlocks(startHeight uint64, numBlocks uint64) ([][]byte, error) {
+	return GetBatchOfBlocks(startHeight, numBlocks, m.file, m.database)
+}
+
+// GetContractHeight returns the height of the block holding the contract whose serialization hashes to contractHash,
+// if the ledger has it
+func (m *LedgerManager) GetContractHeight(contractHash []byte) (uint64, bool, error) {
+	return GetContractHeight(contractHash, m.database)
+}
+
+// IndexContracts indexes the contracts of a ledger made before contracts were indexed. Callers should hold Lock
+func (m *LedgerManager) IndexContracts() error {
+	return IndexContracts(m.file, m.database)
+}
+
+// TruncateTo removes every block above height from the ledger. Callers should hold Lock
+func (m *LedgerManager) TruncateTo(height uint64) error {
+	return TruncateLedger(height, m.file, m.database)
+}
+
+// RollbackTo removes every block above height from the ledger and reverts them in the accounts database.
+// Callers should hold Lock
+func (m *LedgerManager) RollbackTo(height uint64, accounts *sql.DB) error {
+	return RollbackTo(height, m.file, m.database, accounts)
+}
+
+// RepairRollback finishes a rollback interrupted after the ledger was truncated. Callers should hold Lock
+func (m *LedgerManager) RepairRollback(accounts *sql.DB) error {
+	return RepairRollback(m.file, m.database, accounts)
+}
+
+// RebuildAccountsTable replays the ledger into the accounts database
+func (m *LedgerManager) RebuildAccountsTable(accounts *sql.DB) error {
+	return RebuildAccountsTable(m.file, m.database, accounts)
+}
+
 func (m *LedgerManager) GetYoungestBlock() (block.Block, error) {
 	return GetYoungestBlock(m.file, m.database)
 }
@@ -92,9 +134,83 @@ func AddBlock(b block.Block, file *os.File, database *sql.DB) error {
 		return errors.New("Failed to execute query")
 	}
 
+	return indexContracts(database, b)
+}
+
+// indexContracts records the height of b in the contract index for each contract of b
+func indexContracts(database *sql.DB, b block.Block) error {
+	if len(b.Data) == 0 {
+		return nil
+	}
+	if _, err := database.Exec(sqlstatements.CREATE_CONTRACT_INDEX_TABLE); err != nil {
+		return errors.New("Failed to create contract_index table: " + err.Error())
+	}
+	tx, err := database.Begin()
+	if err != nil {
+		return errors.New("Failed to begin indexing contracts: " + err.Error())
+	}
+	for _, data := range b.Data {
+		if _, err := tx.Exec(sqlstatements.INSERT_VALUES_INTO_CONTRACT_INDEX, hex.EncodeToString(hashing.New(data)), b.Height); err != nil {
+			tx.Rollback()
+			return errors.New("Failed to index contract: " + err.Error())
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.New("Failed to index contracts: " + err.Error())
+	}
 	return nil
 }
 
+// GetContractHeight looks up the height of the block holding the contract whose serialization hashes to contractHash
+// in the contract index. It returns false if no block holds it
+func GetContractHeight(contractHash []byte, db *sql.DB) (uint64, bool, error) {
+	if _, err := db.Exec(sqlstatements.CREATE_CONTRACT_INDEX_TABLE); err != nil {
+		return 0, false, errors.New("Failed to create contract_index table: " + err.Error())
+	}
+	var height uint64
+	err := db.QueryRow(sqlstatements.GET_HEIGHT_FROM_CONTRACT_INDEX_BY_HASH, hex.EncodeToString(contractHash)).Scan(&height)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, errors.New("Failed to look up contract: " + err.Error())
+	}
+	return height, true, nil
+}
+
+// IndexContracts adds every block of the ledger to the contract index, unless the contracts of the genesis block,
+// which every ledger has, are indexed already. AddBlock keeps the index up to date from then on
+func IndexContracts(file *os.File, db *sql.DB) error {
+	if _, err := db.Exec(sqlstatements.CREATE_CONTRACT_INDEX_TABLE); err != nil {
+		return errors.New("Failed to create contract_index table: " + err.Error())
+	}
+	var indexed int
+	if err := db.QueryRow(sqlstatements.GET_COUNT_CONTRACT_INDEX_BY_HEIGHT, 0).Scan(&indexed); err != nil {
+		return errors.New("Failed to count indexed contracts: " + err.Error())
+	}
+	if indexed > 0 {
+		return nil
+	}
+	const batchSize = 100
+	for startHeight := uint64(0); ; startHeight += batchSize {
+		serializedBlocks, err := GetBatchOfBlocks(startHeight, batchSize, file, db)
+		if err != nil {
+			return err
+		}
+		if len(serializedBlocks) == 0 {
+			return nil
+		}
+		for _, serializedBlock := range serializedBlocks {
+			b, err := block.Deserialize(serializedBlock)
+			if err != nil {
+				return errors.New("Failed to deserialize block: " + err.Error())
+			}
+			if err := indexContracts(db, b); err != nil {
+				return err
+			}
+		}
+	}
+}
+
 // Given a height number and extracts the block of that height
 func GetBlockByHeight(height int, file *os.File, db *sql.DB) ([]byte, error) {
 	file.Seek(0, io.SeekStart) // reset seek pointer
@@ -211,6 +327,173 @@ func GetBlockByHash(hash []byte, file *os.File, db *sql.DB) ([]byte, error) {
 	return bl, nil
 }
 
+// Given a starting height, extracts up to numBlocks serialized blocks in ascending height order
+func GetBatchOfBlocks(startHeight uint64, numBlocks uint64, file *os.File, db *sql.DB) ([][]byte, error) {
+	if numBlocks == 0 {
+		return nil, nil
+	}
+	rows, err := db.Query(sqlstatements.GET_BATCH_OF_BLOCKS_FROM_METADATA, startHeight, startHeight, numBlocks)
+	if err != nil {
+		return nil, errors.New("Failed to create rows to find batch of blocks: " + err.Error())
+	}
+	defer rows.Close()
+
+	var blocks [][]byte
+	var ht uint64
+	var pos int64
+	var size int
+	for rows.Next() {
+		if err := rows.Scan(&ht, &pos, &size); err != nil {
+			return nil, errors.New("Failed to scan metadata row: " + err.Error())
+		}
+		bl := make([]byte, size)
+		if _, err := file.ReadAt(bl, pos+4); err != nil {
+			return nil, errors.New("Unable to read block at height " + fmt.Sprint(ht) + ": " + err.Error())
+		}
+		blocks = append(blocks, bl)
+	}
+	return blocks, nil
+}
+
+// RepairLedgerFile truncates any bytes after the last block recorded in the metadata table,
+// left behind when a block was written to the ledger but its metadata was not
+func RepairLedgerFile(file *os.File, db *sql.DB) error {
+	rows, err := db.Query(sqlstatements.GET_POSITION_SIZE_FROM_METADATA)
+	if err != nil {
+		return errors.New("Failed to create rows to find end of ledger: " + err.Error())
+	}
+	defer rows.Close()
+
+	var end int64
+	var pos int64
+	var size int64
+	for rows.Next() {
+		if err := rows.Scan(&pos, &size); err != nil {
+			return errors.New("Failed to scan metadata row: " + err.Error())
+		}
+		if pos+4+size > end {
+			end = pos + 4 + size
+		}
+	}
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return errors.New("Could not get file stats")
+	}
+	if fileInfo.Size() > end {
+		if err := file.Truncate(end); err != nil {
+			return errors.New("Failed to truncate ledger file: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// TruncateLedger removes the metadata of every block above height and truncates the ledger file
+// to end after the block at height
+func TruncateLedger(height uint64, file *os.File, db *sql.DB) error {
+	var pos int64
+	var size int64
+	row := db.QueryRow(sqlstatements.GET_POSITION_SIZE_FROM_METADATA_BY_HEIGHT, height)
+	if err := row.Scan(&pos, &size); err != nil {
+		return errors.New("Failed to find block at height " + fmt.Sprint(height) + ": " + err.Error())
+	}
+	if _, err := db.Exec(sqlstatements.CREATE_CONTRACT_INDEX_TABLE); err != nil {
+		return errors.New("Failed to create contract_index table: " + err.Error())
+	}
+	// the contract index is removed with the metadata so it never points above the youngest block
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.New("Failed to begin transaction: " + err.Error())
+	}
+	if _, err := tx.Exec(sqlstatements.DELETE_METADATA_ABOVE_HEIGHT, height); err != nil {
+		tx.Rollback()
+		return errors.New("Failed to delete metadata: " + err.Error())
+	}
+	if _, err := tx.Exec(sqlstatements.DELETE_CONTRACT_INDEX_ABOVE_HEIGHT, height); err != nil {
+		tx.Rollback()
+		return errors.New("Failed to delete contract index: " + err.Error())
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.New("Failed to delete metadata: " + err.Error())
+	}
+	// bytes left behind by an interrupted truncation are removed by RepairLedgerFile
+	if err := file.Truncate(pos + 4 + size); err != nil {
+		return errors.New("Failed to truncate ledger file: " + err.Error())
+	}
+	return nil
+}
+
+// RollbackTo removes the blocks above height from the metadata table and the ledger file, then reverts the
+// accounts to their state after the block at height using the undo log. The undo log keeps the before-images
+// of the removed blocks until they are reverted, so RepairRollback can finish a rollback interrupted in between
+func RollbackTo(height uint64, file *os.File, metadata *sql.DB, accounts *sql.DB) error {
+	if err := TruncateLedger(height, file, metadata); err != nil {
+		return err
+	}
+	return accountstable.RevertTo(accounts, height)
+}
+
+// RepairRollback truncates any bytes after the last block in the metadata table and reverts the accounts to
+// their state after the youngest block, finishing a RollbackTo that was interrupted
+func RepairRollback(file *os.File, metadata *sql.DB, accounts *sql.DB) error {
+	if err := RepairLedgerFile(file, metadata); err != nil {
+		return err
+	}
+	youngestBlockHeader, err := GetYoungestBlockHeader(file, metadata)
+	if err != nil {
+		return err
+	}
+	return accountstable.RevertTo(accounts, youngestBlockHeader.Height)
+}
+
+// RebuildAccountsTable empties the accounts table, undo log, mint log and burn log and replays every block in the ledger into them
+func RebuildAccountsTable(file *os.File, metadata *sql.DB, accounts *sql.DB) error {
+	if _, err := accounts.Exec(sqlstatements.CREATE_ACCOUNT_BALANCES_TABLE); err != nil {
+		return errors.New("Failed to create account_balances table: " + err.Error())
+	}
+	if _, err := accounts.Exec(sqlstatements.DELETE_EVERYTHING_FROM_ACCOUNT_BALANCES); err != nil {
+		return errors.New("Failed to empty account_balances table: " + err.Error())
+	}
+	if _, err := accounts.Exec(sqlstatements.CREATE_UNDO_LOG_TABLE); err != nil {
+		return errors.New("Failed to create undo_log table: " + err.Error())
+	}
+	if _, err := accounts.Exec(sqlstatements.DELETE_EVERYTHING_FROM_UNDO_LOG); err != nil {
+		return errors.New("Failed to empty undo_log table: " + err.Error())
+	}
+	if _, err := accounts.Exec(sqlstatements.CREATE_MINT_LOG_TABLE); err != nil {
+		return errors.New("Failed to create mint_log table: " + err.Error())
+	}
+	if _, err := accounts.Exec(sqlstatements.DELETE_EVERYTHING_FROM_MINT_LOG); err != nil {
+		return errors.New("Failed to empty mint_log table: " + err.Error())
+	}
+	if _, err := accounts.Exec(sqlstatements.CREATE_BURN_LOG_TABLE); err != nil {
+		return errors.New("Failed to create burn_log table: " + err.Error())
+	}
+	if _, err := accounts.Exec(sqlstatements.DELETE_EVERYTHING_FROM_BURN_LOG); err != nil {
+		return errors.New("Failed to empty burn_log table: " + err.Error())
+	}
+
+	const batchSize = 100
+	for startHeight := uint64(0); ; startHeight += batchSize {
+		serializedBlocks, err := GetBatchOfBlocks(startHeight, batchSize, file, metadata)
+		if err != nil {
+			return err
+		}
+		if len(serializedBlocks) == 0 {
+			return nil
+		}
+		for _, serializedBlock := range serializedBlocks {
+			b, err := block.Deserialize(serializedBlock)
+			if err != nil {
+				return errors.New("Failed to deserialize block: " + err.Error())
+			}
+			if err := accountstable.ApplyBlock(accounts, &b); err != nil {
+				return err
+			}
+		}
+	}
+}
+
 /*
 Retrieves Block with the largest height in deserialized form
 */
@@ -243,7 +526,11 @@ func GetYoungestBlock(file *os.File, db *sql.DB) (block.Block, error) {
 	if err != nil {
 		return block.Block{}, err
 	}
-	return block.Deserialize(youngestBlock), nil
+	youngest, err := block.Deserialize(youngestBlock)
+	if err != nil {
+		return block.Block{}, errors.New("Failed to deserialize youngest block: " + err.Error())
+	}
+	return youngest, nil
 }
 
 /*
@@ -255,14 +542,8 @@ func GetYoungestBlockHeader(file *os.File, metadata *sql.DB) (block.BlockHeader,
 		return block.BlockHeader{}, errors.New("Failed to retreive youngest block: " + err.Error())
 	}
 
-	latestBlockHeader := block.BlockHeader{
-		Version:        latestBlock.Version,
-		Height:         latestBlock.Height,
-		Timestamp:      latestBlock.Timestamp,
-		PreviousHash:   latestBlock.PreviousHash,
-		MerkleRootHash: latestBlock.MerkleRootHash,
-	}
-	return latestBlockHeader, nil
+	// the header keeps the producer and signature, which the hash of a signed header covers
+	return latestBlock.GetHeader(), nil
 }
 
 // This is a security feature for the ledger. If the metadata table gets lost somehow, this function will restore it completely.
@@ -327,6 +608,9 @@ func RecoverBlockchainMetadata(ledgerFilename string, metadataFilename string, a
 		if err != nil {
 			return err
 		}
+		if err := indexContracts(metaDb, *deserializedBlock); err != nil {
+			return err
+		}
 
 		//update the account table
 		err = accountstable.UpdateAccountTable(accDb, deserializedBlock)
@@ -384,7 +668,10 @@ func extractBlock(ledgerFile *os.File, pos *int64) (*block.Block, uint32, error)
 		return nil, 0, errors.New("Failed to retrieve serialized block")
 	}
 
-	deserializedBlock := block.Deserialize(serialized)
+	deserializedBlock, err := block.Deserialize(serialized)
+	if err != nil {
+		return nil, 0, errors.New("Failed to deserialize block: " + err.Error())
+	}
 	return &deserializedBlock, bLen, nil
 }
 
@@ -471,6 +758,10 @@ func Airdrop(blockchain string, metadata string, accountBalanceTable string, gen
 	for _, contrcts := range genesisBlock.Data {
 		var contract contracts.Contract
 		contract.Deserialize(contrcts)
+		// the contract committing the block to its genesis spec mints nothing and creates no account
+		if contract.Value == 0 {
+			continue
+		}
 		_, err := stmt.Exec(hex.EncodeToString(contract.RecipPubKeyHash), contract.Value, 0)
 		if err != nil {
 			return errors.New("Failed to execute statement for inserting into account table")
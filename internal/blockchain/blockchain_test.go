@@ -433,7 +433,7 @@ func TestRecoverBlockchainMetadata(t *testing.T) {
 			if err != nil {
 				t.Errorf("failed to get genesis block")
 			}
-			blockchainGenesisBlockDeserialized := block.Deserialize(blockchainGenesisBlockSerialized)
+			blockchainGenesisBlockDeserialized, _ := block.Deserialize(blockchainGenesisBlockSerialized)
 			if !reflect.DeepEqual(blockchainGenesisBlockDeserialized, genny) {
 				t.Errorf("genesis blocks do not match")
 			}
@@ -626,7 +626,7 @@ func TestRecoverBlockchainMetadata_TwoBlocks(t *testing.T) {
 			}
 			ledgerFile.Close()
 			metadataConn.Close()
-			firstBlockDeserialized := block.Deserialize(firstBlockSerialized)
+			firstBlockDeserialized, _ := block.Deserialize(firstBlockSerialized)
 			if !reflect.DeepEqual(firstBlockDeserialized, firstBlock) {
 				t.Errorf("first blocks do not match")
 			}
@@ -768,3 +768,323 @@ func TestAirdrop(t *testing.T) {
 		})
 	}
 }
+
+func TestGetBatchOfBlocks(t *testing.T) {
+	metadata := setUp("testBlockchain.dat", "testDatabase.db")
+	defer tearDown(metadata, "testBlockchain.dat", "testDatabase.db")
+
+	var blocks []block.Block
+	for i := 0; i < 5; i++ {
+		b := block.Block{
+			Version:        1,
+			Height:         uint64(i),
+			Timestamp:      time.Now().UnixNano(),
+			PreviousHash:   hashing.New([]byte{byte(i)}),
+			MerkleRootHash: hashing.New([]byte{byte(i + 1)}),
+			Data:           [][]byte{hashing.New([]byte{byte(i + 2)})},
+		}
+		b.DataLen = uint16(len(b.Data))
+		if err := addBlockHelper(b, "testBlockchain.dat", metadata); err != nil {
+			t.Fatalf("Failed to add block: %v", err)
+		}
+		blocks = append(blocks, b)
+	}
+
+	file, err := os.OpenFile("testBlockchain.dat", os.O_RDONLY, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	defer file.Close()
+
+	tests := []struct {
+		name        string
+		startHeight uint64
+		numBlocks   uint64
+		want        []block.Block
+	}{
+		{"middle of chain", 1, 3, blocks[1:4]},
+		{"past the youngest block", 3, 10, blocks[3:]},
+		{"beyond the chain", 7, 2, nil},
+		{"no blocks", 0, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetBatchOfBlocks(tt.startHeight, tt.numBlocks, file, metadata)
+			if err != nil {
+				t.Fatalf("GetBatchOfBlocks() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %d blocks, got %d", len(tt.want), len(got))
+			}
+			for i := range got {
+				if !bytes.Equal(got[i], tt.want[i].Serialize()) {
+					t.Errorf("block %d does not match", i)
+				}
+			}
+		})
+	}
+}
+
+func TestRepairLedgerFile(t *testing.T) {
+	metadata := setUp("testBlockchain.dat", "testDatabase.db")
+	defer tearDown(metadata, "testBlockchain.dat", "testDatabase.db")
+
+	b := block.Block{
+		Version:        1,
+		Height:         0,
+		Timestamp:      time.Now().UnixNano(),
+		PreviousHash:   hashing.New([]byte{'0'}),
+		MerkleRootHash: hashing.New([]byte{'1'}),
+	}
+	if err := addBlockHelper(b, "testBlockchain.dat", metadata); err != nil {
+		t.Fatalf("Failed to add block: %v", err)
+	}
+	expectedSize := int64(4 + len(b.Serialize()))
+
+	// Simulate a block written to the ledger without its metadata
+	file, err := os.OpenFile("testBlockchain.dat", os.O_APPEND|os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	defer file.Close()
+	file.Write([]byte{1, 2, 3, 4, 5, 6})
+
+	if err := RepairLedgerFile(file, metadata); err != nil {
+		t.Fatalf("RepairLedgerFile() error = %v", err)
+	}
+	fileInfo, _ := file.Stat()
+	if fileInfo.Size() != expectedSize {
+		t.Errorf("expected ledger size %d, got %d", expectedSize, fileInfo.Size())
+	}
+}
+
+func TestTruncateLedgerAndRebuildAccountsTable(t *testing.T) {
+	defer func() {
+		os.Remove("truncate.dat")
+		os.Remove("truncateMetadata.db")
+		os.Remove("truncateAccounts.db")
+	}()
+	senderKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	encodedSenderPublicKey, _ := publickey.Encode(&senderKey.PublicKey)
+	senderPKH := hashing.New(encodedSenderPublicKey)
+	recipientPKH := hashing.New([]byte("recipient"))
+	genny, _ := genesis.BringOnTheGenesis([][]byte{senderPKH}, 1000)
+	if err := Airdrop("truncate.dat", "truncateMetadata.db", "truncateAccounts.db", genny); err != nil {
+		t.Fatalf("Failed to airdrop: %v", err)
+	}
+	file, _ := os.OpenFile("truncate.dat", os.O_APPEND|os.O_RDWR, 0644)
+	defer file.Close()
+	metadata, _ := sql.Open("sqlite3", "truncateMetadata.db")
+	defer metadata.Close()
+	accounts, _ := sql.Open("sqlite3", "truncateAccounts.db")
+	defer accounts.Close()
+	lm := NewLedgerManager(file, metadata)
+
+	parent := genny
+	for i := uint64(1); i <= 2; i++ {
+		contract, _ := contracts.New(1, senderKey, recipientPKH, 100, i)
+		contract.Sign(senderKey)
+		b, _ := block.New(1, i, block.HashBlock(parent), []contracts.Contract{*contract})
+		if err := lm.AddBlock(b); err != nil {
+			t.Fatalf("Failed to add block: %v", err)
+		}
+		parent = b
+	}
+	if err := lm.RebuildAccountsTable(accounts); err != nil {
+		t.Fatalf("RebuildAccountsTable() error = %v", err)
+	}
+	if balance, _ := accountstable.GetBalance(accounts, recipientPKH); balance != 200 {
+		t.Errorf("expected recipient balance 200 after rebuild, got %d", balance)
+	}
+
+	if err := lm.TruncateTo(1); err != nil {
+		t.Fatalf("TruncateTo() error = %v", err)
+	}
+	youngest, err := lm.GetYoungestBlockHeader()
+	if err != nil || youngest.Height != 1 {
+		t.Fatalf("expected youngest height 1 after truncation, got %d (%v)", youngest.Height, err)
+	}
+	if err := lm.RebuildAccountsTable(accounts); err != nil {
+		t.Fatalf("RebuildAccountsTable() error = %v", err)
+	}
+	if balance, _ := accountstable.GetBalance(accounts, recipientPKH); balance != 100 {
+		t.Errorf("expected recipient balance 100 after truncation, got %d", balance)
+	}
+	if nonce, _ := accountstable.GetStateNonce(accounts, senderPKH); nonce != 1 {
+		t.Errorf("expected sender nonce 1 after truncation, got %d", nonce)
+	}
+
+	// The next block is appended directly after the truncated ledger
+	truncatedTip, _ := block.Deserialize(mustGetBlock(t, lm, 1))
+	b, _ := block.New(1, 2, block.HashBlock(truncatedTip), nil)
+	if err := lm.AddBlock(b); err != nil {
+		t.Fatalf("Failed to add block after truncation: %v", err)
+	}
+	if serialized := mustGetBlock(t, lm, 2); !bytes.Equal(serialized, b.Serialize()) {
+		t.Errorf("block appended after truncation does not match")
+	}
+	if err := lm.TruncateTo(5); err == nil {
+		t.Errorf("expected truncating above the youngest block to fail")
+	}
+}
+
+func TestRollbackTo(t *testing.T) {
+	defer func() {
+		os.Remove("rollback.dat")
+		os.Remove("rollbackMetadata.db")
+		os.Remove("rollbackAccounts.db")
+	}()
+	senderKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	encodedSenderPublicKey, _ := publickey.Encode(&senderKey.PublicKey)
+	senderPKH := hashing.New(encodedSenderPublicKey)
+	recipientPKH := hashing.New([]byte("recipient"))
+	genny, _ := genesis.BringOnTheGenesis([][]byte{senderPKH}, 1000)
+	if err := Airdrop("rollback.dat", "rollbackMetadata.db", "rollbackAccounts.db", genny); err != nil {
+		t.Fatalf("Failed to airdrop: %v", err)
+	}
+	file, _ := os.OpenFile("rollback.dat", os.O_APPEND|os.O_RDWR, 0644)
+	defer file.Close()
+	metadata, _ := sql.Open("sqlite3", "rollbackMetadata.db")
+	defer metadata.Close()
+	accounts, _ := sql.Open("sqlite3", "rollbackAccounts.db")
+	defer accounts.Close()
+	lm := NewLedgerManager(file, metadata)
+
+	// addBlocks adds the blocks after parent up to height 2 and applies them to the accounts
+	var blocks []block.Block
+	addBlocks := func(parent block.Block) {
+		for i := parent.Height + 1; i <= 2; i++ {
+			contract, _ := contracts.New(1, senderKey, recipientPKH, 100, i)
+			contract.Sign(senderKey)
+			b, _ := block.New(1, i, block.HashBlock(parent), []contracts.Contract{*contract})
+			if err := lm.AddBlock(b); err != nil {
+				t.Fatalf("Failed to add block: %v", err)
+			}
+			if err := accountstable.ApplyBlock(accounts, &b); err != nil {
+				t.Fatalf("Failed to apply block: %v", err)
+			}
+			blocks = append(blocks, b)
+			parent = b
+		}
+	}
+	if err := lm.RebuildAccountsTable(accounts); err != nil {
+		t.Fatalf("RebuildAccountsTable() error = %v", err)
+	}
+	addBlocks(genny)
+	contractHash := hashing.New(blocks[1].Data[0])
+
+	checkRolledBack := func() {
+		t.Helper()
+		if youngest, err := lm.GetYoungestBlockHeader(); err != nil || youngest.Height != 1 {
+			t.Errorf("expected youngest height 1 after rollback, got %d (%v)", youngest.Height, err)
+		}
+		if serializedBlocks, err := lm.GetBatchOfBlocks(2, 1); err != nil || len(serializedBlocks) != 0 {
+			t.Errorf("expected the metadata of block 2 to be removed")
+		}
+		if _, found, _ := lm.GetContractHeight(contractHash); found {
+			t.Errorf("expected the contract of block 2 to be removed from the contract index")
+		}
+		fileInfo, _ := file.Stat()
+		if want := int64(len(genny.Serialize()) + len(blocks[0].Serialize()) + 8); fileInfo.Size() != want {
+			t.Errorf("expected ledger file of %d bytes, got %d", want, fileInfo.Size())
+		}
+		if balance, _ := accountstable.GetBalance(accounts, recipientPKH); balance != 100 {
+			t.Errorf("expected recipient balance 100 after rollback, got %d", balance)
+		}
+		if balance, _ := accountstable.GetBalance(accounts, senderPKH); balance != 900 {
+			t.Errorf("expected sender balance 900 after rollback, got %d", balance)
+		}
+		if nonce, _ := accountstable.GetStateNonce(accounts, senderPKH); nonce != 1 {
+			t.Errorf("expected sender nonce 1 after rollback, got %d", nonce)
+		}
+	}
+
+	if err := lm.RollbackTo(1, accounts); err != nil {
+		t.Fatalf("RollbackTo() error = %v", err)
+	}
+	checkRolledBack()
+	if err := lm.RollbackTo(5, accounts); err == nil {
+		t.Errorf("expected rolling back above the youngest block to fail")
+	}
+
+	// A rollback interrupted after truncating the ledger is finished by RepairRollback
+	blocks = blocks[:1]
+	addBlocks(blocks[0])
+	contractHash = hashing.New(blocks[1].Data[0])
+	if err := lm.TruncateTo(1); err != nil {
+		t.Fatalf("TruncateTo() error = %v", err)
+	}
+	if balance, _ := accountstable.GetBalance(accounts, recipientPKH); balance != 200 {
+		t.Fatalf("expected truncation alone to keep recipient balance 200, got %d", balance)
+	}
+	if err := lm.RepairRollback(accounts); err != nil {
+		t.Fatalf("RepairRollback() error = %v", err)
+	}
+	checkRolledBack()
+	if err := lm.RepairRollback(accounts); err != nil {
+		t.Fatalf("expected repairing a consistent ledger to succeed: %v", err)
+	}
+	checkRolledBack()
+}
+
+func TestContractIndex(t *testing.T) {
+	defer func() {
+		os.Remove("contractIndex.dat")
+		os.Remove("contractIndexMetadata.db")
+		os.Remove("contractIndexAccounts.db")
+	}()
+	senderKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	encodedSenderPublicKey, _ := publickey.Encode(&senderKey.PublicKey)
+	genny, _ := genesis.BringOnTheGenesis([][]byte{hashing.New(encodedSenderPublicKey)}, 1000)
+	if err := Airdrop("contractIndex.dat", "contractIndexMetadata.db", "contractIndexAccounts.db", genny); err != nil {
+		t.Fatalf("Failed to airdrop: %v", err)
+	}
+	file, _ := os.OpenFile("contractIndex.dat", os.O_APPEND|os.O_RDWR, 0644)
+	defer file.Close()
+	metadata, _ := sql.Open("sqlite3", "contractIndexMetadata.db")
+	defer metadata.Close()
+	lm := NewLedgerManager(file, metadata)
+
+	contract, _ := contracts.New(1, senderKey, hashing.New([]byte("recipient")), 100, 1)
+	contract.Sign(senderKey)
+	b, _ := block.New(1, 1, block.HashBlock(genny), []contracts.Contract{*contract})
+	if err := lm.AddBlock(b); err != nil {
+		t.Fatalf("Failed to add block: %v", err)
+	}
+	contractHash := hashing.New(b.Data[0])
+	if height, found, err := lm.GetContractHeight(contractHash); err != nil || !found || height != 1 {
+		t.Errorf("expected contract at height 1, got %d, %v (%v)", height, found, err)
+	}
+	if height, found, err := lm.GetContractHeight(hashing.New(genny.Data[0])); err != nil || !found || height != 0 {
+		t.Errorf("expected genesis contract at height 0, got %d, %v (%v)", height, found, err)
+	}
+	if _, found, err := lm.GetContractHeight(hashing.New([]byte("missing"))); err != nil || found {
+		t.Errorf("expected unknown contract to be missing, got %v (%v)", found, err)
+	}
+
+	// A ledger indexed before contracts were indexed is backfilled
+	if _, err := metadata.Exec("DROP TABLE contract_index"); err != nil {
+		t.Fatalf("Failed to drop contract index: %v", err)
+	}
+	if err := lm.IndexContracts(); err != nil {
+		t.Fatalf("IndexContracts() error = %v", err)
+	}
+	if height, found, err := lm.GetContractHeight(contractHash); err != nil || !found || height != 1 {
+		t.Errorf("expected backfilled contract at height 1, got %d, %v (%v)", height, found, err)
+	}
+
+	if err := lm.TruncateTo(0); err != nil {
+		t.Fatalf("TruncateTo() error = %v", err)
+	}
+	if _, found, err := lm.GetContractHeight(contractHash); err != nil || found {
+		t.Errorf("expected truncated contract to be missing, got %v (%v)", found, err)
+	}
+}
+
+func mustGetBlock(t *testing.T, lm *LedgerManager, height uint64) []byte {
+	serializedBlocks, err := lm.GetBatchOfBlocks(height, 1)
+	if err != nil || len(serializedBlocks) != 1 {
+		t.Fatalf("Failed to get block #%d: %v", height, err)
+	}
+	return serializedBlocks[0]
+}
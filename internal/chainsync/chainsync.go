@@ -0,0 +1,274 @@
+// Package chainsync downloads the ledger from a peer so a producer can join the network or catch up to it
+package chainsync
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/SIGBlockchain/project_aurum/internal/block"
+	"github.com/SIGBlockchain/project_aurum/internal/blockchain"
+	"github.com/SIGBlockchain/project_aurum/internal/consensus"
+	"github.com/SIGBlockchain/project_aurum/internal/datadir"
+	"github.com/SIGBlockchain/project_aurum/internal/forkchoice"
+	"github.com/SIGBlockchain/project_aurum/internal/monetary"
+	"github.com/SIGBlockchain/project_aurum/internal/requests"
+)
+
+// Streamer implements ifaces.IBlockchainStreamer. Each streamed block must extend the main chain of the Chain
+// it is added to
+type Streamer struct {
+	chain *forkchoice.Chain
+}
+
+// NewStreamer returns a Streamer adding blocks to chain
+func NewStreamer(chain *forkchoice.Chain) *Streamer {
+	return &Streamer{chain: chain}
+}
+
+// Stream appends the blocks in order and returns how many were appended before the first invalid block
+func (s *Streamer) Stream(blocks []block.Block) (int, error) {
+	for i, b := range blocks {
+		update, err := s.chain.Add(b)
+		if err != nil {
+			return i, fmt.Errorf("block #%d was rejected: %v", b.Height, err)
+		}
+		if len(update.Connected) == 0 {
+			return i, fmt.Errorf("block #%d does not extend the main chain", b.Height)
+		}
+	}
+	return len(blocks), nil
+}
+
+// Peer is a producer the ledger is synced from
+type Peer struct {
+	host   string
+	client *http.Client
+}
+
+// NewPeer returns a Peer at host (e.g. "localhost:26001") whose requests time out after timeout
+func NewPeer(host string, timeout time.Duration) *Peer {
+	return &Peer{host: host, client: &http.Client{Timeout: timeout}}
+}
+
+// Height returns the height of the peer's youngest block
+func (p *Peer) Height() (uint64, error) {
+	req, err := requests.GetHeightRequest(p.host)
+	if err != nil {
+		return 0, err
+	}
+	var height requests.HeightResponse
+	if err := p.do(req, &height); err != nil {
+		return 0, err
+	}
+	return height.Height, nil
+}
+
+// Headers returns up to numBlocks of the peer's block headers starting at startHeight
+func (p *Peer) Headers(startHeight uint64, numBlocks uint64) ([]block.BlockHeader, error) {
+	req, err := requests.GetBatchOfHeadersRequest(p.host, startHeight, numBlocks)
+	if err != nil {
+		return nil, err
+	}
+	var jsonHeaders []block.JSONBlockHeader
+	if err := p.do(req, &jsonHeaders); err != nil {
+		return nil, err
+	}
+	headers := make([]block.BlockHeader, len(jsonHeaders))
+	for i := range jsonHeaders {
+		if headers[i], err = jsonHeaders[i].Unmarshal(); err != nil {
+			return nil, errors.New("Failed to unmarshal header: " + err.Error())
+		}
+	}
+	return headers, nil
+}
+
+// Blocks returns up to numBlocks of the peer's blocks starting at startHeight
+func (p *Peer) Blocks(startHeight uint64, numBlocks uint64) ([]block.Block, error) {
+	req, err := requests.GetBatchOfBlocksRequest(p.host, startHeight, numBlocks)
+	if err != nil {
+		return nil, err
+	}
+	var jsonBlocks []block.JSONBlock
+	if err := p.do(req, &jsonBlocks); err != nil {
+		return nil, err
+	}
+	blocks := make([]block.Block, len(jsonBlocks))
+	for i := range jsonBlocks {
+		if blocks[i], err = jsonBlocks[i].Unmarshal(); err != nil {
+			return nil, errors.New("Failed to unmarshal block: " + err.Error())
+		}
+	}
+	return blocks, nil
+}
+
+func (p *Peer) do(req *http.Request, v interface{}) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return errors.New("Failed to reach " + p.host + ": " + err.Error())
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.New("Failed to read response from " + p.host + ": " + err.Error())
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(p.host + " responded " + resp.Status + ": " + string(body))
+	}
+	return json.Unmarshal(body, v)
+}
+
+// Sync brings the ledger, metadata and accounts tables in the data directory dir up to the height of peer,
+// fetching batchSize headers and then the matching blocks at a time.
+//
+// If dir holds no ledger, the genesis block is taken from the peer. A marker file is kept in dir
+// while syncing; if it is found on the next call the interrupted sync is repaired and resumed.
+// If authority is not nil, the synced blocks must follow its slot schedule. The synced blocks must mint the
+// rewards of policy
+func Sync(dir *datadir.Dir, peer *Peer, version uint16, authority *consensus.Authority, policy monetary.Policy, batchSize uint64) error {
+	if batchSize == 0 {
+		return errors.New("batch size must be at least one")
+	}
+	ledgerName := dir.Ledger()
+	metadataName := dir.Metadata()
+	accountsName := dir.Accounts()
+	markerName := dir.SyncMarker()
+
+	_, err := os.Stat(markerName)
+	resuming := err == nil
+
+	if _, err := os.Stat(ledgerName); os.IsNotExist(err) {
+		if err := createMarker(markerName); err != nil {
+			return err
+		}
+		genesisBlock, err := fetchGenesis(peer)
+		if err != nil {
+			return err
+		}
+		if err := blockchain.Airdrop(ledgerName, metadataName, accountsName, genesisBlock); err != nil {
+			return errors.New("Failed to airdrop genesis block from peer: " + err.Error())
+		}
+		resuming = false
+	} else if err := createMarker(markerName); err != nil {
+		return err
+	}
+
+	ledgerFile, err := os.OpenFile(ledgerName, os.O_APPEND|os.O_RDWR, 0644)
+	if err != nil {
+		return errors.New("Failed to open ledger file: " + err.Error())
+	}
+	defer ledgerFile.Close()
+	metadata, err := sql.Open("sqlite3", metadataName)
+	if err != nil {
+		return errors.New("Failed to open metadata table: " + err.Error())
+	}
+	defer metadata.Close()
+	ledger := blockchain.NewLedgerManager(ledgerFile, metadata)
+
+	accounts, err := sql.Open("sqlite3", accountsName)
+	if err != nil {
+		return errors.New("Failed to open accounts table: " + err.Error())
+	}
+	defer accounts.Close()
+
+	if resuming {
+		// The previous sync may have stopped between writing a block and applying its contracts
+		if err := blockchain.RepairLedgerFile(ledgerFile, metadata); err != nil {
+			return err
+		}
+		if err := ledger.RebuildAccountsTable(accounts); err != nil {
+			return err
+		}
+	}
+
+	chain, err := forkchoice.NewChain(ledger, metadata, accounts, version, authority, policy)
+	if err != nil {
+		return err
+	}
+	streamer := NewStreamer(chain)
+
+	peerHeight, err := peer.Height()
+	if err != nil {
+		return err
+	}
+	for {
+		youngest, err := ledger.GetYoungestBlockHeader()
+		if err != nil {
+			return err
+		}
+		if youngest.Height >= peerHeight {
+			break
+		}
+		numBlocks := peerHeight - youngest.Height
+		if numBlocks > batchSize {
+			numBlocks = batchSize
+		}
+
+		headers, err := peer.Headers(youngest.Height+1, numBlocks)
+		if err != nil {
+			return err
+		}
+		if err := verifyHeaderChain(youngest, headers); err != nil {
+			return err
+		}
+		blocks, err := peer.Blocks(youngest.Height+1, uint64(len(headers)))
+		if err != nil {
+			return err
+		}
+		if len(blocks) != len(headers) {
+			return fmt.Errorf("peer sent %d blocks for %d headers", len(blocks), len(headers))
+		}
+		for i := range blocks {
+			if !bytes.Equal(block.HashBlock(blocks[i]), block.HashBlockHeader(headers[i])) {
+				return fmt.Errorf("block #%d does not match its header", blocks[i].Height)
+			}
+		}
+		if _, err := streamer.Stream(blocks); err != nil {
+			return err
+		}
+	}
+
+	return os.Remove(markerName)
+}
+
+// fetchGenesis retrieves the block at height 0 from the peer
+func fetchGenesis(peer *Peer) (block.Block, error) {
+	blocks, err := peer.Blocks(0, 1)
+	if err != nil {
+		return block.Block{}, err
+	}
+	if len(blocks) != 1 || blocks[0].Height != 0 {
+		return block.Block{}, errors.New("peer did not send a genesis block")
+	}
+	return blocks[0], nil
+}
+
+// verifyHeaderChain checks that the headers continue the chain from parent without gaps
+func verifyHeaderChain(parent block.BlockHeader, headers []block.BlockHeader) error {
+	if len(headers) == 0 {
+		return fmt.Errorf("peer sent no headers after block #%d", parent.Height)
+	}
+	for _, header := range headers {
+		if header.Height != parent.Height+1 || !bytes.Equal(header.PreviousHash, block.HashBlockHeader(parent)) {
+			return fmt.Errorf("header #%d does not link to header #%d", header.Height, parent.Height)
+		}
+		parent = header
+	}
+	return nil
+}
+
+func createMarker(markerName string) error {
+	marker, err := os.Create(markerName)
+	if err != nil {
+		return errors.New("Failed to create sync marker: " + err.Error())
+	}
+	return marker.Close()
+}
@@ -0,0 +1,241 @@
+package chainsync
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"database/sql"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SIGBlockchain/project_aurum/internal/accountstable"
+	"github.com/SIGBlockchain/project_aurum/internal/block"
+	"github.com/SIGBlockchain/project_aurum/internal/blockchain"
+	"github.com/SIGBlockchain/project_aurum/internal/constants"
+	"github.com/SIGBlockchain/project_aurum/internal/contracts"
+	"github.com/SIGBlockchain/project_aurum/internal/datadir"
+	"github.com/SIGBlockchain/project_aurum/internal/endpoints"
+	"github.com/SIGBlockchain/project_aurum/internal/forkchoice"
+	"github.com/SIGBlockchain/project_aurum/internal/genesis"
+	"github.com/SIGBlockchain/project_aurum/internal/handlers"
+	"github.com/SIGBlockchain/project_aurum/internal/hashing"
+	"github.com/SIGBlockchain/project_aurum/internal/monetary"
+	"github.com/SIGBlockchain/project_aurum/internal/publickey"
+)
+
+// source is an in-process producer the ledger is synced from
+type source struct {
+	dir        string
+	ledgerFile *os.File
+	metadata   *sql.DB
+	accounts   *sql.DB
+	ledger     *blockchain.LedgerManager
+	streamer   *Streamer
+	server     *httptest.Server
+}
+
+func setUpSource(t *testing.T, genesisBlock block.Block) *source {
+	dir, err := ioutil.TempDir("", "aurum_sync_source")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	dir += "/"
+	if err := blockchain.Airdrop(dir+constants.BlockchainFile, dir+constants.MetadataTable, dir+constants.AccountsTable, genesisBlock); err != nil {
+		t.Fatalf("failed to airdrop: %v", err)
+	}
+	s := &source{dir: dir}
+	s.ledgerFile, _ = os.OpenFile(dir+constants.BlockchainFile, os.O_APPEND|os.O_RDWR, 0644)
+	s.metadata, _ = sql.Open("sqlite3", dir+constants.MetadataTable)
+	s.accounts, _ = sql.Open("sqlite3", dir+constants.AccountsTable)
+	s.ledger = blockchain.NewLedgerManager(s.ledgerFile, s.metadata)
+	chain, err := forkchoice.NewChain(s.ledger, s.metadata, s.accounts, 1, nil, monetary.Policy{})
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	s.streamer = NewStreamer(chain)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(endpoints.HeightQuery, handlers.HandleHeightQuery(s.ledger))
+	mux.HandleFunc(endpoints.HeaderBatchQuery, handlers.HandleGetBatchOfHeaders(s.ledger, 3))
+	mux.HandleFunc(endpoints.BlockBatchQuery, handlers.HandleGetBatchOfBlocks(s.ledger, 3))
+	s.server = httptest.NewServer(mux)
+	return s
+}
+
+func (s *source) host() string {
+	return strings.TrimPrefix(s.server.URL, "http://")
+}
+
+// produce appends a block holding the given contracts to the source's ledger
+func (s *source) produce(t *testing.T, blockContracts []contracts.Contract) {
+	youngest, err := s.ledger.GetYoungestBlockHeader()
+	if err != nil {
+		t.Fatalf("failed to get youngest header: %v", err)
+	}
+	b, err := block.New(1, youngest.Height+1, block.HashBlockHeader(youngest), blockContracts)
+	if err != nil {
+		t.Fatalf("failed to create block: %v", err)
+	}
+	if _, err := s.streamer.Stream([]block.Block{b}); err != nil {
+		t.Fatalf("failed to append block: %v", err)
+	}
+}
+
+func (s *source) tearDown() {
+	s.server.Close()
+	s.ledgerFile.Close()
+	s.metadata.Close()
+	s.accounts.Close()
+	os.RemoveAll(s.dir)
+}
+
+func newKey() (*ecdsa.PrivateKey, []byte) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	encoded, _ := publickey.Encode(&key.PublicKey)
+	return key, hashing.New(encoded)
+}
+
+func signedContract(key *ecdsa.PrivateKey, recipient []byte, value uint64, nonce uint64) contracts.Contract {
+	c, _ := contracts.New(1, key, recipient, value, nonce)
+	c.Sign(key)
+	return *c
+}
+
+func accountsOf(t *testing.T, dir string, pkhashes ...[]byte) []uint64 {
+	db, err := sql.Open("sqlite3", dir+constants.AccountsTable)
+	if err != nil {
+		t.Fatalf("failed to open accounts: %v", err)
+	}
+	defer db.Close()
+	var balances []uint64
+	for _, pkhash := range pkhashes {
+		info, err := accountstable.GetAccountInfo(db, pkhash)
+		if err != nil {
+			t.Fatalf("failed to get account info: %v", err)
+		}
+		balances = append(balances, info.Balance, info.StateNonce)
+	}
+	return balances
+}
+
+func youngestOf(t *testing.T, dir string) block.BlockHeader {
+	ledgerFile, _ := os.Open(dir + constants.BlockchainFile)
+	defer ledgerFile.Close()
+	metadata, _ := sql.Open("sqlite3", dir+constants.MetadataTable)
+	defer metadata.Close()
+	youngest, err := blockchain.GetYoungestBlockHeader(ledgerFile, metadata)
+	if err != nil {
+		t.Fatalf("failed to get youngest header: %v", err)
+	}
+	return youngest
+}
+
+func TestSync(t *testing.T) {
+	aliceKey, alice := newKey()
+	bobKey, bob := newKey()
+	genesisBlock, _ := genesis.BringOnTheGenesis([][]byte{alice, bob}, 1000)
+
+	src := setUpSource(t, genesisBlock)
+	defer src.tearDown()
+	src.produce(t, []contracts.Contract{signedContract(aliceKey, bob, 100, 1)})
+	src.produce(t, nil)
+	// Receiving a contract also increments the recipient's state nonce
+	src.produce(t, []contracts.Contract{signedContract(bobKey, alice, 50, 2)})
+	src.produce(t, []contracts.Contract{signedContract(aliceKey, bob, 10, 3), signedContract(aliceKey, bob, 5, 4)})
+
+	dir, _ := ioutil.TempDir("", "aurum_sync")
+	dir += "/"
+	defer os.RemoveAll(dir)
+
+	// A batch size smaller than the chain forces several rounds of headers and blocks
+	if err := Sync(datadir.New(dir), NewPeer(src.host(), time.Second), 1, nil, monetary.Policy{}, 2); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if youngest := youngestOf(t, dir); !reflect.DeepEqual(youngest, youngestOf(t, src.dir)) {
+		t.Errorf("synced youngest block #%d does not match source", youngest.Height)
+	}
+	want := accountsOf(t, src.dir, alice, bob)
+	got := accountsOf(t, dir, alice, bob)
+	if !equalUint64s(got, want) {
+		t.Errorf("synced accounts %v do not match source %v", got, want)
+	}
+	if _, err := os.Stat(dir + constants.SyncMarkerFile); !os.IsNotExist(err) {
+		t.Errorf("sync marker was not removed")
+	}
+
+	// Simulate an interrupted sync that wrote a partial block and left the accounts stale
+	src.produce(t, []contracts.Contract{signedContract(bobKey, alice, 1, 5)})
+	createMarker(dir + constants.SyncMarkerFile)
+	ledgerFile, _ := os.OpenFile(dir+constants.BlockchainFile, os.O_APPEND|os.O_WRONLY, 0644)
+	ledgerFile.Write([]byte{0xde, 0xad})
+	ledgerFile.Close()
+	staleAccounts, _ := sql.Open("sqlite3", dir+constants.AccountsTable)
+	accountstable.MintAurumUpdateAccountBalanceTable(staleAccounts, alice, 12345)
+	staleAccounts.Close()
+
+	if err := Sync(datadir.New(dir), NewPeer(src.host(), time.Second), 1, nil, monetary.Policy{}, 2); err != nil {
+		t.Fatalf("resumed Sync() error = %v", err)
+	}
+	if youngest := youngestOf(t, dir); youngest.Height != 5 {
+		t.Errorf("expected height 5 after resume, got %d", youngest.Height)
+	}
+	want = accountsOf(t, src.dir, alice, bob)
+	got = accountsOf(t, dir, alice, bob)
+	if !equalUint64s(got, want) {
+		t.Errorf("resumed accounts %v do not match source %v", got, want)
+	}
+}
+
+func TestStreamRejectsInvalidBlock(t *testing.T) {
+	aliceKey, alice := newKey()
+	_, bob := newKey()
+	genesisBlock, _ := genesis.BringOnTheGenesis([][]byte{alice, bob}, 1000)
+	src := setUpSource(t, genesisBlock)
+	defer src.tearDown()
+
+	valid, _ := block.New(1, 1, block.HashBlock(genesisBlock), []contracts.Contract{signedContract(aliceKey, bob, 100, 1)})
+	wrongParent, _ := block.New(1, 2, hashing.New([]byte("not the parent")), nil)
+	n, err := src.streamer.Stream([]block.Block{valid, wrongParent})
+	if err == nil || n != 1 {
+		t.Errorf("expected 1 block streamed and an error, got %d and %v", n, err)
+	}
+
+	overspend, _ := block.New(1, 2, block.HashBlock(valid), []contracts.Contract{signedContract(aliceKey, bob, 1000, 2)})
+	if n, err := src.streamer.Stream([]block.Block{overspend}); err == nil || n != 0 {
+		t.Errorf("expected block with invalid contract to be rejected, got %d and %v", n, err)
+	}
+}
+
+func TestVerifyHeaderChain(t *testing.T) {
+	parent := block.BlockHeader{Version: 1, Height: 3, Timestamp: 10, PreviousHash: hashing.New([]byte("a")), MerkleRootHash: []byte{}}
+	child := block.BlockHeader{Version: 1, Height: 4, Timestamp: 11, PreviousHash: block.HashBlockHeader(parent), MerkleRootHash: []byte{}}
+	grandchild := block.BlockHeader{Version: 1, Height: 5, Timestamp: 12, PreviousHash: block.HashBlockHeader(child), MerkleRootHash: []byte{}}
+
+	if err := verifyHeaderChain(parent, []block.BlockHeader{child, grandchild}); err != nil {
+		t.Errorf("expected linked headers to verify: %v", err)
+	}
+	if err := verifyHeaderChain(parent, []block.BlockHeader{grandchild}); err == nil {
+		t.Errorf("expected gap in headers to fail")
+	}
+	if err := verifyHeaderChain(parent, nil); err == nil {
+		t.Errorf("expected empty headers to fail")
+	}
+}
+
+func equalUint64s(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -1,15 +1,34 @@
+// Package config loads the node's configuration. Settings are layered: defaults, then the configuration file,
+// then AURUM_* environment variables, then command line flags, each overriding the ones before it. The result is
+// validated as a whole, so every invalid setting is reported at once
 package config
 
 import (
+	"bytes"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
-	"go/build"
+	"flag"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/SIGBlockchain/project_aurum/internal/address"
 	"github.com/SIGBlockchain/project_aurum/internal/constants"
+	"github.com/SIGBlockchain/project_aurum/internal/logging"
+	"github.com/SIGBlockchain/project_aurum/internal/publickey"
 )
 
+// EnvPrefix prefixes the environment variable of each setting, which is named after its flag in upper case,
+// such as AURUM_PORT for -port
+const EnvPrefix = "AURUM_"
+
 type Config struct {
 	Version                 uint16
 	InitialAurumSupply      uint64
@@ -17,42 +36,299 @@ type Config struct {
 	BlockProductionInterval string
 	Localhost               bool
 	MintAddr                string
+	Peers                   []string
+	Sync                    bool
+	Producers               []string
+	ProducerKeyFile         string
+	SignedFrom              uint64 // height of the first block producers must sign; older blocks may be unsigned
+	BlockReward             uint64
+	HalvingInterval         uint64
+	MintCap                 uint64
+	MintPeriod              uint64
+	DataDir                 string // directory holding the ledger and tables, see datadir
+	LogLevel                string // debug, info, warn or error
+	APIMaxBatch             uint64 // most blocks or headers served in one batch request
+	APIMaxBodyBytes         int64  // largest request body accepted
 }
 
-// GetBinDir returns a string of the project root bin directory
-// TODO does this need a test?
-func GetBinDir() string {
-	return build.Default.GOPATH + constants.ProjectRoot + "bin/"
+// FieldError is a setting with an invalid value
+type FieldError struct {
+	Field  string
+	Value  string
+	Reason string
 }
 
-// GetConfigFile opens a config file based on a filepath and returns an error if error occurs
-// TODO does this need a test?
-func GetConfigFile(path string) (*os.File, error) {
-	file, err := os.Open(path)
-	if err != nil {
-		return nil, errors.New("Failed to load configuration file : " + err.Error())
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s %q: %s", e.Field, e.Value, e.Reason)
+}
+
+// ValidationError is every invalid setting of a configuration
+type ValidationError []*FieldError
+
+func (e ValidationError) Error() string {
+	messages := make([]string, len(e))
+	for i, fieldErr := range e {
+		messages[i] = fieldErr.Error()
+	}
+	return "Invalid configuration: " + strings.Join(messages, "; ")
+}
+
+// Defaults returns the settings used where the file, environment and flags set nothing
+func Defaults() Config {
+	return Config{
+		Version:                 1,
+		InitialAurumSupply:      500000000000000,
+		Port:                    "26000",
+		BlockProductionInterval: "12h",
+		DataDir:                 constants.DefaultDataDir,
+		LogLevel:                "info",
+		APIMaxBatch:             100,
+		APIMaxBodyBytes:         1 << 20,
 	}
-	return file, nil
 }
 
-// LoadConfiguration fills a Config struct with configuration info from a file and returns
-// the struct
-func LoadConfiguration() (*Config, error) {
-	configFile, err := GetConfigFile(constants.ConfigurationFile)
+// Load returns the configuration layering the defaults, the configuration file filename, the environment and
+// the flags in args, after validating it
+func Load(filename string, args []string) (Config, error) {
+	return LoadWith(filename, args, nil)
+}
+
+// LoadWith is Load calling apply, if not nil, on the layered configuration before validating it, such as to
+// apply the settings of a genesis spec. Invalid environment variables are reported in one ValidationError with
+// the invalid settings
+func LoadWith(filename string, args []string, apply func(cfg *Config) error) (Config, error) {
+	cfg := Defaults()
+	if err := cfg.LoadFile(filename); err != nil {
+		return cfg, err
+	}
+	var invalid ValidationError
+	if err := cfg.LoadEnv(os.LookupEnv); err != nil {
+		invalid = append(invalid, err.(ValidationError)...)
+	}
+	if err := cfg.ParseFlags(args); err != nil {
+		return cfg, err
+	}
+	if apply != nil {
+		if err := apply(&cfg); err != nil {
+			return cfg, err
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		invalid = append(invalid, err.(ValidationError)...)
+	}
+	if len(invalid) > 0 {
+		return cfg, invalid
+	}
+	return cfg, nil
+}
+
+// LoadFile overrides the settings given in the configuration file filename
+func (cfg *Config) LoadFile(filename string) error {
+	data, err := ioutil.ReadFile(filename)
 	if err != nil {
-		return nil, err
+		return errors.New("Failed to load configuration file : " + err.Error())
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(cfg); err != nil {
+		return errors.New("Failed to unmarshall configuration data : " + err.Error())
+	}
+	return nil
+}
+
+// LoadEnv overrides the settings whose environment variable lookup finds. It returns a ValidationError with
+// every variable that could not be parsed, leaving their settings unchanged
+func (cfg *Config) LoadEnv(lookup func(key string) (string, bool)) error {
+	var invalid ValidationError
+	cfg.flagSet().VisitAll(func(f *flag.Flag) {
+		name := EnvPrefix + strings.ToUpper(f.Name)
+		if value, ok := lookup(name); ok {
+			// a flag value may be overwritten by a value it fails to parse
+			previous := f.Value.String()
+			if err := f.Value.Set(value); err != nil {
+				f.Value.Set(previous)
+				invalid = append(invalid, &FieldError{name, value, err.Error()})
+			}
+		}
+	})
+	if len(invalid) > 0 {
+		return invalid
+	}
+	return nil
+}
+
+// ParseFlags overrides the settings given as flags in args. It returns flag.ErrHelp if args ask for help
+func (cfg *Config) ParseFlags(args []string) error {
+	fs := cfg.flagSet()
+	fs.SetOutput(ioutil.Discard)
+	if err := fs.Parse(args); err == flag.ErrHelp {
+		return err
+	} else if err != nil {
+		return errors.New("Failed to parse flags: " + err.Error())
+	}
+	if fs.NArg() > 0 {
+		return errors.New("Unexpected arguments: " + strings.Join(fs.Args(), " "))
+	}
+	return nil
+}
+
+// PrintFlags writes the flags of the settings and their current values to out
+func (cfg *Config) PrintFlags(out io.Writer) {
+	fs := cfg.flagSet()
+	fs.SetOutput(out)
+	fs.PrintDefaults()
+}
+
+// flagSet returns the flags setting cfg
+func (cfg *Config) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("aurum", flag.ContinueOnError)
+	fs.Var((*uint16Value)(&cfg.Version), "version", "enter version number")
+	fs.Uint64Var(&cfg.InitialAurumSupply, "supply", cfg.InitialAurumSupply, "enter a number for initial aurum supply")
+	fs.StringVar(&cfg.Port, "port", cfg.Port, "enter port number")
+	fs.StringVar(&cfg.BlockProductionInterval, "interval", cfg.BlockProductionInterval, "enter a time for block production interval e.g. 1h or 20s")
+	fs.BoolVar(&cfg.Localhost, "localhost", cfg.Localhost, "syntax: -localhost=/boolean here/")
+	fs.StringVar(&cfg.MintAddr, "mint", cfg.MintAddr, "enter a mint address (aur1... or 64 characters hex string)")
+	fs.BoolVar(&cfg.Sync, "sync", cfg.Sync, "syntax: -sync=/boolean here/ (sync the ledger from peers on startup)")
+	fs.Var((*listValue)(&cfg.Peers), "peers", "enter a comma separated list of peer hosts e.g. localhost:26001,localhost:26002")
+	fs.Var((*listValue)(&cfg.Producers), "producers", "enter a comma separated list of authorized producer public keys (hex encoded PEM)\n(slots of one block production interval are assigned to them in turn)")
+	fs.StringVar(&cfg.ProducerKeyFile, "producerkey", cfg.ProducerKeyFile, "enter the path of the PEM encoded private key this node signs blocks with")
+	fs.Uint64Var(&cfg.SignedFrom, "signedfrom", cfg.SignedFrom, "enter the height of the first block producers must sign\n(older unsigned blocks are kept when a chain switches to producers)")
+	fs.Uint64Var(&cfg.BlockReward, "reward", cfg.BlockReward, "enter the aurum minted to the producer of each block")
+	fs.Uint64Var(&cfg.HalvingInterval, "halving", cfg.HalvingInterval, "enter the number of blocks after which the block reward halves\n(0 keeps the reward fixed)")
+	fs.Uint64Var(&cfg.MintCap, "mintcap", cfg.MintCap, "enter the aurum the mint key may mint per mint period")
+	fs.Uint64Var(&cfg.MintPeriod, "mintperiod", cfg.MintPeriod, "enter the number of blocks in a mint period\n(0 applies the mint cap to every block)")
+	fs.StringVar(&cfg.DataDir, "datadir", cfg.DataDir, "enter the directory holding the ledger and tables, locked while the node runs")
+	fs.StringVar(&cfg.LogLevel, "loglevel", cfg.LogLevel, "enter the lowest level of messages logged: debug, info, warn or error")
+	fs.Uint64Var(&cfg.APIMaxBatch, "apimaxbatch", cfg.APIMaxBatch, "enter the most blocks or headers served in one batch request")
+	fs.Int64Var(&cfg.APIMaxBodyBytes, "apimaxbody", cfg.APIMaxBodyBytes, "enter the largest request body in bytes the node accepts")
+	return fs
+}
+
+// Validate checks every setting and returns a ValidationError listing the invalid ones, or nil
+func (cfg Config) Validate() error {
+	var invalid ValidationError
+	check := func(field string, value string, reason string) {
+		invalid = append(invalid, &FieldError{field, value, reason})
+	}
+
+	if cfg.Version == 0 {
+		check("Version", "0", "must be at least 1")
+	} else if cfg.Version >= constants.SignedBlockVersion && len(cfg.Producers) == 0 {
+		check("Version", strconv.Itoa(int(cfg.Version)), "signs blocks, which needs Producers to verify their signatures")
+	}
+	if port, err := strconv.ParseUint(cfg.Port, 10, 16); err != nil || port == 0 {
+		check("Port", cfg.Port, "must be a port number from 1 to 65535")
+	}
+	if interval, err := time.ParseDuration(cfg.BlockProductionInterval); err != nil || interval <= 0 {
+		check("BlockProductionInterval", cfg.BlockProductionInterval, "must be a positive duration with units, e.g. 1h or 20s")
+	}
+	if cfg.MintAddr != "" {
+		if _, err := address.Decode(cfg.MintAddr); err != nil {
+			check("MintAddr", cfg.MintAddr, "must be an aur1... address or 64 hex characters")
+		}
+	}
+	for _, peer := range cfg.Peers {
+		if host, port, err := net.SplitHostPort(peer); err != nil || host == "" || port == "" {
+			check("Peers", peer, "must be a host:port")
+		}
+	}
+	if cfg.Sync && len(cfg.Peers) == 0 {
+		check("Sync", "true", "needs Peers to sync the ledger from")
+	}
+	for _, producer := range cfg.Producers {
+		encodedProducerKey, err := hex.DecodeString(producer)
+		if err == nil {
+			_, err = publickey.Decode(encodedProducerKey)
+		}
+		if err != nil {
+			check("Producers", producer, "must be a hex encoded PEM public key")
+		}
+	}
+	if cfg.DataDir == "" {
+		check("DataDir", cfg.DataDir, "must not be empty")
+	}
+	if _, err := logging.ParseLevel(cfg.LogLevel); err != nil {
+		check("LogLevel", cfg.LogLevel, "must be debug, info, warn or error")
+	}
+	if cfg.APIMaxBatch == 0 {
+		check("APIMaxBatch", "0", "must be at least 1")
+	}
+	if cfg.APIMaxBodyBytes <= 0 {
+		check("APIMaxBodyBytes", strconv.FormatInt(cfg.APIMaxBodyBytes, 10), "must be positive")
 	}
-	defer configFile.Close()
 
-	cfgData, err := ioutil.ReadAll(configFile)
+	if len(invalid) > 0 {
+		return invalid
+	}
+	return nil
+}
+
+// reloadable are the settings a running node applies on reload; the others are only read on startup
+var reloadable = map[string]bool{"BlockProductionInterval": true, "LogLevel": true}
+
+// Reload returns the configuration a running node with cfg changes to on reloading reloaded, such as from the
+// configuration file after it was edited. Only BlockProductionInterval and LogLevel may change, and the interval
+// only without authorized producers, whose slots it sets. If reloaded is invalid or changes another setting,
+// Reload changes nothing and returns a ValidationError explaining each rejected setting
+func (cfg Config) Reload(reloaded Config) (Config, error) {
+	if err := reloaded.Validate(); err != nil {
+		return cfg, err
+	}
+	var rejected ValidationError
+	running, changed := reflect.ValueOf(cfg), reflect.ValueOf(reloaded)
+	for i := 0; i < running.NumField(); i++ {
+		field := running.Type().Field(i).Name
+		value := fmt.Sprint(changed.Field(i).Interface())
+		if value == fmt.Sprint(running.Field(i).Interface()) {
+			continue
+		}
+		if !reloadable[field] {
+			rejected = append(rejected, &FieldError{field, value, "cannot change while the node runs, restart it to apply"})
+		} else if field == "BlockProductionInterval" && len(cfg.Producers) > 0 {
+			rejected = append(rejected, &FieldError{field, value, "sets the slots of the authorized producers, which every producer must agree on, restart the network to apply"})
+		}
+	}
+	if len(rejected) > 0 {
+		return cfg, rejected
+	}
+	return reloaded, nil
+}
+
+// uint16Value is a flag setting a uint16
+type uint16Value uint16
+
+func (v *uint16Value) Set(s string) error {
+	parsed, err := strconv.ParseUint(s, 10, 16)
 	if err != nil {
-		return nil, errors.New("Failed to read configuration file : " + err.Error())
+		return err
 	}
+	*v = uint16Value(parsed)
+	return nil
+}
 
-	cfg := Config{}
-	if err := json.Unmarshal(cfgData, &cfg); err != nil {
-		return nil, errors.New("Failed to unmarshall configuration data : " + err.Error())
+func (v *uint16Value) String() string {
+	if v == nil {
+		return "0"
 	}
+	return strconv.FormatUint(uint64(*v), 10)
+}
 
-	return &cfg, nil
+// listValue is a flag setting a list from comma separated values. Blank values are dropped
+type listValue []string
+
+func (v *listValue) Set(s string) error {
+	*v = nil
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*v = append(*v, item)
+		}
+	}
+	return nil
+}
+
+func (v *listValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return strings.Join(*v, ",")
 }
@@ -1,17 +1,25 @@
 package config
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"flag"
 	"io/ioutil"
 	"os"
 	"reflect"
 	"testing"
 
 	"github.com/SIGBlockchain/project_aurum/internal/constants"
+	"github.com/SIGBlockchain/project_aurum/internal/publickey"
 )
 
 func TestLoadConfigurationFile(t *testing.T) {
-	cfg := Config{1, 20, "5000", "40s", false, ""}
+	producerKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	encodedProducerKey, _ := publickey.Encode(&producerKey.PublicKey)
+	cfg := Config{1, 20, "5000", "40s", false, "", []string{"localhost:26001"}, false, []string{hex.EncodeToString(encodedProducerKey)}, "producer.pem", 0, 50, 1000, 500, 100, "data/", "debug", 10, 4096}
 	marshalledCfg, err := json.Marshal(cfg)
 	if err != nil {
 		t.Errorf("failed to marshall configuration struct: %v", err)
@@ -24,11 +32,189 @@ func TestLoadConfigurationFile(t *testing.T) {
 			t.Errorf("failed to remove config file: %v", err)
 		}
 	}()
-	fileCfg, err := LoadConfiguration()
+	fileCfg, err := Load(constants.ConfigurationFile, nil)
 	if err != nil {
 		t.Errorf("failed to load configuration file: %v", err)
 	}
-	if !reflect.DeepEqual(cfg, *fileCfg) {
-		t.Errorf("structs to not match: got %+v want %+v", *fileCfg, cfg)
+	if !reflect.DeepEqual(cfg, fileCfg) {
+		t.Errorf("structs to not match: got %+v want %+v", fileCfg, cfg)
+	}
+
+	ioutil.WriteFile(constants.ConfigurationFile, []byte(`{"Port": "5000", "Prot": "5001"}`), os.ModePerm)
+	if _, err := Load(constants.ConfigurationFile, nil); err == nil {
+		t.Errorf("expected an unknown setting to be rejected")
+	}
+
+	// settings applied with LoadWith are validated with the rest
+	ioutil.WriteFile(constants.ConfigurationFile, []byte(`{"Version": 2, "Producers": []}`), os.ModePerm)
+	if _, err := Load(constants.ConfigurationFile, nil); err == nil {
+		t.Errorf("expected signed blocks without producers to be rejected")
+	}
+	applyProducers := func(cfg *Config) error {
+		cfg.Producers = []string{hex.EncodeToString(encodedProducerKey)}
+		return nil
+	}
+	if _, err := LoadWith(constants.ConfigurationFile, nil, applyProducers); err != nil {
+		t.Errorf("expected applied producers to be validated: %v", err)
+	}
+
+	// invalid environment variables are reported with the invalid settings
+	os.Setenv(EnvPrefix+"APIMAXBATCH", "many")
+	os.Setenv(EnvPrefix+"PORT", "http")
+	defer os.Unsetenv(EnvPrefix + "APIMAXBATCH")
+	defer os.Unsetenv(EnvPrefix + "PORT")
+	_, err = Load(constants.ConfigurationFile, nil)
+	invalid, ok := err.(ValidationError)
+	var fields []string
+	for _, fieldErr := range invalid {
+		fields = append(fields, fieldErr.Field)
+	}
+	if want := []string{EnvPrefix + "APIMAXBATCH", "Version", "Port"}; !ok || !reflect.DeepEqual(fields, want) {
+		t.Errorf("expected invalid settings %v, got %v", want, err)
+	}
+}
+
+func TestLayers(t *testing.T) {
+	cfg := Defaults()
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("expected the defaults to be valid: %v", err)
+	}
+
+	// the file overrides the defaults it sets and keeps the others
+	tmpfile, err := ioutil.TempFile("", "mockconfig")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	tmpfile.Close()
+	defer os.Remove(tmpfile.Name())
+	ioutil.WriteFile(tmpfile.Name(), []byte(`{"Port": "5000", "Peers": ["localhost:26001"], "LogLevel": "warn"}`), 0644)
+	if err := cfg.LoadFile(tmpfile.Name()); err != nil {
+		t.Fatalf("failed to load file: %v", err)
+	}
+	if cfg.Port != "5000" || cfg.LogLevel != "warn" || cfg.BlockProductionInterval != Defaults().BlockProductionInterval {
+		t.Errorf("unexpected configuration after file: %+v", cfg)
+	}
+
+	// the environment overrides the file, and flags the environment
+	env := map[string]string{"AURUM_PORT": "6000", "AURUM_PEERS": "a:1, b:2", "AURUM_VERSION": "2", "AURUM_LOGLEVEL": "error"}
+	lookup := func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+	if err := cfg.LoadEnv(lookup); err != nil {
+		t.Fatalf("failed to load environment: %v", err)
+	}
+	if err := cfg.ParseFlags([]string{"-port", "7000", "-localhost", "-apimaxbatch=20"}); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+	if cfg.Port != "7000" || !reflect.DeepEqual(cfg.Peers, []string{"a:1", "b:2"}) || cfg.Version != 2 ||
+		cfg.LogLevel != "error" || !cfg.Localhost || cfg.APIMaxBatch != 20 {
+		t.Errorf("unexpected configuration after environment and flags: %+v", cfg)
+	}
+
+	invalid, ok := cfg.LoadEnv(func(string) (string, bool) { return "x", true }).(ValidationError)
+	if !ok || len(invalid) < 2 || invalid[0].Field != EnvPrefix+"APIMAXBATCH" {
+		t.Errorf("expected every invalid environment variable to be rejected, got %v", invalid)
+	}
+	if cfg.APIMaxBatch != 20 || cfg.Version != 2 {
+		t.Errorf("expected invalid environment variables to leave their settings unchanged, got %+v", cfg)
+	}
+	if err := cfg.ParseFlags([]string{"-help"}); err != flag.ErrHelp {
+		t.Errorf("expected -help to return flag.ErrHelp, got %v", err)
+	}
+	if err := cfg.ParseFlags([]string{"-port", "1", "extra"}); err == nil {
+		t.Errorf("expected an unexpected argument to be rejected")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Defaults()
+	cfg.Version = 0
+	cfg.Port = "http"
+	cfg.BlockProductionInterval = "40"
+	cfg.MintAddr = "aur1xyz"
+	cfg.Peers = []string{"localhost:26001", "localhost"}
+	cfg.Producers = []string{"00"}
+	cfg.DataDir = ""
+	cfg.LogLevel = "verbose"
+	cfg.APIMaxBatch = 0
+	cfg.APIMaxBodyBytes = -1
+
+	err := cfg.Validate()
+	invalid, ok := err.(ValidationError)
+	if !ok {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	var fields []string
+	for _, fieldErr := range invalid {
+		fields = append(fields, fieldErr.Field)
+	}
+	want := []string{"Version", "Port", "BlockProductionInterval", "MintAddr", "Peers", "Producers", "DataDir", "LogLevel", "APIMaxBatch", "APIMaxBodyBytes"}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("expected invalid fields %v, got %v", want, fields)
+	}
+	if invalid[4].Value != "localhost" {
+		t.Errorf("expected the invalid peer to be reported, got %q", invalid[4].Value)
+	}
+
+	// without peers a syncing node would start its own chain from a local genesis block
+	cfg = Defaults()
+	cfg.Sync = true
+	if invalid, ok := cfg.Validate().(ValidationError); !ok || len(invalid) != 1 || invalid[0].Field != "Sync" {
+		t.Errorf("expected sync without peers to be rejected, got %v", invalid)
+	}
+	cfg.Peers = []string{"localhost:26001"}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("expected sync with peers to be valid: %v", err)
+	}
+
+	// without producers nobody can verify the signature of a block, so a forged producer would be paid its reward
+	cfg = Defaults()
+	cfg.Version = constants.SignedBlockVersion
+	if invalid, ok := cfg.Validate().(ValidationError); !ok || len(invalid) != 1 || invalid[0].Field != "Version" {
+		t.Errorf("expected signed blocks without producers to be rejected, got %v", invalid)
+	}
+}
+
+func TestReload(t *testing.T) {
+	cfg := Defaults()
+	cfg.Peers = []string{}
+	reloaded := Defaults()
+	reloaded.BlockProductionInterval = "30s"
+	reloaded.LogLevel = "debug"
+	applied, err := cfg.Reload(reloaded)
+	if err != nil {
+		t.Fatalf("failed to reload: %v", err)
+	}
+	if applied.BlockProductionInterval != "30s" || applied.LogLevel != "debug" {
+		t.Errorf("expected the interval and log level to be reloaded, got %+v", applied)
+	}
+
+	// a setting needing a restart rejects the whole reload
+	reloaded.Port = "6000"
+	reloaded.DataDir = "elsewhere/"
+	applied, err = cfg.Reload(reloaded)
+	rejected, ok := err.(ValidationError)
+	if !ok || len(rejected) != 2 || rejected[0].Field != "Port" || rejected[1].Field != "DataDir" {
+		t.Errorf("expected Port and DataDir to be rejected, got %v", err)
+	}
+	if !reflect.DeepEqual(applied, cfg) {
+		t.Errorf("expected a rejected reload to change nothing, got %+v", applied)
+	}
+
+	// the interval sets the slots of authorized producers
+	producerKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	encodedProducerKey, _ := publickey.Encode(&producerKey.PublicKey)
+	cfg.Producers = []string{hex.EncodeToString(encodedProducerKey)}
+	reloaded = cfg
+	reloaded.BlockProductionInterval = "30s"
+	if _, err := cfg.Reload(reloaded); err == nil {
+		t.Errorf("expected the interval of authorized producers to be rejected")
+	}
+
+	reloaded = cfg
+	reloaded.LogLevel = "verbose"
+	if _, err := cfg.Reload(reloaded); err == nil {
+		t.Errorf("expected an invalid reload to be rejected")
 	}
 }
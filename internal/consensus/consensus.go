@@ -0,0 +1,149 @@
+// Package consensus decides which producers may build blocks and when, using proof of authority.
+// Time is divided into slots of equal length, counted from the Unix epoch, and the slots are assigned
+// to the registered producers in turn
+package consensus
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SIGBlockchain/project_aurum/internal/block"
+	"github.com/SIGBlockchain/project_aurum/internal/constants"
+	"github.com/SIGBlockchain/project_aurum/internal/hashing"
+	"github.com/SIGBlockchain/project_aurum/internal/publickey"
+	"github.com/SIGBlockchain/project_aurum/internal/validation"
+)
+
+// Authority is the registry of producers allowed to build blocks and their slot schedule
+type Authority struct {
+	producers    [][]byte
+	keys         []*ecdsa.PublicKey
+	slotDuration time.Duration
+	signedFrom   uint64 // height of the first block that must be signed
+}
+
+// NewAuthority returns an Authority for the given producer public keys, which own the slots in the
+// order given, with slots lasting slotDuration. Blocks from height signedFrom on must be signed by the producers;
+// older blocks may be unsigned blocks of earlier versions, built before the chain switched to proof of authority
+func NewAuthority(producerKeys []*ecdsa.PublicKey, slotDuration time.Duration, signedFrom uint64) (*Authority, error) {
+	if len(producerKeys) == 0 {
+		return nil, errors.New("at least one producer is required")
+	}
+	if slotDuration <= 0 {
+		return nil, errors.New("slot duration must be positive")
+	}
+	a := &Authority{slotDuration: slotDuration, signedFrom: signedFrom}
+	for _, key := range producerKeys {
+		encodedKey, err := publickey.Encode(key)
+		if err != nil {
+			return nil, errors.New("Failed to encode producer public key: " + err.Error())
+		}
+		producer := hashing.New(encodedKey)
+		if a.IsProducer(producer) {
+			return nil, errors.New("duplicate producer " + hex.EncodeToString(producer))
+		}
+		a.producers = append(a.producers, producer)
+		a.keys = append(a.keys, key)
+	}
+	return a, nil
+}
+
+// ParseProducers decodes hex encoded PEM producer public keys, e.g. from the configuration file
+func ParseProducers(hexProducers []string) ([]*ecdsa.PublicKey, error) {
+	keys := make([]*ecdsa.PublicKey, len(hexProducers))
+	for i, hexProducer := range hexProducers {
+		encodedKey, err := hex.DecodeString(hexProducer)
+		if err != nil {
+			return nil, errors.New("Invalid producer public key: " + err.Error())
+		}
+		if keys[i], err = publickey.Decode(encodedKey); err != nil {
+			return nil, errors.New("Invalid producer public key: " + err.Error())
+		}
+	}
+	return keys, nil
+}
+
+// Producers returns the public key hashes of the registered producers in slot order
+func (a *Authority) Producers() [][]byte {
+	return a.producers
+}
+
+// IsProducer returns whether pkhash belongs to a registered producer
+func (a *Authority) IsProducer(pkhash []byte) bool {
+	return a.KeyOf(pkhash) != nil
+}
+
+// KeyOf returns the public key of the registered producer with public key hash pkhash, or nil if there is none
+func (a *Authority) KeyOf(pkhash []byte) *ecdsa.PublicKey {
+	for i, producer := range a.producers {
+		if bytes.Equal(producer, pkhash) {
+			return a.keys[i]
+		}
+	}
+	return nil
+}
+
+// SlotAt returns the slot a Unix nanosecond timestamp falls in
+func (a *Authority) SlotAt(timestamp int64) uint64 {
+	if timestamp < 0 {
+		return 0
+	}
+	return uint64(timestamp / int64(a.slotDuration))
+}
+
+// SlotStart returns the Unix nanosecond timestamp at which slot begins
+func (a *Authority) SlotStart(slot uint64) int64 {
+	return int64(slot) * int64(a.slotDuration)
+}
+
+// ProducerOf returns the public key hash of the producer that owns slot
+func (a *Authority) ProducerOf(slot uint64) []byte {
+	return a.producers[slot%uint64(len(a.producers))]
+}
+
+// NextSlot returns the first slot at or after fromSlot owned by pkhash
+func (a *Authority) NextSlot(pkhash []byte, fromSlot uint64) (uint64, error) {
+	for slot := fromSlot; slot < fromSlot+uint64(len(a.producers)); slot++ {
+		if bytes.Equal(a.ProducerOf(slot), pkhash) {
+			return slot, nil
+		}
+	}
+	return 0, errors.New(hex.EncodeToString(pkhash) + " is not a registered producer")
+}
+
+// CanProduce returns whether pkhash may build a block on top of parent at timestamp:
+// the slot must be its own and no block may have been built in the slot yet
+func (a *Authority) CanProduce(pkhash []byte, timestamp int64, parent block.BlockHeader) bool {
+	slot := a.SlotAt(timestamp)
+	return bytes.Equal(a.ProducerOf(slot), pkhash) && (parent.Height == 0 || slot > a.SlotAt(parent.Timestamp))
+}
+
+// ValidateBlock checks that b was signed by a registered producer in its own slot, and that the slot is after
+// the slot of its parent, so every slot holds at most one block of a branch. Unsigned blocks below the height
+// signatures are required from are not checked
+func (a *Authority) ValidateBlock(b block.BlockHeader, parent block.BlockHeader) error {
+	if b.Version < constants.SignedBlockVersion {
+		if b.Height < a.signedFrom {
+			return nil
+		}
+		return fmt.Errorf("block #%d is not signed by its producer", b.Height)
+	}
+	key := a.KeyOf(b.Producer)
+	if key == nil {
+		return fmt.Errorf("block #%d was built by %s, which is not a registered producer", b.Height, hex.EncodeToString(b.Producer))
+	}
+	if !bytes.Equal(a.ProducerOf(a.SlotAt(b.Timestamp)), b.Producer) {
+		return fmt.Errorf("block #%d was built outside its producer's slot", b.Height)
+	}
+	if !validation.ValidateBlockSignature(b, key) {
+		return fmt.Errorf("block #%d has an invalid producer signature", b.Height)
+	}
+	if parent.Height > 0 && a.SlotAt(b.Timestamp) <= a.SlotAt(parent.Timestamp) {
+		return fmt.Errorf("block #%d was built in the same slot as its parent", b.Height)
+	}
+	return nil
+}
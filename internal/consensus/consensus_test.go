@@ -0,0 +1,175 @@
+package consensus
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/SIGBlockchain/project_aurum/internal/block"
+	"github.com/SIGBlockchain/project_aurum/internal/constants"
+	"github.com/SIGBlockchain/project_aurum/internal/hashing"
+	"github.com/SIGBlockchain/project_aurum/internal/publickey"
+)
+
+func testProducerKeys(t *testing.T) []*ecdsa.PrivateKey {
+	keys := make([]*ecdsa.PrivateKey, 3)
+	for i := range keys {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = key
+	}
+	return keys
+}
+
+func publicKeys(keys []*ecdsa.PrivateKey) []*ecdsa.PublicKey {
+	publicKeys := make([]*ecdsa.PublicKey, len(keys))
+	for i, key := range keys {
+		publicKeys[i] = &key.PublicKey
+	}
+	return publicKeys
+}
+
+func pkhash(key *ecdsa.PrivateKey) []byte {
+	encodedKey, _ := publickey.Encode(&key.PublicKey)
+	return hashing.New(encodedKey)
+}
+
+func signedHeader(t *testing.T, key *ecdsa.PrivateKey, height uint64, timestamp int64) block.BlockHeader {
+	b, err := block.New(constants.SignedBlockVersion, height, make([]byte, 32), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Timestamp = timestamp
+	if err := b.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	return b.GetHeader()
+}
+
+func TestNewAuthority(t *testing.T) {
+	keys := publicKeys(testProducerKeys(t))
+	tests := []struct {
+		name         string
+		producers    []*ecdsa.PublicKey
+		slotDuration time.Duration
+		wantErr      bool
+	}{
+		{name: "valid", producers: keys, slotDuration: time.Second},
+		{name: "no producers", producers: nil, slotDuration: time.Second, wantErr: true},
+		{name: "zero slot duration", producers: keys, slotDuration: 0, wantErr: true},
+		{name: "duplicate producer", producers: []*ecdsa.PublicKey{keys[0], keys[1], keys[0]}, slotDuration: time.Second, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewAuthority(tt.producers, tt.slotDuration, 0); (err != nil) != tt.wantErr {
+				t.Errorf("NewAuthority() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseProducers(t *testing.T) {
+	keys := testProducerKeys(t)
+	encodedKey, _ := publickey.Encode(&keys[1].PublicKey)
+	parsed, err := ParseProducers([]string{hex.EncodeToString(encodedKey)})
+	if err != nil || len(parsed) != 1 || !parsed[0].Equal(&keys[1].PublicKey) {
+		t.Errorf("unexpected result %v, %v", parsed, err)
+	}
+	if _, err := ParseProducers([]string{hex.EncodeToString(pkhash(keys[0]))}); err == nil {
+		t.Errorf("expected a public key hash to be rejected")
+	}
+	if _, err := ParseProducers([]string{"zz" + hex.EncodeToString(encodedKey)[2:]}); err == nil {
+		t.Errorf("expected non hex key to be rejected")
+	}
+}
+
+func TestSlots(t *testing.T) {
+	keys := testProducerKeys(t)
+	a, _ := NewAuthority(publicKeys(keys), time.Second, 0)
+
+	if slot := a.SlotAt(int64(7*time.Second + 500*time.Millisecond)); slot != 7 {
+		t.Errorf("expected slot 7, got %d", slot)
+	}
+	if start := a.SlotStart(7); start != int64(7*time.Second) {
+		t.Errorf("expected slot 7 to start at %d, got %d", int64(7*time.Second), start)
+	}
+	for slot := uint64(0); slot < 6; slot++ {
+		if !bytes.Equal(a.ProducerOf(slot), pkhash(keys[slot%3])) {
+			t.Errorf("slot %d assigned to the wrong producer", slot)
+		}
+	}
+	if slot, err := a.NextSlot(pkhash(keys[0]), 7); err != nil || slot != 9 {
+		t.Errorf("expected next slot 9 for the first producer, got %d (%v)", slot, err)
+	}
+	if slot, err := a.NextSlot(pkhash(keys[1]), 7); err != nil || slot != 7 {
+		t.Errorf("expected next slot 7 for the second producer, got %d (%v)", slot, err)
+	}
+	if _, err := a.NextSlot(hashing.New([]byte("outsider")), 7); err == nil {
+		t.Errorf("expected an unregistered producer to have no slot")
+	}
+	if a.KeyOf(pkhash(keys[2])) != &keys[2].PublicKey {
+		t.Errorf("expected the third producer's key to be returned")
+	}
+}
+
+func TestCanProduceAndValidateBlock(t *testing.T) {
+	keys := testProducerKeys(t)
+	a, _ := NewAuthority(publicKeys(keys), time.Second, 0)
+	parent := block.BlockHeader{Height: 4, Timestamp: int64(7 * time.Second)}
+
+	// Slot 8 belongs to the third producer
+	inSlot := int64(8*time.Second + time.Millisecond)
+	if !a.CanProduce(pkhash(keys[2]), inSlot, parent) {
+		t.Errorf("expected the third producer to produce in its slot")
+	}
+	if a.CanProduce(pkhash(keys[0]), inSlot, parent) {
+		t.Errorf("expected the first producer not to produce in another producer's slot")
+	}
+	if a.CanProduce(pkhash(keys[1]), parent.Timestamp+1, parent) {
+		t.Errorf("expected no second block in the parent's slot")
+	}
+
+	if err := a.ValidateBlock(signedHeader(t, keys[2], 5, inSlot), parent); err != nil {
+		t.Errorf("expected block in a later slot to be valid: %v", err)
+	}
+	if err := a.ValidateBlock(signedHeader(t, keys[1], 5, parent.Timestamp+1), parent); err == nil {
+		t.Errorf("expected block in its parent's slot to be rejected")
+	}
+	if err := a.ValidateBlock(signedHeader(t, keys[0], 5, inSlot), parent); err == nil {
+		t.Errorf("expected block outside its producer's slot to be rejected")
+	}
+	outsider, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err := a.ValidateBlock(signedHeader(t, outsider, 5, inSlot), parent); err == nil {
+		t.Errorf("expected block from an unregistered producer to be rejected")
+	}
+	forged := signedHeader(t, keys[0], 5, inSlot)
+	forged.Producer = pkhash(keys[2])
+	if err := a.ValidateBlock(forged, parent); err == nil {
+		t.Errorf("expected block signed by another producer to be rejected")
+	}
+	if err := a.ValidateBlock(block.BlockHeader{Version: 1, Height: 5, Timestamp: inSlot}, parent); err == nil {
+		t.Errorf("expected unsigned block to be rejected")
+	}
+	genesis := block.BlockHeader{Height: 0, Timestamp: inSlot}
+	if err := a.ValidateBlock(signedHeader(t, keys[2], 1, inSlot+1), genesis); err != nil {
+		t.Errorf("expected the genesis slot not to be reserved: %v", err)
+	}
+
+	// blocks below the height signatures are required from may be unsigned
+	switched, _ := NewAuthority(publicKeys(keys), time.Second, 6)
+	if err := switched.ValidateBlock(block.BlockHeader{Version: 1, Height: 5, Timestamp: inSlot}, parent); err != nil {
+		t.Errorf("expected unsigned block before the switch to producers to be valid: %v", err)
+	}
+	if err := switched.ValidateBlock(block.BlockHeader{Version: 1, Height: 6, Timestamp: inSlot}, parent); err == nil {
+		t.Errorf("expected unsigned block from the switch to producers on to be rejected")
+	}
+	if err := switched.ValidateBlock(signedHeader(t, keys[0], 5, inSlot), parent); err == nil {
+		t.Errorf("expected signed block before the switch to follow the slot schedule")
+	}
+}
@@ -1,8 +1,8 @@
 package constants
 
 const (
-	ProjectRoot       = "/src/github.com/SIGBlockchain/project_aurum/"
-	DockerVolumeDir   = "../data/"
+	// The data directory, relative to the bin directory nodes run in, unless configured otherwise
+	DefaultDataDir    = "../data/"
 	AccountsTable     = "accounts.db"
 	MetadataTable     = "metadata.db"
 	ProducerTable     = "producer.db"
@@ -10,5 +10,19 @@ const (
 	GenesisAddresses  = "genesis_hashes.txt"
 	ConfigurationFile = "config.json"
 	GenesisHashFile   = "genesis_hashes.txt"
+	GenesisSpecFile   = "genesis.json"
+	GenesisSpecHash   = "genesis_spec.hash"
 	BlockHeaderLength = 82
+	SyncMarkerFile    = "sync.inprogress"
+	// Blocks from this version on carry the producer's public key hash and signature
+	SignedBlockVersion      = 2
+	SignedBlockHeaderLength = BlockHeaderLength + 32
+	// Longest producer signature, a DER encoded ECDSA P-256 signature
+	MaxBlockSignatureLength = 72
+	// Deepest a branch may fork below the tip of the main chain and still be stored or switched to
+	MaxForkDepth = 100
+	// Contracts of this version are signed by the mint key and create their value for the recipient
+	MintContractVersion = 0x8001
+	// Contracts of this version destroy their value from the sender's balance; their recipient is all zeros
+	BurnContractVersion = 0x8002
 )
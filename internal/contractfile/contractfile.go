@@ -0,0 +1,173 @@
+// Package contractfile holds contracts in files so they can be built, signed and broadcast on different machines.
+// An online machine builds an unsigned contract for a sender it knows only by public key, a machine holding the
+// sender's private key signs it, possibly offline, and an online machine broadcasts the signed contract
+package contractfile
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/SIGBlockchain/project_aurum/internal/contracts"
+	"github.com/SIGBlockchain/project_aurum/internal/hashing"
+	"github.com/SIGBlockchain/project_aurum/internal/publickey"
+	"github.com/SIGBlockchain/project_aurum/internal/validation"
+)
+
+const (
+	// Format identifies contract files
+	Format = "aurum-contract"
+	// Version is the version of the contract file format
+	Version = 1
+)
+
+// File is a contract file, the JSON encoding of the contract as sent to the node with the format and version of
+// the file. The signature of an unsigned contract is empty
+type File struct {
+	Format   string
+	Version  int
+	Contract contracts.JSONContract
+}
+
+// Build returns the file of an unsigned contract sending value from sender to the recipient wallet address
+// with the given state nonce
+func Build(sender *ecdsa.PublicKey, recipient []byte, value uint64, stateNonce uint64) (File, error) {
+	if sender == nil {
+		return File{}, errors.New("Sender public key must not be nil")
+	}
+	if len(recipient) != 32 {
+		return File{}, errors.New("Recipient wallet address must be 32 bytes long")
+	}
+	if value == 0 {
+		return File{}, errors.New("Value must not be zero")
+	}
+	if stateNonce == 0 {
+		return File{}, errors.New("State nonce must not be zero")
+	}
+	c := contracts.Contract{Version: 1, SenderPubKey: sender, RecipPubKeyHash: recipient, Value: value, StateNonce: stateNonce}
+	encodedSender, err := publickey.Encode(sender)
+	if err != nil {
+		return File{}, errors.New("Failed to encode sender public key: " + err.Error())
+	}
+	if bytes.Equal(recipient, hashing.New(encodedSender)) {
+		return File{}, errors.New("Recipient must not be the sender")
+	}
+	jsonContract, err := c.Marshal()
+	if err != nil {
+		return File{}, err
+	}
+	return File{Format, Version, jsonContract}, nil
+}
+
+// Read reads the contract file filename and checks its format and version and that its contract decodes
+func Read(filename string) (File, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return File{}, errors.New("Failed to read contract file: " + err.Error())
+	}
+	var f File
+	if err := json.Unmarshal(data, &f); err != nil {
+		return File{}, errors.New("Failed to parse contract file: " + err.Error())
+	}
+	if f.Format != Format {
+		return File{}, errors.New("Not a contract file: " + filename)
+	}
+	if f.Version != Version {
+		return File{}, fmt.Errorf("Unsupported contract file version %d", f.Version)
+	}
+	if _, err := f.Unmarshal(); err != nil {
+		return File{}, err
+	}
+	return f, nil
+}
+
+// Write writes the contract file to filename, failing if the file exists so that a contract is not overwritten
+func (f File) Write(filename string) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return errors.New("Failed to marshal contract file: " + err.Error())
+	}
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return errors.New("Failed to create contract file: " + err.Error())
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return errors.New("Failed to write contract file: " + err.Error())
+	}
+	return file.Close()
+}
+
+// Unmarshal returns the contract of the file, checking that its signature length matches its signature
+func (f File) Unmarshal() (contracts.Contract, error) {
+	c, err := f.Contract.Unmarshal()
+	if err != nil {
+		return contracts.Contract{}, errors.New("Invalid contract: " + err.Error())
+	}
+	if int(c.SigLen) != len(c.Signature) {
+		return contracts.Contract{}, errors.New("Invalid contract: signature length does not match signature")
+	}
+	return c, nil
+}
+
+// IsSigned returns true if the contract of the file has a signature
+func (f File) IsSigned() bool {
+	return f.Contract.SignatureLength != 0
+}
+
+// Sign signs the unsigned contract of the file with the sender's private key
+func (f *File) Sign(key *ecdsa.PrivateKey) error {
+	c, err := f.Unmarshal()
+	if err != nil {
+		return err
+	}
+	if f.IsSigned() {
+		return errors.New("Contract is already signed")
+	}
+	if c.SenderPubKey.X.Cmp(key.PublicKey.X) != 0 || c.SenderPubKey.Y.Cmp(key.PublicKey.Y) != 0 {
+		return errors.New("Private key does not belong to the sender of the contract")
+	}
+	if err := c.Sign(key); err != nil {
+		return err
+	}
+	jsonContract, err := c.Marshal()
+	if err != nil {
+		return err
+	}
+	f.Contract = jsonContract
+	return nil
+}
+
+// Signed returns the contract of the file after checking that it is signed by its sender
+func (f File) Signed() (contracts.Contract, error) {
+	if !f.IsSigned() {
+		return contracts.Contract{}, errors.New("Contract is not signed")
+	}
+	c, err := f.Unmarshal()
+	if err != nil {
+		return contracts.Contract{}, err
+	}
+	if err := validation.VerifySignature(&c); err != nil {
+		return contracts.Contract{}, err
+	}
+	return c, nil
+}
+
+// Hash returns the hex encoded hash of the serialized contract, by which its status is looked up on the node.
+// The hash of a contract changes when it is signed
+func (f File) Hash() (string, error) {
+	c, err := f.Unmarshal()
+	if err != nil {
+		return "", err
+	}
+	serialized, err := c.Serialize()
+	if err != nil {
+		return "", errors.New("Failed to serialize contract: " + err.Error())
+	}
+	return hex.EncodeToString(hashing.New(serialized)), nil
+}
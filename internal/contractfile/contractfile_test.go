@@ -0,0 +1,98 @@
+package contractfile
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/SIGBlockchain/project_aurum/internal/hashing"
+)
+
+func TestBuildSignBroadcast(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aurum_contract")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	recipient := hashing.New([]byte("recipient"))
+
+	if _, err := Build(&key.PublicKey, recipient[:4], 10, 1); err == nil {
+		t.Errorf("expected a short recipient address to be rejected")
+	}
+	if _, err := Build(&key.PublicKey, recipient, 0, 1); err == nil {
+		t.Errorf("expected a zero value to be rejected")
+	}
+
+	// The online machine builds the contract from the sender's public key
+	unsignedName := filepath.Join(dir, "unsigned.json")
+	built, err := Build(&key.PublicKey, recipient, 10, 1)
+	if err != nil {
+		t.Fatalf("failed to build contract: %v", err)
+	}
+	if err := built.Write(unsignedName); err != nil {
+		t.Fatalf("failed to write contract file: %v", err)
+	}
+	if err := built.Write(unsignedName); err == nil {
+		t.Errorf("expected an existing contract file not to be overwritten")
+	}
+
+	// The offline machine signs it
+	f, err := Read(unsignedName)
+	if err != nil {
+		t.Fatalf("failed to read contract file: %v", err)
+	}
+	if _, err := f.Signed(); err == nil {
+		t.Errorf("expected an unsigned contract not to be broadcast")
+	}
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err := f.Sign(other); err == nil {
+		t.Errorf("expected a key other than the sender's to be rejected")
+	}
+	if err := f.Sign(key); err != nil {
+		t.Fatalf("failed to sign contract: %v", err)
+	}
+	if err := f.Sign(key); err == nil {
+		t.Errorf("expected a signed contract not to be signed again")
+	}
+	signedName := filepath.Join(dir, "signed.json")
+	if err := f.Write(signedName); err != nil {
+		t.Fatalf("failed to write contract file: %v", err)
+	}
+
+	// The online machine broadcasts it
+	signed, err := Read(signedName)
+	if err != nil {
+		t.Fatalf("failed to read contract file: %v", err)
+	}
+	c, err := signed.Signed()
+	if err != nil {
+		t.Fatalf("expected a valid signature: %v", err)
+	}
+	if c.Value != 10 || c.StateNonce != 1 {
+		t.Errorf("unexpected contract: %+v", c)
+	}
+
+	tampered := signed
+	tampered.Contract.Value = 1000
+	if _, err := tampered.Signed(); err == nil {
+		t.Errorf("expected a contract changed after signing to be rejected")
+	}
+	tampered = signed
+	tampered.Contract.SignatureLength--
+	if _, err := tampered.Signed(); err == nil {
+		t.Errorf("expected a mismatched signature length to be rejected")
+	}
+
+	data, _ := ioutil.ReadFile(signedName)
+	futureName := filepath.Join(dir, "future.json")
+	ioutil.WriteFile(futureName, []byte(strings.Replace(string(data), `"Version": 1,`, `"Version": 2,`, 1)), 0644)
+	if _, err := Read(futureName); err == nil || !strings.Contains(err.Error(), "version") {
+		t.Errorf("expected an unsupported version to be rejected, got %v", err)
+	}
+}
@@ -10,6 +10,8 @@ import (
 	"fmt"
 	"reflect"
 
+	"github.com/SIGBlockchain/project_aurum/internal/address"
+	"github.com/SIGBlockchain/project_aurum/internal/constants"
 	"github.com/SIGBlockchain/project_aurum/internal/hashing"
 	"github.com/SIGBlockchain/project_aurum/internal/publickey"
 )
@@ -179,6 +181,21 @@ func (c *Contract) Sign(sender *ecdsa.PrivateKey) error {
 	return nil
 }
 
+// NewBurn returns an unsigned contract destroying value from the sender's balance
+func NewBurn(sender *ecdsa.PrivateKey, value uint64, nextStateNonce uint64) (*Contract, error) {
+	return New(constants.BurnContractVersion, sender, make([]byte, 32), value, nextStateNonce)
+}
+
+// IsBurn returns true if the contract destroys its value instead of transferring it to the recipient
+func (c *Contract) IsBurn() bool {
+	return c.Version == constants.BurnContractVersion
+}
+
+// IsMint returns true if the contract creates its value for the recipient instead of transferring it from the sender
+func (c *Contract) IsMint() bool {
+	return c.Version == constants.MintContractVersion
+}
+
 // compare two contracts and return true only if all fields match
 func (contract1 *Contract) Equals(contract2 Contract) bool {
 	// copy both contracts
@@ -232,12 +249,18 @@ func (c *Contract) Marshal() (JSONContract, error) {
 		return JSONContract{}, errors.New("Failed to encode sender pubkey: " + err.Error())
 	}
 
+	// the recipient is an encoded address, unless it is not a wallet address and can only be hex encoded
+	recipient := hex.EncodeToString(c.RecipPubKeyHash)
+	if len(c.RecipPubKeyHash) == address.Length {
+		recipient = address.Encode(c.RecipPubKeyHash)
+	}
+
 	var newJSONContract = JSONContract{
 		Version:                c.Version,
 		SenderPublicKey:        hex.EncodeToString(encodedSender),
 		SignatureLength:        c.SigLen,
 		Signature:              hex.EncodeToString(c.Signature),
-		RecipientWalletAddress: hex.EncodeToString(c.RecipPubKeyHash),
+		RecipientWalletAddress: recipient,
 		Value:                  c.Value,
 		StateNonce:             c.StateNonce,
 	}
@@ -259,9 +282,13 @@ func (mc *JSONContract) Unmarshal() (Contract, error) {
 	if err != nil {
 		return Contract{}, errors.New("Failed to decode signature: " + err.Error())
 	}
-	recip, err := hex.DecodeString(mc.RecipientWalletAddress)
+	recip, err := address.Decode(mc.RecipientWalletAddress)
 	if err != nil {
-		return Contract{}, errors.New("Failed to decode recipient wallet address: " + err.Error())
+		// recipients that are not wallet addresses are hex encoded
+		var hexErr error
+		if recip, hexErr = hex.DecodeString(mc.RecipientWalletAddress); hexErr != nil {
+			return Contract{}, errors.New("Failed to decode recipient wallet address: " + err.Error())
+		}
 	}
 
 	c := Contract{
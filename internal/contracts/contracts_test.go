@@ -12,6 +12,7 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/SIGBlockchain/project_aurum/internal/address"
 	"github.com/SIGBlockchain/project_aurum/internal/hashing"
 	"github.com/SIGBlockchain/project_aurum/internal/publickey"
 )
@@ -486,7 +487,7 @@ func TestMarshal(t *testing.T) {
 				if signature, _ := hex.DecodeString(resultContract.Signature); !bytes.Equal(signature, tt.c.Signature) {
 					t.Errorf("Error: Signature does not match. Wanted: %v, Got: %v", tt.c.Signature, signature)
 				}
-				if recip, _ := hex.DecodeString(resultContract.RecipientWalletAddress); !bytes.Equal(recip, tt.c.RecipPubKeyHash) {
+				if recip, _ := address.Decode(resultContract.RecipientWalletAddress); !bytes.Equal(recip, tt.c.RecipPubKeyHash) {
 					t.Errorf("Error: Recip pubkey hash does not match. Wanted: %v, Got: %v", tt.c.RecipPubKeyHash, recip)
 				}
 				if resultContract.Value != tt.c.Value {
@@ -542,4 +543,21 @@ func TestUnmarshal(t *testing.T) {
 			}
 		})
 	}
+	// contracts with the recipient in raw hex, as sent before addresses were encoded, are still accepted
+	hexContract := marshalledContract
+	hexContract.RecipientWalletAddress = hex.EncodeToString(testContract.RecipPubKeyHash)
+	if resultContract, err := hexContract.Unmarshal(); err != nil || !resultContract.Equals(testContract) {
+		t.Errorf("Error: hex recipient was not accepted: %v", err)
+	}
+	typoContract := marshalledContract
+	typo := []byte(typoContract.RecipientWalletAddress)
+	if typo[10] == 'q' {
+		typo[10] = 'p'
+	} else {
+		typo[10] = 'q'
+	}
+	typoContract.RecipientWalletAddress = string(typo)
+	if _, err := typoContract.Unmarshal(); err == nil {
+		t.Errorf("Error: mistyped recipient was accepted")
+	}
 }
@@ -0,0 +1,108 @@
+// Package datadir is the data directory a node keeps its ledger, metadata, accounts and producer tables in.
+// A node locks the directory while it runs, through a lock file in it, so that two processes never open the same
+// ledger at once. The lock is held with flock, which the operating system releases if the process dies
+package datadir
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/SIGBlockchain/project_aurum/internal/constants"
+)
+
+// LockFile is the name of the lock file, which holds the process ID of the process holding the lock
+const LockFile = "LOCK"
+
+// Dir is a data directory
+type Dir struct {
+	path string
+	lock *os.File // nil unless the directory was opened with Open
+}
+
+// New returns the data directory at path without locking it, such as for reading the files of a directory
+// a node may be running in
+func New(path string) *Dir {
+	return &Dir{path: path}
+}
+
+// Open creates the data directory at path if it does not exist and locks it, failing if another process,
+// or another Dir of this process, holds its lock
+func Open(path string) (*Dir, error) {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, errors.New("Failed to create data directory: " + err.Error())
+	}
+	lockName := filepath.Join(path, LockFile)
+	lock, err := os.OpenFile(lockName, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, errors.New("Failed to open data directory lock: " + err.Error())
+	}
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		lock.Close()
+		if err == syscall.EWOULDBLOCK {
+			holder := "another process"
+			if pid, err := ioutil.ReadFile(lockName); err == nil && len(strings.TrimSpace(string(pid))) > 0 {
+				holder = "process " + strings.TrimSpace(string(pid))
+			}
+			return nil, errors.New("Data directory " + path + " is in use by " + holder)
+		}
+		return nil, errors.New("Failed to lock data directory: " + err.Error())
+	}
+	if err := lock.Truncate(0); err == nil {
+		lock.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return &Dir{path, lock}, nil
+}
+
+// Close releases the lock of a directory opened with Open
+func (d *Dir) Close() error {
+	if d.lock == nil {
+		return nil
+	}
+	d.lock.Truncate(0)
+	err := d.lock.Close() // closing the file releases the lock
+	d.lock = nil
+	if err != nil {
+		return errors.New("Failed to release data directory lock: " + err.Error())
+	}
+	return nil
+}
+
+// Path returns the path of the directory
+func (d *Dir) Path() string {
+	return d.path
+}
+
+// Ledger returns the name of the ledger file
+func (d *Dir) Ledger() string {
+	return filepath.Join(d.path, constants.BlockchainFile)
+}
+
+// Metadata returns the name of the metadata table
+func (d *Dir) Metadata() string {
+	return filepath.Join(d.path, constants.MetadataTable)
+}
+
+// Accounts returns the name of the accounts table
+func (d *Dir) Accounts() string {
+	return filepath.Join(d.path, constants.AccountsTable)
+}
+
+// Producer returns the name of the producer table
+func (d *Dir) Producer() string {
+	return filepath.Join(d.path, constants.ProducerTable)
+}
+
+// GenesisSpecHash returns the name of the file holding the hash of the genesis spec the chain started from
+func (d *Dir) GenesisSpecHash() string {
+	return filepath.Join(d.path, constants.GenesisSpecHash)
+}
+
+// SyncMarker returns the name of the file marking a sync in progress
+func (d *Dir) SyncMarker() string {
+	return filepath.Join(d.path, constants.SyncMarkerFile)
+}
@@ -0,0 +1,49 @@
+package datadir
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLock(t *testing.T) {
+	parent, err := ioutil.TempDir("", "aurum_data")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	defer os.RemoveAll(parent)
+	path := filepath.Join(parent, "data")
+
+	dir, err := Open(path)
+	if err != nil {
+		t.Fatalf("failed to open data directory: %v", err)
+	}
+	if dir.Ledger() != filepath.Join(path, "blockchain.dat") || dir.Accounts() != filepath.Join(path, "accounts.db") {
+		t.Errorf("unexpected file names %s, %s", dir.Ledger(), dir.Accounts())
+	}
+	pid, _ := ioutil.ReadFile(filepath.Join(path, LockFile))
+	if strings.TrimSpace(string(pid)) != strconv.Itoa(os.Getpid()) {
+		t.Errorf("expected the lock file to hold the process ID, got %q", pid)
+	}
+
+	// a second node on the same directory is refused until the first closes it
+	if _, err := Open(path); err == nil || !strings.Contains(err.Error(), "in use by process") {
+		t.Errorf("expected a locked data directory to be refused, got %v", err)
+	}
+	if err := dir.Close(); err != nil {
+		t.Fatalf("failed to close data directory: %v", err)
+	}
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("expected an unlocked data directory to open: %v", err)
+	}
+	reopened.Close()
+
+	// New names the files without locking
+	if New(path).Metadata() != filepath.Join(path, "metadata.db") {
+		t.Errorf("unexpected metadata name %s", New(path).Metadata())
+	}
+}
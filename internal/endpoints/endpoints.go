@@ -9,4 +9,11 @@ const (
 	BlockQueryByHeight = "/block/height"
 	BlockQueryByHash   = "/block/hash"
 	HeightQuery        = "/height"
+	BlockBatchQuery    = "/block/batch"
+	HeaderBatchQuery   = "/header/batch"
+	MintHistory        = "/mint/history"
+	SupplyQuery        = "/supply"
+	ContractStatus     = "/contract/status"
+	AdminConfig        = "/admin/config"
+	AdminReload        = "/admin/reload"
 )
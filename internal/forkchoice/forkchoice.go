@@ -0,0 +1,436 @@
+// Package forkchoice keeps every block seen on the network in a tree and switches the ledger to the
+// tallest branch, rolling the accounts table back to the common ancestor and replaying the winning branch
+package forkchoice
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/SIGBlockchain/project_aurum/internal/accountstable"
+	"github.com/SIGBlockchain/project_aurum/internal/block"
+	"github.com/SIGBlockchain/project_aurum/internal/blockchain"
+	"github.com/SIGBlockchain/project_aurum/internal/consensus"
+	"github.com/SIGBlockchain/project_aurum/internal/constants"
+	"github.com/SIGBlockchain/project_aurum/internal/contracts"
+	"github.com/SIGBlockchain/project_aurum/internal/monetary"
+	"github.com/SIGBlockchain/project_aurum/internal/pendingpool"
+	"github.com/SIGBlockchain/project_aurum/internal/sqlstatements"
+	"github.com/SIGBlockchain/project_aurum/internal/validation"
+)
+
+// ErrKnownBlock is returned when a block has already been added to the tree
+var ErrKnownBlock = errors.New("Block already known")
+
+// ErrUnknownParent is returned when the parent of a block is not in the tree
+var ErrUnknownParent = errors.New("Parent block not known")
+
+// Tree stores every valid block seen, on the main chain or not, keyed by its hash
+type Tree struct {
+	db *sql.DB
+}
+
+// NewTree creates the block_tree table in db if it does not exist and returns a Tree backed by it
+func NewTree(db *sql.DB) (*Tree, error) {
+	if _, err := db.Exec(sqlstatements.CREATE_BLOCK_TREE_TABLE); err != nil {
+		return nil, errors.New("Failed to create block_tree table: " + err.Error())
+	}
+	return &Tree{db: db}, nil
+}
+
+// Insert stores b in the tree; inserting a block twice has no effect
+func (t *Tree) Insert(b block.Block) error {
+	_, err := t.db.Exec(sqlstatements.INSERT_OR_IGNORE_INTO_BLOCK_TREE,
+		hex.EncodeToString(block.HashBlock(b)), hex.EncodeToString(b.PreviousHash), b.Height, b.Serialize())
+	if err != nil {
+		return errors.New("Failed to insert block into block_tree: " + err.Error())
+	}
+	return nil
+}
+
+// Get returns the block with the given hash, or sql.ErrNoRows if it is not in the tree
+func (t *Tree) Get(hash []byte) (block.Block, error) {
+	var serializedBlock []byte
+	if err := t.db.QueryRow(sqlstatements.GET_BLOCK_FROM_BLOCK_TREE_BY_HASH, hex.EncodeToString(hash)).Scan(&serializedBlock); err != nil {
+		return block.Block{}, err
+	}
+	return block.Deserialize(serializedBlock)
+}
+
+// Contains returns whether the block with the given hash is in the tree
+func (t *Tree) Contains(hash []byte) (bool, error) {
+	_, err := t.Get(hash)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Delete removes the block with the given hash from the tree
+func (t *Tree) Delete(hash []byte) error {
+	if _, err := t.db.Exec(sqlstatements.DELETE_FROM_BLOCK_TREE_BY_HASH, hex.EncodeToString(hash)); err != nil {
+		return errors.New("Failed to delete block from block_tree: " + err.Error())
+	}
+	return nil
+}
+
+// Update describes how the main chain changed after a block was added
+type Update struct {
+	Tip       block.BlockHeader    // youngest block of the main chain
+	Connected []block.Block        // blocks appended to the main chain, in height order
+	Orphaned  []contracts.Contract // contracts of blocks removed from the main chain that the new branch does not hold
+}
+
+// Chain is the main chain held in the ledger together with the tree of competing branches.
+//
+// The fork-choice rule is the greatest height; of two branches of the same height the one seen first is kept
+type Chain struct {
+	ledger    *blockchain.LedgerManager
+	accounts  *sql.DB
+	tree      *Tree
+	version   uint16
+	authority *consensus.Authority
+	policy    monetary.Policy
+	// aurum minted by the genesis block, the base of the total supply invariant
+	genesisSupply uint64
+}
+
+// NewChain returns a Chain over the ledger, keeping its block tree in the metadata database.
+// Blocks already in the ledger are added to the tree, and the accounts table is rebuilt if it has no undo log or
+// reverted if a rollback was interrupted.
+// If authority is not nil, blocks must also follow its slot schedule. Blocks must mint the rewards of policy
+func NewChain(ledger *blockchain.LedgerManager, metadata *sql.DB, accounts *sql.DB, version uint16, authority *consensus.Authority, policy monetary.Policy) (*Chain, error) {
+	tree, err := NewTree(metadata)
+	if err != nil {
+		return nil, err
+	}
+	c := &Chain{ledger: ledger, accounts: accounts, tree: tree, version: version, authority: authority, policy: policy}
+
+	ledger.Lock()
+	defer ledger.Unlock()
+
+	if err := ledger.RepairRollback(accounts); err != nil {
+		return nil, err
+	}
+	if err := ledger.IndexContracts(); err != nil {
+		return nil, err
+	}
+
+	// Replay the ledger so every block has before-images to roll back with
+	hasUndoLog, err := accountstable.HasUndoLog(accounts)
+	if err != nil {
+		return nil, errors.New("Failed to look up undo log: " + err.Error())
+	}
+	if !hasUndoLog {
+		if err := ledger.RebuildAccountsTable(accounts); err != nil {
+			return nil, err
+		}
+	}
+
+	const batchSize = 100
+	for startHeight := uint64(0); ; startHeight += batchSize {
+		serializedBlocks, err := ledger.GetBatchOfBlocks(startHeight, batchSize)
+		if err != nil {
+			return nil, err
+		}
+		if len(serializedBlocks) == 0 {
+			return c, nil
+		}
+		for _, serializedBlock := range serializedBlocks {
+			b, err := block.Deserialize(serializedBlock)
+			if err != nil {
+				return nil, errors.New("Failed to deserialize block: " + err.Error())
+			}
+			if b.Height == 0 {
+				if c.genesisSupply, err = monetary.GenesisSupply(b); err != nil {
+					return nil, err
+				}
+			}
+			if err := tree.Insert(b); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// Tip returns the header of the youngest block of the main chain
+func (c *Chain) Tip() (block.BlockHeader, error) {
+	c.ledger.Lock()
+	defer c.ledger.Unlock()
+	return c.ledger.GetYoungestBlockHeader()
+}
+
+// Add validates b against its parent and stores it in the tree. A child of the tip is appended to the ledger;
+// a block that makes its branch taller than the main chain causes a reorganization to that branch.
+// Branches may not fork more than constants.MaxForkDepth blocks below the tip
+func (c *Chain) Add(b block.Block) (Update, error) {
+	c.ledger.Lock()
+	defer c.ledger.Unlock()
+
+	tip, err := c.ledger.GetYoungestBlockHeader()
+	if err != nil {
+		return Update{}, err
+	}
+	known, err := c.tree.Contains(block.HashBlock(b))
+	if err != nil {
+		return Update{}, errors.New("Failed to look up block: " + err.Error())
+	}
+	// Blocks rolled back from the ledger stay in the tree, so a known block above the tip is added again
+	if known && b.Height <= tip.Height {
+		return Update{}, ErrKnownBlock
+	}
+
+	if bytes.Equal(b.PreviousHash, block.HashBlockHeader(tip)) {
+		if err := c.connect(tip, b); err != nil {
+			return Update{}, err
+		}
+		return Update{Tip: b.GetHeader(), Connected: []block.Block{b}}, nil
+	}
+
+	parent, err := c.tree.Get(b.PreviousHash)
+	if err == sql.ErrNoRows {
+		return Update{}, ErrUnknownParent
+	} else if err != nil {
+		return Update{}, errors.New("Failed to look up parent block: " + err.Error())
+	}
+	if parent.Height+constants.MaxForkDepth < tip.Height {
+		return Update{}, fmt.Errorf("block #%d forks more than %d blocks below the tip", b.Height, constants.MaxForkDepth)
+	}
+	if err := c.validateHeader(parent.GetHeader(), b); err != nil {
+		return Update{}, err
+	}
+	if err := c.validateBranchBlock(b); err != nil {
+		return Update{}, err
+	}
+	if err := c.tree.Insert(b); err != nil {
+		return Update{}, err
+	}
+	if b.Height <= tip.Height {
+		return Update{Tip: tip}, nil
+	}
+	return c.reorganize(tip, b)
+}
+
+// connect validates b and its contracts against the tip and appends it to the ledger and accounts table.
+// Afterwards the total supply must match the monetary policy
+func (c *Chain) connect(tip block.BlockHeader, b block.Block) error {
+	if err := c.validateHeader(tip, b); err != nil {
+		return err
+	}
+	if err := c.policy.ValidateReward(b); err != nil {
+		return err
+	}
+	if err := c.policy.ValidateMints(c.accounts, b); err != nil {
+		return err
+	}
+	blockContracts, err := extractContracts(b)
+	if err != nil {
+		return err
+	}
+	// Validate the contracts in order, as a sender may appear more than once in a block.
+	// The reward was validated against the policy above
+	blockPool := pendingpool.NewPendingMap()
+	blockPool.MintAddr = c.policy.MintAddr
+	for _, contract := range blockContracts {
+		if contract.SenderPubKey == nil {
+			continue
+		}
+		if err := blockPool.Add(contract, c.accounts); err != nil {
+			return fmt.Errorf("block #%d contains an invalid contract: %v", b.Height, err)
+		}
+	}
+	if err := c.ledger.AddBlock(b); err != nil {
+		return err
+	}
+	if err := accountstable.ApplyBlock(c.accounts, &b); err != nil {
+		// ApplyBlock left the accounts table unchanged; remove the block from the ledger
+		if rollBackErr := c.rollBack(tip.Height); rollBackErr != nil {
+			return errors.New("Failed to roll back block: " + rollBackErr.Error())
+		}
+		return err
+	}
+	if err := c.policy.CheckSupply(c.accounts, c.genesisSupply, b.Height); err != nil {
+		if rollBackErr := c.rollBack(tip.Height); rollBackErr != nil {
+			return errors.New("Failed to roll back block: " + rollBackErr.Error())
+		}
+		return err
+	}
+	return c.tree.Insert(b)
+}
+
+// validateHeader checks b against its parent and, if there is one, the authority's slot schedule
+func (c *Chain) validateHeader(parent block.BlockHeader, b block.Block) error {
+	if !validation.ValidateBlock(b, c.version, parent.Height, block.HashBlockHeader(parent), parent.Timestamp) {
+		return fmt.Errorf("block #%d is not a valid child of block #%d", b.Height, parent.Height)
+	}
+	// Once a chain switched to a version, its blocks never go back to an earlier one
+	if b.Version < parent.Version {
+		return fmt.Errorf("block #%d has version %d, earlier than version %d of its parent", b.Height, b.Version, parent.Version)
+	}
+	if c.authority != nil {
+		return c.authority.ValidateBlock(b.GetHeader(), parent)
+	}
+	// Without an authority there is no producer key to verify the signature with, so the producer could be forged
+	if b.Version >= constants.SignedBlockVersion {
+		return fmt.Errorf("signed block #%d cannot be verified without authorized producers", b.Height)
+	}
+	return nil
+}
+
+// validateBranchBlock checks the contracts of b that do not depend on the accounts of its branch: its reward and
+// the signature of every other contract. The rest is checked when the branch is connected
+func (c *Chain) validateBranchBlock(b block.Block) error {
+	if err := c.policy.ValidateReward(b); err != nil {
+		return err
+	}
+	blockContracts, err := extractContracts(b)
+	if err != nil {
+		return err
+	}
+	for _, contract := range blockContracts {
+		if contract.SenderPubKey == nil {
+			continue
+		}
+		if err := validation.VerifySignature(contract); err != nil {
+			return fmt.Errorf("block #%d contains an invalid contract: %v", b.Height, err)
+		}
+	}
+	return nil
+}
+
+// reorganize switches the main chain from tip to the branch ending in newTip. If a block of the branch is invalid
+// the old main chain is restored and the block is removed from the tree
+func (c *Chain) reorganize(tip block.BlockHeader, newTip block.Block) (Update, error) {
+	// Walk back from newTip until the branch meets the main chain
+	branch := []block.Block{newTip}
+	for {
+		parentHash := branch[0].PreviousHash
+		onMainChain, err := c.mainChainHas(branch[0].Height-1, parentHash, tip.Height)
+		if err != nil {
+			return Update{}, err
+		}
+		if onMainChain {
+			break
+		}
+		parent, err := c.tree.Get(parentHash)
+		if err != nil {
+			return Update{}, errors.New("Failed to walk back branch: " + err.Error())
+		}
+		branch = append([]block.Block{parent}, branch...)
+	}
+	ancestorHeight := branch[0].Height - 1
+	if ancestorHeight+constants.MaxForkDepth < tip.Height {
+		if err := c.tree.Delete(block.HashBlock(newTip)); err != nil {
+			return Update{}, err
+		}
+		return Update{}, fmt.Errorf("branch of block #%d forks more than %d blocks below the tip", newTip.Height, constants.MaxForkDepth)
+	}
+
+	serializedOldBlocks, err := c.ledger.GetBatchOfBlocks(ancestorHeight+1, tip.Height-ancestorHeight)
+	if err != nil {
+		return Update{}, err
+	}
+	oldBlocks := make([]block.Block, len(serializedOldBlocks))
+	for i := range serializedOldBlocks {
+		if oldBlocks[i], err = block.Deserialize(serializedOldBlocks[i]); err != nil {
+			return Update{}, errors.New("Failed to deserialize block: " + err.Error())
+		}
+	}
+
+	if err := c.rollBack(ancestorHeight); err != nil {
+		return Update{}, err
+	}
+	parent, err := c.ledger.GetYoungestBlockHeader()
+	if err != nil {
+		return Update{}, err
+	}
+	for _, b := range branch {
+		if err := c.connect(parent, b); err != nil {
+			if restoreErr := c.restore(ancestorHeight, oldBlocks); restoreErr != nil {
+				return Update{}, errors.New("Failed to restore main chain: " + restoreErr.Error())
+			}
+			if deleteErr := c.tree.Delete(block.HashBlock(b)); deleteErr != nil {
+				return Update{}, deleteErr
+			}
+			return Update{}, err
+		}
+		parent = b.GetHeader()
+	}
+
+	return Update{Tip: newTip.GetHeader(), Connected: branch, Orphaned: orphanedContracts(oldBlocks, branch)}, nil
+}
+
+// mainChainHas returns whether the main chain, whose tip is at tipHeight, holds the block with hash at height
+func (c *Chain) mainChainHas(height uint64, hash []byte, tipHeight uint64) (bool, error) {
+	if height > tipHeight {
+		return false, nil
+	}
+	serializedBlocks, err := c.ledger.GetBatchOfBlocks(height, 1)
+	if err != nil {
+		return false, err
+	}
+	if len(serializedBlocks) != 1 {
+		return false, fmt.Errorf("block #%d missing from ledger", height)
+	}
+	b, err := block.Deserialize(serializedBlocks[0])
+	if err != nil {
+		return false, errors.New("Failed to deserialize block: " + err.Error())
+	}
+	return bytes.Equal(block.HashBlock(b), hash), nil
+}
+
+// rollBack removes every block above height from the ledger and reverts the accounts table to match
+func (c *Chain) rollBack(height uint64) error {
+	return c.ledger.RollbackTo(height, c.accounts)
+}
+
+// restore rolls the ledger back to height and appends the blocks of the previous main chain again
+func (c *Chain) restore(height uint64, oldBlocks []block.Block) error {
+	if err := c.rollBack(height); err != nil {
+		return err
+	}
+	for i := range oldBlocks {
+		if err := c.ledger.AddBlock(oldBlocks[i]); err != nil {
+			return err
+		}
+		if err := accountstable.ApplyBlock(c.accounts, &oldBlocks[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orphanedContracts returns the contracts of oldBlocks that none of the newBlocks hold.
+// Rewards belong to their block and are never orphaned
+func orphanedContracts(oldBlocks []block.Block, newBlocks []block.Block) []contracts.Contract {
+	included := make(map[string]bool)
+	for _, b := range newBlocks {
+		for _, data := range b.Data {
+			included[string(data)] = true
+		}
+	}
+	var orphaned []contracts.Contract
+	for _, b := range oldBlocks {
+		for _, data := range b.Data {
+			if included[string(data)] {
+				continue
+			}
+			var contract contracts.Contract
+			if err := contract.Deserialize(data); err != nil || contract.SenderPubKey == nil {
+				continue
+			}
+			orphaned = append(orphaned, contract)
+		}
+	}
+	return orphaned
+}
+
+// extractContracts returns the contracts in b, which may be empty
+func extractContracts(b block.Block) ([]*contracts.Contract, error) {
+	if b.DataLen == 0 {
+		return nil, nil
+	}
+	return block.ExtractContractsFromBlock(b)
+}
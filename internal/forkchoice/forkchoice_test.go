@@ -0,0 +1,540 @@
+package forkchoice
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/SIGBlockchain/project_aurum/internal/accountstable"
+	"github.com/SIGBlockchain/project_aurum/internal/block"
+	"github.com/SIGBlockchain/project_aurum/internal/blockchain"
+	"github.com/SIGBlockchain/project_aurum/internal/consensus"
+	"github.com/SIGBlockchain/project_aurum/internal/constants"
+	"github.com/SIGBlockchain/project_aurum/internal/contracts"
+	"github.com/SIGBlockchain/project_aurum/internal/genesis"
+	"github.com/SIGBlockchain/project_aurum/internal/hashing"
+	"github.com/SIGBlockchain/project_aurum/internal/monetary"
+	"github.com/SIGBlockchain/project_aurum/internal/publickey"
+)
+
+type testChain struct {
+	*Chain
+	dir        string
+	ledgerFile *os.File
+	metadata   *sql.DB
+	accounts   *sql.DB
+}
+
+func setUp(t *testing.T, genesisBlock block.Block) *testChain {
+	dir, err := ioutil.TempDir("", "aurum_forkchoice")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	ledgerName := filepath.Join(dir, constants.BlockchainFile)
+	metadataName := filepath.Join(dir, constants.MetadataTable)
+	accountsName := filepath.Join(dir, constants.AccountsTable)
+	if err := blockchain.Airdrop(ledgerName, metadataName, accountsName, genesisBlock); err != nil {
+		t.Fatalf("failed to airdrop: %v", err)
+	}
+	tc := &testChain{dir: dir}
+	tc.ledgerFile, _ = os.OpenFile(ledgerName, os.O_APPEND|os.O_RDWR, 0644)
+	tc.metadata, _ = sql.Open("sqlite3", metadataName)
+	tc.accounts, _ = sql.Open("sqlite3", accountsName)
+	if tc.Chain, err = NewChain(blockchain.NewLedgerManager(tc.ledgerFile, tc.metadata), tc.metadata, tc.accounts, 1, nil, monetary.Policy{}); err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	return tc
+}
+
+func (tc *testChain) tearDown() {
+	tc.ledgerFile.Close()
+	tc.metadata.Close()
+	tc.accounts.Close()
+	os.RemoveAll(tc.dir)
+}
+
+func (tc *testChain) balance(t *testing.T, pkhash []byte) uint64 {
+	balance, err := accountstable.GetBalance(tc.accounts, pkhash)
+	if err != nil {
+		t.Fatalf("failed to get balance: %v", err)
+	}
+	return balance
+}
+
+// tableSupply checks that the supply read from the mint and burn logs matches the supply counted from the ledger
+func (tc *testChain) tableSupply(t *testing.T, genesisSupply uint64, height uint64) monetary.Supply {
+	supply, err := tc.policy.TableSupply(tc.accounts, genesisSupply, height)
+	if err != nil {
+		t.Fatalf("TableSupply() error = %v", err)
+	}
+	ledgerSupply, err := monetary.LedgerSupply(tc.ledger)
+	if err != nil {
+		t.Fatalf("LedgerSupply() error = %v", err)
+	}
+	if supply != ledgerSupply {
+		t.Errorf("supply from the tables %+v does not match supply from the ledger %+v", supply, ledgerSupply)
+	}
+	return supply
+}
+
+func newKey() (*ecdsa.PrivateKey, []byte) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	encoded, _ := publickey.Encode(&key.PublicKey)
+	return key, hashing.New(encoded)
+}
+
+func signedContract(key *ecdsa.PrivateKey, recipient []byte, value uint64, nonce uint64) contracts.Contract {
+	c, _ := contracts.New(1, key, recipient, value, nonce)
+	c.Sign(key)
+	return *c
+}
+
+func child(t *testing.T, parent block.Block, blockContracts ...contracts.Contract) block.Block {
+	b, err := block.New(1, parent.Height+1, block.HashBlock(parent), blockContracts)
+	if err != nil {
+		t.Fatalf("failed to create block: %v", err)
+	}
+	return b
+}
+
+func TestAdd(t *testing.T) {
+	aliceKey, alice := newKey()
+	_, bob := newKey()
+	genesisBlock, _ := genesis.BringOnTheGenesis([][]byte{alice, bob}, 1000)
+	tc := setUp(t, genesisBlock)
+	defer tc.tearDown()
+
+	a1 := child(t, genesisBlock, signedContract(aliceKey, bob, 100, 1))
+	update, err := tc.Add(a1)
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if update.Tip.Height != 1 || len(update.Connected) != 1 || len(update.Orphaned) != 0 {
+		t.Errorf("unexpected update after extending the tip: %+v", update)
+	}
+	if _, err := tc.Add(a1); err != ErrKnownBlock {
+		t.Errorf("expected ErrKnownBlock, got %v", err)
+	}
+	if _, err := tc.Add(child(t, child(t, a1))); err != ErrUnknownParent {
+		t.Errorf("expected ErrUnknownParent, got %v", err)
+	}
+	overspend := child(t, a1, signedContract(aliceKey, bob, 5000, 2))
+	if _, err := tc.Add(overspend); err == nil {
+		t.Errorf("expected block with an invalid contract to be rejected")
+	}
+	if tip, _ := tc.Tip(); tip.Height != 1 {
+		t.Errorf("expected tip at height 1, got %d", tip.Height)
+	}
+}
+
+func TestReorganize(t *testing.T) {
+	aliceKey, alice := newKey()
+	_, bob := newKey()
+	_, carol := newKey()
+	genesisBlock, _ := genesis.BringOnTheGenesis([][]byte{alice, bob}, 1000)
+	tc := setUp(t, genesisBlock)
+	defer tc.tearDown()
+
+	toBob := signedContract(aliceKey, bob, 100, 1)
+	a1 := child(t, genesisBlock, toBob)
+	if _, err := tc.Add(a1); err != nil {
+		t.Fatalf("failed to add a1: %v", err)
+	}
+
+	// A competing block at the same height is stored but does not replace the tip
+	toCarol := signedContract(aliceKey, carol, 30, 1)
+	b1 := child(t, genesisBlock, toCarol)
+	update, err := tc.Add(b1)
+	if err != nil {
+		t.Fatalf("failed to add b1: %v", err)
+	}
+	if len(update.Connected) != 0 || update.Tip.Height != 1 {
+		t.Errorf("expected tie to keep the current tip, got %+v", update)
+	}
+	if tc.balance(t, bob) != 600 {
+		t.Errorf("expected bob's balance unchanged by a side branch, got %d", tc.balance(t, bob))
+	}
+
+	// Extending the side branch makes it the main chain
+	b2 := child(t, b1)
+	update, err = tc.Add(b2)
+	if err != nil {
+		t.Fatalf("failed to add b2: %v", err)
+	}
+	if update.Tip.Height != 2 || len(update.Connected) != 2 || !update.Connected[0].Equals(b1) || !update.Connected[1].Equals(b2) {
+		t.Errorf("expected b1 and b2 to be connected, got %+v", update)
+	}
+	if len(update.Orphaned) != 1 || !update.Orphaned[0].Equals(toBob) {
+		t.Errorf("expected a1's contract to be orphaned, got %+v", update.Orphaned)
+	}
+	if got := []uint64{tc.balance(t, alice), tc.balance(t, bob), tc.balance(t, carol)}; got[0] != 470 || got[1] != 500 || got[2] != 30 {
+		t.Errorf("expected balances [470 500 30] after reorganization, got %v", got)
+	}
+
+	// A taller branch holding an invalid block is rejected and the main chain is restored
+	a2 := child(t, a1)
+	if _, err := tc.Add(a2); err != nil {
+		t.Fatalf("failed to add a2: %v", err)
+	}
+	a3 := child(t, a2, signedContract(aliceKey, bob, 5000, 2))
+	if _, err := tc.Add(a3); err == nil {
+		t.Fatalf("expected branch with an invalid block to be rejected")
+	}
+	tip, _ := tc.Tip()
+	if tip.Height != 2 || !bytes.Equal(block.HashBlockHeader(tip), block.HashBlock(b2)) {
+		t.Errorf("expected b2 to remain the tip, got block #%d", tip.Height)
+	}
+	if got := []uint64{tc.balance(t, alice), tc.balance(t, bob), tc.balance(t, carol)}; got[0] != 470 || got[1] != 500 || got[2] != 30 {
+		t.Errorf("expected balances [470 500 30] after failed reorganization, got %v", got)
+	}
+	if known, _ := tc.tree.Contains(block.HashBlock(a3)); known {
+		t.Errorf("expected invalid block to be removed from the tree")
+	}
+}
+
+func TestAddAfterRollback(t *testing.T) {
+	aliceKey, alice := newKey()
+	_, bob := newKey()
+	genesisBlock, _ := genesis.BringOnTheGenesis([][]byte{alice, bob}, 1000)
+	tc := setUp(t, genesisBlock)
+	defer tc.tearDown()
+
+	a1 := child(t, genesisBlock, signedContract(aliceKey, bob, 100, 1))
+	a2 := child(t, a1, signedContract(aliceKey, bob, 100, 2))
+	for _, b := range []block.Block{a1, a2} {
+		if _, err := tc.Add(b); err != nil {
+			t.Fatalf("failed to add block #%d: %v", b.Height, err)
+		}
+	}
+
+	// The rolled back blocks are still in the tree, but are added again when resynced
+	if err := tc.rollBack(0); err != nil {
+		t.Fatalf("failed to roll back: %v", err)
+	}
+	for _, b := range []block.Block{a1, a2} {
+		update, err := tc.Add(b)
+		if err != nil {
+			t.Fatalf("failed to add block #%d again: %v", b.Height, err)
+		}
+		if update.Tip.Height != b.Height || len(update.Connected) != 1 || !update.Connected[0].Equals(b) {
+			t.Errorf("expected block #%d to be connected again, got %+v", b.Height, update)
+		}
+	}
+	if got := []uint64{tc.balance(t, alice), tc.balance(t, bob)}; got[0] != 300 || got[1] != 700 {
+		t.Errorf("expected balances [300 700] after adding the blocks again, got %v", got)
+	}
+	if _, err := tc.Add(a2); err != ErrKnownBlock {
+		t.Errorf("expected ErrKnownBlock for a block on the main chain, got %v", err)
+	}
+}
+
+func TestAddBoundsSideBranches(t *testing.T) {
+	aliceKey, alice := newKey()
+	_, bob := newKey()
+	_, carol := newKey()
+	genesisBlock, _ := genesis.BringOnTheGenesis([][]byte{alice, bob}, 1000)
+	tc := setUp(t, genesisBlock)
+	defer tc.tearDown()
+
+	// A side block must carry valid contract signatures even though its branch is not connected
+	a1 := child(t, genesisBlock, signedContract(aliceKey, bob, 100, 1))
+	if _, err := tc.Add(a1); err != nil {
+		t.Fatalf("failed to add a1: %v", err)
+	}
+	forged := signedContract(aliceKey, carol, 30, 1)
+	forged.Value = 900
+	if _, err := tc.Add(child(t, genesisBlock, forged)); err == nil {
+		t.Errorf("expected side block with a forged contract to be rejected")
+	}
+
+	// A branch may not fork deeper than MaxForkDepth below the tip
+	shallow := child(t, genesisBlock, signedContract(aliceKey, carol, 30, 1))
+	if _, err := tc.Add(shallow); err != nil {
+		t.Fatalf("failed to add side block: %v", err)
+	}
+	tip := a1
+	for i := 0; i <= constants.MaxForkDepth; i++ {
+		tip = child(t, tip)
+		if _, err := tc.Add(tip); err != nil {
+			t.Fatalf("failed to add block #%d: %v", tip.Height, err)
+		}
+	}
+	if _, err := tc.Add(child(t, genesisBlock, signedContract(aliceKey, carol, 40, 1))); err == nil {
+		t.Errorf("expected block forking more than MaxForkDepth below the tip to be rejected")
+	}
+	if _, err := tc.Add(child(t, shallow)); err == nil {
+		t.Errorf("expected block on a branch forking more than MaxForkDepth below the tip to be rejected")
+	}
+	if height, _ := tc.Tip(); height.Height != constants.MaxForkDepth+2 {
+		t.Errorf("expected tip at height %d, got %d", constants.MaxForkDepth+2, height.Height)
+	}
+}
+
+func TestAddFollowsAuthority(t *testing.T) {
+	aliceKey, alice := newKey()
+	bobKey, bob := newKey()
+	genesisBlock, _ := genesis.BringOnTheGenesis([][]byte{alice, bob}, 1000)
+	tc := setUp(t, genesisBlock)
+	defer tc.tearDown()
+	// Slots last long enough for every block of the test to fall in the same slot
+	tc.version = constants.SignedBlockVersion
+	tc.authority, _ = consensus.NewAuthority([]*ecdsa.PublicKey{&aliceKey.PublicKey}, 24*time.Hour, 0)
+
+	if _, err := tc.Add(signedChild(t, bobKey, genesisBlock)); err == nil {
+		t.Errorf("expected block signed by an unregistered producer to be rejected")
+	}
+	a1 := signedChild(t, aliceKey, genesisBlock, signedContract(aliceKey, bob, 100, 1))
+	if _, err := tc.Add(a1); err != nil {
+		t.Fatalf("expected first block after genesis to be accepted: %v", err)
+	}
+	if _, err := tc.Add(signedChild(t, aliceKey, a1)); err == nil || !strings.Contains(err.Error(), "same slot") {
+		t.Errorf("expected second block in the same slot to be rejected by the slot rule, got %v", err)
+	}
+}
+
+func TestAddFollowsAuthorityAcrossSlots(t *testing.T) {
+	aliceKey, alice := newKey()
+	bobKey, bob := newKey()
+	carolKey, _ := newKey()
+	genesisBlock, _ := genesis.BringOnTheGenesis([][]byte{alice, bob}, 1000)
+	tc := setUp(t, genesisBlock)
+	defer tc.tearDown()
+	tc.version = constants.SignedBlockVersion
+	producerKeys := []*ecdsa.PrivateKey{aliceKey, bobKey, carolKey}
+	tc.authority, _ = consensus.NewAuthority([]*ecdsa.PublicKey{&aliceKey.PublicKey, &bobKey.PublicKey, &carolKey.PublicKey}, time.Minute, 0)
+
+	// inSlot returns a timestamp in slot, which lies in the past
+	firstSlot := tc.authority.SlotAt(time.Now().UnixNano()) - 12
+	inSlot := func(slot uint64) int64 { return tc.authority.SlotStart(slot) + int64(time.Second) }
+	ownerOf := func(slot uint64) *ecdsa.PrivateKey {
+		for i, producer := range tc.authority.Producers() {
+			if bytes.Equal(producer, tc.authority.ProducerOf(slot)) {
+				return producerKeys[i]
+			}
+		}
+		return nil
+	}
+
+	// Every producer builds in its own slots in turn, and a missed slot is skipped
+	parent := genesisBlock
+	for _, slot := range []uint64{firstSlot, firstSlot + 1, firstSlot + 2, firstSlot + 3, firstSlot + 5, firstSlot + 6} {
+		b := signedChildAt(t, ownerOf(slot), parent, inSlot(slot))
+		if _, err := tc.Add(b); err != nil {
+			t.Fatalf("expected block #%d in slot %d to be accepted: %v", b.Height, slot, err)
+		}
+		parent = b
+	}
+	if tip, _ := tc.ledger.GetYoungestBlockHeader(); tip.Height != 6 {
+		t.Errorf("expected the chain to reach height 6, got %d", tip.Height)
+	}
+
+	slot := firstSlot + 7
+	if _, err := tc.Add(signedChildAt(t, ownerOf(slot+1), parent, inSlot(slot))); err == nil {
+		t.Errorf("expected block in another producer's slot to be rejected")
+	}
+	if _, err := tc.Add(signedChildAt(t, ownerOf(slot-1), parent, inSlot(slot-1)+1)); err == nil {
+		t.Errorf("expected second block in its parent's slot to be rejected")
+	}
+	if _, err := tc.Add(signedChildAt(t, ownerOf(slot), parent, inSlot(slot))); err != nil {
+		t.Errorf("expected block in the next producer's slot to be accepted: %v", err)
+	}
+}
+
+func TestAddRejectsUnverifiedSignature(t *testing.T) {
+	_, alice := newKey()
+	_, bob := newKey()
+	genesisBlock, _ := genesis.BringOnTheGenesis([][]byte{alice, bob}, 1000)
+	tc := setUp(t, genesisBlock)
+	defer tc.tearDown()
+	tc.version = constants.SignedBlockVersion
+
+	forged, err := block.New(constants.SignedBlockVersion, 1, block.HashBlock(genesisBlock), nil)
+	if err != nil {
+		t.Fatalf("failed to create block: %v", err)
+	}
+	forged.Producer = bob
+	forged.Signature = []byte("not a signature")
+	if _, err := tc.Add(forged); err == nil {
+		t.Errorf("expected a signed block to be rejected without an authority to verify it")
+	}
+}
+
+func TestAddConsecutiveSignedBlocks(t *testing.T) {
+	aliceKey, alice := newKey()
+	_, bob := newKey()
+	genesisBlock, _ := genesis.BringOnTheGenesis([][]byte{alice, bob}, 1000)
+	tc := setUp(t, genesisBlock)
+	defer tc.tearDown()
+	tc.version = constants.SignedBlockVersion
+	tc.authority, _ = consensus.NewAuthority([]*ecdsa.PublicKey{&aliceKey.PublicKey}, time.Minute, 0)
+
+	// Each block is built in the slot after its parent's, and its child links to the hash of its signed header
+	parent := genesisBlock
+	now := time.Now().UnixNano()
+	for i := int64(3); i > 0; i-- {
+		b := signedChildAt(t, aliceKey, parent, now-i*int64(time.Minute))
+		if _, err := tc.Add(b); err != nil {
+			t.Fatalf("expected signed block #%d to be accepted: %v", b.Height, err)
+		}
+		parent = b
+	}
+	tip, err := tc.ledger.GetYoungestBlockHeader()
+	if err != nil || !bytes.Equal(block.HashBlockHeader(tip), block.HashBlock(parent)) {
+		t.Errorf("expected the youngest header to hash like the signed tip, got %+v (%v)", tip, err)
+	}
+}
+
+func TestAddKeepsUnsignedHistory(t *testing.T) {
+	aliceKey, alice := newKey()
+	_, bob := newKey()
+	genesisBlock, _ := genesis.BringOnTheGenesis([][]byte{alice, bob}, 1000)
+	tc := setUp(t, genesisBlock)
+	defer tc.tearDown()
+	// A version 1 chain switching to producers from height 2 on, synced by a node of the signed version
+	tc.version = constants.SignedBlockVersion
+	tc.authority, _ = consensus.NewAuthority([]*ecdsa.PublicKey{&aliceKey.PublicKey}, time.Minute, 2)
+
+	now := time.Now().UnixNano()
+	old, _ := block.NewAt(1, 1, now-3*int64(time.Minute), block.HashBlock(genesisBlock), nil)
+	if _, err := tc.Add(old); err != nil {
+		t.Fatalf("expected unsigned block before the switch to producers to be accepted: %v", err)
+	}
+	unsigned, _ := block.NewAt(1, 2, now-2*int64(time.Minute), block.HashBlock(old), nil)
+	if _, err := tc.Add(unsigned); err == nil {
+		t.Errorf("expected unsigned block from the switch to producers on to be rejected")
+	}
+	signed := signedChildAt(t, aliceKey, old, now-2*int64(time.Minute))
+	if _, err := tc.Add(signed); err != nil {
+		t.Fatalf("expected signed block at the switch to producers to be accepted: %v", err)
+	}
+	downgraded, _ := block.NewAt(1, 3, now-int64(time.Minute), block.HashBlock(signed), nil)
+	if _, err := tc.Add(downgraded); err == nil {
+		t.Errorf("expected block of an earlier version than its parent to be rejected")
+	}
+}
+
+func signedChild(t *testing.T, producer *ecdsa.PrivateKey, parent block.Block, blockContracts ...contracts.Contract) block.Block {
+	return signedChildAt(t, producer, parent, time.Now().UnixNano(), blockContracts...)
+}
+
+func signedChildAt(t *testing.T, producer *ecdsa.PrivateKey, parent block.Block, timestamp int64, blockContracts ...contracts.Contract) block.Block {
+	b, err := block.NewAt(constants.SignedBlockVersion, parent.Height+1, timestamp, block.HashBlock(parent), blockContracts)
+	if err != nil {
+		t.Fatalf("failed to create block: %v", err)
+	}
+	if err := b.Sign(producer); err != nil {
+		t.Fatalf("failed to sign block: %v", err)
+	}
+	return b
+}
+
+func TestAddMintsReward(t *testing.T) {
+	aliceKey, alice := newKey()
+	_, bob := newKey()
+	_, mint := newKey()
+	genesisBlock, _ := genesis.BringOnTheGenesis([][]byte{alice, bob}, 1000)
+	tc := setUp(t, genesisBlock)
+	defer tc.tearDown()
+	tc.policy = monetary.Policy{InitialReward: 50, MintAddr: mint}
+
+	if _, err := tc.Add(child(t, genesisBlock, signedContract(aliceKey, bob, 100, 1))); err == nil {
+		t.Errorf("expected block without its reward to be rejected")
+	}
+	reward, _ := tc.policy.NewReward(1, mint)
+	a1 := child(t, genesisBlock, signedContract(aliceKey, bob, 100, 1), *reward)
+	if _, err := tc.Add(a1); err != nil {
+		t.Fatalf("expected block with its reward to be accepted: %v", err)
+	}
+	if got := tc.balance(t, mint); got != 50 {
+		t.Errorf("expected mint address to hold the reward of 50, got %d", got)
+	}
+	if err := tc.policy.CheckSupply(tc.accounts, 1000, 1); err != nil {
+		t.Errorf("expected supply invariant to hold: %v", err)
+	}
+	if supply := tc.tableSupply(t, 1000, 1); supply != (monetary.Supply{Circulating: 1050, Minted: 1050}) {
+		t.Errorf("unexpected supply %+v", supply)
+	}
+}
+
+func TestAddMintContract(t *testing.T) {
+	_, alice := newKey()
+	_, bob := newKey()
+	mintKey, mint := newKey()
+	genesisBlock, _ := genesis.BringOnTheGenesis([][]byte{alice, bob}, 1000)
+	tc := setUp(t, genesisBlock)
+	defer tc.tearDown()
+	tc.policy = monetary.Policy{MintAddr: mint, MintCap: 100, MintPeriod: 10}
+
+	mintContract := func(value uint64, nonce uint64) contracts.Contract {
+		c, _ := contracts.New(constants.MintContractVersion, mintKey, bob, value, nonce)
+		c.Sign(mintKey)
+		return *c
+	}
+	if _, err := tc.Add(child(t, genesisBlock, mintContract(150, 1))); err == nil {
+		t.Errorf("expected mint over the cap to be rejected")
+	}
+	a1 := child(t, genesisBlock, mintContract(60, 1), mintContract(40, 2))
+	if _, err := tc.Add(a1); err != nil {
+		t.Fatalf("expected mints up to the cap to be accepted: %v", err)
+	}
+	if got := tc.balance(t, bob); got != 600 {
+		t.Errorf("expected bob to hold 600 after the mints, got %d", got)
+	}
+	if _, err := tc.Add(child(t, a1, mintContract(1, 3))); err == nil {
+		t.Errorf("expected mint over the cap of the period to be rejected")
+	}
+	if err := tc.policy.CheckSupply(tc.accounts, 1000, 1); err != nil {
+		t.Errorf("expected supply invariant to hold: %v", err)
+	}
+	if supply := tc.tableSupply(t, 1000, 1); supply != (monetary.Supply{Circulating: 1100, Minted: 1100}) {
+		t.Errorf("unexpected supply %+v", supply)
+	}
+
+	// Rolling back the block removes its mints from the mint log
+	if err := tc.rollBack(0); err != nil {
+		t.Fatalf("failed to roll back: %v", err)
+	}
+	if allowance, _ := tc.policy.MintAllowance(tc.accounts, 2); allowance != 100 {
+		t.Errorf("expected the full allowance after rolling back, got %d", allowance)
+	}
+}
+
+func TestAddBurnContract(t *testing.T) {
+	aliceKey, alice := newKey()
+	_, bob := newKey()
+	genesisBlock, _ := genesis.BringOnTheGenesis([][]byte{alice, bob}, 1000)
+	tc := setUp(t, genesisBlock)
+	defer tc.tearDown()
+
+	burn, _ := contracts.NewBurn(aliceKey, 200, 1)
+	burn.Sign(aliceKey)
+	a1 := child(t, genesisBlock, *burn, signedContract(aliceKey, bob, 100, 2))
+	if _, err := tc.Add(a1); err != nil {
+		t.Fatalf("expected block with a burn to be accepted: %v", err)
+	}
+	if got := []uint64{tc.balance(t, alice), tc.balance(t, bob)}; got[0] != 200 || got[1] != 600 {
+		t.Errorf("expected balances [200 600] after the burn, got %v", got)
+	}
+	if err := tc.policy.CheckSupply(tc.accounts, 1000, 1); err != nil {
+		t.Errorf("expected supply invariant to hold: %v", err)
+	}
+	if supply := tc.tableSupply(t, 1000, 1); supply != (monetary.Supply{Circulating: 800, Minted: 1000, Burned: 200}) {
+		t.Errorf("unexpected supply %+v", supply)
+	}
+
+	overburn, _ := contracts.NewBurn(aliceKey, 500, 3)
+	overburn.Sign(aliceKey)
+	if _, err := tc.Add(child(t, a1, *overburn)); err == nil {
+		t.Errorf("expected burn of more than the balance to be rejected")
+	}
+}
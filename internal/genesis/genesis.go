@@ -2,16 +2,24 @@ package genesis
 
 import (
 	"bufio"
+	"bytes"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
-	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
 
 	"os"
 
+	"github.com/SIGBlockchain/project_aurum/internal/address"
 	"github.com/SIGBlockchain/project_aurum/internal/block"
+	"github.com/SIGBlockchain/project_aurum/internal/config"
+	"github.com/SIGBlockchain/project_aurum/internal/consensus"
 	"github.com/SIGBlockchain/project_aurum/internal/constants"
 	"github.com/SIGBlockchain/project_aurum/internal/contracts"
 	"github.com/SIGBlockchain/project_aurum/internal/hashing"
@@ -34,22 +42,91 @@ type Flags struct {
 	NumBlocks   *uint64
 }
 
+// Timestamp is the time, in Unix nanoseconds, of genesis blocks built from a genesis address file, fixed so that
+// every node building the genesis block from the same file gets the same block
+const Timestamp int64 = 1546300800000000000 // 2019-01-01T00:00:00Z
+
+// Allocation is a wallet address the genesis block mints aurum to. Allocations without a Value share the initial
+// supply left over by the allocations with one evenly
+type Allocation struct {
+	Address []byte
+	Value   uint64
+}
+
+// BringOnTheGenesis returns the genesis block minting an even share of initialAurumSupply to each public key hash
 func BringOnTheGenesis(genesisPublicKeyHashes [][]byte, initialAurumSupply uint64) (block.Block, error) {
+	allocations := make([]Allocation, len(genesisPublicKeyHashes))
+	for i, pubKeyHash := range genesisPublicKeyHashes {
+		allocations[i] = Allocation{Address: pubKeyHash}
+	}
+	return BringOnTheGenesisAllocations(allocations, initialAurumSupply)
+}
+
+// BringOnTheGenesisAllocations returns the genesis block minting initialAurumSupply to allocations. The remainder
+// of the even shares goes a unit each to the first allocations without a value, so the whole supply is minted
+// unless every allocation has a value. The block is stamped with Timestamp
+func BringOnTheGenesisAllocations(allocations []Allocation, initialAurumSupply uint64) (block.Block, error) {
+	return bringOnTheGenesisAt(allocations, initialAurumSupply, Timestamp, nil)
+}
+
+// bringOnTheGenesisAt returns the genesis block minting initialAurumSupply to allocations with the given timestamp.
+// If specHash is not nil, the block ends with a nil-sender contract of no value to specHash, committing to the spec
+func bringOnTheGenesisAt(allocations []Allocation, initialAurumSupply uint64, timestamp int64, specHash []byte) (block.Block, error) {
+	if len(allocations) == 0 {
+		return block.Block{}, errors.New("No genesis addresses to allocate aurum to")
+	}
+	var allocated, shares uint64
+	seen := make(map[string]bool)
+	for _, allocation := range allocations {
+		if seen[string(allocation.Address)] {
+			return block.Block{}, errors.New("Duplicate genesis address: " + address.Encode(allocation.Address))
+		}
+		seen[string(allocation.Address)] = true
+		if allocation.Value == 0 {
+			shares++
+		} else if allocation.Value > initialAurumSupply-allocated {
+			return block.Block{}, errors.New("Genesis allocations exceed the initial aurum supply")
+		} else {
+			allocated += allocation.Value
+		}
+	}
+	var mintAmt, remainder uint64
+	if shares > 0 {
+		// (supply left over / number of allocations without a value)
+		mintAmt, remainder = (initialAurumSupply-allocated)/shares, (initialAurumSupply-allocated)%shares
+		if mintAmt == 0 {
+			return block.Block{}, errors.New("Initial aurum supply left over is too small to share between genesis addresses")
+		}
+	}
+
 	version := uint16(1)
-	mintAmt := initialAurumSupply / uint64(len(genesisPublicKeyHashes)) // (initialAurumSupply / n supplied key hashes)
 	var datum []contracts.Contract
-
-	for _, pubKeyHash := range genesisPublicKeyHashes {
-		// for every public key hashes, make a nil-sender contract with value indicated by mintAmt
-		contract, err := contracts.New(version, nil, pubKeyHash, mintAmt, 0)
+	for _, allocation := range allocations {
+		value := allocation.Value
+		if value == 0 {
+			value = mintAmt
+			if remainder > 0 {
+				value++
+				remainder--
+			}
+		}
+		// for every allocation, make a nil-sender contract with its value
+		contract, err := contracts.New(version, nil, allocation.Address, value, 0)
+		if err != nil {
+			return block.Block{}, errors.New("Failed to make contracts")
+		}
+		datum = append(datum, *contract)
+	}
+	if specHash != nil {
+		contract, err := contracts.New(version, nil, specHash, 0, 0)
 		if err != nil {
 			return block.Block{}, errors.New("Failed to make contracts")
 		}
-		datum = append(datum, *contract) // switched second parameter from data to contract
+		datum = append(datum, *contract)
 	}
 
 	// create genesis block with null previous hash
-	genesisBlock, err := block.New(version, 0, make([]byte, 32), datum)
+	genesisBlock, err := block.NewAt(version, 0, timestamp, make([]byte, 32), datum)
 	if err != nil {
 		return block.Block{}, errors.New("Failed to create genesis block")
 	}
@@ -57,39 +134,77 @@ func BringOnTheGenesis(genesisPublicKeyHashes [][]byte, initialAurumSupply uint6
 	return genesisBlock, nil
 }
 
-// Open the genesisHashFile
-// Read line by line
-// use bufio.ReadLine()
+// ReadGenesisHashes returns the addresses in the genesis address file in the current directory
 func ReadGenesisHashes() ([][]byte, error) {
-	//open genesisHashFile
-	file, err := os.Open(constants.GenesisAddresses)
+	allocations, err := ReadGenesisAllocations(constants.GenesisAddresses)
 	if err != nil {
-		return [][]byte{}, errors.New("Unable to open genesis_hashs.txt")
+		return nil, err
 	}
+	hashesInBytes := make([][]byte, len(allocations))
+	for i, allocation := range allocations {
+		hashesInBytes[i] = allocation.Address
+	}
+	return hashesInBytes, nil
+}
 
+// ReadGenesisAllocations reads the genesis address file filename. Each line holds an address, encoded or hex
+// encoded, optionally followed by the aurum allocated to it; blank lines are skipped
+func ReadGenesisAllocations(filename string) ([]Allocation, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, errors.New("Unable to open " + filename + ": " + err.Error())
+	}
 	defer file.Close()
 
-	reader := bufio.NewReader(file)
-
-	var hashesInBytes [][]byte
-
-	// while loop to loop till EOF
-	for {
-		line, _, err := reader.ReadLine()
-		if err == io.EOF {
-			break
+	var allocations []Allocation
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 2 {
+			return nil, errors.New("Invalid genesis address line: " + scanner.Text())
 		}
-		decodedHash, _ := hex.DecodeString(string(line))
-		// append to the byte slice that is going to be returned
-		hashesInBytes = append(hashesInBytes, decodedHash)
+		decodedHash, err := address.Decode(fields[0])
+		if err != nil {
+			return nil, errors.New("Invalid genesis address: " + err.Error())
+		}
+		allocation := Allocation{Address: decodedHash}
+		if len(fields) == 2 {
+			if allocation.Value, err = strconv.ParseUint(fields[1], 10, 64); err != nil || allocation.Value == 0 {
+				return nil, errors.New("Invalid genesis allocation: " + fields[1])
+			}
+		}
+		allocations = append(allocations, allocation)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.New("Failed to read " + filename + ": " + err.Error())
 	}
+	return allocations, nil
+}
 
-	return hashesInBytes, err
+// WriteGenesisAllocations writes allocations to the genesis address file filename, with encoded addresses
+func WriteGenesisAllocations(filename string, allocations []Allocation) error {
+	var sb strings.Builder
+	for _, allocation := range allocations {
+		sb.WriteString(address.Encode(allocation.Address))
+		if allocation.Value != 0 {
+			sb.WriteString(" " + strconv.FormatUint(allocation.Value, 10))
+		}
+		sb.WriteString("\n")
+	}
+	if err := ioutil.WriteFile(filename, []byte(sb.String()), 0644); err != nil {
+		return errors.New("Failed to write " + filename + ": " + err.Error())
+	}
+	return nil
 }
 
 // Create the genesisHashFile
 // Generate numHashes number of public key hashes
 // Store them AS STRINGS (not bytes) in the file, line by line
+// The private keys are discarded, so the aurum allocated to these addresses can never be spent;
+// cmd/genesis keeps the keys in encrypted wallet accounts
 func GenerateGenesisHashFile(numHashes uint16) error{
 
 	// creating the new file
@@ -108,11 +223,226 @@ func GenerateGenesisHashFile(numHashes uint16) error{
 		// get public kek and hash it
 		hashedPubKey := hashing.New(encodedPublicKey)
 
-		// get pub key hash as string to store in txt file
-		hashPubKeyStr := hex.EncodeToString(hashedPubKey)
+		// get pub key hash as an encoded address to store in txt file
+		hashPubKeyStr := address.Encode(hashedPubKey)
 
 		// write pub key hash into genesisHashFile
 		genHashfile.WriteString(hashPubKeyStr + "\n")
 	}
 	return nil
 }
+
+// Spec is a genesis specification, the JSON file every node of a chain starts from. It gives each genesis address
+// its balance explicitly, so the initial supply is their sum, and fixes the timestamp of the genesis block, so every
+// node builds the same genesis block. It also sets the chain's initial producers and mint authority.
+// The hash of the spec commits to all of it, and the genesis block commits to the hash of the spec
+type Spec struct {
+	ChainID     string    // ChainID names the chain the spec starts
+	Timestamp   time.Time // Timestamp is the time of the genesis block
+	Balances    []Balance
+	Producers   []string `json:",omitempty"` // hex encoded PEM public keys of the authorized producers
+	MintAddr    string   `json:",omitempty"` // address of the mint authority
+	GenesisHash string   `json:",omitempty"` // hex encoded hash the genesis block must have, if set
+	SpecHash    string   `json:",omitempty"` // hex encoded hash the spec must have, see Hash, if set
+}
+
+// Balance is the aurum a genesis address starts with
+type Balance struct {
+	Address string // encoded or hex encoded wallet address
+	Balance uint64
+}
+
+// ReadSpec reads the genesis spec filename and checks that it is complete and consistent
+func ReadSpec(filename string) (Spec, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return Spec{}, errors.New("Unable to open genesis spec: " + err.Error())
+	}
+	defer file.Close()
+	var spec Spec
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&spec); err != nil {
+		return Spec{}, errors.New("Failed to parse genesis spec: " + err.Error())
+	}
+	if err := spec.Validate(); err != nil {
+		return Spec{}, err
+	}
+	return spec, nil
+}
+
+// Validate checks that the spec names its chain and timestamp, that its balances are to distinct, valid addresses
+// and add up to a supply that fits in a uint64, and that its producers and mint address are valid
+func (s Spec) Validate() error {
+	if s.ChainID == "" {
+		return errors.New("Genesis spec must set a chain ID")
+	}
+	if s.Timestamp.IsZero() {
+		return errors.New("Genesis spec must set a timestamp")
+	}
+	if _, err := s.Allocations(); err != nil {
+		return err
+	}
+	if _, err := consensus.ParseProducers(s.Producers); err != nil {
+		return errors.New("Invalid genesis spec: " + err.Error())
+	}
+	if s.MintAddr != "" {
+		if _, err := address.Decode(s.MintAddr); err != nil {
+			return errors.New("Invalid genesis spec mint address: " + err.Error())
+		}
+	}
+	if s.GenesisHash != "" {
+		if decoded, err := hex.DecodeString(s.GenesisHash); err != nil || len(decoded) != 32 {
+			return errors.New("Invalid genesis spec hash: " + s.GenesisHash)
+		}
+	}
+	if s.SpecHash != "" {
+		if hash := hex.EncodeToString(s.Hash()); hash != strings.ToLower(s.SpecHash) {
+			return errors.New("Genesis spec hash " + hash + " does not match the pinned spec hash " + s.SpecHash)
+		}
+	}
+	return nil
+}
+
+// Hash returns the hash of the chain ID, timestamp, balances, producers and mint address of a valid spec. Addresses
+// and keys are hashed decoded, so specs writing them differently have the same hash
+func (s Spec) Hash() []byte {
+	var canonical struct {
+		ChainID   string
+		Timestamp int64
+		Balances  []Allocation
+		Producers [][]byte
+		MintAddr  []byte
+	}
+	canonical.ChainID = s.ChainID
+	canonical.Timestamp = s.Timestamp.UnixNano()
+	canonical.Balances, _ = s.Allocations()
+	for _, producer := range s.Producers {
+		decoded, _ := hex.DecodeString(producer)
+		canonical.Producers = append(canonical.Producers, decoded)
+	}
+	if s.MintAddr != "" {
+		canonical.MintAddr, _ = address.Decode(s.MintAddr)
+	}
+	encoded, _ := json.Marshal(canonical)
+	return hashing.New(encoded)
+}
+
+// Pin records the hash of the spec in filename, such as in a node's data directory, the first time the node starts
+// from it. Later it checks that the spec is the one recorded, so a node cannot run the chain with other producers
+// or another mint authority than the chain started with
+func (s Spec) Pin(filename string) error {
+	hash := hex.EncodeToString(s.Hash())
+	recorded, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		if err := ioutil.WriteFile(filename, []byte(hash+"\n"), 0644); err != nil {
+			return errors.New("Failed to record genesis spec hash: " + err.Error())
+		}
+		return nil
+	} else if err != nil {
+		return errors.New("Failed to read genesis spec hash: " + err.Error())
+	}
+	if strings.TrimSpace(string(recorded)) != hash {
+		return errors.New("Genesis spec hash " + hash + " differs from the hash " + strings.TrimSpace(string(recorded)) +
+			" of the spec the chain started from")
+	}
+	return nil
+}
+
+// Allocations returns the balances of the spec as allocations of the genesis block
+func (s Spec) Allocations() ([]Allocation, error) {
+	if len(s.Balances) == 0 {
+		return nil, errors.New("Genesis spec must set at least one balance")
+	}
+	allocations := make([]Allocation, len(s.Balances))
+	seen := make(map[string]bool)
+	var supply uint64
+	for i, balance := range s.Balances {
+		walletAddress, err := address.Decode(balance.Address)
+		if err != nil {
+			return nil, errors.New("Invalid genesis spec address: " + err.Error())
+		}
+		if seen[string(walletAddress)] {
+			return nil, errors.New("Duplicate genesis spec address: " + balance.Address)
+		}
+		seen[string(walletAddress)] = true
+		if balance.Balance == 0 {
+			return nil, errors.New("Genesis spec balance must not be zero: " + balance.Address)
+		}
+		if supply+balance.Balance < supply {
+			return nil, errors.New("Genesis spec balances overflow the supply")
+		}
+		supply += balance.Balance
+		allocations[i] = Allocation{Address: walletAddress, Value: balance.Balance}
+	}
+	return allocations, nil
+}
+
+// Supply returns the initial aurum supply of the spec, the sum of its balances
+func (s Spec) Supply() uint64 {
+	var supply uint64
+	for _, balance := range s.Balances {
+		supply += balance.Balance
+	}
+	return supply
+}
+
+// Block returns the genesis block of the spec, checking it against the spec's genesis hash if it sets one.
+// Its last contract mints nothing to the hash of the spec, so the block commits to the whole spec
+func (s Spec) Block() (block.Block, error) {
+	allocations, err := s.Allocations()
+	if err != nil {
+		return block.Block{}, err
+	}
+	genesisBlock, err := bringOnTheGenesisAt(allocations, s.Supply(), s.Timestamp.UnixNano(), s.Hash())
+	if err != nil {
+		return block.Block{}, err
+	}
+	if s.GenesisHash != "" {
+		if hash := hex.EncodeToString(block.HashBlock(genesisBlock)); hash != s.GenesisHash {
+			return block.Block{}, errors.New("Genesis block hash " + hash + " does not match the genesis spec hash " + s.GenesisHash)
+		}
+	}
+	return genesisBlock, nil
+}
+
+// Verify checks that genesisBlock, such as the first block of a ledger, is the genesis block of the spec
+func (s Spec) Verify(genesisBlock block.Block) error {
+	specBlock, err := s.Block()
+	if err != nil {
+		return err
+	}
+	if hash, specHash := block.HashBlock(genesisBlock), block.HashBlock(specBlock); !bytes.Equal(hash, specHash) {
+		return errors.New("Genesis block " + hex.EncodeToString(hash) + " is not the genesis block " +
+			hex.EncodeToString(specHash) + " of chain " + s.ChainID)
+	}
+	return nil
+}
+
+// Apply sets the initial supply, producers and mint address of cfg to those of the spec. Producers or a mint
+// address already set in cfg must match the spec's
+func (s Spec) Apply(cfg *config.Config) error {
+	if len(cfg.Producers) > 0 {
+		if len(cfg.Producers) != len(s.Producers) {
+			return errors.New("Configured producers differ from the genesis spec producers")
+		}
+		for i := range cfg.Producers {
+			if !strings.EqualFold(cfg.Producers[i], s.Producers[i]) {
+				return errors.New("Configured producers differ from the genesis spec producers")
+			}
+		}
+	}
+	if cfg.MintAddr != "" {
+		configured, err := address.Decode(cfg.MintAddr)
+		if err != nil {
+			return errors.New("Invalid mint address: " + err.Error())
+		}
+		if specMintAddr, _ := address.Decode(s.MintAddr); !bytes.Equal(configured, specMintAddr) {
+			return errors.New("Configured mint address differs from the genesis spec mint address")
+		}
+	}
+	cfg.InitialAurumSupply = s.Supply()
+	cfg.Producers = s.Producers
+	cfg.MintAddr = s.MintAddr
+	return nil
+}
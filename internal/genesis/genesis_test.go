@@ -1,17 +1,22 @@
 package genesis
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"database/sql"
 	"encoding/hex"
+	"io/ioutil"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/SIGBlockchain/project_aurum/internal/address"
 	"github.com/SIGBlockchain/project_aurum/internal/block"
 	"github.com/SIGBlockchain/project_aurum/internal/blockchain"
+	"github.com/SIGBlockchain/project_aurum/internal/config"
 	"github.com/SIGBlockchain/project_aurum/internal/constants"
 	"github.com/SIGBlockchain/project_aurum/internal/contracts"
 	"github.com/SIGBlockchain/project_aurum/internal/hashing"
@@ -110,6 +115,23 @@ func TestReadGenesisHashes(t *testing.T) {
 	}
 }
 
+func TestReadGenesisHashesRejectsTypos(t *testing.T) {
+	encoded := address.Encode(hashing.New([]byte("genesis")))
+	typo := []byte(encoded)
+	if typo[10] == 'q' {
+		typo[10] = 'p'
+	} else {
+		typo[10] = 'q'
+	}
+	genHashfile, _ := os.Create(constants.GenesisAddresses)
+	genHashfile.WriteString(encoded + "\n\n" + string(typo) + "\n")
+	genHashfile.Close()
+	defer os.Remove(constants.GenesisAddresses)
+	if _, err := ReadGenesisHashes(); err == nil {
+		t.Errorf("expected a mistyped address to be rejected")
+	}
+}
+
 func TestGenesisReadsAppropriately(t *testing.T) {
 	var testGenesisHash = "8db5d191bf333f96179c5f2ec7acd20a8c01378a1af120e2f2ded3672896931a"
 	genHashfile, _ := os.Create(constants.GenesisHashFile)
@@ -187,3 +209,199 @@ func TestGenesisReadsAppropriately(t *testing.T) {
 		}
 	}
 }
+
+func TestGenesisAllocations(t *testing.T) {
+	alice, bob, carol := hashing.New([]byte("alice")), hashing.New([]byte("bob")), hashing.New([]byte("carol"))
+	allocations := []Allocation{{Address: alice}, {Address: bob, Value: 400}, {Address: carol}}
+	filename := "test_genesis_allocations.txt"
+	if err := WriteGenesisAllocations(filename, allocations); err != nil {
+		t.Fatalf("failed to write genesis allocations: %v", err)
+	}
+	defer os.Remove(filename)
+	read, err := ReadGenesisAllocations(filename)
+	if err != nil {
+		t.Fatalf("failed to read genesis allocations: %v", err)
+	}
+	if !reflect.DeepEqual(read, allocations) {
+		t.Errorf("expected %v, got %v", allocations, read)
+	}
+
+	genesisBlock, err := BringOnTheGenesisAllocations(read, 1001)
+	if err != nil {
+		t.Fatalf("failed to create genesis block: %v", err)
+	}
+	for i, want := range []uint64{301, 400, 300} {
+		var c contracts.Contract
+		c.Deserialize(genesisBlock.Data[i])
+		if c.Value != want {
+			t.Errorf("expected allocation %d to be %d, got %d", i, want, c.Value)
+		}
+	}
+
+	invalid := map[string][]Allocation{
+		"no addresses":         nil,
+		"duplicate address":    {{Address: alice}, {Address: alice, Value: 1}},
+		"exceeding the supply": {{Address: alice, Value: 600}, {Address: bob, Value: 600}},
+		"nothing left":         {{Address: alice, Value: 1000}, {Address: bob}},
+	}
+	for name, allocations := range invalid {
+		if _, err := BringOnTheGenesisAllocations(allocations, 1000); err == nil {
+			t.Errorf("expected %s to be rejected", name)
+		}
+	}
+
+	ioutil.WriteFile(filename, []byte(address.Encode(alice)+" 0\n"), 0644)
+	if _, err := ReadGenesisAllocations(filename); err == nil {
+		t.Errorf("expected a zero allocation to be rejected")
+	}
+}
+
+func TestSpec(t *testing.T) {
+	producerKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	encodedProducer, _ := publickey.Encode(&producerKey.PublicKey)
+	alice, bob := address.Encode(hashing.New([]byte("alice"))), hex.EncodeToString(hashing.New([]byte("bob")))
+	specJSON := `{
+	"ChainID": "aurum-test",
+	"Timestamp": "2026-01-01T00:00:00Z",
+	"Balances": [{"Address": "` + alice + `", "Balance": 700}, {"Address": "` + bob + `", "Balance": 301}],
+	"Producers": ["` + hex.EncodeToString(encodedProducer) + `"],
+	"MintAddr": "` + alice + `"
+}`
+	filename := "test_genesis_spec.json"
+	ioutil.WriteFile(filename, []byte(specJSON), 0644)
+	defer os.Remove(filename)
+	spec, err := ReadSpec(filename)
+	if err != nil {
+		t.Fatalf("failed to read genesis spec: %v", err)
+	}
+	if spec.Supply() != 1001 {
+		t.Errorf("expected a supply of 1001, got %d", spec.Supply())
+	}
+
+	// every node builds the same genesis block from the spec
+	first, err := spec.Block()
+	if err != nil {
+		t.Fatalf("failed to create genesis block: %v", err)
+	}
+	second, _ := spec.Block()
+	hash := hex.EncodeToString(block.HashBlock(first))
+	if hash != hex.EncodeToString(block.HashBlock(second)) {
+		t.Errorf("expected the genesis block of a spec to be deterministic")
+	}
+	if err := spec.Verify(second); err != nil {
+		t.Errorf("expected the genesis block to verify: %v", err)
+	}
+	other, _ := BringOnTheGenesis([][]byte{hashing.New([]byte("alice"))}, 1001)
+	if err := spec.Verify(other); err == nil {
+		t.Errorf("expected another genesis block not to verify")
+	}
+	spec.GenesisHash = hash
+	if _, err := spec.Block(); err != nil {
+		t.Errorf("expected the genesis hash to match: %v", err)
+	}
+	spec.GenesisHash = hex.EncodeToString(make([]byte, 32))
+	if _, err := spec.Block(); err == nil {
+		t.Errorf("expected a mismatched genesis hash to be rejected")
+	}
+
+	// the spec hash commits to the producers and mint address, and the genesis block to the spec hash
+	spec.GenesisHash = hash
+	changed := spec
+	changed.GenesisHash = ""
+	changed.Producers = nil
+	changed.MintAddr = address.Encode(hashing.New([]byte("bob")))
+	if bytes.Equal(changed.Hash(), spec.Hash()) {
+		t.Errorf("expected specs with other producers and mint address to differ in hash")
+	}
+	changedBlock, err := changed.Block()
+	if err != nil {
+		t.Fatalf("failed to create genesis block: %v", err)
+	}
+	if err := spec.Verify(changedBlock); err == nil {
+		t.Errorf("expected the genesis block of a spec with other producers and mint address not to verify")
+	}
+	last := changedBlock.Data[len(changedBlock.Data)-1]
+	var commitment contracts.Contract
+	if err := commitment.Deserialize(last); err != nil || commitment.Value != 0 || !bytes.Equal(commitment.RecipPubKeyHash, changed.Hash()) {
+		t.Errorf("expected the last contract of the genesis block to commit to the spec hash, got %+v (%v)", commitment, err)
+	}
+	spec.SpecHash = hex.EncodeToString(spec.Hash())
+	if err := spec.Validate(); err != nil {
+		t.Errorf("expected the spec hash to match: %v", err)
+	}
+	changed.SpecHash = spec.SpecHash
+	if err := changed.Validate(); err == nil {
+		t.Errorf("expected a mismatched spec hash to be rejected")
+	}
+	pinned := "test_genesis_spec.hash"
+	defer os.Remove(pinned)
+	if err := spec.Pin(pinned); err != nil {
+		t.Errorf("failed to record spec hash: %v", err)
+	}
+	if err := spec.Pin(pinned); err != nil {
+		t.Errorf("expected the recorded spec to match: %v", err)
+	}
+	if err := changed.Pin(pinned); err == nil {
+		t.Errorf("expected another spec not to match the recorded spec")
+	}
+
+	cfg := config.Config{InitialAurumSupply: 5}
+	if err := spec.Apply(&cfg); err != nil || cfg.InitialAurumSupply != 1001 || len(cfg.Producers) != 1 || cfg.MintAddr != alice {
+		t.Errorf("expected the spec to set the supply, producers and mint address, got %+v (%v)", cfg, err)
+	}
+	if err := spec.Apply(&config.Config{MintAddr: bob}); err == nil {
+		t.Errorf("expected a conflicting mint address to be rejected")
+	}
+	if err := spec.Apply(&config.Config{Producers: []string{"00"}}); err == nil {
+		t.Errorf("expected conflicting producers to be rejected")
+	}
+
+	invalid := map[string]string{
+		"unknown field":     strings.Replace(specJSON, `"ChainID"`, `"Chain"`, 1),
+		"missing timestamp": strings.Replace(specJSON, `"Timestamp": "2026-01-01T00:00:00Z",`, "", 1),
+		"duplicate address": strings.Replace(specJSON, bob, hex.EncodeToString(hashing.New([]byte("alice"))), 1),
+		"zero balance":      strings.Replace(specJSON, `"Balance": 301`, `"Balance": 0`, 1),
+		"invalid producer":  strings.Replace(specJSON, hex.EncodeToString(encodedProducer), "00", 1),
+	}
+	for name, data := range invalid {
+		ioutil.WriteFile(filename, []byte(data), 0644)
+		if _, err := ReadSpec(filename); err == nil {
+			t.Errorf("expected a spec with %s to be rejected", name)
+		}
+	}
+}
+
+// The genesis hash of the address file and spec in testdata is pinned, and so is the hash of the spec, so a change to
+// how genesis blocks or spec hashes are built, which would split nodes running different versions onto different
+// chains, fails this test
+func TestGenesisHashVector(t *testing.T) {
+	const want = "a53f409f8c23670f2059cdd59a1826bad2fa61996e238cd40813c2aa31db39aa"
+	allocations, err := ReadGenesisAllocations("testdata/genesis_hashes.txt")
+	if err != nil {
+		t.Fatalf("failed to read genesis addresses: %v", err)
+	}
+	genesisBlock, err := BringOnTheGenesisAllocations(allocations, 500000000000000)
+	if err != nil {
+		t.Fatalf("failed to create genesis block: %v", err)
+	}
+	if hash := hex.EncodeToString(block.HashBlock(genesisBlock)); hash != want {
+		t.Errorf("expected genesis hash %s, got %s", want, hash)
+	}
+
+	// the spec gives the same balances explicitly, with the same timestamp, and its genesis block also commits to
+	// the spec hash
+	const wantSpec = "2ab4bb8bb166bd146bb56d0f2ff1a4eabe2d99260d45cd5225731a957de8b608"
+	spec, err := ReadSpec("testdata/genesis.json")
+	if err != nil {
+		t.Fatalf("failed to read genesis spec: %v", err)
+	}
+	if spec.GenesisHash != wantSpec {
+		t.Errorf("expected the spec to pin genesis hash %s, got %s", wantSpec, spec.GenesisHash)
+	}
+	if hash := hex.EncodeToString(spec.Hash()); hash != "4d4d12805d2bb7973c8f5ca44aa88ed63275ae0a5327ea4e255aed6c04df0aff" {
+		t.Errorf("unexpected spec hash %s", hash)
+	}
+	if _, err := spec.Block(); err != nil {
+		t.Errorf("failed to create genesis block from spec: %v", err)
+	}
+}
@@ -3,18 +3,27 @@ package handlers
 import (
 	"bytes"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync"
 
+	"github.com/SIGBlockchain/project_aurum/internal/accountstable"
+	"github.com/SIGBlockchain/project_aurum/internal/address"
 	"github.com/SIGBlockchain/project_aurum/internal/block"
+	"github.com/SIGBlockchain/project_aurum/internal/config"
 	"github.com/SIGBlockchain/project_aurum/internal/contracts"
+	"github.com/SIGBlockchain/project_aurum/internal/forkchoice"
 	"github.com/SIGBlockchain/project_aurum/internal/ifaces"
+	"github.com/SIGBlockchain/project_aurum/internal/monetary"
 	"github.com/SIGBlockchain/project_aurum/internal/pendingpool"
+	"github.com/SIGBlockchain/project_aurum/internal/requests"
 	"github.com/SIGBlockchain/project_aurum/internal/sqlstatements"
 )
 
@@ -24,11 +33,23 @@ const NOT_FOUND_ERR_MSG = "No entry found for the reqeusted wallet address. Pote
 func HandleAccountInfoRequest(dbConn *sql.DB, pMap pendingpool.PendingMap, pendingLock *sync.Mutex) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		var reqestingWalletAddress = r.URL.Query().Get("w") // assume this is hex-encoded
+		var reqestingWalletAddress = r.URL.Query().Get("w") // an encoded address, or hex-encoded
+
+		// the tables are keyed by hex-encoded wallet address; mistyped encoded addresses are rejected
+		var encodedAddress string
+		if decoded, err := address.Decode(reqestingWalletAddress); err == nil {
+			reqestingWalletAddress = hex.EncodeToString(decoded)
+			encodedAddress = address.Encode(decoded)
+		} else if strings.HasPrefix(strings.ToLower(reqestingWalletAddress), address.Prefix+"1") {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, err.Error())
+			return
+		}
 
 		// TODO: Remake this struct
 		type AccountInfo struct {
 			WalletAddress string
+			Address       string
 			Balance       uint64
 			StateNonce    uint64
 		}
@@ -40,7 +61,7 @@ func HandleAccountInfoRequest(dbConn *sql.DB, pMap pendingpool.PendingMap, pendi
 		pendingLock.Unlock()
 
 		if ok {
-			accInfo = AccountInfo{reqestingWalletAddress, pendingData.PendingBal, pendingData.PendingNonce}
+			accInfo = AccountInfo{reqestingWalletAddress, encodedAddress, pendingData.PendingBal, pendingData.PendingNonce}
 		} else {
 
 			// Query the database
@@ -67,6 +88,7 @@ func HandleAccountInfoRequest(dbConn *sql.DB, pMap pendingpool.PendingMap, pendi
 				io.WriteString(w, err.Error())
 				return
 			}
+			accInfo.Address = encodedAddress
 		}
 
 		// Marshall the struct into the response body
@@ -127,7 +149,12 @@ func HandleGetJSONBlockByHeight(fetcher ifaces.IBlockFetcher) func(w http.Respon
 			io.WriteString(w, err.Error())
 			return
 		}
-		b := block.Deserialize(serializedBlock)
+		b, err := block.Deserialize(serializedBlock)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, err.Error())
+			return
+		}
 		jsonBlock := b.Marshal()
 		marshalledBlock, err := json.Marshal(jsonBlock)
 		if err != nil {
@@ -140,6 +167,346 @@ func HandleGetJSONBlockByHeight(fetcher ifaces.IBlockFetcher) func(w http.Respon
 	}
 }
 
+// Handler for blocks gossiped by peers
+// The block is added to the chain, which validates it against its parent and may reorganize the ledger
+// onto the block's branch. Updates that change the main chain are sent on updateChannel
+func HandleIncomingBlock(chain *forkchoice.Chain, updateChannel chan forkchoice.Update) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var requestBody block.JSONBlock
+		buf := new(bytes.Buffer)
+		buf.ReadFrom(r.Body)
+		if err := json.Unmarshal(buf.Bytes(), &requestBody); err != nil {
+			w.WriteHeader(http.StatusNotAcceptable)
+			io.WriteString(w, err.Error())
+			return
+		}
+		incomingBlock, err := requestBody.Unmarshal()
+		if err != nil {
+			w.WriteHeader(http.StatusNotAcceptable)
+			io.WriteString(w, err.Error())
+			return
+		}
+
+		update, err := chain.Add(incomingBlock)
+		if err == forkchoice.ErrKnownBlock || err == forkchoice.ErrUnknownParent {
+			w.WriteHeader(http.StatusConflict)
+			io.WriteString(w, err.Error())
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, err.Error())
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		// Blocks on a branch shorter than the main chain are stored without changing the tip
+		if updateChannel != nil && len(update.Connected) > 0 {
+			updateChannel <- update
+		}
+	}
+}
+
+// Handler for queries of the height of the youngest block in the ledger
+func HandleHeightQuery(ledger ifaces.ILedgerManager) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		ledger.Lock()
+		youngestBlockHeader, err := ledger.GetYoungestBlockHeader()
+		ledger.Unlock()
+		if err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(w, err.Error())
+			return
+		}
+		marshalledHeight, err := json.Marshal(requests.HeightResponse{Height: youngestBlockHeader.Height})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, string(marshalledHeight))
+	}
+}
+
+// MintResponse is a mint contract in the response to a mint history query
+type MintResponse struct {
+	Height    uint64
+	Recipient string
+	Value     uint64
+}
+
+// Handler for the history of mint contracts applied to the accounts table, oldest first
+func HandleMintHistory(dbConn *sql.DB) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		mintLog, err := accountstable.GetMintLog(dbConn)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, err.Error())
+			return
+		}
+		mints := make([]MintResponse, len(mintLog))
+		for i, entry := range mintLog {
+			mints[i] = MintResponse{entry.Height, hex.EncodeToString(entry.Recipient), entry.Value}
+		}
+		marshalledMints, err := json.Marshal(mints)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, string(marshalledMints))
+	}
+}
+
+// Handler for the circulating, minted and burned aurum at the youngest block, from the reward schedule of policy
+// and the mint and burn logs of the accounts table
+func HandleSupplyQuery(ledger ifaces.ILedgerManager, dbConn *sql.DB, policy monetary.Policy) func(w http.ResponseWriter, r *http.Request) {
+	// The genesis supply is read once, under the ledger's lock
+	var genesisSupply uint64
+	var haveGenesisSupply bool
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		ledger.Lock()
+		supply, err := func() (monetary.Supply, error) {
+			if !haveGenesisSupply {
+				serializedGenesis, err := ledger.GetBlockByHeight(0)
+				if err != nil {
+					return monetary.Supply{}, err
+				}
+				genesisBlock, err := block.Deserialize(serializedGenesis)
+				if err != nil {
+					return monetary.Supply{}, errors.New("Failed to deserialize genesis block: " + err.Error())
+				}
+				if genesisSupply, err = monetary.GenesisSupply(genesisBlock); err != nil {
+					return monetary.Supply{}, err
+				}
+				haveGenesisSupply = true
+			}
+			youngestBlockHeader, err := ledger.GetYoungestBlockHeader()
+			if err != nil {
+				return monetary.Supply{}, err
+			}
+			return policy.TableSupply(dbConn, genesisSupply, youngestBlockHeader.Height)
+		}()
+		ledger.Unlock()
+		if err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(w, err.Error())
+			return
+		}
+		marshalledSupply, err := json.Marshal(supply)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, string(marshalledSupply))
+	}
+}
+
+// ContractStatusResponse is the body of a response to a contract status query
+type ContractStatusResponse struct {
+	Height        uint64 // of the block confirming the contract
+	Confirmations uint64 // the confirming block and every block after it
+}
+
+// Handler for the status of the contract whose hex encoded hash, the hash of the serialized contract, is c.
+// Contracts that are not in the ledger, whether pending or unknown, are not found
+func HandleContractStatus(ledger ifaces.ILedgerManager) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		contractHash, err := hex.DecodeString(r.URL.Query().Get("c"))
+		if err != nil || len(contractHash) != 32 {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, "Invalid contract hash")
+			return
+		}
+		ledger.Lock()
+		status, found, err := findContract(ledger, contractHash)
+		ledger.Unlock()
+		if err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(w, err.Error())
+			return
+		}
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, "No contract with this hash in the ledger. It may still be pending")
+			return
+		}
+		marshalledStatus, err := json.Marshal(status)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, string(marshalledStatus))
+	}
+}
+
+// findContract looks up the block holding the contract with contractHash in the ledger's contract index
+func findContract(ledger ifaces.ILedgerManager, contractHash []byte) (ContractStatusResponse, bool, error) {
+	height, found, err := ledger.GetContractHeight(contractHash)
+	if err != nil || !found {
+		return ContractStatusResponse{}, false, err
+	}
+	youngestBlockHeader, err := ledger.GetYoungestBlockHeader()
+	if err != nil {
+		return ContractStatusResponse{}, false, err
+	}
+	return ContractStatusResponse{height, youngestBlockHeader.Height - height + 1}, true, nil
+}
+
+// Handler for batches of block headers, starting at height h with at most n (capped at maxBatch) headers
+func HandleGetBatchOfHeaders(ledger ifaces.ILedgerManager, maxBatch uint64) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		serializedBlocks, err := getBatchOfBlocks(ledger, maxBatch, r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, err.Error())
+			return
+		}
+		jsonHeaders := make([]block.JSONBlockHeader, len(serializedBlocks))
+		for i, serializedBlock := range serializedBlocks {
+			b, err := block.Deserialize(serializedBlock)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				io.WriteString(w, err.Error())
+				return
+			}
+			jsonHeaders[i] = b.GetHeader().Marshal()
+		}
+		marshalledHeaders, err := json.Marshal(jsonHeaders)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, string(marshalledHeaders))
+	}
+}
+
+// Handler for batches of blocks, starting at height h with at most n (capped at maxBatch) blocks
+func HandleGetBatchOfBlocks(ledger ifaces.ILedgerManager, maxBatch uint64) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		serializedBlocks, err := getBatchOfBlocks(ledger, maxBatch, r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, err.Error())
+			return
+		}
+		jsonBlocks := make([]block.JSONBlock, len(serializedBlocks))
+		for i, serializedBlock := range serializedBlocks {
+			b, err := block.Deserialize(serializedBlock)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				io.WriteString(w, err.Error())
+				return
+			}
+			jsonBlocks[i] = b.Marshal()
+		}
+		marshalledBlocks, err := json.Marshal(jsonBlocks)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, string(marshalledBlocks))
+	}
+}
+
+// getBatchOfBlocks parses the h and n query values and fetches that batch from the ledger
+func getBatchOfBlocks(ledger ifaces.ILedgerManager, maxBatch uint64, r *http.Request) ([][]byte, error) {
+	startHeight, err := strconv.ParseUint(r.URL.Query().Get("h"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	numBlocks, err := strconv.ParseUint(r.URL.Query().Get("n"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	if numBlocks > maxBatch {
+		numBlocks = maxBatch
+	}
+	return ledger.GetBatchOfBlocks(startHeight, numBlocks)
+}
+
+// LimitRequestBody wraps handler so that reading more than maxBytes of a request body fails
+func LimitRequestBody(handler http.Handler, maxBytes int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Handler for queries of the configuration the node is running with, which is read under configLock.
+// Like every admin request, it is only served to clients on the node's own host
+func HandleConfigQuery(cfg *config.Config, configLock *sync.RWMutex) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !fromLoopback(r) {
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, "Admin requests are only served to the local host")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		configLock.RLock()
+		marshalledConfig, err := json.Marshal(cfg)
+		configLock.RUnlock()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, string(marshalledConfig))
+	}
+}
+
+// Handler for POST requests to reload the configuration. The request is passed to the node on reloadChannel as a
+// channel the node answers on with the error of the reload, such as settings that need a restart, or nil
+func HandleConfigReload(reloadChannel chan chan error) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !fromLoopback(r) {
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, "Admin requests are only served to the local host")
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			io.WriteString(w, "Reload with a POST request")
+			return
+		}
+		result := make(chan error)
+		reloadChannel <- result
+		if err := <-result; err != nil {
+			w.WriteHeader(http.StatusConflict)
+			io.WriteString(w, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, "Configuration reloaded")
+	}
+}
+
+// fromLoopback returns true if r was sent from a loopback address
+func fromLoopback(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
 // GetBlockFromResponse will convert the body of a reponse and return a Block
 // Note - per the documentation on the response struct, the body is never nil
 func GetBlockFromResponse(r *http.Response) (block.Block, error) {
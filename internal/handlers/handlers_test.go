@@ -8,20 +8,30 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/SIGBlockchain/project_aurum/internal/accountstable"
+	"github.com/SIGBlockchain/project_aurum/internal/address"
 	"github.com/SIGBlockchain/project_aurum/internal/block"
+	"github.com/SIGBlockchain/project_aurum/internal/blockchain"
+	"github.com/SIGBlockchain/project_aurum/internal/config"
 	"github.com/SIGBlockchain/project_aurum/internal/constants"
 	"github.com/SIGBlockchain/project_aurum/internal/contracts"
+	"github.com/SIGBlockchain/project_aurum/internal/datadir"
+	"github.com/SIGBlockchain/project_aurum/internal/endpoints"
+	"github.com/SIGBlockchain/project_aurum/internal/genesis"
 	"github.com/SIGBlockchain/project_aurum/internal/hashing"
 	"github.com/SIGBlockchain/project_aurum/internal/mock"
+	"github.com/SIGBlockchain/project_aurum/internal/monetary"
 	"github.com/SIGBlockchain/project_aurum/internal/pendingpool"
 	"github.com/SIGBlockchain/project_aurum/internal/publickey"
 	"github.com/SIGBlockchain/project_aurum/internal/sqlstatements"
@@ -104,6 +114,33 @@ func TestHandleAccountInfoRequest(t *testing.T) {
 		t.Errorf("failed to get correct state nonce: got %d want %d", accInfo.StateNonce, 0)
 	}
 
+	// The same account by its encoded address, which a typo makes invalid
+	encoded := address.Encode(walletAddress)
+	req, _ = requests.NewAccountInfoRequest("", encoded)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	var encodedInfo struct {
+		WalletAddress string
+		Address       string
+		Balance       uint64
+	}
+	json.Unmarshal(rr.Body.Bytes(), &encodedInfo)
+	if rr.Code != http.StatusOK || encodedInfo.Balance != 1337 || encodedInfo.Address != encoded || encodedInfo.WalletAddress != hex.EncodeToString(walletAddress) {
+		t.Errorf("unexpected response to encoded address: %d %s", rr.Code, rr.Body.String())
+	}
+	typo := []byte(encoded)
+	if typo[10] == 'q' {
+		typo[10] = 'p'
+	} else {
+		typo[10] = 'q'
+	}
+	req, _ = requests.NewAccountInfoRequest("", string(typo))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected a mistyped address to be rejected, got %d", rr.Code)
+	}
+
 	// Pending case
 	privateKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	encodedSenderPublicKey, _ = publickey.Encode(&privateKey.PublicKey)
@@ -350,7 +387,7 @@ func TestGetJSONBlockByHeight(t *testing.T) {
 		{
 			"Valid Block",
 			block.Block{
-				Version:        3,
+				Version:        1,
 				Height:         584,
 				PreviousHash:   []byte("guavapineapplemango1234567890abc"),
 				MerkleRootHash: []byte("grapewatermeloncoconut1emonsabcd"),
@@ -427,7 +464,7 @@ func TestGetBlockFromResponse(t *testing.T) {
 		{
 			"Valid Block",
 			block.Block{
-				Version:        3,
+				Version:        1,
 				Height:         584,
 				PreviousHash:   hashing.New([]byte("0x34")),
 				MerkleRootHash: hashing.New([]byte("0x34")),
@@ -482,3 +519,205 @@ func TestGetBlockFromResponse(t *testing.T) {
 
 	}
 }
+
+func TestHandleIncomingBlockMalformedBody(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, endpoints.IncomingBlock, strings.NewReader("not a block"))
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(HandleIncomingBlock(nil, nil))
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotAcceptable {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotAcceptable)
+	}
+}
+
+func TestLimitRequestBody(t *testing.T) {
+	readAll := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.Copy(ioutil.Discard, r.Body); err != nil {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+		}
+	})
+	handler := LimitRequestBody(readAll, 8)
+	for body, want := range map[string]int{"12345678": http.StatusOK, "123456789": http.StatusRequestEntityTooLarge} {
+		req, err := http.NewRequest(http.MethodPost, endpoints.Contract, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != want {
+			t.Errorf("handler returned wrong status code for %d bytes: got %v want %v", len(body), rr.Code, want)
+		}
+	}
+}
+
+func TestHandleConfigQuery(t *testing.T) {
+	cfg := config.Defaults()
+	handler := http.HandlerFunc(HandleConfigQuery(&cfg, new(sync.RWMutex)))
+	req, err := http.NewRequest(http.MethodGet, endpoints.AdminConfig, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected a remote admin request to be forbidden, got %v", rr.Code)
+	}
+
+	req.RemoteAddr = "127.0.0.1:40000"
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	var served config.Config
+	if err := json.Unmarshal(rr.Body.Bytes(), &served); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("failed to query configuration: %v %s", rr.Code, rr.Body.String())
+	}
+	if !reflect.DeepEqual(served, cfg) {
+		t.Errorf("served configuration does not match: got %+v want %+v", served, cfg)
+	}
+}
+
+func TestHandleConfigReload(t *testing.T) {
+	reloadChannel := make(chan chan error)
+	go func() {
+		(<-reloadChannel) <- nil
+		(<-reloadChannel) <- errors.New("Port needs a restart")
+	}()
+	handler := http.HandlerFunc(HandleConfigReload(reloadChannel))
+	tests := []struct {
+		method string
+		want   int
+	}{
+		{http.MethodGet, http.StatusMethodNotAllowed},
+		{http.MethodPost, http.StatusOK},
+		{http.MethodPost, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, endpoints.AdminReload, nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+		req.RemoteAddr = "[::1]:40000"
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("handler returned wrong status code for %s: got %v want %v", tt.method, rr.Code, tt.want)
+		}
+	}
+}
+
+func TestHandleGetBatchOfBlocksBadQuery(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, endpoints.BlockBatchQuery+"?h=abc&n=2", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	for _, handler := range []http.HandlerFunc{HandleGetBatchOfBlocks(nil, 10), HandleGetBatchOfHeaders(nil, 10)} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestHandleContractStatusBadQuery(t *testing.T) {
+	req, err := requests.GetContractStatusRequest("", "xyz")
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(HandleContractStatus(nil)).ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHandleMintHistory(t *testing.T) {
+	dbConn, _ := sql.Open("sqlite3", constants.AccountsTable)
+	defer func() {
+		dbConn.Close()
+		if err := os.Remove(constants.AccountsTable); err != nil {
+			t.Errorf("failed to remove database: %v", err)
+		}
+	}()
+	dbConn.Exec(sqlstatements.CREATE_ACCOUNT_BALANCES_TABLE)
+
+	mintKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	recipient := hashing.New([]byte("recipient"))
+	mint, _ := contracts.New(constants.MintContractVersion, mintKey, recipient, 25, 1)
+	mint.Sign(mintKey)
+	b, _ := block.New(1, 3, make([]byte, 32), []contracts.Contract{*mint})
+	if err := accountstable.ApplyBlock(dbConn, &b); err != nil {
+		t.Fatalf("failed to apply block: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, endpoints.MintHistory, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(HandleMintHistory(dbConn)).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var mints []MintResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &mints); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	expected := []MintResponse{{3, hex.EncodeToString(recipient), 25}}
+	if !reflect.DeepEqual(mints, expected) {
+		t.Errorf("unexpected mint history: got %v want %v", mints, expected)
+	}
+}
+
+func TestHandleSupplyQuery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aurum_handlers")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	dataDir := datadir.New(dir)
+	mintKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	recipient := hashing.New([]byte("recipient"))
+	genesisBlock, _ := genesis.BringOnTheGenesis([][]byte{recipient}, 1000)
+	if err := blockchain.Airdrop(dataDir.Ledger(), dataDir.Metadata(), dataDir.Accounts(), genesisBlock); err != nil {
+		t.Fatalf("failed to airdrop: %v", err)
+	}
+	ledgerFile, _ := os.OpenFile(dataDir.Ledger(), os.O_APPEND|os.O_RDWR, 0644)
+	defer ledgerFile.Close()
+	metadataConn, _ := sql.Open("sqlite3", dataDir.Metadata())
+	defer metadataConn.Close()
+	accountsConn, _ := sql.Open("sqlite3", dataDir.Accounts())
+	defer accountsConn.Close()
+	ledger := blockchain.NewLedgerManager(ledgerFile, metadataConn)
+
+	policy := monetary.Policy{InitialReward: 50}
+	mint, _ := contracts.New(constants.MintContractVersion, mintKey, recipient, 25, 1)
+	mint.Sign(mintKey)
+	reward, _ := policy.NewReward(1, recipient)
+	b, _ := block.New(1, 1, block.HashBlock(genesisBlock), []contracts.Contract{*mint, *reward})
+	if err := ledger.AddBlock(b); err != nil {
+		t.Fatalf("failed to add block: %v", err)
+	}
+	if err := accountstable.ApplyBlock(accountsConn, &b); err != nil {
+		t.Fatalf("failed to apply block: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, endpoints.SupplyQuery, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(HandleSupplyQuery(ledger, accountsConn, policy)).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var supply monetary.Supply
+	if err := json.Unmarshal(rr.Body.Bytes(), &supply); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if expected := (monetary.Supply{Circulating: 1075, Minted: 1075}); supply != expected {
+		t.Errorf("unexpected supply: got %+v want %+v", supply, expected)
+	}
+}
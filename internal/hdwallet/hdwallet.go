@@ -0,0 +1,151 @@
+// Package hdwallet derives any number of account keys from a single seed, so that a wallet can be backed up once as
+// a mnemonic phrase and restored from it. Mnemonics and seeds follow BIP-0039 and keys are derived on P-256 as
+// described by SLIP-0010, using hardened derivation only
+package hdwallet
+
+import (
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	bip39 "github.com/tyler-smith/go-bip39"
+
+	"github.com/SIGBlockchain/project_aurum/internal/privatekey"
+)
+
+const (
+	// Hardened is added to a child index to derive a hardened child
+	Hardened uint32 = 1 << 31
+	// Purpose is the first level of account paths, as in BIP-0044
+	Purpose uint32 = 44
+	// CoinType is the second level of account paths. Aurum has no registered SLIP-0044 coin type,
+	// so it uses 1, the coin type shared by test networks
+	CoinType uint32 = 1
+	// EntropyBits is the entropy of new mnemonics, which are 12 words long
+	EntropyBits = 128
+
+	masterKeySecret = "Nist256p1 seed"
+)
+
+// ExtendedKey is a private key together with the chain code its children are derived with
+type ExtendedKey struct {
+	Key       []byte // 32 byte big endian secret scalar
+	ChainCode []byte
+}
+
+// NewMnemonic returns a new random 12 word mnemonic
+func NewMnemonic() (string, error) {
+	entropy, err := bip39.NewEntropy(EntropyBits)
+	if err != nil {
+		return "", errors.New("Failed to generate entropy: " + err.Error())
+	}
+	return bip39.NewMnemonic(entropy)
+}
+
+// SeedFromMnemonic checks the words and checksum of mnemonic and returns the 64 byte seed it stands for.
+// Whitespace between words is normalized and the empty passphrase is used
+func SeedFromMnemonic(mnemonic string) ([]byte, error) {
+	mnemonic = strings.Join(strings.Fields(strings.ToLower(mnemonic)), " ")
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, "")
+	if err != nil {
+		return nil, errors.New("Invalid mnemonic: " + err.Error())
+	}
+	return seed, nil
+}
+
+// NewMasterKey returns the root of the key tree of seed
+func NewMasterKey(seed []byte) (ExtendedKey, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return ExtendedKey{}, errors.New("Seed must be between 16 and 64 bytes long")
+	}
+	i := hmacSHA512([]byte(masterKeySecret), seed)
+	for !validScalar(i[:32]) {
+		i = hmacSHA512([]byte(masterKeySecret), i)
+	}
+	return ExtendedKey{i[:32], i[32:]}, nil
+}
+
+// Child returns the hardened child of k with the given index, which must be below Hardened
+func (k ExtendedKey) Child(index uint32) (ExtendedKey, error) {
+	if index >= Hardened {
+		return ExtendedKey{}, fmt.Errorf("Child index %d is out of range", index)
+	}
+	n := elliptic.P256().Params().N
+	data := make([]byte, 37)
+	copy(data[1:33], k.Key)
+	binary.BigEndian.PutUint32(data[33:], index+Hardened)
+	for {
+		i := hmacSHA512(k.ChainCode, data)
+		childKey := new(big.Int).SetBytes(i[:32])
+		if childKey.Cmp(n) < 0 {
+			childKey.Add(childKey, new(big.Int).SetBytes(k.Key))
+			childKey.Mod(childKey, n)
+			if childKey.Sign() != 0 {
+				return ExtendedKey{childKey.FillBytes(make([]byte, 32)), i[32:]}, nil
+			}
+		}
+		// The derived key is invalid, which is vanishingly unlikely, so derivation is retried from the chain code
+		data[0] = 1
+		copy(data[1:33], i[32:])
+	}
+}
+
+// Derive returns the descendant of k at the hardened indices of path, in order
+func (k ExtendedKey) Derive(path ...uint32) (ExtendedKey, error) {
+	var err error
+	for _, index := range path {
+		if k, err = k.Child(index); err != nil {
+			return ExtendedKey{}, err
+		}
+	}
+	return k, nil
+}
+
+// PrivateKey returns the P-256 private key of k
+func (k ExtendedKey) PrivateKey() (privatekey.AurumPrivateKey, error) {
+	return privatekey.NewFromScalar(k.Key)
+}
+
+// AccountPath returns the hardened indices of the account with the given index, m/44'/1'/index'
+func AccountPath(index uint32) []uint32 {
+	return []uint32{Purpose, CoinType, index}
+}
+
+// FormatPath returns path in the usual notation, such as m/44'/1'/0'
+func FormatPath(path []uint32) string {
+	formatted := "m"
+	for _, index := range path {
+		formatted += fmt.Sprintf("/%d'", index)
+	}
+	return formatted
+}
+
+// DeriveAccount returns the private key of the account with the given index of the wallet with seed
+func DeriveAccount(seed []byte, index uint32) (privatekey.AurumPrivateKey, error) {
+	master, err := NewMasterKey(seed)
+	if err != nil {
+		return privatekey.AurumPrivateKey{}, err
+	}
+	account, err := master.Derive(AccountPath(index)...)
+	if err != nil {
+		return privatekey.AurumPrivateKey{}, err
+	}
+	return account.PrivateKey()
+}
+
+func hmacSHA512(key []byte, data []byte) []byte {
+	mac := hmac.New(sha512.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// validScalar returns true if d is a valid P-256 private key, in [1, n-1]
+func validScalar(d []byte) bool {
+	scalar := new(big.Int).SetBytes(d)
+	return scalar.Sign() != 0 && scalar.Cmp(elliptic.P256().Params().N) < 0
+}
@@ -0,0 +1,90 @@
+package hdwallet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/SIGBlockchain/project_aurum/internal/publickey"
+)
+
+// TestDerive checks derivation against the nist256p1 test vectors of SLIP-0010
+func TestDerive(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	master, err := NewMasterKey(seed)
+	if err != nil {
+		t.Fatalf("failed to create master key: %v", err)
+	}
+	tests := []struct {
+		path      []uint32
+		chainCode string
+		key       string
+	}{
+		{nil, "beeb672fe4621673f722f38529c07392fecaa61015c80c34f29ce8b41b3cb6ea", "612091aaa12e22dd2abef664f8a01a82cae99ad7441b7ef8110424915c268bc2"},
+		{[]uint32{0}, "3460cea53e6a6bb5fb391eeef3237ffd8724bf0a40e94943c98b83825342ee11", "6939694369114c67917a182c59ddb8cafc3004e63ca5d3b84403ba8613debc0c"},
+		// The first key derived for this index is invalid, so derivation is retried
+		{[]uint32{28578}, "e94c8ebe30c2250a14713212f6449b20f3329105ea15b652ca5bdfc68f6c65c2", "06f0db126f023755d0b8d86d4591718a5210dd8d024e3e14b6159d63f53aa669"},
+	}
+	for _, tt := range tests {
+		t.Run(FormatPath(tt.path), func(t *testing.T) {
+			k, err := master.Derive(tt.path...)
+			if err != nil {
+				t.Fatalf("failed to derive key: %v", err)
+			}
+			if chainCode := hex.EncodeToString(k.ChainCode); chainCode != tt.chainCode {
+				t.Errorf("expected chain code %s, got %s", tt.chainCode, chainCode)
+			}
+			if key := hex.EncodeToString(k.Key); key != tt.key {
+				t.Errorf("expected key %s, got %s", tt.key, key)
+			}
+		})
+	}
+	if _, err := master.Child(Hardened); err == nil {
+		t.Errorf("expected an index at or above Hardened to be rejected")
+	}
+}
+
+func TestDeriveAccount(t *testing.T) {
+	mnemonic := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	seed, err := SeedFromMnemonic("  Abandon abandon abandon abandon abandon abandon\nabandon abandon abandon abandon abandon about ")
+	if err != nil {
+		t.Fatalf("failed to read mnemonic: %v", err)
+	}
+	// BIP-0039 seed of the mnemonic with the empty passphrase
+	if hex.EncodeToString(seed) != "5eb00bbddcf069084889a8ab9155568165f5c453ccb85e70811aaed6f6da5fc19a5ac40b389cd370d086206dec8aa6c43daea6690f20ad3d8d48b2d2ce9e38e4" {
+		t.Errorf("unexpected seed %x", seed)
+	}
+	if _, err := SeedFromMnemonic(strings.Replace(mnemonic, "about", "abandon", 1)); err == nil {
+		t.Errorf("expected a mnemonic with a bad checksum to be rejected")
+	}
+
+	first, err := DeriveAccount(seed, 0)
+	if err != nil {
+		t.Fatalf("failed to derive account: %v", err)
+	}
+	again, _ := DeriveAccount(seed, 0)
+	second, _ := DeriveAccount(seed, 1)
+	if !first.Equals(again.Key) {
+		t.Errorf("expected derivation to be deterministic")
+	}
+	if first.Equals(second.Key) {
+		t.Errorf("expected accounts to have different keys")
+	}
+	firstPublic, _ := publickey.New(first.Key)
+	againPublic, _ := publickey.New(again.Key)
+	if !bytes.Equal(firstPublic.Hash, againPublic.Hash) {
+		t.Errorf("expected the same address")
+	}
+
+	newMnemonic, err := NewMnemonic()
+	if err != nil {
+		t.Fatalf("failed to create mnemonic: %v", err)
+	}
+	if words := strings.Fields(newMnemonic); len(words) != 12 {
+		t.Errorf("expected 12 words, got %d", len(words))
+	}
+	if _, err := SeedFromMnemonic(newMnemonic); err != nil {
+		t.Errorf("expected a new mnemonic to be valid: %v", err)
+	}
+}
@@ -20,6 +20,8 @@ type ILedgerManager interface {
 	GetBlockByHeight(height int) ([]byte, error)
 	GetBlockByPosition(position int) ([]byte, error)
 	GetBlockByHash(hash []byte) ([]byte, error)
+	GetBatchOfBlocks(startHeight uint64, numBlocks uint64) ([][]byte, error)
+	GetContractHeight(contractHash []byte) (uint64, bool, error)
 	GetYoungestBlock() (block.Block, error)
 	GetYoungestBlockHeader() (block.BlockHeader, error)
 	Lock()
@@ -0,0 +1,201 @@
+// Package keystore encrypts private keys under a passphrase. The key encrypting the private key is derived from
+// the passphrase with scrypt and the private key is sealed with AES-256-GCM, so a wrong passphrase or a tampered
+// keystore fails to decrypt rather than yielding a different key
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/scrypt"
+
+	"github.com/SIGBlockchain/project_aurum/internal/privatekey"
+)
+
+const (
+	Version = 1
+	KDF     = "scrypt"
+	Cipher  = "aes-256-gcm"
+	keyLen  = 32
+	saltLen = 32
+)
+
+var (
+	// ErrWrongPassphrase is returned when a keystore does not decrypt under the passphrase given
+	ErrWrongPassphrase = errors.New("Wrong passphrase")
+	// ErrLocked is returned when the private key of a locked keystore is requested
+	ErrLocked = errors.New("Keystore is locked")
+)
+
+// ScryptParams are the cost parameters of scrypt and the salt it was run with
+type ScryptParams struct {
+	N    int
+	R    int
+	P    int
+	Salt string // hex encoded
+}
+
+// StandardParams are the scrypt cost parameters for wallets, which take a fraction of a second to unlock.
+// LightParams are cheaper, for tests and constrained machines
+var (
+	StandardParams = ScryptParams{N: 1 << 15, R: 8, P: 1}
+	LightParams    = ScryptParams{N: 1 << 12, R: 8, P: 1}
+)
+
+// Keystore is a PEM encoded private key encrypted under a passphrase, as stored in JSON.
+// An unlocked Keystore also holds the decrypted private key in memory until it is locked again
+type Keystore struct {
+	Version    int
+	KDF        string
+	KDFParams  ScryptParams
+	Cipher     string
+	Nonce      string // hex encoded
+	Ciphertext string // hex encoded
+
+	privateKey *ecdsa.PrivateKey
+}
+
+// Encrypt returns a Keystore holding key encrypted under passphrase, deriving the encryption key with scrypt
+// at the cost of params under a new random salt. The keystore is returned locked
+func Encrypt(key *ecdsa.PrivateKey, passphrase []byte, params ScryptParams) (*Keystore, error) {
+	pemEncoded, err := privatekey.Encode(key)
+	if err != nil {
+		return nil, errors.New("Failed to encode private key: " + err.Error())
+	}
+	return EncryptSecret(pemEncoded, passphrase, params)
+}
+
+// EncryptSecret returns a Keystore holding secret, such as a wallet seed, encrypted under passphrase the same way
+// Encrypt encrypts private keys. Its secret is read with DecryptSecret rather than Unlock
+func EncryptSecret(secret []byte, passphrase []byte, params ScryptParams) (*Keystore, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("Passphrase must not be empty")
+	}
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, errors.New("Failed to generate salt: " + err.Error())
+	}
+	params.Salt = hex.EncodeToString(salt)
+	aead, err := newAEAD(passphrase, params)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.New("Failed to generate nonce: " + err.Error())
+	}
+	return &Keystore{
+		Version:    Version,
+		KDF:        KDF,
+		KDFParams:  params,
+		Cipher:     Cipher,
+		Nonce:      hex.EncodeToString(nonce),
+		Ciphertext: hex.EncodeToString(aead.Seal(nil, nonce, secret, nil)),
+	}, nil
+}
+
+// Unlock decrypts the private key with passphrase and keeps it in memory until Lock is called
+func (ks *Keystore) Unlock(passphrase []byte) error {
+	pemEncoded, err := ks.DecryptSecret(passphrase)
+	if err != nil {
+		return err
+	}
+	// a keystore may hold a seed rather than a key
+	if keyBlock, _ := pem.Decode(pemEncoded); keyBlock == nil {
+		return errors.New("Failed to decode private key: keystore does not hold a PEM encoded key")
+	}
+	key, err := privatekey.Decode(pemEncoded)
+	if err != nil {
+		return errors.New("Failed to decode private key: " + err.Error())
+	}
+	ks.privateKey = key
+	return nil
+}
+
+// DecryptSecret decrypts the contents of the keystore with passphrase and returns them without unlocking it
+func (ks *Keystore) DecryptSecret(passphrase []byte) ([]byte, error) {
+	if ks.Version != Version || ks.KDF != KDF || ks.Cipher != Cipher {
+		return nil, fmt.Errorf("Unsupported keystore: version %d, %s, %s", ks.Version, ks.KDF, ks.Cipher)
+	}
+	nonce, err := hex.DecodeString(ks.Nonce)
+	if err != nil {
+		return nil, errors.New("Failed to decode nonce: " + err.Error())
+	}
+	ciphertext, err := hex.DecodeString(ks.Ciphertext)
+	if err != nil {
+		return nil, errors.New("Failed to decode ciphertext: " + err.Error())
+	}
+	aead, err := newAEAD(passphrase, ks.KDFParams)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, errors.New("Invalid nonce length")
+	}
+	secret, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return secret, nil
+}
+
+// Lock drops the decrypted private key, zeroing its secret scalar.
+// Keys returned by PrivateKey must not be used after the keystore is locked
+func (ks *Keystore) Lock() {
+	if ks.privateKey != nil {
+		ks.privateKey.D.SetInt64(0)
+		ks.privateKey = nil
+	}
+}
+
+// IsLocked returns true if the private key is not decrypted
+func (ks *Keystore) IsLocked() bool {
+	return ks.privateKey == nil
+}
+
+// PrivateKey returns the decrypted private key of an unlocked keystore
+func (ks *Keystore) PrivateKey() (*ecdsa.PrivateKey, error) {
+	if ks.privateKey == nil {
+		return nil, ErrLocked
+	}
+	return ks.privateKey, nil
+}
+
+// ChangePassphrase re-encrypts the private key under newPassphrase with a new salt and nonce, keeping the
+// cost parameters. The keystore is left unlocked
+func (ks *Keystore) ChangePassphrase(oldPassphrase []byte, newPassphrase []byte) error {
+	if err := ks.Unlock(oldPassphrase); err != nil {
+		return err
+	}
+	key := ks.privateKey
+	reencrypted, err := Encrypt(key, newPassphrase, ks.KDFParams)
+	if err != nil {
+		return err
+	}
+	*ks = *reencrypted
+	ks.privateKey = key
+	return nil
+}
+
+// newAEAD derives the encryption key from passphrase with scrypt and returns the AES-256-GCM cipher using it
+func newAEAD(passphrase []byte, params ScryptParams) (cipher.AEAD, error) {
+	salt, err := hex.DecodeString(params.Salt)
+	if err != nil {
+		return nil, errors.New("Failed to decode salt: " + err.Error())
+	}
+	derivedKey, err := scrypt.Key(passphrase, salt, params.N, params.R, params.P, keyLen)
+	if err != nil {
+		return nil, errors.New("Failed to derive key: " + err.Error())
+	}
+	block, err := aes.NewCipher(derivedKey)
+	if err != nil {
+		return nil, errors.New("Failed to create cipher: " + err.Error())
+	}
+	return cipher.NewGCM(block)
+}
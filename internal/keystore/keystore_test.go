@@ -0,0 +1,93 @@
+package keystore
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+)
+
+func TestKeystore(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if _, err := Encrypt(key, nil, LightParams); err == nil {
+		t.Errorf("expected an empty passphrase to be rejected")
+	}
+	ks, err := Encrypt(key, []byte("passphrase"), LightParams)
+	if err != nil {
+		t.Fatalf("failed to encrypt key: %v", err)
+	}
+	if !ks.IsLocked() {
+		t.Errorf("expected a new keystore to be locked")
+	}
+
+	// Keystores are stored as JSON and unlocked after they are read back
+	marshalled, err := json.Marshal(ks)
+	if err != nil {
+		t.Fatalf("failed to marshal keystore: %v", err)
+	}
+	var stored Keystore
+	if err := json.Unmarshal(marshalled, &stored); err != nil {
+		t.Fatalf("failed to unmarshal keystore: %v", err)
+	}
+	if err := stored.Unlock([]byte("wrong")); err != ErrWrongPassphrase {
+		t.Errorf("expected the wrong passphrase to be rejected, got %v", err)
+	}
+	if _, err := stored.PrivateKey(); err != ErrLocked {
+		t.Errorf("expected a locked keystore to withhold its key, got %v", err)
+	}
+	if err := stored.Unlock([]byte("passphrase")); err != nil {
+		t.Fatalf("failed to unlock keystore: %v", err)
+	}
+	if decrypted, err := stored.PrivateKey(); err != nil || decrypted.D.Cmp(key.D) != 0 {
+		t.Errorf("expected the keystore to decrypt to the original key: %v", err)
+	}
+	decrypted, _ := stored.PrivateKey()
+	stored.Lock()
+	if !stored.IsLocked() || decrypted.D.Sign() != 0 {
+		t.Errorf("expected locking to drop and zero the key")
+	}
+
+	if err := stored.ChangePassphrase([]byte("wrong"), []byte("new passphrase")); err != ErrWrongPassphrase {
+		t.Errorf("expected the wrong old passphrase to be rejected, got %v", err)
+	}
+	salt := stored.KDFParams.Salt
+	if err := stored.ChangePassphrase([]byte("passphrase"), []byte("new passphrase")); err != nil {
+		t.Fatalf("failed to change passphrase: %v", err)
+	}
+	if stored.KDFParams.Salt == salt {
+		t.Errorf("expected a new salt")
+	}
+	if err := stored.Unlock([]byte("passphrase")); err != ErrWrongPassphrase {
+		t.Errorf("expected the old passphrase to be rejected, got %v", err)
+	}
+	if err := stored.Unlock([]byte("new passphrase")); err != nil {
+		t.Errorf("expected the new passphrase to unlock the keystore: %v", err)
+	}
+
+	tampered := *ks
+	ciphertext, _ := hex.DecodeString(tampered.Ciphertext)
+	ciphertext[0] ^= 1
+	tampered.Ciphertext = hex.EncodeToString(ciphertext)
+	if err := tampered.Unlock([]byte("passphrase")); err != ErrWrongPassphrase {
+		t.Errorf("expected a tampered keystore to fail to decrypt, got %v", err)
+	}
+}
+
+func TestEncryptSecret(t *testing.T) {
+	secret := []byte("seed bytes")
+	ks, err := EncryptSecret(secret, []byte("passphrase"), LightParams)
+	if err != nil {
+		t.Fatalf("failed to encrypt secret: %v", err)
+	}
+	if _, err := ks.DecryptSecret([]byte("wrong")); err != ErrWrongPassphrase {
+		t.Errorf("expected the wrong passphrase to be rejected, got %v", err)
+	}
+	if decrypted, err := ks.DecryptSecret([]byte("passphrase")); err != nil || string(decrypted) != string(secret) {
+		t.Errorf("expected %q, got %q (%v)", secret, decrypted, err)
+	}
+	if err := ks.Unlock([]byte("passphrase")); err == nil {
+		t.Errorf("expected a secret that is not a private key not to unlock")
+	}
+}
@@ -0,0 +1,90 @@
+// Package logging filters the node's log messages by level. Messages are written with the standard log package,
+// so they share its flags and output; messages below the current level are dropped. The level may be changed
+// while the node runs
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+// Level is the severity of a log message
+type Level int32
+
+const (
+	// Debug messages trace routine events, such as each contract added to the pending pool
+	Debug Level = iota
+	// Info messages report the progress of the node
+	Info
+	// Warn messages report failures the node recovers from
+	Warn
+	// Error messages report failures of requests or operations the node keeps running after
+	Error
+)
+
+var levelNames = [...]string{"debug", "info", "warn", "error"}
+
+var current = int32(Info)
+
+// String returns the name of the level
+func (l Level) String() string {
+	if l < Debug || l > Error {
+		return fmt.Sprintf("level(%d)", int32(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel returns the level named name, case insensitively
+func ParseLevel(name string) (Level, error) {
+	for i, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return Level(i), nil
+		}
+	}
+	return Info, errors.New("Invalid log level, use " + strings.Join(levelNames[:], ", ") + ": " + name)
+}
+
+// SetLevel drops messages below level from then on
+func SetLevel(level Level) {
+	atomic.StoreInt32(&current, int32(level))
+}
+
+// GetLevel returns the current level
+func GetLevel() Level {
+	return Level(atomic.LoadInt32(&current))
+}
+
+// Enabled returns true if messages of level are logged
+func Enabled(level Level) bool {
+	return level >= GetLevel()
+}
+
+// Debugf logs a debug message
+func Debugf(format string, v ...interface{}) {
+	logf(Debug, format, v...)
+}
+
+// Infof logs an info message
+func Infof(format string, v ...interface{}) {
+	logf(Info, format, v...)
+}
+
+// Warnf logs a warning
+func Warnf(format string, v ...interface{}) {
+	logf(Warn, format, v...)
+}
+
+// Errorf logs an error
+func Errorf(format string, v ...interface{}) {
+	logf(Error, format, v...)
+}
+
+// logf logs the message if its level is enabled, attributing it to the caller of Debugf, Infof, Warnf or Errorf
+func logf(level Level, format string, v ...interface{}) {
+	if Enabled(level) {
+		log.Output(3, fmt.Sprintf(format, v...))
+	}
+}
@@ -0,0 +1,45 @@
+package logging
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLevels(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer log.SetOutput(os.Stderr)
+	defer SetLevel(Info)
+
+	for _, name := range []string{"debug", "INFO", "Warn", "error"} {
+		if _, err := ParseLevel(name); err != nil {
+			t.Errorf("failed to parse level %s: %v", name, err)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Errorf("expected an unknown level to be rejected")
+	}
+
+	SetLevel(Warn)
+	Debugf("debug %d", 1)
+	Infof("info %d", 2)
+	Warnf("warn %d", 3)
+	Errorf("error %d", 4)
+	logged := out.String()
+	if strings.Contains(logged, "debug 1") || strings.Contains(logged, "info 2") {
+		t.Errorf("expected messages below warn to be dropped:\n%s", logged)
+	}
+	if !strings.Contains(logged, "warn 3") || !strings.Contains(logged, "error 4") {
+		t.Errorf("expected warnings and errors to be logged:\n%s", logged)
+	}
+
+	out.Reset()
+	SetLevel(Debug)
+	Debugf("debug %d", 5)
+	if !strings.Contains(out.String(), "debug 5") || GetLevel() != Debug {
+		t.Errorf("expected debug messages to be logged after lowering the level")
+	}
+}
@@ -0,0 +1,308 @@
+// Package monetary holds the monetary policy: how much aurum each block mints, to whom, how much
+// the mint key may mint, and how much aurum should exist at a given height once burns are deducted
+package monetary
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/SIGBlockchain/project_aurum/internal/accountstable"
+	"github.com/SIGBlockchain/project_aurum/internal/address"
+	"github.com/SIGBlockchain/project_aurum/internal/block"
+	"github.com/SIGBlockchain/project_aurum/internal/config"
+	"github.com/SIGBlockchain/project_aurum/internal/contracts"
+	"github.com/SIGBlockchain/project_aurum/internal/ifaces"
+	"github.com/SIGBlockchain/project_aurum/internal/sqlstatements"
+)
+
+// Policy is the block reward schedule. Every block after genesis mints the reward for its height to its
+// producer in a nil-sender contract, which is the last contract of the block. The reward halves every
+// HalvingInterval blocks; with a HalvingInterval of zero the issuance is fixed at InitialReward per block.
+//
+// The key of MintAddr may also sign mint contracts, which together mint at most MintCap aurum in every period of
+// MintPeriod blocks; with a MintPeriod of zero the cap holds for every block.
+// The zero Policy mints nothing after genesis
+type Policy struct {
+	InitialReward   uint64
+	HalvingInterval uint64
+	// MintAddr receives the rewards of unsigned blocks, which do not name their producer.
+	// If it is nil, the recipient of those rewards is not checked and mint contracts are rejected
+	MintAddr   []byte
+	MintCap    uint64
+	MintPeriod uint64
+}
+
+// NewPolicy returns the Policy set in cfg. The mint address is an encoded or hex encoded public key hash, or empty
+func NewPolicy(cfg *config.Config) (Policy, error) {
+	p := Policy{InitialReward: cfg.BlockReward, HalvingInterval: cfg.HalvingInterval, MintCap: cfg.MintCap, MintPeriod: cfg.MintPeriod}
+	if cfg.MintAddr != "" {
+		decodedMintAddr, err := address.Decode(cfg.MintAddr)
+		if err != nil {
+			return Policy{}, errors.New("Invalid mint address: " + err.Error())
+		}
+		p.MintAddr = decodedMintAddr
+	}
+	return p, nil
+}
+
+// RewardAt returns the aurum minted by the block at height. The genesis block has no reward
+func (p Policy) RewardAt(height uint64) uint64 {
+	if height == 0 {
+		return 0
+	}
+	if p.HalvingInterval == 0 {
+		return p.InitialReward
+	}
+	halvings := (height - 1) / p.HalvingInterval
+	if halvings >= 64 {
+		return 0
+	}
+	return p.InitialReward >> halvings
+}
+
+// IssuedThrough returns the aurum minted by the rewards of every block up to and including height
+func (p Policy) IssuedThrough(height uint64) uint64 {
+	if p.HalvingInterval == 0 {
+		return p.InitialReward * height
+	}
+	var issued uint64
+	for halvings := uint64(0); halvings < 64 && height > 0; halvings++ {
+		blocks := p.HalvingInterval
+		if height < blocks {
+			blocks = height
+		}
+		issued += blocks * (p.InitialReward >> halvings)
+		height -= blocks
+	}
+	return issued
+}
+
+// Beneficiary returns the public key hash the reward of a block goes to: its producer, or the mint address
+// for unsigned blocks
+func (p Policy) Beneficiary(h block.BlockHeader) []byte {
+	if len(h.Producer) > 0 {
+		return h.Producer
+	}
+	return p.MintAddr
+}
+
+// NewReward returns the nil-sender contract minting the reward of the block at height to recipient.
+// The state nonce of a reward is its block height, which keeps rewards of equal value distinct.
+// If the policy mints nothing at height, the contract is nil
+func (p Policy) NewReward(height uint64, recipient []byte) (*contracts.Contract, error) {
+	reward := p.RewardAt(height)
+	if reward == 0 {
+		return nil, nil
+	}
+	contract, err := contracts.New(1, nil, recipient, reward, height)
+	if err != nil {
+		return nil, errors.New("Failed to create reward contract: " + err.Error())
+	}
+	return contract, nil
+}
+
+// ValidateReward checks that b mints exactly the reward for its height to its beneficiary, in a nil-sender
+// contract at the end of the block, and mints nothing else
+func (p Policy) ValidateReward(b block.Block) error {
+	var reward *contracts.Contract
+	for i, data := range b.Data {
+		var contract contracts.Contract
+		if err := contract.Deserialize(data); err != nil {
+			return errors.New("Failed to deserialize contract: " + err.Error())
+		}
+		if contract.SenderPubKey != nil {
+			continue
+		}
+		if i != len(b.Data)-1 {
+			return fmt.Errorf("block #%d mints aurum before its last contract", b.Height)
+		}
+		reward = &contract
+	}
+
+	expected := p.RewardAt(b.Height)
+	if reward == nil {
+		if expected == 0 {
+			return nil
+		}
+		return fmt.Errorf("block #%d is missing its reward of %d aurum", b.Height, expected)
+	}
+	if reward.Value != expected {
+		return fmt.Errorf("block #%d mints %d aurum instead of %d", b.Height, reward.Value, expected)
+	}
+	if reward.StateNonce != b.Height {
+		return fmt.Errorf("reward of block #%d has state nonce %d", b.Height, reward.StateNonce)
+	}
+	if beneficiary := p.Beneficiary(b.GetHeader()); beneficiary != nil && !bytes.Equal(reward.RecipPubKeyHash, beneficiary) {
+		return fmt.Errorf("block #%d mints its reward to %s instead of %s", b.Height,
+			address.Encode(reward.RecipPubKeyHash), address.Encode(beneficiary))
+	}
+	return nil
+}
+
+// MintPeriodStart returns the height of the first block of the mint period the block at height belongs to
+func (p Policy) MintPeriodStart(height uint64) uint64 {
+	if p.MintPeriod == 0 || height == 0 {
+		return height
+	}
+	return (height-1)/p.MintPeriod*p.MintPeriod + 1
+}
+
+// MintAllowance returns how much aurum the mint contracts of the block at height may still mint, given the mint
+// contracts applied to the accounts table earlier in its period
+func (p Policy) MintAllowance(accounts *sql.DB, height uint64) (uint64, error) {
+	if len(p.MintAddr) == 0 || height == 0 {
+		return 0, nil
+	}
+	minted, err := accountstable.GetMintedBetween(accounts, p.MintPeriodStart(height), height-1)
+	if err != nil {
+		return 0, err
+	}
+	if minted >= p.MintCap {
+		return 0, nil
+	}
+	return p.MintCap - minted, nil
+}
+
+// ValidateMints checks that the mint contracts of b stay within the mint allowance of its height.
+// Their signatures and state nonces are checked by validation.ValidateMint
+func (p Policy) ValidateMints(accounts *sql.DB, b block.Block) error {
+	var minted uint64
+	for _, data := range b.Data {
+		var contract contracts.Contract
+		if err := contract.Deserialize(data); err != nil {
+			return errors.New("Failed to deserialize contract: " + err.Error())
+		}
+		if contract.IsMint() {
+			minted += contract.Value
+		}
+	}
+	if minted == 0 {
+		return nil
+	}
+	allowance, err := p.MintAllowance(accounts, b.Height)
+	if err != nil {
+		return err
+	}
+	if minted > allowance {
+		return fmt.Errorf("block #%d mints %d aurum with mint contracts, over the allowance of %d", b.Height, minted, allowance)
+	}
+	return nil
+}
+
+// GenesisSupply returns the aurum minted by the genesis block
+func GenesisSupply(genesisBlock block.Block) (uint64, error) {
+	var supply uint64
+	for _, data := range genesisBlock.Data {
+		var contract contracts.Contract
+		if err := contract.Deserialize(data); err != nil {
+			return 0, errors.New("Failed to deserialize contract: " + err.Error())
+		}
+		if contract.SenderPubKey == nil {
+			supply += contract.Value
+		}
+	}
+	return supply, nil
+}
+
+// ExpectedSupply returns the aurum that should exist once the block at height has been applied,
+// given the aurum minted by mint contracts and destroyed by burn contracts up to that block
+func (p Policy) ExpectedSupply(genesisSupply uint64, minted uint64, burned uint64, height uint64) uint64 {
+	return genesisSupply + p.IssuedThrough(height) + minted - burned
+}
+
+// TotalSupply returns the sum of every balance in the accounts table
+func TotalSupply(accounts *sql.DB) (uint64, error) {
+	var supply uint64
+	if err := accounts.QueryRow(sqlstatements.GET_SUM_OF_BALANCES_FROM_ACCOUNT_BALANCES).Scan(&supply); err != nil {
+		return 0, errors.New("Failed to sum balances: " + err.Error())
+	}
+	return supply, nil
+}
+
+// CheckSupply checks the total supply invariant: the balances in the accounts table add up to the genesis
+// supply plus every reward and mint contract up to height, less every burn contract
+func (p Policy) CheckSupply(accounts *sql.DB, genesisSupply uint64, height uint64) error {
+	supply, err := TotalSupply(accounts)
+	if err != nil {
+		return err
+	}
+	minted, err := accountstable.GetMintedBetween(accounts, 0, height)
+	if err != nil {
+		return err
+	}
+	burned, err := accountstable.GetBurnedBetween(accounts, 0, height)
+	if err != nil {
+		return err
+	}
+	if expected := p.ExpectedSupply(genesisSupply, minted, burned, height); supply != expected {
+		return fmt.Errorf("total supply at block #%d is %d aurum, expected %d", height, supply, expected)
+	}
+	return nil
+}
+
+// Supply is the aurum created and destroyed by the blocks of a ledger
+type Supply struct {
+	Circulating uint64 // Minted less Burned
+	Minted      uint64 // by the genesis block, block rewards and mint contracts
+	Burned      uint64 // by burn contracts
+}
+
+// Add counts the aurum created and destroyed by the contracts of b
+func (s *Supply) Add(b block.Block) error {
+	for _, data := range b.Data {
+		var contract contracts.Contract
+		if err := contract.Deserialize(data); err != nil {
+			return errors.New("Failed to deserialize contract: " + err.Error())
+		}
+		if contract.SenderPubKey == nil || contract.IsMint() {
+			s.Minted += contract.Value
+		} else if contract.IsBurn() {
+			s.Burned += contract.Value
+		}
+	}
+	s.Circulating = s.Minted - s.Burned
+	return nil
+}
+
+// TableSupply returns the aurum created and destroyed once the block at height has been applied, from the reward
+// schedule and the mint and burn logs of the accounts table, without reading the ledger
+func (p Policy) TableSupply(accounts *sql.DB, genesisSupply uint64, height uint64) (Supply, error) {
+	minted, err := accountstable.GetMintedBetween(accounts, 0, height)
+	if err != nil {
+		return Supply{}, err
+	}
+	burned, err := accountstable.GetBurnedBetween(accounts, 0, height)
+	if err != nil {
+		return Supply{}, err
+	}
+	supply := Supply{Minted: genesisSupply + p.IssuedThrough(height) + minted, Burned: burned}
+	supply.Circulating = supply.Minted - supply.Burned
+	return supply, nil
+}
+
+// LedgerSupply counts the aurum created and destroyed by every block in the ledger.
+// Callers should hold the ledger's lock so the ledger does not change while it is read
+func LedgerSupply(ledger ifaces.ILedgerManager) (Supply, error) {
+	const batchSize = 100
+	var supply Supply
+	for startHeight := uint64(0); ; startHeight += batchSize {
+		serializedBlocks, err := ledger.GetBatchOfBlocks(startHeight, batchSize)
+		if err != nil {
+			return Supply{}, err
+		}
+		if len(serializedBlocks) == 0 {
+			return supply, nil
+		}
+		for _, serializedBlock := range serializedBlocks {
+			b, err := block.Deserialize(serializedBlock)
+			if err != nil {
+				return Supply{}, errors.New("Failed to deserialize block: " + err.Error())
+			}
+			if err := supply.Add(b); err != nil {
+				return Supply{}, err
+			}
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package monetary
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/SIGBlockchain/project_aurum/internal/accountstable"
+	"github.com/SIGBlockchain/project_aurum/internal/address"
+	"github.com/SIGBlockchain/project_aurum/internal/block"
+	"github.com/SIGBlockchain/project_aurum/internal/config"
+	"github.com/SIGBlockchain/project_aurum/internal/constants"
+	"github.com/SIGBlockchain/project_aurum/internal/contracts"
+	"github.com/SIGBlockchain/project_aurum/internal/hashing"
+	"github.com/SIGBlockchain/project_aurum/internal/publickey"
+	"github.com/SIGBlockchain/project_aurum/internal/sqlstatements"
+)
+
+func TestNewPolicy(t *testing.T) {
+	mintAddr := hashing.New([]byte("mint"))
+	p, err := NewPolicy(&config.Config{BlockReward: 50, HalvingInterval: 10, MintAddr: hex.EncodeToString(mintAddr), MintCap: 500, MintPeriod: 100})
+	want := Policy{InitialReward: 50, HalvingInterval: 10, MintAddr: mintAddr, MintCap: 500, MintPeriod: 100}
+	if err != nil || !reflect.DeepEqual(p, want) {
+		t.Errorf("unexpected policy %+v, %v", p, err)
+	}
+	if encoded, err := NewPolicy(&config.Config{BlockReward: 50, MintAddr: address.Encode(mintAddr)}); err != nil || !bytes.Equal(encoded.MintAddr, mintAddr) {
+		t.Errorf("expected an encoded mint address to be accepted: %v", err)
+	}
+	if _, err := NewPolicy(&config.Config{BlockReward: 50, MintAddr: "abcd"}); err == nil {
+		t.Errorf("expected short mint address to be rejected")
+	}
+	if p, err := NewPolicy(&config.Config{BlockReward: 50}); err != nil || p.MintAddr != nil {
+		t.Errorf("expected empty mint address to be allowed: %+v, %v", p, err)
+	}
+}
+
+func TestRewardSchedule(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		height uint64
+		reward uint64
+		issued uint64
+	}{
+		{name: "genesis", policy: Policy{InitialReward: 50, HalvingInterval: 2}, height: 0, reward: 0, issued: 0},
+		{name: "first era", policy: Policy{InitialReward: 50, HalvingInterval: 2}, height: 2, reward: 50, issued: 100},
+		{name: "second era", policy: Policy{InitialReward: 50, HalvingInterval: 2}, height: 3, reward: 25, issued: 125},
+		{name: "third era", policy: Policy{InitialReward: 50, HalvingInterval: 2}, height: 6, reward: 12, issued: 174},
+		{name: "exhausted", policy: Policy{InitialReward: 50, HalvingInterval: 2}, height: 1000, reward: 0, issued: 194},
+		{name: "fixed issuance", policy: Policy{InitialReward: 7}, height: 10, reward: 7, issued: 70},
+		{name: "no issuance", policy: Policy{}, height: 10, reward: 0, issued: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if reward := tt.policy.RewardAt(tt.height); reward != tt.reward {
+				t.Errorf("RewardAt() = %d, want %d", reward, tt.reward)
+			}
+			if issued := tt.policy.IssuedThrough(tt.height); issued != tt.issued {
+				t.Errorf("IssuedThrough() = %d, want %d", issued, tt.issued)
+			}
+		})
+	}
+}
+
+func TestValidateReward(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	mintAddr := hashing.New([]byte("mint"))
+	p := Policy{InitialReward: 50, MintAddr: mintAddr}
+	transfer, _ := contracts.New(1, key, hashing.New([]byte("recipient")), 10, 1)
+	transfer.Sign(key)
+	reward, _ := p.NewReward(3, mintAddr)
+	wrongValue, _ := contracts.New(1, nil, mintAddr, 60, 3)
+	wrongRecipient, _ := contracts.New(1, nil, hashing.New([]byte("thief")), 50, 3)
+	wrongNonce, _ := contracts.New(1, nil, mintAddr, 50, 0)
+
+	tests := []struct {
+		name      string
+		contracts []contracts.Contract
+		wantErr   bool
+	}{
+		{name: "reward last", contracts: []contracts.Contract{*transfer, *reward}},
+		{name: "missing reward", contracts: []contracts.Contract{*transfer}, wantErr: true},
+		{name: "reward before transfer", contracts: []contracts.Contract{*reward, *transfer}, wantErr: true},
+		{name: "two rewards", contracts: []contracts.Contract{*reward, *reward}, wantErr: true},
+		{name: "wrong value", contracts: []contracts.Contract{*wrongValue}, wantErr: true},
+		{name: "wrong recipient", contracts: []contracts.Contract{*wrongRecipient}, wantErr: true},
+		{name: "wrong nonce", contracts: []contracts.Contract{*wrongNonce}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, _ := block.New(1, 3, make([]byte, 32), tt.contracts)
+			if err := p.ValidateReward(b); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateReward() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Without a reward no block may mint
+	b, _ := block.New(1, 3, make([]byte, 32), []contracts.Contract{*reward})
+	if err := (Policy{}).ValidateReward(b); err == nil {
+		t.Errorf("expected minting without a reward to be rejected")
+	}
+}
+
+func TestCheckSupply(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aurum_monetary")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	accounts, _ := sql.Open("sqlite3", filepath.Join(dir, "accounts.db"))
+	defer accounts.Close()
+	accounts.Exec(sqlstatements.CREATE_ACCOUNT_BALANCES_TABLE)
+
+	mintAddr := hashing.New([]byte("mint"))
+	p := Policy{InitialReward: 50, MintAddr: mintAddr}
+	genesisContract, _ := contracts.New(1, nil, hashing.New([]byte("genesis")), 1000, 0)
+	genesisBlock, _ := block.New(1, 0, make([]byte, 32), []contracts.Contract{*genesisContract})
+	genesisSupply, err := GenesisSupply(genesisBlock)
+	if err != nil || genesisSupply != 1000 {
+		t.Fatalf("GenesisSupply() = %d, %v", genesisSupply, err)
+	}
+	if err := accountstable.ApplyBlock(accounts, &genesisBlock); err != nil {
+		t.Fatalf("failed to apply genesis block: %v", err)
+	}
+	if err := p.CheckSupply(accounts, genesisSupply, 0); err != nil {
+		t.Errorf("expected supply to match at genesis: %v", err)
+	}
+
+	reward, _ := p.NewReward(1, mintAddr)
+	b, _ := block.New(1, 1, block.HashBlock(genesisBlock), []contracts.Contract{*reward})
+	if err := accountstable.ApplyBlock(accounts, &b); err != nil {
+		t.Fatalf("failed to apply block: %v", err)
+	}
+	if err := p.CheckSupply(accounts, genesisSupply, 1); err != nil {
+		t.Errorf("expected supply to match after the first reward: %v", err)
+	}
+	if err := p.CheckSupply(accounts, genesisSupply, 2); err == nil {
+		t.Errorf("expected a missing reward to break the invariant")
+	}
+}
+
+func TestMintAllowance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aurum_monetary")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	accounts, _ := sql.Open("sqlite3", filepath.Join(dir, "accounts.db"))
+	defer accounts.Close()
+	accounts.Exec(sqlstatements.CREATE_ACCOUNT_BALANCES_TABLE)
+
+	mintKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	encodedMintKey, _ := publickey.Encode(&mintKey.PublicKey)
+	mintAddr := hashing.New(encodedMintKey)
+	p := Policy{MintAddr: mintAddr, MintCap: 100, MintPeriod: 3}
+	recipient := hashing.New([]byte("recipient"))
+	mintBlock := func(height uint64, values ...uint64) block.Block {
+		var mints []contracts.Contract
+		for i, value := range values {
+			mint, _ := contracts.New(constants.MintContractVersion, mintKey, recipient, value, uint64(i+1))
+			mint.Sign(mintKey)
+			mints = append(mints, *mint)
+		}
+		b, _ := block.New(1, height, make([]byte, 32), mints)
+		return b
+	}
+
+	if start := p.MintPeriodStart(5); start != 4 {
+		t.Errorf("expected block #5 to be in the period starting at #4, got %d", start)
+	}
+	if err := p.ValidateMints(accounts, mintBlock(4, 60, 40)); err != nil {
+		t.Errorf("expected mints up to the cap to be valid: %v", err)
+	}
+	if err := p.ValidateMints(accounts, mintBlock(4, 60, 41)); err == nil {
+		t.Errorf("expected mints over the cap to be rejected")
+	}
+
+	applied := mintBlock(4, 70)
+	if err := accountstable.ApplyBlock(accounts, &applied); err != nil {
+		t.Fatalf("failed to apply block: %v", err)
+	}
+	if allowance, err := p.MintAllowance(accounts, 5); err != nil || allowance != 30 {
+		t.Errorf("expected an allowance of 30 later in the period, got %d (%v)", allowance, err)
+	}
+	if allowance, err := p.MintAllowance(accounts, 7); err != nil || allowance != 100 {
+		t.Errorf("expected the full allowance in the next period, got %d (%v)", allowance, err)
+	}
+	if err := p.CheckSupply(accounts, 0, 4); err != nil {
+		t.Errorf("expected minted aurum to count towards the supply: %v", err)
+	}
+	if allowance, _ := (Policy{MintCap: 100}).MintAllowance(accounts, 5); allowance != 0 {
+		t.Errorf("expected no allowance without a mint address, got %d", allowance)
+	}
+}
@@ -0,0 +1,79 @@
+// Package paymenturi encodes requests for payment as URIs, such as aurum:aur1...?amount=100&memo=dues, which can be
+// shared as links or QR codes and read by a wallet to fill in the contract paying them. The scheme follows BIP-0021:
+// the address is the path of the URI, and parameters the wallet must understand are prefixed with req-
+package paymenturi
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/SIGBlockchain/project_aurum/internal/address"
+)
+
+// Scheme is the URI scheme of payment requests
+const Scheme = "aurum"
+
+// Request is a request for payment to a wallet address. An Amount of zero leaves the amount to the payer
+type Request struct {
+	Address []byte
+	Amount  uint64
+	Memo    string
+}
+
+// String returns the URI of the request, with the address encoded
+func (r Request) String() string {
+	params := url.Values{}
+	if r.Amount != 0 {
+		params.Set("amount", strconv.FormatUint(r.Amount, 10))
+	}
+	if r.Memo != "" {
+		params.Set("memo", r.Memo)
+	}
+	uri := Scheme + ":" + address.Encode(r.Address)
+	if len(params) != 0 {
+		uri += "?" + strings.Replace(params.Encode(), "+", "%20", -1)
+	}
+	return uri
+}
+
+// Parse returns the request in uri. The scheme is case insensitive and the address may be encoded or hex encoded.
+// Unknown parameters are ignored unless they are prefixed with req-, which marks them as required
+func Parse(uri string) (Request, error) {
+	sep := strings.Index(uri, ":")
+	if sep < 0 || !strings.EqualFold(uri[:sep], Scheme) {
+		return Request{}, errors.New("Not an " + Scheme + " URI: " + uri)
+	}
+	rest := strings.TrimPrefix(uri[sep+1:], "//")
+	query := ""
+	if q := strings.Index(rest, "?"); q >= 0 {
+		rest, query = rest[:q], rest[q+1:]
+	}
+	walletAddress, err := address.Decode(rest)
+	if err != nil {
+		return Request{}, err
+	}
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return Request{}, errors.New("Invalid payment request parameters: " + err.Error())
+	}
+
+	r := Request{Address: walletAddress}
+	for key, values := range params {
+		if len(values) != 1 {
+			return Request{}, errors.New("Payment request parameter is repeated: " + key)
+		}
+		switch {
+		case key == "amount":
+			if r.Amount, err = strconv.ParseUint(values[0], 10, 64); err != nil || r.Amount == 0 {
+				return Request{}, errors.New("Invalid payment request amount: " + values[0])
+			}
+		case key == "memo":
+			r.Memo = values[0]
+		case strings.HasPrefix(key, "req-"):
+			return Request{}, errors.New("Unsupported required payment request parameter: " + key)
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,56 @@
+package paymenturi
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/SIGBlockchain/project_aurum/internal/address"
+	"github.com/SIGBlockchain/project_aurum/internal/hashing"
+)
+
+func TestStringParse(t *testing.T) {
+	walletAddress := hashing.New([]byte("club treasurer"))
+	encoded := address.Encode(walletAddress)
+	tests := []struct {
+		r   Request
+		uri string
+	}{
+		{Request{Address: walletAddress}, "aurum:" + encoded},
+		{Request{Address: walletAddress, Amount: 25}, "aurum:" + encoded + "?amount=25"},
+		{Request{Address: walletAddress, Amount: 25, Memo: "pizza & dues"}, "aurum:" + encoded + "?amount=25&memo=pizza%20%26%20dues"},
+	}
+	for _, tt := range tests {
+		if uri := tt.r.String(); uri != tt.uri {
+			t.Errorf("expected %s, got %s", tt.uri, uri)
+		}
+		if r, err := Parse(tt.uri); err != nil || !reflect.DeepEqual(r, tt.r) {
+			t.Errorf("expected %s to parse to %+v, got %+v (%v)", tt.uri, tt.r, r, err)
+		}
+	}
+
+	lenient := map[string]Request{
+		"AURUM:" + encoded + "?memo=dues+for+fall":   {Address: walletAddress, Memo: "dues for fall"},
+		"aurum://" + encoded + "?amount=5&label=x":   {Address: walletAddress, Amount: 5},
+		"aurum:" + hex.EncodeToString(walletAddress): {Address: walletAddress},
+	}
+	for uri, want := range lenient {
+		if r, err := Parse(uri); err != nil || !reflect.DeepEqual(r, want) {
+			t.Errorf("expected %s to parse to %+v, got %+v (%v)", uri, want, r, err)
+		}
+	}
+
+	for _, invalid := range []string{
+		encoded,
+		"bitcoin:" + encoded,
+		"aurum:" + encoded[:len(encoded)-1],
+		"aurum:" + encoded + "?amount=-1",
+		"aurum:" + encoded + "?amount=0",
+		"aurum:" + encoded + "?amount=1&amount=2",
+		"aurum:" + encoded + "?req-expires=100",
+	} {
+		if _, err := Parse(invalid); err == nil {
+			t.Errorf("expected %s to be rejected", invalid)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Package peers contains the list of producers a node gossips blocks with
+package peers
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/SIGBlockchain/project_aurum/internal/block"
+	"github.com/SIGBlockchain/project_aurum/internal/requests"
+)
+
+// Peers holds the hosts (e.g. "localhost:26001") of the other producers on the network
+type Peers struct {
+	hosts  []string
+	client *http.Client
+	lock   sync.RWMutex
+}
+
+// New returns a Peers for the given hosts with a client that times out after timeout
+func New(hosts []string, timeout time.Duration) *Peers {
+	p := &Peers{client: &http.Client{Timeout: timeout}}
+	for _, host := range hosts {
+		p.Add(host)
+	}
+	return p
+}
+
+// Add inserts host into the peer list if it is not already present
+func (p *Peers) Add(host string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, h := range p.hosts {
+		if h == host {
+			return
+		}
+	}
+	p.hosts = append(p.hosts, host)
+}
+
+// Hosts returns a copy of the peer list
+func (p *Peers) Hosts() []string {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	hosts := make([]string, len(p.hosts))
+	copy(hosts, p.hosts)
+	return hosts
+}
+
+// Send posts b to the IncomingBlock endpoint of host
+func (p *Peers) Send(host string, b block.Block) error {
+	req, err := requests.SendBlockRequest(host, &b)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return errors.New("Failed to send block to " + host + ": " + err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return errors.New(host + " rejected block: " + resp.Status + ": " + string(body))
+	}
+	return nil
+}
+
+// Broadcast sends b to every peer concurrently and returns the errors of the peers that did not accept it,
+// keyed by host
+func (p *Peers) Broadcast(b block.Block) map[string]error {
+	hosts := p.Hosts()
+	failed := make(map[string]error)
+	var failedLock sync.Mutex
+	var wg sync.WaitGroup
+	for _, host := range hosts {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			if err := p.Send(host, b); err != nil {
+				failedLock.Lock()
+				failed[host] = err
+				failedLock.Unlock()
+			}
+		}(host)
+	}
+	wg.Wait()
+	return failed
+}
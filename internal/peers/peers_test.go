@@ -0,0 +1,166 @@
+package peers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"database/sql"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/SIGBlockchain/project_aurum/internal/accountstable"
+	"github.com/SIGBlockchain/project_aurum/internal/block"
+	"github.com/SIGBlockchain/project_aurum/internal/blockchain"
+	"github.com/SIGBlockchain/project_aurum/internal/constants"
+	"github.com/SIGBlockchain/project_aurum/internal/contracts"
+	"github.com/SIGBlockchain/project_aurum/internal/endpoints"
+	"github.com/SIGBlockchain/project_aurum/internal/forkchoice"
+	"github.com/SIGBlockchain/project_aurum/internal/genesis"
+	"github.com/SIGBlockchain/project_aurum/internal/handlers"
+	"github.com/SIGBlockchain/project_aurum/internal/hashing"
+	"github.com/SIGBlockchain/project_aurum/internal/monetary"
+	"github.com/SIGBlockchain/project_aurum/internal/publickey"
+)
+
+// testNode is an in-process producer serving the IncomingBlock endpoint
+type testNode struct {
+	dir        string
+	ledgerFile *os.File
+	metadata   *sql.DB
+	accounts   *sql.DB
+	ledger     *blockchain.LedgerManager
+	chain      *forkchoice.Chain
+	server     *httptest.Server
+}
+
+func setUpNode(t *testing.T, genesisBlock block.Block) *testNode {
+	dir, err := ioutil.TempDir("", "aurum_peer")
+	if err != nil {
+		t.Fatalf("failed to create node directory: %v", err)
+	}
+	ledgerName := filepath.Join(dir, constants.BlockchainFile)
+	metadataName := filepath.Join(dir, constants.MetadataTable)
+	accountsName := filepath.Join(dir, constants.AccountsTable)
+	if err := blockchain.Airdrop(ledgerName, metadataName, accountsName, genesisBlock); err != nil {
+		t.Fatalf("failed to airdrop: %v", err)
+	}
+	n := &testNode{dir: dir}
+	if n.ledgerFile, err = os.OpenFile(ledgerName, os.O_APPEND|os.O_RDWR, 0644); err != nil {
+		t.Fatalf("failed to open ledger: %v", err)
+	}
+	if n.metadata, err = sql.Open("sqlite3", metadataName); err != nil {
+		t.Fatalf("failed to open metadata: %v", err)
+	}
+	if n.accounts, err = sql.Open("sqlite3", accountsName); err != nil {
+		t.Fatalf("failed to open accounts: %v", err)
+	}
+	n.ledger = blockchain.NewLedgerManager(n.ledgerFile, n.metadata)
+	if n.chain, err = forkchoice.NewChain(n.ledger, n.metadata, n.accounts, 1, nil, monetary.Policy{}); err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(endpoints.IncomingBlock, handlers.HandleIncomingBlock(n.chain, nil))
+	n.server = httptest.NewServer(mux)
+	return n
+}
+
+func (n *testNode) host() string {
+	return strings.TrimPrefix(n.server.URL, "http://")
+}
+
+func (n *testNode) tearDown() {
+	n.server.Close()
+	n.ledgerFile.Close()
+	n.metadata.Close()
+	n.accounts.Close()
+	os.RemoveAll(n.dir)
+}
+
+func TestAdd(t *testing.T) {
+	p := New([]string{"localhost:26001"}, time.Second)
+	p.Add("localhost:26002")
+	p.Add("localhost:26001")
+	hosts := p.Hosts()
+	if len(hosts) != 2 || hosts[0] != "localhost:26001" || hosts[1] != "localhost:26002" {
+		t.Errorf("unexpected hosts: %v", hosts)
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	senderKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	encodedSenderPublicKey, _ := publickey.Encode(&senderKey.PublicKey)
+	senderPKH := hashing.New(encodedSenderPublicKey)
+	recipientKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	encodedRecipientPublicKey, _ := publickey.Encode(&recipientKey.PublicKey)
+	recipientPKH := hashing.New(encodedRecipientPublicKey)
+
+	genesisBlock, err := genesis.BringOnTheGenesis([][]byte{senderPKH, recipientPKH}, 1000)
+	if err != nil {
+		t.Fatalf("failed to create genesis block: %v", err)
+	}
+
+	var nodes []*testNode
+	for i := 0; i < 3; i++ {
+		n := setUpNode(t, genesisBlock)
+		defer n.tearDown()
+		nodes = append(nodes, n)
+	}
+
+	// The first node produces a block and gossips it to the others
+	contract, _ := contracts.New(1, senderKey, recipientPKH, 200, 1)
+	contract.Sign(senderKey)
+	newBlock, err := block.New(1, 1, block.HashBlock(genesisBlock), []contracts.Contract{*contract})
+	if err != nil {
+		t.Fatalf("failed to create block: %v", err)
+	}
+	producer := nodes[0]
+	if _, err := producer.chain.Add(newBlock); err != nil {
+		t.Fatalf("failed to add block to producer: %v", err)
+	}
+
+	p := New([]string{nodes[1].host(), nodes[2].host()}, time.Second)
+	if failed := p.Broadcast(newBlock); len(failed) != 0 {
+		t.Fatalf("broadcast failed: %v", failed)
+	}
+
+	for i, n := range nodes {
+		youngest, err := n.ledger.GetYoungestBlock()
+		if err != nil {
+			t.Fatalf("node %d: failed to get youngest block: %v", i, err)
+		}
+		if !youngest.Equals(newBlock) {
+			t.Errorf("node %d: youngest block does not match the produced block", i)
+		}
+		balance, err := accountstable.GetBalance(n.accounts, recipientPKH)
+		if err != nil || balance != 700 {
+			t.Errorf("node %d: expected recipient balance 700, got %d (%v)", i, balance, err)
+		}
+	}
+
+	// Gossiping the same block again is rejected as already known
+	failed := p.Broadcast(newBlock)
+	if len(failed) != 2 {
+		t.Errorf("expected both peers to reject a known block, got %v", failed)
+	}
+
+	// A block whose contract spends more than the sender has is rejected
+	overspend, _ := contracts.New(1, senderKey, recipientPKH, 10000, 2)
+	overspend.Sign(senderKey)
+	badBlock, _ := block.New(1, 2, block.HashBlock(newBlock), []contracts.Contract{*overspend})
+	if err := p.Send(nodes[1].host(), badBlock); err == nil {
+		t.Errorf("expected block with an invalid contract to be rejected")
+	}
+	youngest, _ := nodes[1].ledger.GetYoungestBlockHeader()
+	if youngest.Height != 1 {
+		t.Errorf("expected height 1 after rejected block, got %d", youngest.Height)
+	}
+}
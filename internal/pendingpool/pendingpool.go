@@ -18,9 +18,11 @@ type PendingData struct {
 	PendingNonce uint64
 }
 
-//PendingMap contains a map that maps a hex encoded string of a wallet address to a pointer of PendingData
+//PendingMap contains a map that maps a hex encoded string of a wallet address to a pointer of PendingData.
+//MintAddr is the wallet address whose key may sign mint contracts; without it mint contracts are rejected
 type PendingMap struct {
-	Sender map[string]*PendingData
+	Sender   map[string]*PendingData
+	MintAddr []byte
 }
 
 //NewPendingData returns an instance of pendingData given pending balance and pending nonce
@@ -31,7 +33,7 @@ func NewPendingData(pendingBal uint64, pendingNonce uint64) PendingData {
 //NewPendingMap returns an instance of pendingMap given a wallet address and an instance of pendingData
 func NewPendingMap() PendingMap {
 	m := make(map[string]*PendingData)
-	return PendingMap{m}
+	return PendingMap{Sender: m}
 }
 
 //Add returns an error if the process of validating the given contract has failed.
@@ -46,6 +48,9 @@ func (m *PendingMap) Add(c *contracts.Contract, accDB *sql.DB) error {
 	senderPKStr := hex.EncodeToString(senderPKHash) // hex encoded sender PKhash string for the key
 
 	senderPD, inMap := m.Sender[senderPKStr]
+	if c.IsMint() {
+		return m.addMint(c, senderPKHash, senderPD, accDB)
+	}
 	if !inMap { // if the key is not in the map
 		err := validation.ValidateContract(accDB, c)
 		if err != nil {
@@ -68,3 +73,20 @@ func (m *PendingMap) Add(c *contracts.Contract, accDB *sql.DB) error {
 
 	return nil
 }
+
+//addMint validates a mint contract against the mint account's pending state nonce, or its state nonce in the
+//accounts table if it has no pending contracts. The mint account need not exist yet
+func (m *PendingMap) addMint(c *contracts.Contract, mintPKHash []byte, mintPD *PendingData, accDB *sql.DB) error {
+	if mintPD == nil {
+		pendingD := NewPendingData(0, 0)
+		if accountInfo, err := accountstable.GetAccountInfo(accDB, mintPKHash); err == nil {
+			pendingD = NewPendingData(accountInfo.Balance, accountInfo.StateNonce)
+		}
+		mintPD = &pendingD
+	}
+	if err := validation.ValidateMint(c, m.MintAddr, &(mintPD.PendingNonce)); err != nil {
+		return errors.New("Failed to validate mint contract: " + err.Error())
+	}
+	m.Sender[hex.EncodeToString(mintPKHash)] = mintPD
+	return nil
+}
@@ -1,14 +1,17 @@
 package privatekey
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"encoding/pem"
 	"errors"
+	"math/big"
 	"os"
 )
 
@@ -23,6 +26,23 @@ func New() (AurumPrivateKey, error) {
 	if err != nil {
 		return AurumPrivateKey{}, err
 	}
+	return newFromKey(p)
+}
+
+// NewFromScalar returns the AurumPrivateKey on P-256 with the big endian secret scalar d, which must be in [1, n-1]
+func NewFromScalar(d []byte) (AurumPrivateKey, error) {
+	curve := elliptic.P256()
+	scalar := new(big.Int).SetBytes(d)
+	if scalar.Sign() == 0 || scalar.Cmp(curve.Params().N) >= 0 {
+		return AurumPrivateKey{}, errors.New("Private key scalar is out of range")
+	}
+	p := &ecdsa.PrivateKey{D: scalar}
+	p.PublicKey.Curve = curve
+	p.PublicKey.X, p.PublicKey.Y = curve.ScalarBaseMult(scalar.Bytes())
+	return newFromKey(p)
+}
+
+func newFromKey(p *ecdsa.PrivateKey) (AurumPrivateKey, error) {
 	pBytes, err := Encode(p)
 	if err != nil {
 		return AurumPrivateKey{}, err
@@ -38,20 +58,177 @@ func New() (AurumPrivateKey, error) {
 	return newInst, nil
 }
 
-// Returns the PEM-Encoded byte slice from a given private key
+// Formats private keys are imported and exported in
+const (
+	FormatPKCS8 = "pkcs8" // PEM encoded PKCS #8, labelled PRIVATE KEY
+	FormatSEC1  = "sec1"  // PEM encoded SEC 1, labelled EC PRIVATE KEY
+	FormatJWK   = "jwk"   // JSON Web Key
+	FormatHex   = "hex"   // hex encoded 32 byte secret scalar
+)
+
+const (
+	pkcs8Label = "PRIVATE KEY"
+	sec1Label  = "EC PRIVATE KEY"
+	scalarLen  = 32
+)
+
+// Returns the PEM-Encoded byte slice from a given private key, in PKCS #8
 func Encode(key *ecdsa.PrivateKey) ([]byte, error) {
-	x509EncodedPriv, err := x509.MarshalECPrivateKey(key)
+	if key == nil {
+		return nil, errors.New("Could not return the encoded private key - the key value is nil")
+	}
+	pkcs8EncodedPriv, err := x509.MarshalPKCS8PrivateKey(key)
 	if err != nil {
-		return []byte{}, err
+		return nil, err
 	}
-	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: x509EncodedPriv}), nil
+	return pem.EncodeToMemory(&pem.Block{Type: pkcs8Label, Bytes: pkcs8EncodedPriv}), nil
 }
 
-// Returns the private key from a given PEM-Encoded byte slice representation of the private key
+// Returns the private key from a given PEM-Encoded byte slice representation of the private key.
+// Keys may be in PKCS #8 or SEC 1; keys encoded before Encode used PKCS #8 hold SEC 1 under the PKCS #8 label
 func Decode(key []byte) (*ecdsa.PrivateKey, error) {
 	keyBlock, _ := pem.Decode(key)
-	x509EncodedPriv := keyBlock.Bytes
-	return x509.ParseECPrivateKey(x509EncodedPriv)
+	if keyBlock == nil {
+		return nil, errors.New("Failed to decode PEM block")
+	}
+	var privateKey *ecdsa.PrivateKey
+	switch keyBlock.Type {
+	case pkcs8Label:
+		parsed, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+		if err != nil {
+			if privateKey, err = x509.ParseECPrivateKey(keyBlock.Bytes); err != nil {
+				return nil, errors.New("Failed to parse PKCS #8 private key: " + err.Error())
+			}
+			break
+		}
+		var ok bool
+		if privateKey, ok = parsed.(*ecdsa.PrivateKey); !ok {
+			return nil, errors.New("Private key is not an ECDSA key")
+		}
+	case sec1Label:
+		var err error
+		if privateKey, err = x509.ParseECPrivateKey(keyBlock.Bytes); err != nil {
+			return nil, errors.New("Failed to parse EC private key: " + err.Error())
+		}
+	default:
+		return nil, errors.New("Unsupported PEM block: " + keyBlock.Type)
+	}
+	if privateKey.Curve != elliptic.P256() {
+		return nil, errors.New("Private key is not on the P-256 curve")
+	}
+	return privateKey, nil
+}
+
+// EncodeSEC1 returns the PEM encoded SEC 1 form of the private key, as written by openssl ec
+func EncodeSEC1(key *ecdsa.PrivateKey) ([]byte, error) {
+	if key == nil {
+		return nil, errors.New("Could not return the encoded private key - the key value is nil")
+	}
+	sec1EncodedPriv, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: sec1Label, Bytes: sec1EncodedPriv}), nil
+}
+
+// jwk is a P-256 private key as a JSON Web Key (RFC 7517), with base64url encoded coordinates and secret
+type jwk struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	D   string `json:"d"`
+}
+
+// EncodeJWK returns the private key as a JSON Web Key
+func EncodeJWK(key *ecdsa.PrivateKey) ([]byte, error) {
+	if key == nil || key.Curve != elliptic.P256() {
+		return nil, errors.New("Private key must be a P-256 key")
+	}
+	encode := func(n *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(n.FillBytes(make([]byte, scalarLen)))
+	}
+	return json.Marshal(jwk{"EC", "P-256", encode(key.X), encode(key.Y), encode(key.D)})
+}
+
+// DecodeJWK returns the private key in a JSON Web Key, checking that its public key matches its secret
+func DecodeJWK(data []byte) (*ecdsa.PrivateKey, error) {
+	var k jwk
+	if err := json.Unmarshal(data, &k); err != nil {
+		return nil, errors.New("Failed to parse JSON Web Key: " + err.Error())
+	}
+	if k.Kty != "EC" || k.Crv != "P-256" {
+		return nil, errors.New("JSON Web Key is not a P-256 key")
+	}
+	d, err := base64.RawURLEncoding.DecodeString(k.D)
+	if err != nil || len(d) != scalarLen {
+		return nil, errors.New("Invalid JSON Web Key secret")
+	}
+	privateKey, err := NewFromScalar(d)
+	if err != nil {
+		return nil, err
+	}
+	x, errX := base64.RawURLEncoding.DecodeString(k.X)
+	y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+	if errX != nil || errY != nil || new(big.Int).SetBytes(x).Cmp(privateKey.Key.X) != 0 || new(big.Int).SetBytes(y).Cmp(privateKey.Key.Y) != 0 {
+		return nil, errors.New("JSON Web Key public key does not match its secret")
+	}
+	return privateKey.Key, nil
+}
+
+// EncodeHex returns the secret scalar of the private key, hex encoded and padded to 32 bytes
+func EncodeHex(key *ecdsa.PrivateKey) (string, error) {
+	if key == nil || key.Curve != elliptic.P256() {
+		return "", errors.New("Private key must be a P-256 key")
+	}
+	return hex.EncodeToString(key.D.FillBytes(make([]byte, scalarLen))), nil
+}
+
+// DecodeHex returns the private key with the hex encoded secret scalar
+func DecodeHex(hexKey string) (*ecdsa.PrivateKey, error) {
+	d, err := hex.DecodeString(hexKey)
+	if err != nil || len(d) != scalarLen {
+		return nil, errors.New("Hex private key must be 64 hex characters")
+	}
+	privateKey, err := NewFromScalar(d)
+	if err != nil {
+		return nil, err
+	}
+	return privateKey.Key, nil
+}
+
+// Export returns the private key in the given format
+func Export(key *ecdsa.PrivateKey, format string) ([]byte, error) {
+	switch format {
+	case FormatPKCS8:
+		return Encode(key)
+	case FormatSEC1:
+		return EncodeSEC1(key)
+	case FormatJWK:
+		return EncodeJWK(key)
+	case FormatHex:
+		hexKey, err := EncodeHex(key)
+		return []byte(hexKey), err
+	}
+	return nil, errors.New("Unknown private key format: " + format)
+}
+
+// Import returns the private key in data, detecting its format: PEM encoded PKCS #8 or SEC 1, a JSON Web Key,
+// a hex encoded secret scalar, or a hex encoded PEM key as held by wallets before keystores
+func Import(data []byte) (*ecdsa.PrivateKey, error) {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("-----BEGIN")):
+		return Decode(trimmed)
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		return DecodeJWK(trimmed)
+	case len(trimmed) == 2*scalarLen:
+		return DecodeHex(string(trimmed))
+	}
+	if pemEncoded, err := hex.DecodeString(string(trimmed)); err == nil && len(pemEncoded) > 0 {
+		return Decode(pemEncoded)
+	}
+	return nil, errors.New("Unrecognized private key format")
 }
 
 // Equals returns true if the given two *ecdsa.PrivateKey are equal
@@ -99,11 +276,10 @@ func GenerateNRandomKeys(filename string, n uint32) error {
 			return err
 		}
 		// Encodes the private key
-		x509Encoded, err := x509.MarshalECPrivateKey(p)
+		pemEncoded, err := Encode(p)
 		if err != nil {
 			return err
 		}
-		pemEncoded := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: x509Encoded})
 		// Converts the encoded byte string into a string so it can be used in the json struct
 		encodedStr := hex.EncodeToString(pemEncoded)
 		// Add the encoded byte string to the string slice
@@ -18,8 +18,8 @@ import (
 	"github.com/SIGBlockchain/project_aurum/internal/accountstable"
 	"github.com/SIGBlockchain/project_aurum/internal/block"
 	"github.com/SIGBlockchain/project_aurum/internal/blockchain"
-	"github.com/SIGBlockchain/project_aurum/internal/constants"
 	"github.com/SIGBlockchain/project_aurum/internal/contracts"
+	"github.com/SIGBlockchain/project_aurum/internal/datadir"
 	"github.com/SIGBlockchain/project_aurum/internal/hashing"
 	"github.com/SIGBlockchain/project_aurum/internal/validation"
 )
@@ -41,12 +41,6 @@ type Flags struct {
 }
 
 var version = uint16(1)
-var ledger = "blockchain.dat"
-var metadataTable = constants.MetadataTable
-
-// TODO: Will need to change the name to support get functions
-var accountsTable = constants.AccountsTable
-
 var SecretBytes = hashing.New([]byte("aurum"))[8:16]
 
 // This stores connection information for the producer
@@ -65,7 +59,8 @@ type Header struct{}
 // Payloads should correspond to message type
 type Message struct{}
 
-func RunServer(ln net.Listener, bChan chan []byte, debug bool) {
+// RunServer accepts connections on ln, answering account info requests from the accounts table of dir
+func RunServer(dir *datadir.Dir, ln net.Listener, bChan chan []byte, debug bool) {
 	// Set logger
 	var lgr = log.New(ioutil.Discard, "SRVR_LOG: ", log.Ldate|log.Lmicroseconds|log.Lshortfile)
 	if debug {
@@ -103,7 +98,7 @@ func RunServer(ln net.Listener, bChan chan []byte, debug bool) {
 				lgr.Println("Received account info request")
 				// TODO: Will require a sync.Mutex lock here eventually
 				// Open connection to account table
-				dbConnection, err := sql.Open("sqlite3", constants.AccountsTable)
+				dbConnection, err := sql.Open("sqlite3", dir.Accounts())
 				if err != nil {
 					lgr.Fatalf("Failed to open account table: %s\n", err)
 				}
@@ -141,7 +136,8 @@ func RunServer(ln net.Listener, bChan chan []byte, debug bool) {
 	}
 }
 
-func ProduceBlocks(byteChan chan []byte, fl Flags, limit bool) {
+// ProduceBlocks adds a block of the pooled contracts to the ledger of dir every production interval
+func ProduceBlocks(dir *datadir.Dir, byteChan chan []byte, fl Flags, limit bool) {
 	// Set logger
 	var lgr = log.New(ioutil.Discard, "PROD_LOG: ", log.Ldate|log.Lmicroseconds|log.Lshortfile)
 	if *fl.Debug {
@@ -149,14 +145,14 @@ func ProduceBlocks(byteChan chan []byte, fl Flags, limit bool) {
 	}
 
 	// Open connection to metadata database
-	metadataConn, err := sql.Open("sqlite3", metadataTable)
+	metadataConn, err := sql.Open("sqlite3", dir.Metadata())
 	if err != nil {
 		lgr.Fatalf("failed to open metadata table: %s\n", err)
 	}
 	defer metadataConn.Close()
 
 	// Open connection to account database
-	dbConnection, err := sql.Open("sqlite3", constants.AccountsTable)
+	dbConnection, err := sql.Open("sqlite3", dir.Accounts())
 	if err != nil {
 		lgr.Fatalf("Failed to open account table: %s\n", err)
 	}
@@ -167,7 +163,7 @@ func ProduceBlocks(byteChan chan []byte, fl Flags, limit bool) {
 	}()
 
 	// Retrieve youngest block header
-	ledgerFile, err := os.OpenFile(ledger, os.O_RDONLY, 0644)
+	ledgerFile, err := os.OpenFile(dir.Ledger(), os.O_RDONLY, 0644)
 	if err != nil {
 		lgr.Fatalf("failed to open ledger file: %s\n", err)
 	}
@@ -230,7 +226,7 @@ func ProduceBlocks(byteChan chan []byte, fl Flags, limit bool) {
 			} else {
 
 				// Add the block
-				ledgerFile, err := os.OpenFile(constants.BlockchainFile, os.O_APPEND|os.O_WRONLY, 0644)
+				ledgerFile, err := os.OpenFile(dir.Ledger(), os.O_APPEND|os.O_WRONLY, 0644)
 				if err != nil {
 					lgr.Fatalf("failed to open ledger file: %s\n", err)
 				}
@@ -249,7 +245,7 @@ func ProduceBlocks(byteChan chan []byte, fl Flags, limit bool) {
 
 					// TODO: for each contract in the dataPool, update the accounts table
 					// TODO: will require a sync.Mutex for the accounts table
-					dbConn, err := sql.Open("sqlite3", constants.AccountsTable)
+					dbConn, err := sql.Open("sqlite3", dir.Accounts())
 					if err != nil {
 						lgr.Fatalf("Failed to connect to accounts database: %v", err)
 					}
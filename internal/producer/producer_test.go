@@ -8,6 +8,7 @@ import (
 	"database/sql"
 	"encoding/binary"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"os"
 	"reflect"
@@ -16,8 +17,8 @@ import (
 	"github.com/SIGBlockchain/project_aurum/internal/accountinfo"
 	"github.com/SIGBlockchain/project_aurum/internal/accountstable"
 	"github.com/SIGBlockchain/project_aurum/internal/blockchain"
-	"github.com/SIGBlockchain/project_aurum/internal/constants"
 	"github.com/SIGBlockchain/project_aurum/internal/contracts"
+	"github.com/SIGBlockchain/project_aurum/internal/datadir"
 	"github.com/SIGBlockchain/project_aurum/internal/genesis"
 	"github.com/SIGBlockchain/project_aurum/internal/hashing"
 	"github.com/SIGBlockchain/project_aurum/internal/publickey"
@@ -62,13 +63,18 @@ func TestRunServer(t *testing.T) {
 			messageToBeRcvd: []byte("Thank you.\n"),
 		},
 	}
+	dataDir, err := ioutil.TempDir("", "aurum_data")
+	if err != nil {
+		t.Fatalf("failed to create data directory:\n%s", err.Error())
+	}
+	defer os.RemoveAll(dataDir)
 	ln, err := net.Listen("tcp", "localhost:13131")
 	if err != nil {
 		t.Errorf("failed to startup listener")
 	}
 	byteChan := make(chan []byte)
 	buf := make([]byte, 1024)
-	go RunServer(ln, byteChan, false)
+	go RunServer(datadir.New(dataDir), ln, byteChan, false)
 	for _, arg := range testArgs {
 		conn, err := net.Dial("tcp", "localhost:13131")
 		if err != nil {
@@ -113,23 +119,22 @@ func TestByteChannel(t *testing.T) {
 	if err != nil {
 		t.Errorf("failed to create genesis block:\n%s", err.Error())
 	}
-	if err := blockchain.Airdrop(ledger, metadataTable, constants.AccountsTable, genesisBlock); err != nil {
+	dataDir, err := ioutil.TempDir("", "aurum_data")
+	if err != nil {
+		t.Fatalf("failed to create data directory:\n%s", err.Error())
+	}
+	dir := datadir.New(dataDir)
+	if err := blockchain.Airdrop(dir.Ledger(), dir.Metadata(), dir.Accounts(), genesisBlock); err != nil {
 		t.Errorf("failed to perform air drop:\n%s", err.Error())
 	}
-	ledgerFile, err := os.OpenFile("blockchain.dat", os.O_RDONLY, 0644)
-	metadataConn, _ := sql.Open("sqlite3", constants.MetadataTable)
+	ledgerFile, err := os.OpenFile(dir.Ledger(), os.O_RDONLY, 0644)
+	metadataConn, _ := sql.Open("sqlite3", dir.Metadata())
 	defer func() {
 		if removeFiles {
 			ledgerFile.Close()
 			metadataConn.Close()
-			if err := os.Remove("blockchain.dat"); err != nil {
-				t.Errorf("failed to remove blockchain.dat:\n%s", err.Error())
-			}
-			if err := os.Remove(constants.MetadataTable); err != nil {
-				t.Errorf("failed to remove metadatata.tab:\n%s", err.Error())
-			}
-			if err := os.Remove(constants.AccountsTable); err != nil {
-				t.Errorf("failed to remove accounts.db:\n%s", err.Error())
+			if err := os.RemoveAll(dataDir); err != nil {
+				t.Errorf("failed to remove data directory:\n%s", err.Error())
 			}
 		}
 	}()
@@ -140,7 +145,7 @@ func TestByteChannel(t *testing.T) {
 	byteChan := make(chan []byte)
 	debug := false
 
-	go RunServer(ln, byteChan, debug)
+	go RunServer(dir, ln, byteChan, debug)
 	testMode := true
 	prodInterval := "2000ms"
 	memStats := false
@@ -171,7 +176,7 @@ func TestByteChannel(t *testing.T) {
 	if err != nil {
 		t.Errorf("failed to send message")
 	}
-	ProduceBlocks(byteChan, fl, true)
+	ProduceBlocks(dir, byteChan, fl, true)
 
 	youngestBlock, err := blockchain.GetYoungestBlock(ledgerFile, metadataConn)
 	if err != nil {
@@ -188,29 +193,37 @@ func TestByteChannel(t *testing.T) {
 }
 
 func TestResponseToAccountInfoRequest(t *testing.T) {
-	if err := wallet.SetupWallet(); err != nil {
+	walletDir, err := ioutil.TempDir("", "aurum_wallet")
+	if err != nil {
+		t.Fatalf("failed to create wallet directory:\n%s", err.Error())
+	}
+	defer os.RemoveAll(walletDir)
+	w, err := wallet.Open(walletDir)
+	if err != nil {
+		t.Fatalf("failed to open wallet:\n%s", err.Error())
+	}
+	if err := w.NewAccount("producer", []byte("passphrase")); err != nil {
 		t.Errorf("failed to setup wallet:\n%s", err.Error())
 	}
-	defer func() {
-		if err := os.Remove("aurum_wallet.json"); err != nil {
-			t.Errorf("failed to remove aurum_wallet.json:\n%s", err.Error())
-		}
-	}()
-	dbName := constants.AccountsTable
-	dbc, _ := sql.Open("sqlite3", dbName)
+	dataDir, err := ioutil.TempDir("", "aurum_data")
+	if err != nil {
+		t.Fatalf("failed to create data directory:\n%s", err.Error())
+	}
+	dir := datadir.New(dataDir)
+	dbc, _ := sql.Open("sqlite3", dir.Accounts())
 	defer func() {
 		err := dbc.Close()
 		if err != nil {
 			t.Errorf("Failed to remove database: %s", err)
 		}
-		err = os.Remove(dbName)
+		err = os.RemoveAll(dataDir)
 		if err != nil {
 			t.Errorf("Failed to remove database: %s", err)
 		}
 	}()
 	statement, _ := dbc.Prepare(sqlstatements.CREATE_ACCOUNT_BALANCES_TABLE)
 	statement.Exec()
-	walletAddress, err := wallet.GetWalletAddress()
+	walletAddress, err := w.GetWalletAddress("")
 	// t.Logf("Wallet address: %v", walletAddress)
 	if err != nil {
 		t.Errorf("failed to retrieve wallet address:\n%s", err.Error())
@@ -222,7 +235,7 @@ func TestResponseToAccountInfoRequest(t *testing.T) {
 	byteChan := make(chan []byte)
 	debug := false
 
-	go RunServer(ln, byteChan, debug)
+	go RunServer(dir, ln, byteChan, debug)
 
 	// Request
 	var requestInfoMessage []byte
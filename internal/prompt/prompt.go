@@ -0,0 +1,68 @@
+// Package prompt reads passphrases from the terminal without echoing them, or a line each from an input that is
+// not a terminal, such as a pipe in scripts and tests
+package prompt
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// Prompter reads passphrases from its input
+type Prompter struct {
+	in    io.Reader
+	lines *bufio.Reader
+}
+
+// New returns a Prompter reading from in
+func New(in io.Reader) *Prompter {
+	return &Prompter{in, bufio.NewReader(in)}
+}
+
+// Passphrase reads a passphrase, prompting for it on the terminal
+func (p *Prompter) Passphrase(prompt string) ([]byte, error) {
+	if f, ok := p.in.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		fmt.Fprint(os.Stderr, prompt)
+		passphrase, err := term.ReadPassword(int(f.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return nil, errors.New("Failed to read passphrase: " + err.Error())
+		}
+		return passphrase, nil
+	}
+	line, err := p.lines.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return nil, errors.New("Failed to read passphrase: " + err.Error())
+	}
+	return []byte(strings.TrimRight(line, "\r\n")), nil
+}
+
+// NewPassphrase reads a new passphrase for account, or for no account in particular if it is empty, twice and
+// checks that it is not empty and was repeated correctly
+func (p *Prompter) NewPassphrase(account string) ([]byte, error) {
+	subject := "passphrase"
+	if account != "" {
+		subject += " for " + account
+	}
+	passphrase, err := p.Passphrase("New " + subject + ": ")
+	if err != nil {
+		return nil, err
+	}
+	if len(passphrase) == 0 {
+		return nil, errors.New("Passphrase must not be empty")
+	}
+	repeated, err := p.Passphrase("Repeat " + subject + ": ")
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(passphrase, repeated) {
+		return nil, errors.New("Passphrases do not match")
+	}
+	return passphrase, nil
+}
@@ -0,0 +1,22 @@
+package prompt
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewPassphrase(t *testing.T) {
+	p := New(strings.NewReader("secret\nsecret\r\nsecret\nsecrets\n\n"))
+	if passphrase, err := p.NewPassphrase(""); err != nil || string(passphrase) != "secret" {
+		t.Errorf("expected passphrase secret, got %q (%v)", passphrase, err)
+	}
+	if _, err := p.NewPassphrase("main"); err == nil {
+		t.Errorf("expected mismatched passphrases to be rejected")
+	}
+	if _, err := p.NewPassphrase(""); err == nil {
+		t.Errorf("expected an empty passphrase to be rejected")
+	}
+	if _, err := p.Passphrase("Passphrase: "); err == nil {
+		t.Errorf("expected reading past the input to fail")
+	}
+}
@@ -76,16 +76,66 @@ func GetBlockByHashRequest(blockHash string) (*http.Request, error) {
 	return req, nil
 }
 
-func SendBlockRequest(block *block.Block) (*http.Request, error) {
+// SendBlockRequest returns a request posting the JSON encoded block to the peer at host
+func SendBlockRequest(host string, block *block.Block) (*http.Request, error) {
 	jsonBlock := block.Marshal()
 
 	marshalledBlock, err := json.Marshal(jsonBlock)
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequest(http.MethodPost, endpoints.IncomingBlock, bytes.NewBuffer(marshalledBlock))
+	req, err := http.NewRequest(http.MethodPost, "http://"+host+endpoints.IncomingBlock, bytes.NewBuffer(marshalledBlock))
 	if err != nil {
 		return nil, errors.New("Failed to make new request:\n" + err.Error())
 	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// HeightResponse is the body of a response to a height query
+type HeightResponse struct {
+	Height uint64
+}
+
+// GetHeightRequest returns a request for the height of the youngest block of the producer at host
+func GetHeightRequest(host string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, "http://"+host+endpoints.HeightQuery, nil)
+	if err != nil {
+		return nil, errors.New("Failed to make new request:\n" + err.Error())
+	}
+	return req, nil
+}
+
+// GetBatchOfHeadersRequest returns a request for numBlocks block headers starting at startHeight
+func GetBatchOfHeadersRequest(host string, startHeight uint64, numBlocks uint64) (*http.Request, error) {
+	return newBatchRequest("http://"+host+endpoints.HeaderBatchQuery, startHeight, numBlocks)
+}
+
+// GetBatchOfBlocksRequest returns a request for numBlocks blocks starting at startHeight
+func GetBatchOfBlocksRequest(host string, startHeight uint64, numBlocks uint64) (*http.Request, error) {
+	return newBatchRequest("http://"+host+endpoints.BlockBatchQuery, startHeight, numBlocks)
+}
+
+func newBatchRequest(url string, startHeight uint64, numBlocks uint64) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.New("Failed to make new request:\n" + err.Error())
+	}
+	values := req.URL.Query()
+	values.Add("h", strconv.FormatUint(startHeight, 10))
+	values.Add("n", strconv.FormatUint(numBlocks, 10))
+	req.URL.RawQuery = values.Encode()
+	return req, nil
+}
+
+// GetContractStatusRequest returns a request for the status of the contract with the hex encoded contractHash
+func GetContractStatusRequest(host string, contractHash string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, "http://"+host+endpoints.ContractStatus, nil)
+	if err != nil {
+		return nil, errors.New("Failed to make new request:\n" + err.Error())
+	}
+	values := req.URL.Query()
+	values.Add("c", contractHash)
+	req.URL.RawQuery = values.Encode()
 	return req, nil
 }
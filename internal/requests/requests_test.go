@@ -15,6 +15,7 @@ import (
 
 	"github.com/SIGBlockchain/project_aurum/internal/block"
 	"github.com/SIGBlockchain/project_aurum/internal/contracts"
+	"github.com/SIGBlockchain/project_aurum/internal/endpoints"
 	"github.com/google/go-cmp/cmp"
 )
 
@@ -162,10 +163,13 @@ func TestSendBlockRequest(t *testing.T) {
 	testBlock.DataLen = uint16(len(testBlock.Data))
 	expectedJsonBlock := testBlock.Marshal()
 
-	req, err := SendBlockRequest(&testBlock)
+	req, err := SendBlockRequest("localhost:26000", &testBlock)
 	if err != nil {
 		t.Errorf("Failed to create send block request: %s", err.Error())
 	}
+	if req.URL.Host != "localhost:26000" || req.URL.Path != endpoints.IncomingBlock {
+		t.Errorf("Wrong request URL: %s", req.URL.String())
+	}
 	rr := httptest.NewRecorder()
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
@@ -193,3 +197,31 @@ func TestSendBlockRequest(t *testing.T) {
 		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
 	}
 }
+
+func TestGetBatchOfBlocksRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  func(string, uint64, uint64) (*http.Request, error)
+		endpoint string
+	}{
+		{"blocks", GetBatchOfBlocksRequest, endpoints.BlockBatchQuery},
+		{"headers", GetBatchOfHeadersRequest, endpoints.HeaderBatchQuery},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := tt.request("localhost:26000", 40, 25)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			if req.Method != http.MethodGet {
+				t.Errorf("Expected a GET request. Found a %s", req.Method)
+			}
+			if req.URL.Host != "localhost:26000" || req.URL.Path != tt.endpoint {
+				t.Errorf("Wrong request URL: %s", req.URL.String())
+			}
+			if h, n := req.URL.Query().Get("h"), req.URL.Query().Get("n"); h != "40" || n != "25" {
+				t.Errorf("Wrong query values: h=%s n=%s", h, n)
+			}
+		})
+	}
+}
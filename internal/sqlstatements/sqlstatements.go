@@ -20,4 +20,37 @@ const (
 	GET_BALANCE_NONCE_FROM_ACCOUNT_BALANCES_BY_PUB_KEY_HASH = "SELECT balance, nonce FROM account_balances WHERE public_key_hash = ?"
 	GET_BATCH_OF_BLOCKS_FROM_METADATA                       = "SELECT height, position, size FROM metadata WHERE height BETWEEN ? and ? + ? - 1 ORDER BY height"
 	// GET_BATCH_OF_BLOCKS_FROM_METADATA variables: (startHeight, startHeight, numBlocks) 
+	GET_POSITION_SIZE_FROM_METADATA_BY_HEIGHT = "SELECT position, size FROM metadata WHERE height = ?"
+	DELETE_METADATA_ABOVE_HEIGHT              = "DELETE FROM metadata WHERE height > ?"
+	// contract_index holds the height of the block holding each contract, keyed by the hex encoded hash of the serialized contract
+	CREATE_CONTRACT_INDEX_TABLE            = "CREATE TABLE IF NOT EXISTS contract_index (hash TEXT PRIMARY KEY, height INTEGER)"
+	INSERT_VALUES_INTO_CONTRACT_INDEX      = "INSERT OR REPLACE INTO contract_index (hash, height) VALUES (?, ?)"
+	GET_HEIGHT_FROM_CONTRACT_INDEX_BY_HASH = "SELECT height FROM contract_index WHERE hash = ?"
+	GET_COUNT_CONTRACT_INDEX_BY_HEIGHT     = "SELECT COUNT(*) FROM contract_index WHERE height = ?"
+	DELETE_CONTRACT_INDEX_ABOVE_HEIGHT     = "DELETE FROM contract_index WHERE height > ?"
+	DELETE_EVERYTHING_FROM_ACCOUNT_BALANCES   = "DELETE FROM account_balances"
+	CREATE_BLOCK_TREE_TABLE                   = "CREATE TABLE IF NOT EXISTS block_tree (hash TEXT PRIMARY KEY, previous_hash TEXT, height INTEGER, block BLOB)"
+	INSERT_OR_IGNORE_INTO_BLOCK_TREE          = "INSERT OR IGNORE INTO block_tree (hash, previous_hash, height, block) VALUES (?, ?, ?, ?)"
+	GET_BLOCK_FROM_BLOCK_TREE_BY_HASH         = "SELECT block FROM block_tree WHERE hash = ?"
+	DELETE_FROM_BLOCK_TREE_BY_HASH            = "DELETE FROM block_tree WHERE hash = ?"
+	CREATE_UNDO_LOG_TABLE                     = "CREATE TABLE IF NOT EXISTS undo_log (height INTEGER, public_key_hash TEXT, balance INTEGER, nonce INTEGER, existed INTEGER, PRIMARY KEY (height, public_key_hash))"
+	INSERT_OR_IGNORE_INTO_UNDO_LOG            = "INSERT OR IGNORE INTO undo_log (height, public_key_hash, balance, nonce, existed) VALUES (?, ?, ?, ?, ?)"
+	GET_UNDO_LOG_ABOVE_HEIGHT                 = "SELECT public_key_hash, balance, nonce, existed FROM undo_log WHERE height > ? ORDER BY height DESC"
+	DELETE_UNDO_LOG_ABOVE_HEIGHT              = "DELETE FROM undo_log WHERE height > ?"
+	DELETE_EVERYTHING_FROM_UNDO_LOG           = "DELETE FROM undo_log"
+	DELETE_ACCOUNT_FROM_ACCOUNT_BALANCES      = "DELETE FROM account_balances WHERE public_key_hash = ?"
+	GET_UNDO_LOG_TABLE_NAME                   = "SELECT name FROM sqlite_master WHERE type = 'table' AND name = 'undo_log'"
+	GET_SUM_OF_BALANCES_FROM_ACCOUNT_BALANCES = "SELECT COALESCE(SUM(balance), 0) FROM account_balances"
+	CREATE_MINT_LOG_TABLE                     = "CREATE TABLE IF NOT EXISTS mint_log (height INTEGER, public_key_hash TEXT, value INTEGER)"
+	INSERT_VALUES_INTO_MINT_LOG               = "INSERT INTO mint_log (height, public_key_hash, value) VALUES (?, ?, ?)"
+	GET_SUM_OF_VALUES_FROM_MINT_LOG_BETWEEN   = "SELECT COALESCE(SUM(value), 0) FROM mint_log WHERE height BETWEEN ? AND ?"
+	GET_EVERYTHING_FROM_MINT_LOG              = "SELECT height, public_key_hash, value FROM mint_log ORDER BY height"
+	DELETE_MINT_LOG_ABOVE_HEIGHT              = "DELETE FROM mint_log WHERE height > ?"
+	DELETE_EVERYTHING_FROM_MINT_LOG           = "DELETE FROM mint_log"
+	CREATE_BURN_LOG_TABLE                     = "CREATE TABLE IF NOT EXISTS burn_log (height INTEGER, public_key_hash TEXT, value INTEGER)"
+	INSERT_VALUES_INTO_BURN_LOG               = "INSERT INTO burn_log (height, public_key_hash, value) VALUES (?, ?, ?)"
+	GET_SUM_OF_VALUES_FROM_BURN_LOG_BETWEEN   = "SELECT COALESCE(SUM(value), 0) FROM burn_log WHERE height BETWEEN ? AND ?"
+	DELETE_BURN_LOG_ABOVE_HEIGHT              = "DELETE FROM burn_log WHERE height > ?"
+	DELETE_EVERYTHING_FROM_BURN_LOG           = "DELETE FROM burn_log"
+	GET_EVERYTHING_FROM_METADATA              = "SELECT height, position, size, hash FROM metadata ORDER BY height"
 )
@@ -6,75 +6,33 @@ import (
 	"database/sql"
 	"encoding/asn1"
 	"errors"
-	"flag"
-	"log"
 	"math/big"
-	"os"
-	"strings"
 	"time"
-	"unicode"
 
 	"github.com/SIGBlockchain/project_aurum/internal/accountstable"
 	"github.com/SIGBlockchain/project_aurum/internal/block"
-	"github.com/SIGBlockchain/project_aurum/internal/config"
+	"github.com/SIGBlockchain/project_aurum/internal/constants"
 	"github.com/SIGBlockchain/project_aurum/internal/contracts"
 	"github.com/SIGBlockchain/project_aurum/internal/hashing"
-	"github.com/SIGBlockchain/project_aurum/internal/jsonify"
 	"github.com/SIGBlockchain/project_aurum/internal/publickey"
 )
 
-// SetConfigFromFlags loads a configuration file into a Config struct, modifies the struct according to flags,
-// and returns the updated struct
-func SetConfigFromFlags(configFile *os.File) (config.Config, error) {
-	cfg := config.Config{}
-	err := jsonify.LoadJSON(configFile, &cfg)
-	if err != nil {
-		return cfg, errors.New("Failed to unmarshall configuration data : " + err.Error())
-	}
-
-	//specify flags
-	versionU64 := flag.Uint("version", uint(cfg.Version), "enter version number")
-	flag.Uint64Var(&cfg.InitialAurumSupply, "supply", cfg.InitialAurumSupply, "enter a number for initial aurum supply")
-	flag.StringVar(&cfg.Port, "port", cfg.Port, "enter port number")
-	flag.StringVar(&cfg.BlockProductionInterval, "interval", cfg.BlockProductionInterval, "enter a time for block production interval\n(assuming seconds if units are not provided)")
-	flag.BoolVar(&cfg.Localhost, "localhost", cfg.Localhost, "syntax: -localhost=/boolean here/")
-	flag.StringVar(&cfg.MintAddr, "mint", cfg.MintAddr, "enter a mint address (64 characters hex string)")
-
-	//read flags
-	flag.Parse()
-	cfg.Version = uint16(*versionU64)
-
-	// get units of interval
-	intervalSuffix := strings.TrimLeftFunc(cfg.BlockProductionInterval, func(r rune) bool {
-		return !unicode.IsLetter(r) && unicode.IsDigit(r)
-	})
-	// check units are valid
-	hasSuf := false
-	for _, s := range [7]string{"ns", "us", "µs", "ms", "s", "m", "h"} {
-		if intervalSuffix == s {
-			hasSuf = true
-			break
-		}
-	}
-	if !hasSuf {
-		log.Fatalf("Failed to enter a valid interval suffix\nBad input: %v\n"+
-			"Format should be digits and unit with no space e.g. 1h or 20s",
-			cfg.BlockProductionInterval)
-	}
-
-	if len(cfg.MintAddr) != 64 && len(cfg.MintAddr) != 0 {
-		log.Fatalf("Failed to enter a valid 64 character hex string for mint address.\n"+
-			"Bad input: %v (len: %v)\n"+"The mint address must have 64 characters", cfg.MintAddr, len(cfg.MintAddr))
-	}
-	return cfg, nil
-}
-
 func ValidateContract(dbConnection *sql.DB, c *contracts.Contract) error {
 	// check for zero value transaction
 	if c.Value == 0 {
 		return errors.New("Invalid contract: zero value transaction")
 	}
 
+	// mint contracts are validated with ValidateMint
+	if c.IsMint() {
+		return errors.New("Invalid contract: mint contract is not a transfer")
+	}
+
+	// burn contracts destroy their value and have no recipient
+	if c.IsBurn() && !bytes.Equal(c.RecipPubKeyHash, make([]byte, 32)) {
+		return errors.New("Invalid contract: burn contract recipient must be all zeros")
+	}
+
 	// check for nil sender public key and recip == sha-256 hash of senderPK
 	encodedCSenderPublicKey, err := publickey.Encode(c.SenderPubKey)
 	if err != nil {
@@ -85,26 +43,8 @@ func ValidateContract(dbConnection *sql.DB, c *contracts.Contract) error {
 	}
 
 	// verify the signature in the contract
-	// Serialize the Contract
-	copyOfSigLen := c.SigLen
-	c.SigLen = 0
-	serializedContract, err := c.Serialize()
-	if err != nil {
-		return errors.New(err.Error())
-	}
-	hashedContract := hashing.New(serializedContract)
-
-	// stores r and s values needed for ecdsa.Verify
-	var esig struct {
-		R, S *big.Int
-	}
-	if _, err := asn1.Unmarshal(c.Signature, &esig); err != nil {
-		return errors.New("Failed to unmarshal signature")
-	}
-
-	// if ecdsa.Verify returns false, the signature is invalid
-	if !ecdsa.Verify(c.SenderPubKey, hashedContract, esig.R, esig.S) {
-		return errors.New("Invalid contract: signature is invalid")
+	if err := VerifySignature(c); err != nil {
+		return err
 	}
 
 	// retrieve sender's balance from account balance table
@@ -124,13 +64,42 @@ func ValidateContract(dbConnection *sql.DB, c *contracts.Contract) error {
 		}
 
 		/* valid contract */
-		c.SigLen = copyOfSigLen
 		return nil
 	}
 
 	return errors.New("Failed to validate contract")
 }
 
+// VerifySignature returns an error unless the contract is signed by the private key of its sender
+func VerifySignature(c *contracts.Contract) error {
+	if c.SenderPubKey == nil {
+		return errors.New("Invalid contract: sender cannot be nil")
+	}
+
+	// the signature is over the hash of the unsigned contract
+	unsigned := *c
+	unsigned.SigLen = 0
+	serializedContract, err := unsigned.Serialize()
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	hashedContract := hashing.New(serializedContract)
+
+	// stores r and s values needed for ecdsa.Verify
+	var esig struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(c.Signature, &esig); err != nil {
+		return errors.New("Failed to unmarshal signature")
+	}
+
+	// if ecdsa.Verify returns false, the signature is invalid
+	if !ecdsa.Verify(c.SenderPubKey, hashedContract, esig.R, esig.S) {
+		return errors.New("Invalid contract: signature is invalid")
+	}
+	return nil
+}
+
 // ValidatePending validates a contract with the given pending balance and pending state nonce
 func ValidatePending(c *contracts.Contract, pBalance *uint64, pNonce *uint64) error {
 	// check for zero value transaction
@@ -138,6 +107,16 @@ func ValidatePending(c *contracts.Contract, pBalance *uint64, pNonce *uint64) er
 		return errors.New("Invalid contract: zero value transaction")
 	}
 
+	// mint contracts are validated with ValidateMint
+	if c.IsMint() {
+		return errors.New("Invalid contract: mint contract is not a transfer")
+	}
+
+	// burn contracts destroy their value and have no recipient
+	if c.IsBurn() && !bytes.Equal(c.RecipPubKeyHash, make([]byte, 32)) {
+		return errors.New("Invalid contract: burn contract recipient must be all zeros")
+	}
+
 	// check for nil sender public key and recip == sha-256 hash of senderPK
 	recipPKhash := hashing.SHA256Hash{SecureHash: c.RecipPubKeyHash}
 
@@ -150,26 +129,8 @@ func ValidatePending(c *contracts.Contract, pBalance *uint64, pNonce *uint64) er
 	}
 
 	// verify the signature in the contract
-	// Serialize the Contract
-	copyOfSigLen := c.SigLen
-	c.SigLen = 0
-	serializedContract, err := c.Serialize()
-	if err != nil {
-		return errors.New(err.Error())
-	}
-	hashedContract := hashing.New(serializedContract)
-
-	// stores r and s values needed for ecdsa.Verify
-	var esig struct {
-		R, S *big.Int
-	}
-	if _, err := asn1.Unmarshal(c.Signature, &esig); err != nil {
-		return errors.New("Failed to unmarshal signature")
-	}
-
-	// if ecdsa.Verify returns false, the signature is invalid
-	if !ecdsa.Verify(c.SenderPubKey, hashedContract, esig.R, esig.S) {
-		return errors.New("Invalid contract: signature is invalid")
+	if err := VerifySignature(c); err != nil {
+		return err
 	}
 
 	// if sender's pending balance is less than the contract amount, invalid contract
@@ -183,17 +144,53 @@ func ValidatePending(c *contracts.Contract, pBalance *uint64, pNonce *uint64) er
 	}
 
 	/* valid contract, return updated pending balance and state nonce */
-	c.SigLen = copyOfSigLen
 	*pBalance -= c.Value
 	(*pNonce)++
 	return nil
 }
 
+// ValidateMint validates a mint contract: it must be signed by the key whose hash is mintAddr and its state nonce
+// must follow pNonce, the (pending) state nonce of the mint account. On success pNonce is incremented
+func ValidateMint(c *contracts.Contract, mintAddr []byte, pNonce *uint64) error {
+	if !c.IsMint() {
+		return errors.New("Invalid mint contract: wrong version")
+	}
+	if len(mintAddr) == 0 {
+		return errors.New("Invalid mint contract: no mint address is configured")
+	}
+	if c.Value == 0 {
+		return errors.New("Invalid mint contract: zero value")
+	}
+	if c.SenderPubKey == nil {
+		return errors.New("Invalid mint contract: sender cannot be nil")
+	}
+	encodedCSenderPublicKey, err := publickey.Encode(c.SenderPubKey)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(hashing.New(encodedCSenderPublicKey), mintAddr) {
+		return errors.New("Invalid mint contract: not signed by the mint key")
+	}
+	if bytes.Equal(c.RecipPubKeyHash, mintAddr) {
+		return errors.New("Invalid mint contract: mint account cannot be the recipient")
+	}
+
+	if err := VerifySignature(c); err != nil {
+		return err
+	}
+
+	if (*pNonce)+1 != c.StateNonce {
+		return errors.New("Invalid mint contract: contract state nonce is not the expected number")
+	}
+	(*pNonce)++
+	return nil
+}
+
 // ValidateBlock takes in expected version, height, previousHash, and timeStamp
-// and compares them with the block's
+// and compares them with the block's. Blocks of earlier versions than version stay valid, so old blocks can be synced
 func ValidateBlock(b block.Block, version uint16, prevHeight uint64, previousHash []byte, prevTimeStamp int64) bool {
 	// Check Version
-	if b.Version != version {
+	if b.Version == 0 || b.Version > version {
 		return false
 	}
 	// Check Height
@@ -208,14 +205,43 @@ func ValidateBlock(b block.Block, version uint16, prevHeight uint64, previousHas
 	if b.Timestamp <= prevTimeStamp || b.Timestamp > time.Now().UnixNano() {
 		return false
 	}
-	// Check MerkleRoot
-	if !hashing.MerkleRootHashOf(b.MerkleRootHash, b.Data) {
+	// Check that blocks carry a producer and signature exactly from the signed header version on
+	if b.Version >= constants.SignedBlockVersion {
+		if len(b.Producer) != 32 || len(b.Signature) == 0 {
+			return false
+		}
+	} else if len(b.Producer) != 0 || len(b.Signature) != 0 {
+		return false
+	}
+	// Check MerkleRoot; the root of a block without data is stored as zeros in the ledger
+	if len(b.Data) == 0 {
+		if !bytes.Equal(b.MerkleRootHash, make([]byte, len(b.MerkleRootHash))) {
+			return false
+		}
+	} else if !hashing.MerkleRootHashOf(b.MerkleRootHash, b.Data) {
 		return false
 	}
 
 	return true
 }
 
+// ValidateBlockSignature checks that the header was signed by producerKey and names it as the producer
+func ValidateBlockSignature(h block.BlockHeader, producerKey *ecdsa.PublicKey) bool {
+	encodedProducerKey, err := publickey.Encode(producerKey)
+	if err != nil || !bytes.Equal(h.Producer, hashing.New(encodedProducerKey)) {
+		return false
+	}
+
+	// stores r and s values needed for ecdsa.Verify
+	var esig struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(h.Signature, &esig); err != nil {
+		return false
+	}
+	return ecdsa.Verify(producerKey, block.HashBlockHeader(h), esig.R, esig.S)
+}
+
 // ValidateProducerTimestamp checks the parameter timestamp p to see if
 // it is greater than the sum of the interval itv and
 // the table timestamp t (corresponding to the walletAddr).
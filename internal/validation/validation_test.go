@@ -5,16 +5,12 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"database/sql"
-	"encoding/json"
-	"io/ioutil"
 	"os"
-	"reflect"
 	"testing"
 	"time"
 
 	"github.com/SIGBlockchain/project_aurum/internal/accountstable"
 	"github.com/SIGBlockchain/project_aurum/internal/block"
-	"github.com/SIGBlockchain/project_aurum/internal/config"
 	"github.com/SIGBlockchain/project_aurum/internal/constants"
 	"github.com/SIGBlockchain/project_aurum/internal/contracts"
 	"github.com/SIGBlockchain/project_aurum/internal/hashing"
@@ -353,6 +349,28 @@ func TestValidateBlock(t *testing.T) {
 			},
 			true,
 		},
+		{
+			"Valid empty block read from ledger",
+			block.Block{
+				Version:        1,
+				Height:         baseBlk.Height + 1,
+				PreviousHash:   block.HashBlock(baseBlk),
+				MerkleRootHash: make([]byte, 32),
+				Timestamp:      time.Now().UnixNano(),
+			},
+			true,
+		},
+		{
+			"Invalid empty block merkle root",
+			block.Block{
+				Version:        1,
+				Height:         baseBlk.Height + 1,
+				PreviousHash:   block.HashBlock(baseBlk),
+				MerkleRootHash: hashing.New([]byte{'q'}),
+				Timestamp:      time.Now().UnixNano(),
+			},
+			false,
+		},
 		{
 			"Invalid version",
 			block.Block{
@@ -443,6 +461,19 @@ func TestValidateBlock(t *testing.T) {
 				DataLen:        baseBlk.DataLen,
 			},
 			false,
+		},	{
+			"Invalid producer in unsigned version",
+			block.Block{
+				Version:        1,
+				Height:         baseBlk.Height + 1,
+				PreviousHash:   block.HashBlock(baseBlk),
+				MerkleRootHash: hashing.GetMerkleRootHash(baseBlk.Data),
+				Producer:       hashing.New([]byte{'p'}),
+				Timestamp:      time.Now().UnixNano(),
+				Data:           baseBlk.Data,
+				DataLen:        baseBlk.DataLen,
+			},
+			false,
 		},
 	}
 
@@ -456,15 +487,119 @@ func TestValidateBlock(t *testing.T) {
 	}
 }
 
+func TestValidateSignedBlock(t *testing.T) {
+	producerKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	parent := block.BlockHeader{Version: constants.SignedBlockVersion, Height: 4, Timestamp: time.Now().UnixNano() - 10, PreviousHash: hashing.New([]byte{'x'}), MerkleRootHash: make([]byte, 32)}
+	b, _ := block.New(constants.SignedBlockVersion, 5, block.HashBlockHeader(parent), nil)
+
+	if ValidateBlock(b, constants.SignedBlockVersion, parent.Height, block.HashBlockHeader(parent), parent.Timestamp) {
+		t.Errorf("expected unsigned block of a signed version to be invalid")
+	}
+	b.Sign(producerKey)
+	if !ValidateBlock(b, constants.SignedBlockVersion, parent.Height, block.HashBlockHeader(parent), parent.Timestamp) {
+		t.Errorf("expected signed block to be valid")
+	}
+	if !ValidateBlockSignature(b.GetHeader(), &producerKey.PublicKey) {
+		t.Errorf("expected signature of the producer to verify")
+	}
+	if ValidateBlockSignature(b.GetHeader(), &otherKey.PublicKey) {
+		t.Errorf("expected signature not to verify against another key")
+	}
+	forged := b.GetHeader()
+	forged.Timestamp++
+	if ValidateBlockSignature(forged, &producerKey.PublicKey) {
+		t.Errorf("expected signature not to verify after the header changed")
+	}
+
+	// blocks built before the version bump stay valid
+	old, _ := block.New(1, 5, block.HashBlockHeader(parent), nil)
+	if !ValidateBlock(old, constants.SignedBlockVersion, parent.Height, block.HashBlockHeader(parent), parent.Timestamp) {
+		t.Errorf("expected block of an earlier version to be valid")
+	}
+}
+
+func TestValidateBurn(t *testing.T) {
+	dbc, _ := sql.Open("sqlite3", constants.AccountsTable)
+	defer func() {
+		dbc.Close()
+		os.Remove(constants.AccountsTable)
+	}()
+	dbc.Exec(sqlstatements.CREATE_ACCOUNT_BALANCES_TABLE)
+	senderKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	encodedSenderPublicKey, _ := publickey.Encode(&senderKey.PublicKey)
+	accountstable.InsertAccountIntoAccountBalanceTable(dbc, hashing.New(encodedSenderPublicKey), 1000)
+
+	burn, _ := contracts.NewBurn(senderKey, 400, 1)
+	burn.Sign(senderKey)
+	if err := ValidateContract(dbc, burn); err != nil {
+		t.Errorf("expected burn to be valid: %v", err)
+	}
+	misdirected, _ := contracts.New(constants.BurnContractVersion, senderKey, hashing.New([]byte("recipient")), 400, 1)
+	misdirected.Sign(senderKey)
+	if err := ValidateContract(dbc, misdirected); err == nil {
+		t.Errorf("expected burn with a recipient to be rejected")
+	}
+	overburn, _ := contracts.NewBurn(senderKey, 1001, 1)
+	overburn.Sign(senderKey)
+	if err := ValidateContract(dbc, overburn); err == nil {
+		t.Errorf("expected burn of more than the balance to be rejected")
+	}
+}
+
+func TestValidateMint(t *testing.T) {
+	mintKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	encodedMintKey, _ := publickey.Encode(&mintKey.PublicKey)
+	mintAddr := hashing.New(encodedMintKey)
+	recipient := hashing.New([]byte("recipient"))
+	newMint := func(key *ecdsa.PrivateKey, version uint16, recipient []byte, value uint64, nonce uint64) *contracts.Contract {
+		c, _ := contracts.New(version, key, recipient, value, nonce)
+		c.Sign(key)
+		return c
+	}
+	forged := newMint(mintKey, constants.MintContractVersion, recipient, 10, 1)
+	forged.Value = 1000
+
+	tests := []struct {
+		name     string
+		c        *contracts.Contract
+		mintAddr []byte
+		wantErr  bool
+	}{
+		{name: "valid", c: newMint(mintKey, constants.MintContractVersion, recipient, 10, 1), mintAddr: mintAddr},
+		{name: "transfer version", c: newMint(mintKey, 1, recipient, 10, 1), mintAddr: mintAddr, wantErr: true},
+		{name: "minting disabled", c: newMint(mintKey, constants.MintContractVersion, recipient, 10, 1), mintAddr: nil, wantErr: true},
+		{name: "other key", c: newMint(otherKey, constants.MintContractVersion, recipient, 10, 1), mintAddr: mintAddr, wantErr: true},
+		{name: "zero value", c: newMint(mintKey, constants.MintContractVersion, recipient, 0, 1), mintAddr: mintAddr, wantErr: true},
+		{name: "mint to itself", c: newMint(mintKey, constants.MintContractVersion, mintAddr, 10, 1), mintAddr: mintAddr, wantErr: true},
+		{name: "wrong nonce", c: newMint(mintKey, constants.MintContractVersion, recipient, 10, 2), mintAddr: mintAddr, wantErr: true},
+		{name: "forged value", c: forged, mintAddr: mintAddr, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var nonce uint64
+			if err := ValidateMint(tt.c, tt.mintAddr, &nonce); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateMint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	var pendingNonce, pendingBalance uint64 = 0, 1000
+	if err := ValidatePending(newMint(mintKey, constants.MintContractVersion, recipient, 10, 1), &pendingBalance, &pendingNonce); err == nil {
+		t.Errorf("expected mint contract not to validate as a transfer")
+	}
+}
+
 func TestValidateProducerTimestamp(t *testing.T) {
-	wallet.CreateProducerTable()
+	wallet.CreateProducerTable(constants.ProducerTable)
 	db, err := sql.Open("sqlite3", constants.ProducerTable)
 	if err != nil {
 		t.Error("Failed to open database for test")
 	}
 	defer func() {
 		db.Close()
-		os.Remove("producer.db")
+		os.Remove(constants.ProducerTable)
 	}()
 
 	walletAddr := []byte{'a'}
@@ -531,48 +666,3 @@ func TestValidateProducerTimestamp(t *testing.T) {
 	}
 
 }
-
-// TODO - since we don't care about the file, shouldn't this be mocked?
-func TestSetConfigFromFlags(t *testing.T) {
-	// create a test file and open it
-	tmpfile, err := ioutil.TempFile("", "mockconfig") //create tempfile and open it
-	if err != nil {
-		t.Errorf("failed to open temp file")
-	}
-
-	// defer close and remove
-	defer func() {
-		err := tmpfile.Close() //closes file
-		if err != nil {
-			t.Errorf("Failed to remove database: %s", err)
-		}
-
-		err = os.Remove(tmpfile.Name()) //deletes the file
-		if err != nil {
-			t.Errorf("Failed to remove database: %s", err)
-
-		}
-	}()
-
-	// create config to be loaded into file
-	expectedCfg := config.Config{1, 20, "5000", "40s", false, ""}
-
-	// convert to bytes
-	marshalledCfg, err := json.Marshal(expectedCfg)
-	if err != nil {
-		t.Errorf("failed to marshall configuration struct: %v", err)
-	}
-
-	// write to temp file
-	err = ioutil.WriteFile(tmpfile.Name(), marshalledCfg, 0644)
-	if err != nil {
-		t.Errorf("failed to write file %v", err)
-	}
-
-	actualCfg, err := SetConfigFromFlags(tmpfile)
-
-	if !reflect.DeepEqual(actualCfg, expectedCfg) {
-		t.Errorf("the Config structs are not equal: Wanted %v, Got %v", actualCfg, expectedCfg)
-	}
-
-}
@@ -8,253 +8,707 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
 
-	"github.com/SIGBlockchain/project_aurum/internal/constants"
 	"github.com/SIGBlockchain/project_aurum/internal/hashing"
+	"github.com/SIGBlockchain/project_aurum/internal/hdwallet"
+	"github.com/SIGBlockchain/project_aurum/internal/keystore"
 	"github.com/SIGBlockchain/project_aurum/internal/privatekey"
 	"github.com/SIGBlockchain/project_aurum/internal/publickey"
 	"github.com/SIGBlockchain/project_aurum/internal/sqlstatements"
 	_ "github.com/mattn/go-sqlite3"
 )
 
-// SetupWallet initializes a JSON file called "aurum_wallet.json"
-// with the hex encoded privatekey, balance, and nonce
-func SetupWallet() error {
-	// if the JSON file already exists, return error
-	_, err := os.Stat("aurum_wallet.json")
-	if err == nil {
-		return errors.New("JSON file for aurum_wallet already exists")
-	}
+const (
+	// DirEnv is the environment variable naming the wallet directory when no directory is given
+	DirEnv = "AURUM_WALLET_DIR"
+
+	// GapLimit is the number of unused accounts in a row after which RestoreSeed stops looking for used accounts
+	GapLimit = 20
+
+	indexFileName     = "wallet.json"
+	seedFileName      = "seed.json"
+	accountsDirName   = "accounts"
+	accountFileSuffix = ".json"
+)
+
+// ContractState is the state of a contract the wallet has sent, as last seen on the node
+type ContractState string
+
+const (
+	// ContractSent is a contract posted to the node that the wallet has not checked on since
+	ContractSent ContractState = "sent"
+	// ContractPending is a contract the node holds in its pending pool
+	ContractPending ContractState = "pending"
+	// ContractConfirmed is a contract in a block of the node's ledger
+	ContractConfirmed ContractState = "confirmed"
+	// ContractDropped is a contract the node no longer counts, which will not be confirmed.
+	// Its state nonce is free to be used again
+	ContractDropped ContractState = "dropped"
+)
+
+// StuckAfter is how long a contract may go unconfirmed before it is considered stuck
+var StuckAfter = 10 * time.Minute
+
+// KeystoreParams are the scrypt cost parameters new keystores are encrypted with
+var KeystoreParams = keystore.StandardParams
+
+var accountNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Wallet is a directory of named accounts, each with its own key and cached balance and state nonce.
+// One of the accounts is the default account, which methods taking an account name use when the name is empty
+type Wallet struct {
+	dir string
+}
+
+// walletIndex is the file naming the default account
+type walletIndex struct {
+	Default string
+}
+
+// seedFile is the file the seed of a wallet is stored in, encrypted, with the index of the next account to derive
+type seedFile struct {
+	Keystore  *keystore.Keystore
+	NextIndex uint32
+}
+
+// accountFile is the file an account is stored in. The private key of an encrypted account is held in Keystore;
+// wallets created before keystores hold it in PrivateKey, hex encoded in plaintext, until EncryptAccount is run.
+// Accounts derived from the wallet's seed record the index they were derived at
+type accountFile struct {
+	Address    string             `json:",omitempty"` // hex encoded public key hash
+	Keystore   *keystore.Keystore `json:",omitempty"`
+	PrivateKey string             `json:",omitempty"`
+	Index      *uint32            `json:",omitempty"`
+	Balance    uint64
+	Nonce      uint64
+	Journal    []JournalEntry `json:",omitempty"`
+}
+
+// JournalEntry is a contract sent from an account, kept in the account's journal
+type JournalEntry struct {
+	ContractHash string // hex encoded hash of the serialized contract
+	Recipient    string // hex encoded wallet address
+	Value        uint64
+	StateNonce   uint64
+	State        ContractState
+	Height       uint64 `json:",omitempty"` // block a confirmed contract is in
+	SentAt       time.Time
+}
+
+// InFlight returns true if the contract has been sent but is neither confirmed nor dropped
+func (entry JournalEntry) InFlight() bool {
+	return entry.State == ContractSent || entry.State == ContractPending
+}
 
-	// Create JSON file for wallet
-	file, err := os.Create("aurum_wallet.json")
+// Stuck returns true if the contract is in flight and was sent more than StuckAfter before now
+func (entry JournalEntry) Stuck(now time.Time) bool {
+	return entry.InFlight() && now.Sub(entry.SentAt) > StuckAfter
+}
+
+// DefaultDir returns the wallet directory named by the AURUM_WALLET_DIR environment variable,
+// or .aurum/wallet in the user's home directory
+func DefaultDir() (string, error) {
+	if dir := os.Getenv(DirEnv); dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
 	if err != nil {
-		return err
+		return "", errors.New("Failed to find home directory: " + err.Error())
 	}
-	defer file.Close()
+	return filepath.Join(home, ".aurum", "wallet"), nil
+}
 
-	// Json structure that will be used to store information into the json file
-	type jsonStruct struct {
-		PrivateKey string
-		Balance    uint64
-		Nonce      uint64
+// Open returns the wallet in dir, creating the directory, readable only by its owner, if it does not exist
+func Open(dir string) (*Wallet, error) {
+	if err := os.MkdirAll(filepath.Join(dir, accountsDirName), 0700); err != nil {
+		return nil, errors.New("Failed to create wallet directory: " + err.Error())
 	}
+	return &Wallet{dir}, nil
+}
 
-	// Generate ecdsa key pairs
-	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-	if err != nil {
+// Dir returns the directory of the wallet
+func (w *Wallet) Dir() string {
+	return w.dir
+}
+
+// NewAccount creates the account name with a new private key encrypted under passphrase.
+// The first account of a wallet becomes its default account
+func (w *Wallet) NewAccount(name string, passphrase []byte) error {
+	if err := w.checkNewAccount(name); err != nil {
 		return err
 	}
 
-	// Encodes private key
-	pemEncoded, err := privatekey.Encode(privateKey)
+	// Generate ecdsa key pairs
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
 		return err
 	}
+	return w.addKey(name, privateKey, passphrase)
+}
 
-	// Encodes the pem encoded private key into string and stores it into a jsonStruct
-	hexKey := hex.EncodeToString(pemEncoded)
-	j := jsonStruct{PrivateKey: hexKey}
+// ImportKey creates the account name holding privateKey, encrypted under passphrase
+func (w *Wallet) ImportKey(name string, privateKey *ecdsa.PrivateKey, passphrase []byte) error {
+	if err := w.checkNewAccount(name); err != nil {
+		return err
+	}
+	if privateKey == nil || privateKey.Curve != elliptic.P256() {
+		return errors.New("Private key must be a P-256 key")
+	}
+	return w.addKey(name, privateKey, passphrase)
+}
 
-	// Marshall the jsonStruct
-	jsonEncoded, err := json.Marshal(j)
+// addKey adds the account name holding privateKey encrypted under passphrase
+func (w *Wallet) addKey(name string, privateKey *ecdsa.PrivateKey, passphrase []byte) error {
+	ks, err := keystore.Encrypt(privateKey, passphrase, KeystoreParams)
+	if err != nil {
+		return errors.New("Failed to encrypt private key: " + err.Error())
+	}
+	walletAddress, err := addressOf(privateKey)
 	if err != nil {
 		return err
 	}
+	return w.addAccount(name, accountFile{Address: hex.EncodeToString(walletAddress), Keystore: ks})
+}
 
-	// Write into the json file
-	_, err = file.Write(jsonEncoded)
-	if err != nil {
+// ImportWalletFile adds the single account wallet in filename, as written to aurum_wallet.json before wallets held
+// multiple accounts, as the account name. A plaintext wallet stays plaintext until EncryptAccount is run
+func (w *Wallet) ImportWalletFile(name string, filename string) error {
+	if err := w.checkNewAccount(name); err != nil {
 		return err
 	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return errors.New("Failed to read wallet file: " + err.Error())
+	}
+	var account accountFile
+	if err := json.Unmarshal(data, &account); err != nil {
+		return errors.New("Failed to parse data from json file: " + err.Error())
+	}
+	if account.Keystore == nil {
+		if _, err := decodePlaintextKey(account.PrivateKey); err != nil {
+			return err
+		}
+	}
+	return w.addAccount(name, account)
+}
 
-	return nil
+// HasSeed returns true if the wallet has a seed to derive accounts from
+func (w *Wallet) HasSeed() bool {
+	_, err := os.Stat(filepath.Join(w.dir, seedFileName))
+	return err == nil
 }
 
-// GetPrivateKey opens the wallet and returns the private key
-func GetPrivateKey() (*ecdsa.PrivateKey, error) {
-	// Opens the wallet
-	file, err := os.Open("aurum_wallet.json")
+// CreateSeed stores the seed of mnemonic, encrypted under passphrase, as the seed accounts are derived from.
+// A wallet has at most one seed
+func (w *Wallet) CreateSeed(mnemonic string, passphrase []byte) error {
+	seed, err := hdwallet.SeedFromMnemonic(mnemonic)
 	if err != nil {
-		return nil, errors.New("Failed to open wallet")
+		return err
 	}
-	defer file.Close()
+	return w.writeSeed(seed, passphrase, 0)
+}
 
-	// Reads the file and stores the data into a byte slice
-	data, err := ioutil.ReadAll(file)
+// DeriveAccount creates the account name with the next key derived from the wallet's seed, decrypting the seed and
+// encrypting the key under passphrase
+func (w *Wallet) DeriveAccount(name string, passphrase []byte) error {
+	if err := w.checkNewAccount(name); err != nil {
+		return err
+	}
+	stored, err := w.readSeed()
 	if err != nil {
-		return nil, errors.New("Failed to read wallet")
+		return err
 	}
-
-	// Json struct for storing the private key from the json file
-	type jsonStruct struct {
-		PrivateKey string
+	seed, err := stored.Keystore.DecryptSecret(passphrase)
+	if err != nil {
+		return err
 	}
+	if err := w.addDerivedAccount(name, seed, stored.NextIndex, passphrase); err != nil {
+		return err
+	}
+	stored.NextIndex++
+	return w.writeSeedFile(stored)
+}
 
-	// Parse the data from the json file into a jsonStruct
-	var j jsonStruct
-	err = json.Unmarshal(data, &j)
+// RestoreSeed stores the seed of mnemonic like CreateSeed and recreates the accounts derived from it, naming them
+// account-0, account-1, and so on. Accounts are derived in order until GapLimit accounts in a row are not used,
+// as reported by used given their wallet addresses; every account up to the last used one is recreated, and the
+// first account always is. The names of the recreated accounts are returned
+func (w *Wallet) RestoreSeed(mnemonic string, passphrase []byte, used func(walletAddress []byte) (bool, error)) ([]string, error) {
+	if w.HasSeed() {
+		return nil, errors.New("Wallet already has a seed")
+	}
+	seed, err := hdwallet.SeedFromMnemonic(mnemonic)
 	if err != nil {
 		return nil, err
 	}
+	var count uint32 = 1
+	for index, unused := uint32(0), 0; unused < GapLimit; index++ {
+		key, err := hdwallet.DeriveAccount(seed, index)
+		if err != nil {
+			return nil, err
+		}
+		pubKey, err := publickey.New(key.Key)
+		if err != nil {
+			return nil, err
+		}
+		isUsed, err := used(pubKey.Hash)
+		if err != nil {
+			return nil, err
+		}
+		if isUsed {
+			count, unused = index+1, 0
+		} else {
+			unused++
+		}
+	}
+
+	names := make([]string, count)
+	for index := range names {
+		names[index] = fmt.Sprintf("account-%d", index)
+		if err := w.checkNewAccount(names[index]); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.writeSeed(seed, passphrase, count); err != nil {
+		return nil, err
+	}
+	for index, name := range names {
+		if err := w.addDerivedAccount(name, seed, uint32(index), passphrase); err != nil {
+			return nil, err
+		}
+	}
+	return names, nil
+}
 
-	// Decodes the private key from the jsonStruct
-	pemEncoded, _ := hex.DecodeString(j.PrivateKey)
-	privateKey, err := privatekey.Decode(pemEncoded)
+// Accounts returns the names of the accounts in the wallet in alphabetical order
+func (w *Wallet) Accounts() ([]string, error) {
+	files, err := ioutil.ReadDir(filepath.Join(w.dir, accountsDirName))
 	if err != nil {
-		return nil, err
+		return nil, errors.New("Failed to read wallet directory: " + err.Error())
+	}
+	var names []string
+	for _, file := range files {
+		if name := strings.TrimSuffix(file.Name(), accountFileSuffix); name != file.Name() && accountNamePattern.MatchString(name) {
+			names = append(names, name)
+		}
 	}
+	sort.Strings(names)
+	return names, nil
+}
 
-	return privateKey, nil
+// DefaultAccount returns the name of the default account
+func (w *Wallet) DefaultAccount() (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(w.dir, indexFileName))
+	if os.IsNotExist(err) {
+		return "", errors.New("Wallet has no accounts")
+	} else if err != nil {
+		return "", errors.New("Failed to read wallet index: " + err.Error())
+	}
+	var index walletIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return "", errors.New("Failed to parse wallet index: " + err.Error())
+	}
+	return index.Default, nil
 }
 
-// GetBalance opens the wallet and returns the balance
-func GetBalance() (uint64, error) {
-	fwallet, err := os.Open("aurum_wallet.json")
+// SetDefaultAccount makes the existing account name the default account
+func (w *Wallet) SetDefaultAccount(name string) error {
+	if _, err := w.readAccount(name); err != nil {
+		return err
+	}
+	data, err := json.Marshal(walletIndex{name})
 	if err != nil {
-		return 0, errors.New("Failed to open wallet file: " + err.Error())
+		return errors.New("Failed to marshal wallet index: " + err.Error())
 	}
-	defer fwallet.Close()
+	return writeFile(filepath.Join(w.dir, indexFileName), data)
+}
 
-	jsonEncoded, err := ioutil.ReadAll(fwallet)
+// GetPrivateKey returns the private key of the account, decrypting it with passphrase.
+// The passphrase of a plaintext account is ignored
+func (w *Wallet) GetPrivateKey(name string, passphrase []byte) (*ecdsa.PrivateKey, error) {
+	account, err := w.readAccount(name)
 	if err != nil {
-		return 0, errors.New("Failed to read wallet file: " + err.Error())
+		return nil, err
+	}
+	if account.Keystore == nil {
+		return decodePlaintextKey(account.PrivateKey)
 	}
+	if err := account.Keystore.Unlock(passphrase); err != nil {
+		return nil, err
+	}
+	return account.Keystore.PrivateKey()
+}
 
-	type jsonStruct struct {
-		Balance uint64
+// IsEncrypted returns true if the private key of the account is held in a keystore
+func (w *Wallet) IsEncrypted(name string) (bool, error) {
+	account, err := w.readAccount(name)
+	if err != nil {
+		return false, err
 	}
+	return account.Keystore != nil, nil
+}
 
-	var j jsonStruct
-	err = json.Unmarshal(jsonEncoded, &j)
+// EncryptAccount migrates a plaintext account in place, replacing its private key with a keystore encrypted under
+// passphrase
+func (w *Wallet) EncryptAccount(name string, passphrase []byte) error {
+	account, err := w.readAccount(name)
 	if err != nil {
-		return 0, errors.New("Failed to parse data from json file: " + err.Error())
+		return err
+	}
+	if account.Keystore != nil {
+		return errors.New("Account is already encrypted")
+	}
+	privateKey, err := decodePlaintextKey(account.PrivateKey)
+	if err != nil {
+		return err
 	}
+	if account.Keystore, err = keystore.Encrypt(privateKey, passphrase, KeystoreParams); err != nil {
+		return errors.New("Failed to encrypt private key: " + err.Error())
+	}
+	walletAddress, err := addressOf(privateKey)
+	if err != nil {
+		return err
+	}
+	account.Address = hex.EncodeToString(walletAddress)
+	account.PrivateKey = ""
+	return w.writeAccount(name, account)
+}
 
-	return j.Balance, nil
+// ChangePassphrase re-encrypts the private key of an encrypted account under newPassphrase
+func (w *Wallet) ChangePassphrase(name string, oldPassphrase []byte, newPassphrase []byte) error {
+	account, err := w.readAccount(name)
+	if err != nil {
+		return err
+	}
+	if account.Keystore == nil {
+		return errors.New("Account is not encrypted")
+	}
+	if err := account.Keystore.ChangePassphrase(oldPassphrase, newPassphrase); err != nil {
+		return err
+	}
+	account.Keystore.Lock()
+	return w.writeAccount(name, account)
 }
 
-// GetStateNonce opens the wallet and returns the state nonce
-func GetStateNonce() (uint64, error) {
-	// Opens the wallet
-	file, err := os.Open("aurum_wallet.json")
+// GetBalance returns the cached balance of the account
+func (w *Wallet) GetBalance(name string) (uint64, error) {
+	account, err := w.readAccount(name)
 	if err != nil {
-		return 0, errors.New("Failed to open wallet")
+		return 0, err
 	}
-	defer file.Close()
+	return account.Balance, nil
+}
 
-	// Reads the json file and stores the data into the data byte slice
-	data, err := ioutil.ReadAll(file)
+// GetStateNonce returns the cached state nonce of the account
+func (w *Wallet) GetStateNonce(name string) (uint64, error) {
+	account, err := w.readAccount(name)
 	if err != nil {
-		return 0, errors.New("Failed to read wallet")
+		return 0, err
 	}
+	return account.Nonce, nil
+}
 
-	// Json struct for storing the nonce from the json file
-	type jsonStruct struct {
-		Nonce uint64
+// GetWalletAddress returns the wallet address of the account
+func (w *Wallet) GetWalletAddress(name string) ([]byte, error) {
+	account, err := w.readAccount(name)
+	if err != nil {
+		return nil, err
+	}
+	if account.Address != "" {
+		walletAddress, err := hex.DecodeString(account.Address)
+		if err != nil {
+			return nil, errors.New("Failed to decode wallet address")
+		}
+		return walletAddress, nil
 	}
 
-	// Parse the data from the json file into a jsonStruct
-	var j jsonStruct
-	err = json.Unmarshal(data, &j)
+	// Plaintext wallets do not store their address
+	privKey, err := decodePlaintextKey(account.PrivateKey)
 	if err != nil {
-		return 0, errors.New("Failed to parse data from json file: " + err.Error())
+		return nil, errors.New("Failed to decode private key hash")
 	}
+	return addressOf(privKey)
+}
 
-	return j.Nonce, nil
+// UpdateWallet sets the cached balance and state nonce of the account
+func (w *Wallet) UpdateWallet(name string, balance, stateNonce uint64) error {
+	account, err := w.readAccount(name)
+	if err != nil {
+		return err
+	}
+	account.Balance = balance
+	account.Nonce = stateNonce
+	return w.writeAccount(name, account)
 }
 
-// GetWalletAddress opens the wallet and returns the wallet address
-func GetWalletAddress() ([]byte, error) {
-	// Opens the wallet
-	file, err := os.Open("aurum_wallet.json")
+// addDerivedAccount adds the account name with the key derived from seed at index, encrypted under passphrase
+func (w *Wallet) addDerivedAccount(name string, seed []byte, index uint32, passphrase []byte) error {
+	privateKey, err := hdwallet.DeriveAccount(seed, index)
 	if err != nil {
-		return nil, errors.New("Failed to open wallet")
+		return errors.New("Failed to derive private key: " + err.Error())
 	}
-	defer file.Close()
+	pubKey, err := publickey.New(privateKey.Key)
+	if err != nil {
+		return err
+	}
+	ks, err := keystore.Encrypt(privateKey.Key, passphrase, KeystoreParams)
+	if err != nil {
+		return errors.New("Failed to encrypt private key: " + err.Error())
+	}
+	return w.addAccount(name, accountFile{Address: hex.EncodeToString(pubKey.Hash), Keystore: ks, Index: &index})
+}
 
-	// Reads the json file and stores the data into a byte slice
-	data, err := ioutil.ReadAll(file)
+// writeSeed encrypts seed under passphrase and stores it with the index of the next account to derive,
+// unless the wallet already has a seed
+func (w *Wallet) writeSeed(seed []byte, passphrase []byte, nextIndex uint32) error {
+	if w.HasSeed() {
+		return errors.New("Wallet already has a seed")
+	}
+	ks, err := keystore.EncryptSecret(seed, passphrase, KeystoreParams)
 	if err != nil {
-		return nil, errors.New("Failed to read wallet")
+		return errors.New("Failed to encrypt seed: " + err.Error())
 	}
+	return w.writeSeedFile(seedFile{ks, nextIndex})
+}
 
-	// Json struct for storing the data from the json file
-	type jsonStruct struct {
-		PrivateKey string
+func (w *Wallet) readSeed() (seedFile, error) {
+	data, err := ioutil.ReadFile(filepath.Join(w.dir, seedFileName))
+	if os.IsNotExist(err) {
+		return seedFile{}, errors.New("Wallet has no seed")
+	} else if err != nil {
+		return seedFile{}, errors.New("Failed to read seed: " + err.Error())
+	}
+	var stored seedFile
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return seedFile{}, errors.New("Failed to parse seed: " + err.Error())
+	}
+	if stored.Keystore == nil {
+		return seedFile{}, errors.New("Seed file holds no keystore")
 	}
+	return stored, nil
+}
 
-	// Parse the data from the json file into a jsonStruct
-	var j jsonStruct
-	err = json.Unmarshal(data, &j)
+func (w *Wallet) writeSeedFile(stored seedFile) error {
+	data, err := json.Marshal(stored)
 	if err != nil {
-		return nil, errors.New("Failed to parse data from json file")
+		return errors.New("Failed to marshal seed: " + err.Error())
 	}
+	return writeFile(filepath.Join(w.dir, seedFileName), data)
+}
 
-	// Get the private key hash
-	privKeyHash, err := hex.DecodeString(j.PrivateKey)
+// RecordSent adds a contract sent from the account to its journal in the sent state and deducts its value from the
+// cached balance, advancing the cached state nonce to the contract's
+func (w *Wallet) RecordSent(name string, entry JournalEntry) error {
+	account, err := w.readAccount(name)
 	if err != nil {
-		return nil, errors.New("Failed to decode private key string")
+		return err
+	}
+	entry.State = ContractSent
+	account.Journal = append(account.Journal, entry)
+	if account.Balance >= entry.Value {
+		account.Balance -= entry.Value
+	} else {
+		account.Balance = 0
 	}
+	if entry.StateNonce > account.Nonce {
+		account.Nonce = entry.StateNonce
+	}
+	return w.writeAccount(name, account)
+}
 
-	// Get the private key
-	privKey, err := privatekey.Decode(privKeyHash)
+// Journal returns the contracts sent from the account, oldest first
+func (w *Wallet) Journal(name string) ([]JournalEntry, error) {
+	account, err := w.readAccount(name)
 	if err != nil {
-		return nil, errors.New("Failed to decode private key hash")
+		return nil, err
+	}
+	return account.Journal, nil
+}
+
+// NextStateNonce returns the state nonce of the next contract from the account: one past the cached state nonce
+// and the state nonces of its contracts in flight, so that contracts sent before the node counts the previous
+// ones do not reuse their nonces
+func (w *Wallet) NextStateNonce(name string) (uint64, error) {
+	account, err := w.readAccount(name)
+	if err != nil {
+		return 0, err
 	}
+	stateNonce := account.Nonce
+	for _, entry := range account.Journal {
+		if entry.InFlight() && entry.StateNonce > stateNonce {
+			stateNonce = entry.StateNonce
+		}
+	}
+	return stateNonce + 1, nil
+}
 
-	// Get the PEM encoded public key
-	pubKeyEncoded, err := publickey.Encode(&privKey.PublicKey)
+// Reconcile caches the balance and state nonce the node reports for the account, counting its pending contracts,
+// and brings the journal up to date. contractHeight returns the height of the block a contract is in, or false
+// if the contract is not in the node's ledger. A contract in flight that is in the ledger is confirmed, and any
+// other contract with its state nonce is dropped; one that is not in the ledger is pending if the node's state
+// nonce covers it, and dropped otherwise. The updated journal is returned
+func (w *Wallet) Reconcile(name string, balance, stateNonce uint64, contractHeight func(contractHash string) (uint64, bool, error)) ([]JournalEntry, error) {
+	account, err := w.readAccount(name)
 	if err != nil {
 		return nil, err
 	}
-	return hashing.New(pubKeyEncoded), nil
+	account.Balance = balance
+	account.Nonce = stateNonce
+
+	confirmedNonces := make(map[uint64]bool)
+	for i, entry := range account.Journal {
+		if entry.State == ContractConfirmed {
+			confirmedNonces[entry.StateNonce] = true
+			continue
+		} else if !entry.InFlight() {
+			continue
+		}
+		height, confirmed, err := contractHeight(entry.ContractHash)
+		if err != nil {
+			return nil, errors.New("Failed to get contract status: " + err.Error())
+		}
+		if confirmed {
+			account.Journal[i].State = ContractConfirmed
+			account.Journal[i].Height = height
+			confirmedNonces[entry.StateNonce] = true
+		}
+	}
+	for i, entry := range account.Journal {
+		if !entry.InFlight() {
+			continue
+		}
+		if entry.StateNonce > stateNonce || confirmedNonces[entry.StateNonce] {
+			account.Journal[i].State = ContractDropped
+		} else {
+			account.Journal[i].State = ContractPending
+		}
+	}
+	if err := w.writeAccount(name, account); err != nil {
+		return nil, err
+	}
+	return account.Journal, nil
+}
+
+// checkNewAccount checks that name is a valid account name and is not taken
+func (w *Wallet) checkNewAccount(name string) error {
+	if !accountNamePattern.MatchString(name) {
+		return errors.New("Invalid account name, use letters, digits, - and _: " + name)
+	}
+	if _, err := os.Stat(w.accountFileName(name)); err == nil {
+		return errors.New("Account already exists: " + name)
+	}
+	return nil
+}
+
+// addAccount writes a new account and makes it the default account if the wallet has none
+func (w *Wallet) addAccount(name string, account accountFile) error {
+	if err := w.writeAccount(name, account); err != nil {
+		return err
+	}
+	if _, err := w.DefaultAccount(); err != nil {
+		return w.SetDefaultAccount(name)
+	}
+	return nil
+}
+
+func (w *Wallet) accountFileName(name string) string {
+	return filepath.Join(w.dir, accountsDirName, name+accountFileSuffix)
 }
 
-func UpdateWallet(balance, stateNonce uint64) error {
-	wallet := "aurum_wallet.json"
-	if _, err := os.Stat(wallet); os.IsNotExist(err) {
-		return errors.New("wallet file not detected: " + err.Error())
+// resolve returns the name of the default account if name is empty
+func (w *Wallet) resolve(name string) (string, error) {
+	if name == "" {
+		return w.DefaultAccount()
 	}
-	type walletData struct {
-		PrivateKey string
-		Balance    uint64
-		Nonce      uint64
+	if !accountNamePattern.MatchString(name) {
+		return "", errors.New("Invalid account name: " + name)
 	}
-	f, err := os.Open(wallet)
+	return name, nil
+}
+
+// readAccount opens the account and parses it
+func (w *Wallet) readAccount(name string) (accountFile, error) {
+	name, err := w.resolve(name)
 	if err != nil {
-		return errors.New("failed to open wallet: " + err.Error())
+		return accountFile{}, err
+	}
+	data, err := ioutil.ReadFile(w.accountFileName(name))
+	if os.IsNotExist(err) {
+		return accountFile{}, errors.New("No such account: " + name)
+	} else if err != nil {
+		return accountFile{}, errors.New("Failed to read account: " + err.Error())
 	}
-	defer f.Close()
-	data, err := ioutil.ReadAll(f)
-	var jsonData walletData
-	if err := json.Unmarshal(data, &jsonData); err != nil {
-		return errors.New("failed to unmarshall data: %s" + err.Error())
+	var account accountFile
+	if err := json.Unmarshal(data, &account); err != nil {
+		return accountFile{}, errors.New("Failed to parse data from json file: " + err.Error())
 	}
-	jsonData.Balance = balance
-	jsonData.Nonce = stateNonce
+	return account, nil
+}
 
-	dumpData, err := json.Marshal(jsonData)
+func (w *Wallet) writeAccount(name string, account accountFile) error {
+	name, err := w.resolve(name)
 	if err != nil {
-		return errors.New("failed to marshal dump data: " + err.Error())
+		return err
 	}
-	if err := ioutil.WriteFile(wallet, dumpData, 0644); err != nil {
-		return errors.New("failed to write to file: " + err.Error())
+	data, err := json.Marshal(account)
+	if err != nil {
+		return errors.New("Failed to marshal account: " + err.Error())
 	}
+	return writeFile(w.accountFileName(name), data)
+}
 
+// writeFile replaces filename with data. The new file is written beside the old one and renamed over it,
+// so it is never left half written, and is readable only by its owner
+func writeFile(filename string, data []byte) error {
+	tmpName := filename + ".tmp"
+	if err := ioutil.WriteFile(tmpName, data, 0600); err != nil {
+		return errors.New("Failed to write wallet: " + err.Error())
+	}
+	if err := os.Chmod(tmpName, 0600); err != nil {
+		return errors.New("Failed to restrict wallet permissions: " + err.Error())
+	}
+	if err := os.Rename(tmpName, filename); err != nil {
+		os.Remove(tmpName)
+		return errors.New("Failed to replace wallet: " + err.Error())
+	}
 	return nil
 }
 
-func CreateProducerTable() error {
-	file, err := os.Create(constants.ProducerTable)
+// decodePlaintextKey decodes the hex encoded PEM private key of a plaintext wallet
+func decodePlaintextKey(hexKey string) (*ecdsa.PrivateKey, error) {
+	pemEncoded, err := hex.DecodeString(hexKey)
+	if err != nil || len(pemEncoded) == 0 {
+		return nil, errors.New("Failed to decode private key string")
+	}
+	return privatekey.Decode(pemEncoded)
+}
+
+// addressOf returns the wallet address of privateKey, the hash of its PEM encoded public key
+func addressOf(privateKey *ecdsa.PrivateKey) ([]byte, error) {
+	pubKeyEncoded, err := publickey.Encode(&privateKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return hashing.New(pubKeyEncoded), nil
+}
+
+// CreateProducerTable creates the producer table filename, such as the Producer of a node's data directory
+func CreateProducerTable(filename string) error {
+	file, err := os.Create(filename)
 	if err != nil {
 		return errors.New("Failed to create producer file")
 	}
 	file.Close()
 
-	db, err := sql.Open("sqlite3", constants.ProducerTable)
+	db, err := sql.Open("sqlite3", filename)
 	if err != nil {
 		return errors.New("Failed to open table" + err.Error())
 	}
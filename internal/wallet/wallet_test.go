@@ -0,0 +1,247 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/SIGBlockchain/project_aurum/internal/keystore"
+)
+
+func TestWalletAccounts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aurum_wallet")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	KeystoreParams = keystore.LightParams
+	w, err := Open(filepath.Join(dir, "wallet"))
+	if err != nil {
+		t.Fatalf("failed to open wallet: %v", err)
+	}
+
+	if _, err := w.GetWalletAddress(""); err == nil {
+		t.Errorf("expected an empty wallet to have no default account")
+	}
+	if err := w.NewAccount("savings", []byte("first")); err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+	if err := w.NewAccount("spending", []byte("second")); err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+	for _, name := range []string{"savings", "../escape", ""} {
+		if err := w.NewAccount(name, []byte("third")); err == nil {
+			t.Errorf("expected account name %q to be rejected", name)
+		}
+	}
+
+	if names, err := w.Accounts(); err != nil || !reflect.DeepEqual(names, []string{"savings", "spending"}) {
+		t.Errorf("unexpected accounts %v (%v)", names, err)
+	}
+	if name, err := w.DefaultAccount(); err != nil || name != "savings" {
+		t.Errorf("expected the first account to be the default, got %q (%v)", name, err)
+	}
+	savings, _ := w.GetWalletAddress("savings")
+	spending, _ := w.GetWalletAddress("spending")
+	if defaultAddress, _ := w.GetWalletAddress(""); !bytes.Equal(defaultAddress, savings) || bytes.Equal(savings, spending) {
+		t.Errorf("expected distinct accounts with the default resolving to savings")
+	}
+
+	// Each account caches its own balance and state nonce
+	if err := w.UpdateWallet("spending", 40, 3); err != nil {
+		t.Fatalf("failed to update account: %v", err)
+	}
+	if balance, _ := w.GetBalance("savings"); balance != 0 {
+		t.Errorf("expected the savings balance to be untouched, got %d", balance)
+	}
+	if nonce, _ := w.GetStateNonce("spending"); nonce != 3 {
+		t.Errorf("expected the spending state nonce to be 3, got %d", nonce)
+	}
+
+	if err := w.SetDefaultAccount("missing"); err == nil {
+		t.Errorf("expected a missing account not to become the default")
+	}
+	if err := w.SetDefaultAccount("spending"); err != nil {
+		t.Fatalf("failed to set default account: %v", err)
+	}
+	if balance, _ := w.GetBalance(""); balance != 40 {
+		t.Errorf("expected the default account to be spending, got balance %d", balance)
+	}
+	if _, err := w.GetPrivateKey("", []byte("first")); err != keystore.ErrWrongPassphrase {
+		t.Errorf("expected the savings passphrase not to unlock spending, got %v", err)
+	}
+	if _, err := w.GetPrivateKey("", []byte("second")); err != nil {
+		t.Errorf("failed to unlock spending: %v", err)
+	}
+}
+
+func TestDefaultDir(t *testing.T) {
+	defer os.Setenv(DirEnv, os.Getenv(DirEnv))
+	os.Setenv(DirEnv, "/tmp/aurum_wallet_env")
+	if dir, err := DefaultDir(); err != nil || dir != "/tmp/aurum_wallet_env" {
+		t.Errorf("expected the environment to name the wallet directory, got %q (%v)", dir, err)
+	}
+	os.Setenv(DirEnv, "")
+	if dir, err := DefaultDir(); err != nil || filepath.Base(dir) != "wallet" {
+		t.Errorf("expected a wallet directory in the home directory, got %q (%v)", dir, err)
+	}
+}
+
+func TestWalletSeed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aurum_wallet")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	KeystoreParams = keystore.LightParams
+	w, _ := Open(filepath.Join(dir, "original"))
+
+	mnemonic := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	if err := w.DeriveAccount("first", []byte("secret")); err == nil {
+		t.Errorf("expected a wallet without a seed not to derive accounts")
+	}
+	if err := w.CreateSeed(mnemonic, []byte("secret")); err != nil {
+		t.Fatalf("failed to create seed: %v", err)
+	}
+	if err := w.CreateSeed(mnemonic, []byte("secret")); err == nil {
+		t.Errorf("expected the seed not to be replaced")
+	}
+	if err := w.DeriveAccount("first", []byte("wrong")); err != keystore.ErrWrongPassphrase {
+		t.Errorf("expected the wrong passphrase to be rejected, got %v", err)
+	}
+	var addresses [][]byte
+	for _, name := range []string{"first", "second", "third"} {
+		if err := w.DeriveAccount(name, []byte("secret")); err != nil {
+			t.Fatalf("failed to derive account: %v", err)
+		}
+		walletAddress, _ := w.GetWalletAddress(name)
+		addresses = append(addresses, walletAddress)
+	}
+	if bytes.Equal(addresses[0], addresses[1]) {
+		t.Errorf("expected derived accounts to have different addresses")
+	}
+
+	// Only the third account has been used, so restoring recreates all three
+	restored, _ := Open(filepath.Join(dir, "restored"))
+	var queried int
+	used := func(walletAddress []byte) (bool, error) {
+		queried++
+		return bytes.Equal(walletAddress, addresses[2]), nil
+	}
+	names, err := restored.RestoreSeed(mnemonic, []byte("other"), used)
+	if err != nil {
+		t.Fatalf("failed to restore seed: %v", err)
+	}
+	if !reflect.DeepEqual(names, []string{"account-0", "account-1", "account-2"}) {
+		t.Errorf("unexpected accounts restored: %v", names)
+	}
+	if queried != 3+GapLimit {
+		t.Errorf("expected restoring to stop after %d unused accounts, queried %d", GapLimit, queried)
+	}
+	for index, name := range names {
+		if walletAddress, _ := restored.GetWalletAddress(name); !bytes.Equal(walletAddress, addresses[index]) {
+			t.Errorf("expected %s to have address %s, got %s", name, hex.EncodeToString(addresses[index]), hex.EncodeToString(walletAddress))
+		}
+	}
+	if key, err := restored.GetPrivateKey("account-2", []byte("other")); err != nil || !bytes.Equal(key.D.Bytes(), mustKey(t, w, "third").D.Bytes()) {
+		t.Errorf("expected the restored key to match the original: %v", err)
+	}
+	if err := restored.DeriveAccount("next", []byte("other")); err != nil {
+		t.Fatalf("failed to derive account: %v", err)
+	}
+	if walletAddress, _ := restored.GetWalletAddress("next"); bytes.Equal(walletAddress, addresses[2]) {
+		t.Errorf("expected derivation to continue after the restored accounts")
+	}
+	if _, err := restored.RestoreSeed(mnemonic, []byte("other"), used); err == nil {
+		t.Errorf("expected a wallet with a seed not to be restored again")
+	}
+
+	// A wallet whose accounts were never used still gets its first account back
+	unused, _ := Open(filepath.Join(dir, "unused"))
+	names, err = unused.RestoreSeed(mnemonic, []byte("other"), func([]byte) (bool, error) { return false, nil })
+	if err != nil || !reflect.DeepEqual(names, []string{"account-0"}) {
+		t.Errorf("expected only the first account to be restored, got %v (%v)", names, err)
+	}
+}
+
+func mustKey(t *testing.T, w *Wallet, name string) *ecdsa.PrivateKey {
+	key, err := w.GetPrivateKey(name, []byte("secret"))
+	if err != nil {
+		t.Fatalf("failed to get private key: %v", err)
+	}
+	return key
+}
+
+func TestWalletJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aurum_wallet")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	KeystoreParams = keystore.LightParams
+	w, _ := Open(dir)
+	if err := w.NewAccount("main", []byte("secret")); err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+	if err := w.UpdateWallet("main", 1000, 4); err != nil {
+		t.Fatalf("failed to update wallet: %v", err)
+	}
+
+	// Two contracts are sent before the node has counted either
+	now := time.Now()
+	for _, entry := range []JournalEntry{
+		{ContractHash: "first", Value: 100, StateNonce: 5, SentAt: now.Add(-time.Hour)},
+		{ContractHash: "second", Value: 200, StateNonce: 6, SentAt: now},
+	} {
+		if err := w.RecordSent("main", entry); err != nil {
+			t.Fatalf("failed to record contract: %v", err)
+		}
+	}
+	if balance, _ := w.GetBalance("main"); balance != 700 {
+		t.Errorf("expected the contracts to be deducted from the balance, got %d", balance)
+	}
+	if nonce, _ := w.NextStateNonce("main"); nonce != 7 {
+		t.Errorf("expected the next state nonce to follow the contracts in flight, got %d", nonce)
+	}
+
+	// The node has confirmed the first contract and holds the second in its pending pool
+	heights := map[string]uint64{"first": 12}
+	contractHeight := func(contractHash string) (uint64, bool, error) {
+		height, ok := heights[contractHash]
+		return height, ok, nil
+	}
+	journal, err := w.Reconcile("main", 700, 6, contractHeight)
+	if err != nil {
+		t.Fatalf("failed to reconcile: %v", err)
+	}
+	if journal[0].State != ContractConfirmed || journal[0].Height != 12 || journal[1].State != ContractPending {
+		t.Errorf("unexpected journal: %+v", journal)
+	}
+	if journal[0].Stuck(now) || journal[1].Stuck(now) || !journal[1].Stuck(now.Add(StuckAfter+time.Second)) {
+		t.Errorf("expected only a contract in flight for longer than StuckAfter to be stuck")
+	}
+
+	// The node drops the second contract, so its state nonce is used again
+	journal, _ = w.Reconcile("main", 900, 5, contractHeight)
+	if journal[1].State != ContractDropped {
+		t.Errorf("expected the contract the node no longer counts to be dropped, got %s", journal[1].State)
+	}
+	if nonce, _ := w.NextStateNonce("main"); nonce != 6 {
+		t.Errorf("expected the dropped state nonce to be reused, got %d", nonce)
+	}
+
+	// A contract replaced by another with the same state nonce is dropped once the other is confirmed
+	w.RecordSent("main", JournalEntry{ContractHash: "third", Value: 50, StateNonce: 6, SentAt: now})
+	w.RecordSent("main", JournalEntry{ContractHash: "replacement", Value: 60, StateNonce: 6, SentAt: now})
+	heights["replacement"] = 13
+	journal, _ = w.Reconcile("main", 840, 6, contractHeight)
+	if journal[2].State != ContractDropped || journal[3].State != ContractConfirmed {
+		t.Errorf("unexpected journal: %+v", journal[2:])
+	}
+}